@@ -0,0 +1,56 @@
+package sternx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+// auditVerifyPageSize is how many audit events verify reads at a time
+const auditVerifyPageSize = 1000
+
+func auditCommand() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+	auditCmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check that no audit event was changed, removed or inserted",
+		Long: `Check the hash chain of the audit log from the first event on.
+
+The hash of the last event is printed on success. Removing the newest events
+keeps the chain intact, so compare it with the hash printed by an earlier run.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigration(cmd, func(ctx context.Context, ps repository.IRepository, _ []repository.Migration) error {
+				var verifier audit.Verifier
+				params := repository.ListAuditEventsParams{Limit: auditVerifyPageSize}
+				for {
+					events, err := ps.ListAuditEvents(ctx, params)
+					if err != nil {
+						return err
+					}
+					for _, event := range events {
+						if err := verifier.Verify(event); err != nil {
+							return fmt.Errorf("%w, after %d valid events", err, verifier.Count())
+						}
+					}
+					if len(events) < params.Limit {
+						break
+					}
+					params.AfterID = events[len(events)-1].ID
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Verified %d audit events\n", verifier.Count())
+				if verifier.Count() > 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), "Last hash: %s\n", verifier.LastHash())
+				}
+				return nil
+			})
+		},
+	})
+	return auditCmd
+}
@@ -0,0 +1,109 @@
+package sternx
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// runCommand runs the sternx command line with args and returns its output
+func runCommand(t *testing.T, args ...string) (string, error) {
+	root := &cobra.Command{Use: "sternx", SilenceUsage: true, SilenceErrors: true}
+	Register(root)
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs(args)
+	err := root.Execute()
+	return out.String(), err
+}
+
+// newAuditedDatabase returns the config file of a migrated SQLite database
+// and the database, with a few audit events, one of them erased
+func newAuditedDatabase(t *testing.T) (string, *sql.DB, []domain.AuditEvent) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "sternx.db")
+	configPath := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("Storage:\n  Driver: \"sqlite\"\n  SQLite:\n    Path: %q\n", dbPath)
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0o600))
+
+	_, err := runCommand(t, "migrate", "up", "--config", configPath)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	repo := repository.NewSQLite(dbPath, logger.NewDevLogger())
+	var users []*domain.User
+	for _, email := range []string{"jane@example.com", "john@example.com"} {
+		user, err := repo.CreateUser(ctx, repository.CreateUserParams{Name: "Someone", Email: email, Role: domain.StandardRole, HashedPassword: "x"})
+		require.NoError(t, err)
+		users = append(users, user)
+	}
+	request, err := repo.CreateErasureRequest(ctx, users[0].ID, users[0].ID)
+	require.NoError(t, err)
+	_, err = repo.EraseUser(ctx, request.ID)
+	require.NoError(t, err)
+
+	events, err := repo.ListAuditEvents(ctx, repository.ListAuditEventsParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return configPath, db, events
+}
+
+func TestAuditVerify(t *testing.T) {
+	configPath, db, events := newAuditedDatabase(t)
+
+	// Erasures scrub events without breaking the chain
+	require.NotNil(t, events[0].ErasedAt)
+	out, err := runCommand(t, "audit", "verify", "--config", configPath)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("Verified 3 audit events\nLast hash: %s\n", events[2].Hash), out)
+
+	// The log can't be changed, besides scrubbing personal data
+	_, err = db.Exec("UPDATE audit_events SET target = 'user:0' WHERE id = $1", events[1].ID)
+	require.Error(t, err)
+	_, err = db.Exec("DELETE FROM audit_events WHERE id = $1", events[1].ID)
+	require.Error(t, err)
+}
+
+func TestAuditVerifyTampered(t *testing.T) {
+	// The triggers only stop accidental changes, someone with access to the
+	// database can drop them
+	tests := map[string]string{
+		"ChangedActor":    "UPDATE audit_events SET actor = 'someone@example.com' WHERE id = $1",
+		"ChangedDiff":     "UPDATE audit_events SET diff = '{}' WHERE id = $1",
+		"ChangedTarget":   "UPDATE audit_events SET target = 'user:0' WHERE id = $1",
+		"ChangedDigest":   "UPDATE audit_events SET personal_digest = '' WHERE id = $1",
+		"ChangedPrevHash": "UPDATE audit_events SET prev_hash = '' WHERE id = $1",
+		"FakeErasure":     "UPDATE audit_events SET actor = 'someone@example.com', personal_digest = '', erased_at = created_at WHERE id = $1",
+		"Removed":         "DELETE FROM audit_events WHERE id = $1",
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			configPath, db, events := newAuditedDatabase(t)
+			for _, trigger := range []string{"audit_events_no_update", "audit_events_no_delete"} {
+				_, err := db.Exec("DROP TRIGGER " + trigger)
+				require.NoError(t, err)
+			}
+			_, err := db.Exec(tamper, events[1].ID)
+			require.NoError(t, err)
+
+			out, err := runCommand(t, "audit", "verify", "--config", configPath)
+			require.ErrorContains(t, err, "audit chain broken")
+			require.ErrorContains(t, err, "after 1 valid events")
+			require.Empty(t, out)
+		})
+	}
+}
@@ -3,20 +3,28 @@ package sternx
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/fibonachyy/sternx/config"
+	"github.com/fibonachyy/sternx/doc"
 	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/events"
+	"github.com/fibonachyy/sternx/internal/federation"
 	"github.com/fibonachyy/sternx/internal/logger"
 	"github.com/fibonachyy/sternx/internal/metrics"
+	"github.com/fibonachyy/sternx/internal/notification"
 	"github.com/fibonachyy/sternx/internal/repository"
 	"github.com/fibonachyy/sternx/internal/service"
 	"github.com/fibonachyy/sternx/internal/tracing"
+	"github.com/fibonachyy/sternx/internal/webhook"
+	"github.com/fibonachyy/sternx/pkg/password"
 	"go.opentelemetry.io/otel/metric"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
@@ -39,9 +47,11 @@ func main(cfg config.Config) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	ps := repository.NewPostgres(cfg.Postgres.Host, cfg.Postgres.User, cfg.Postgres.Password, cfg.Postgres.DB, log)
-	err := ps.Migrate(cfg.Postgres.MigrationsPath)
+	ps, migrations, err := storage(cfg, log)
 	if err != nil {
+		log.Fatalf(context.Background(), "Failed to set up storage: %v", err)
+	}
+	if _, err := ps.MigrateUp(context.Background(), migrations, 0); err != nil {
 		log.Fatalf(context.Background(), "Failed to run database migrations: %v", err)
 	}
 
@@ -54,16 +64,40 @@ func main(cfg config.Config) {
 	meter := provider.Meter("sternx-golang-app")
 	metrics.GenerateMetrics(context.Background(), meter, log)
 
-	creds, err := credentials.NewServerTLSFromFile(cfg.Tls.Cert, cfg.Tls.Key)
+	var creds credentials.TransportCredentials
+	if cfg.Tls.Cert != "" {
+		creds, err = credentials.NewServerTLSFromFile(cfg.Tls.Cert, cfg.Tls.Key)
+		if err != nil {
+			log.Fatalf(context.Background(), "Failed to load TLS credentials: %v", err)
+		}
+	}
+
+	userServiceServer, err := setupUserService(cfg, ps)
 	if err != nil {
-		log.Fatalf(context.Background(), "Failed to load TLS credentials: %v", err)
+		log.Fatalf(context.Background(), "Failed to set up user service: %v", err)
 	}
 
-	// Set up the gRPC server
-	grpcServer, err := setupGRPCServer(cfg, creds, ps, log, meter)
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(logger.WithLogger(context.Background(), log))
+	defer stopJobs()
+
+	// Purge deleted users
+	go userServiceServer.PurgeDeletedUsers(jobsCtx)
+
+	// Publish the user events of the outbox
+	publisher, closePublisher, err := eventPublisher(cfg)
 	if err != nil {
-		log.Fatalf(context.Background(), "Failed to set up gRPC server: %v", err)
+		log.Fatalf(context.Background(), "Failed to set up event publisher: %v", err)
 	}
+	defer closePublisher()
+	publisher = events.Fanout(publisher, webhook.NewPublisher(ps))
+	go events.NewRelay(ps, publisher, relayConfig(cfg)).Run(jobsCtx)
+
+	// Send the webhook deliveries the relay queued
+	go webhook.NewDispatcher(ps, webhookConfig(cfg)).Run(jobsCtx)
+
+	// Set up the gRPC server
+	grpcServer := setupGRPCServer(creds, userServiceServer, log, meter)
 
 	// Start the gRPC server in a separate goroutine
 	go func() {
@@ -84,11 +118,21 @@ func main(cfg config.Config) {
 	// with Swagger UI extensions, providing a better user experience.
 	// Access the Swagger JSON file at: http://serveradd:getWayport/swagger/
 	const swaggerJSONPath = "/swagger/"
-	swaggerJSONHandler := http.StripPrefix(swaggerJSONPath, http.FileServer(http.Dir("doc/swagger")))
+	swaggerJSONHandler := http.StripPrefix(swaggerJSONPath, http.FileServer(http.FS(assets(cfg.Swagger.Path, doc.Swagger()))))
 	mux.Handle(swaggerJSONPath, swaggerJSONHandler)
 
+	// OAuth2 and OpenID Connect endpoints are plain HTTP handlers since their wire format is fixed by the RFCs
+	mux.Handle(service.OIDCDiscoveryPath, userServiceServer.OIDCDiscoveryHandler())
+	mux.Handle(service.OAuth2AuthorizePath, userServiceServer.OAuth2AuthorizeHandler(log))
+	mux.Handle(service.OAuth2TokenPath, userServiceServer.OAuth2TokenHandler(log))
+	mux.Handle(service.OAuth2DeviceAuthorizationPath, userServiceServer.OAuth2DeviceAuthorizationHandler(log))
+	mux.Handle(service.OAuth2UserInfoPath, userServiceServer.OAuth2UserInfoHandler(log))
+	mux.Handle(service.OAuth2JWKSPath, userServiceServer.OAuth2JWKSHandler())
+	mux.Handle(service.FederationPathPrefix, userServiceServer.FederationHandler(log))
+	mux.Handle(service.SCIMPathPrefix, userServiceServer.SCIMHandler(log))
+
 	// Set up the gRPC gateway
-	gatewayMux, err := setupGRPCGateway(fmt.Sprintf("127.0.0.1:%s", cfg.Grpc.Port), log)
+	gatewayMux, err := setupGRPCGateway(fmt.Sprintf("127.0.0.1:%s", cfg.Grpc.Port), userServiceServer.Config.Proxies, log)
 	if err != nil {
 		log.Fatalf(context.Background(), "Failed to set up gRPC gateway: %v", err)
 	}
@@ -125,11 +169,91 @@ func main(cfg config.Config) {
 	log.Info(context.Background(), "Server gracefully stopped")
 }
 
-func setupGRPCServer(cfg config.Config, creds credentials.TransportCredentials, ps repository.IRepository, log logger.Logger, meter metric.Meter) (*grpc.Server, error) {
+// breachedListFalsePositiveRate is the share of passwords the breached list
+// wrongly rejects, traded against the size of its bloom filter
+const breachedListFalsePositiveRate = 0.001
+
+func setupUserService(cfg config.Config, ps repository.IRepository) (*service.UserServiceServer, error) {
+	proxies, err := service.NewProxies(cfg.Grpc.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	conf := service.Config{
+		JWTDuration:         time.Minute * time.Duration(cfg.Jwt.ExpireMin),
+		TokenSymmetricKey:   cfg.Jwt.TokenSymmetricKey,
+		APIKeyDuration:      24 * time.Hour * time.Duration(cfg.ApiKey.ExpireDays),
+		ClientTokenDuration: time.Minute * time.Duration(cfg.OAuth2.TokenExpireMin),
+		Issuer:              cfg.Oidc.Issuer,
+		IDTokenSigningKey:   cfg.Oidc.SigningKey,
+		AuthCodeDuration:    time.Second * time.Duration(cfg.Oidc.AuthCodeExpireSec),
+
+		DeviceCodeDuration:    time.Second * time.Duration(cfg.OAuth2.DeviceCodeExpireSec),
+		DevicePollInterval:    time.Second * time.Duration(cfg.OAuth2.DevicePollIntervalSec),
+		DeviceVerificationURI: cfg.OAuth2.DeviceVerificationURI,
+		ImpersonationDuration: time.Minute * time.Duration(cfg.OAuth2.ImpersonationExpireMin),
+
+		MagicLinkDuration:  time.Minute * time.Duration(cfg.MagicLink.ExpireMin),
+		MagicLinkURL:       cfg.MagicLink.URL,
+		NotificationSender: notificationSender(cfg),
+
+		PasswordHashing: password.Config{
+			Memory:      cfg.Password.Argon2.MemoryKiB,
+			Iterations:  cfg.Password.Argon2.Iterations,
+			Parallelism: cfg.Password.Argon2.Parallelism,
+			Pepper:      cfg.Password.Pepper,
+			PepperID:    cfg.Password.PepperID,
+			OldPeppers:  cfg.Password.OldPeppers,
+		},
+		PasswordHistorySize: cfg.Password.HistorySize,
+		PasswordMaxAge:      24 * time.Hour * time.Duration(cfg.Password.MaxAgeDays),
+
+		DeletedUserRetention: 24 * time.Hour * time.Duration(cfg.DeletedUsers.RetentionDays),
+		UserPurgeInterval:    time.Minute * time.Duration(cfg.DeletedUsers.PurgeIntervalMin),
+
+		Proxies: proxies,
+
+		WatchPollInterval: time.Millisecond * time.Duration(cfg.Events.WatchIntervalMs),
+	}
+	for _, provider := range cfg.Federation.Providers {
+		conf.FederationProviders = append(conf.FederationProviders, federation.ProviderConfig{
+			Name:          provider.Name,
+			Issuer:        provider.Issuer,
+			ClientID:      provider.ClientID,
+			ClientSecret:  provider.ClientSecret,
+			RedirectURL:   provider.RedirectURL,
+			Scopes:        provider.Scopes,
+			AutoProvision: provider.AutoProvision,
+		})
+	}
+
+	policy := cfg.Password.Policy
+	conf.PasswordPolicy = password.Policy{
+		MinLength:          policy.MinLength,
+		MaxLength:          policy.MaxLength,
+		RequireLowercase:   policy.RequireLowercase,
+		RequireUppercase:   policy.RequireUppercase,
+		RequireDigit:       policy.RequireDigit,
+		RequireSymbol:      policy.RequireSymbol,
+		MinEntropyBits:     policy.MinEntropyBits,
+		ForbidPersonalInfo: policy.ForbidPersonalInfo,
+	}
+	if policy.BreachedListPath != "" {
+		breached, err := password.LoadBreachedList(policy.BreachedListPath, breachedListFalsePositiveRate)
+		if err != nil {
+			return nil, err
+		}
+		conf.PasswordPolicy.Breached = breached
+	}
+
+	return service.NewUserServiceServer(ps, conf)
+}
+
+func setupGRPCServer(creds credentials.TransportCredentials, userServiceServer *service.UserServiceServer, log logger.Logger, meter metric.Meter) *grpc.Server {
 	log.Info(context.Background(), "Setting up gRPC server...")
 
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(service.UnaryInterceptor(log, meter)),
+		grpc.UnaryInterceptor(service.UnaryInterceptor(log, meter, userServiceServer.Config.Proxies)),
+		grpc.StreamInterceptor(service.StreamInterceptor(log, meter, userServiceServer.Config.Proxies)),
 		// grpc.Creds(creds),
 		// Note: TLS (Transport Layer Security) is currently disabled for the service to facilitate development purposes.
 		// Enabling TLS requires valid certificate files. Without them, testing the application becomes restricted.
@@ -139,18 +263,22 @@ func setupGRPCServer(cfg config.Config, creds credentials.TransportCredentials,
 	reflection.Register(grpcServer)
 
 	// Register your gRPC service implementation
-	conf := service.Config{JWTDuration: time.Minute * time.Duration(cfg.Jwt.ExpireMin), TokenSymmetricKey: cfg.Jwt.TokenSymmetricKey}
-	userServiceServer, err := service.NewUserServiceServer(ps, conf)
-	if err != nil {
-		return nil, err
-	}
 	userpb.RegisterUserServiceServer(grpcServer, userServiceServer)
-	return grpcServer, nil
+	return grpcServer
 }
 
-func setupGRPCGateway(serverAddr string, log logger.Logger) (*runtime.ServeMux, error) {
-	mux := runtime.NewServeMux()
-	conn, err := grpc.Dial(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func setupGRPCGateway(serverAddr string, proxies *service.Proxies, log logger.Logger) (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithErrorHandler(service.GatewayErrorHandler),
+	)
+	// The gateway credentials let the server trust the client address the
+	// gateway forwards
+	conn, err := grpc.Dial(serverAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(proxies.GatewayCredentials()),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial gRPC server: %v", err)
 	}
@@ -162,6 +290,39 @@ func setupGRPCGateway(serverAddr string, log logger.Logger) (*runtime.ServeMux,
 	return mux, nil
 }
 
+// incomingHeaderMatcher forwards the API key, request ID and If-Match headers
+// to the gRPC server in addition to the headers grpc-gateway forwards by default.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "If-Match") {
+		return "if-match", true
+	}
+	if strings.EqualFold(key, "X-Api-Key") {
+		return "x-api-key", true
+	}
+	if strings.EqualFold(key, "X-Request-Id") {
+		return "x-request-id", true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher returns the etag of users as the ETag header, and
+// other header metadata the way grpc-gateway does by default
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == "etag" {
+		return "ETag", true
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+}
+
+// assets returns the files of the override directory when one is configured,
+// and the ones built into the binary otherwise
+func assets(override string, embedded fs.FS) fs.FS {
+	if override != "" {
+		return os.DirFS(override)
+	}
+	return embedded
+}
+
 func Register(root *cobra.Command) {
 	root.PersistentFlags().String("config", "config.yaml", "read config file")
 	root.AddCommand(
@@ -174,5 +335,102 @@ func Register(root *cobra.Command) {
 				main(cfg)
 			},
 		},
+		migrateCommand(),
+		auditCommand(),
 	)
 }
+
+// storage opens the repository of the configured storage driver along with
+// its migrations
+func storage(cfg config.Config, log logger.Logger) (repository.IRepository, []repository.Migration, error) {
+	switch cfg.Storage.Driver {
+	case "", "postgres":
+		migrations, err := repository.LoadMigrations(assets(cfg.Postgres.MigrationsPath, repository.EmbeddedMigrations()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load database migrations: %w", err)
+		}
+		return repository.NewPostgres(cfg.Postgres.Host, cfg.Postgres.User, cfg.Postgres.Password, cfg.Postgres.DB, log), migrations, nil
+	case "sqlite":
+		migrations, err := repository.LoadMigrations(assets(cfg.Storage.SQLite.MigrationsPath, repository.EmbeddedSQLiteMigrations()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load database migrations: %w", err)
+		}
+		return repository.NewSQLite(cfg.Storage.SQLite.Path, log), migrations, nil
+	case "memory":
+		return repository.NewMemory(), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+func notificationSender(cfg config.Config) notification.Sender {
+	if cfg.Notification.Driver == "smtp" {
+		return notification.SMTPSender{
+			Addr:     cfg.Notification.Smtp.Addr,
+			Username: cfg.Notification.Smtp.Username,
+			Password: cfg.Notification.Smtp.Password,
+			From:     cfg.Notification.Smtp.From,
+		}
+	}
+	return notification.LogSender{}
+}
+
+// eventPublisher returns the publisher of user events, along with a function
+// that releases it
+func eventPublisher(cfg config.Config) (events.Publisher, func() error, error) {
+	switch cfg.Events.Publisher {
+	case "", "none":
+		return events.Discard, func() error { return nil }, nil
+	case "stdout":
+		return events.NewWriterPublisher(os.Stdout), func() error { return nil }, nil
+	case "file":
+		publisher, err := events.OpenFilePublisher(cfg.Events.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, publisher.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown event publisher %q", cfg.Events.Publisher)
+	}
+}
+
+// relayConfig returns the configuration of the event relay, with the
+// defaults for the settings left out of the config file
+func relayConfig(cfg config.Config) events.RelayConfig {
+	conf := events.DefaultRelayConfig()
+	if cfg.Events.RelayIntervalSec > 0 {
+		conf.Interval = time.Second * time.Duration(cfg.Events.RelayIntervalSec)
+	}
+	if cfg.Events.BatchSize > 0 {
+		conf.BatchSize = cfg.Events.BatchSize
+	}
+	if cfg.Events.LeaseSec > 0 {
+		conf.LeaseDuration = time.Second * time.Duration(cfg.Events.LeaseSec)
+	}
+	if cfg.Events.RetentionDays > 0 {
+		conf.Retention = 24 * time.Hour * time.Duration(cfg.Events.RetentionDays)
+	}
+	return conf
+}
+
+// webhookConfig returns the configuration of the webhook dispatcher, with
+// the defaults for the settings left out of the config file
+func webhookConfig(cfg config.Config) webhook.Config {
+	conf := webhook.DefaultConfig()
+	if cfg.Webhooks.IntervalSec > 0 {
+		conf.Interval = time.Second * time.Duration(cfg.Webhooks.IntervalSec)
+	}
+	if cfg.Webhooks.TimeoutSec > 0 {
+		conf.Timeout = time.Second * time.Duration(cfg.Webhooks.TimeoutSec)
+	}
+	if cfg.Webhooks.MaxAttempts > 0 {
+		conf.MaxAttempts = cfg.Webhooks.MaxAttempts
+	}
+	if cfg.Webhooks.InitialBackoffSec > 0 {
+		conf.InitialBackoff = time.Second * time.Duration(cfg.Webhooks.InitialBackoffSec)
+	}
+	if cfg.Webhooks.MaxBackoffMin > 0 {
+		conf.MaxBackoff = time.Minute * time.Duration(cfg.Webhooks.MaxBackoffMin)
+	}
+	return conf
+}
@@ -0,0 +1,149 @@
+package sternx
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fibonachyy/sternx/config"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+func migrateCommand() *cobra.Command {
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage database migrations",
+	}
+	migrate.AddCommand(
+		&cobra.Command{
+			Use:   "up [steps]",
+			Short: "Apply pending migrations, all of them unless steps is given",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				steps, err := migrationSteps(args, 0)
+				if err != nil {
+					return err
+				}
+				return runMigration(cmd, func(ctx context.Context, ps repository.IRepository, migrations []repository.Migration) error {
+					applied, err := ps.MigrateUp(ctx, migrations, steps)
+					if len(applied) == 0 && err == nil {
+						fmt.Fprintln(cmd.OutOrStdout(), "No pending migrations")
+					}
+					for _, migration := range applied {
+						fmt.Fprintf(cmd.OutOrStdout(), "Applied %d_%s\n", migration.Version, migration.Name)
+					}
+					return err
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "down [steps]",
+			Short: "Revert the latest applied migration, or the latest steps ones",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				steps, err := migrationSteps(args, 1)
+				if err != nil {
+					return err
+				}
+				return runMigration(cmd, func(ctx context.Context, ps repository.IRepository, migrations []repository.Migration) error {
+					reverted, err := ps.MigrateDown(ctx, migrations, steps)
+					if len(reverted) == 0 && err == nil {
+						fmt.Fprintln(cmd.OutOrStdout(), "No applied migrations")
+					}
+					for _, migration := range reverted {
+						fmt.Fprintf(cmd.OutOrStdout(), "Reverted %d_%s\n", migration.Version, migration.Name)
+					}
+					return err
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "redo",
+			Short: "Revert and apply again the latest applied migration",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runMigration(cmd, func(ctx context.Context, ps repository.IRepository, migrations []repository.Migration) error {
+					redone, err := ps.MigrateRedo(ctx, migrations)
+					if err != nil {
+						return err
+					}
+					if redone == nil {
+						fmt.Fprintln(cmd.OutOrStdout(), "No applied migrations")
+						return nil
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Redone %d_%s\n", redone.Version, redone.Name)
+					return nil
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "List migrations and whether they are applied",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runMigration(cmd, func(ctx context.Context, ps repository.IRepository, migrations []repository.Migration) error {
+					statuses, err := ps.MigrationStatus(ctx, migrations)
+					if err != nil {
+						return err
+					}
+					w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+					for _, status := range statuses {
+						fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, migrationState(status), migrationAppliedAt(status))
+					}
+					return w.Flush()
+				})
+			},
+		},
+	)
+	return migrate
+}
+
+// runMigration connects to the storage of the config file and runs fn with
+// the migrations of its driver, built into the binary or found in its
+// MigrationsPath
+func runMigration(cmd *cobra.Command, fn func(ctx context.Context, ps repository.IRepository, migrations []repository.Migration) error) error {
+	configPath, _ := cmd.Flags().GetString("config")
+	cfg := config.ReadConfig(configPath)
+
+	ps, migrations, err := storage(cfg, logger.NewDevLogger())
+	if err != nil {
+		return err
+	}
+	return fn(cmd.Context(), ps, migrations)
+}
+
+func migrationSteps(args []string, defaultSteps int) (int, error) {
+	if len(args) == 0 {
+		return defaultSteps, nil
+	}
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps < 1 {
+		return 0, fmt.Errorf("steps must be a positive number, got %q", args[0])
+	}
+	return steps, nil
+}
+
+func migrationState(status repository.MigrationStatus) string {
+	switch {
+	case status.Missing:
+		return "applied, file missing"
+	case status.Modified:
+		return "applied, modified"
+	case status.Applied():
+		return "applied"
+	default:
+		return "pending"
+	}
+}
+
+func migrationAppliedAt(status repository.MigrationStatus) string {
+	if !status.Applied() {
+		return "-"
+	}
+	return status.AppliedAt.Local().Format(time.RFC3339)
+}
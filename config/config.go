@@ -8,6 +8,13 @@ import (
 )
 
 type Config struct {
+	Storage struct {
+		Driver string `yaml:"Driver"`
+		SQLite struct {
+			Path           string `yaml:"Path"`
+			MigrationsPath string `yaml:"MigrationsPath"`
+		} `yaml:"SQLite"`
+	} `yaml:"Storage"`
 	Postgres struct {
 		Host           string `yaml:"Host"`
 		User           string `yaml:"User"`
@@ -15,9 +22,15 @@ type Config struct {
 		DB             string `yaml:"DB"`
 		MigrationsPath string `yaml:"MigrationsPath"`
 	} `yaml:"Postgres"`
+	Swagger struct {
+		Path string `yaml:"Path"`
+	}
 	Grpc struct {
 		Port       string `yaml:"Port"`
 		GetwayPort string `yaml:"GetwayPort"`
+		// TrustedProxies are the addresses or CIDR ranges of the reverse
+		// proxies in front of the gateway
+		TrustedProxies []string `yaml:"TrustedProxies"`
 	}
 	Tls struct {
 		Cert string `yaml:"Cert"`
@@ -27,6 +40,88 @@ type Config struct {
 		ExpireMin         int    `yaml:"ExpireMin"`
 		TokenSymmetricKey string `yaml:"TokenSymmetricKey"`
 	}
+	ApiKey struct {
+		ExpireDays int `yaml:"ExpireDays"`
+	}
+	OAuth2 struct {
+		TokenExpireMin         int    `yaml:"TokenExpireMin"`
+		DeviceCodeExpireSec    int    `yaml:"DeviceCodeExpireSec"`
+		DevicePollIntervalSec  int    `yaml:"DevicePollIntervalSec"`
+		DeviceVerificationURI  string `yaml:"DeviceVerificationURI"`
+		ImpersonationExpireMin int    `yaml:"ImpersonationExpireMin"`
+	}
+	Oidc struct {
+		Issuer            string `yaml:"Issuer"`
+		SigningKey        string `yaml:"SigningKey"`
+		AuthCodeExpireSec int    `yaml:"AuthCodeExpireSec"`
+	}
+	Federation struct {
+		Providers []struct {
+			Name          string   `yaml:"Name"`
+			Issuer        string   `yaml:"Issuer"`
+			ClientID      string   `yaml:"ClientID"`
+			ClientSecret  string   `yaml:"ClientSecret"`
+			RedirectURL   string   `yaml:"RedirectURL"`
+			Scopes        []string `yaml:"Scopes"`
+			AutoProvision bool     `yaml:"AutoProvision"`
+		} `yaml:"Providers"`
+	}
+	Password struct {
+		Argon2 struct {
+			MemoryKiB   uint32 `yaml:"MemoryKiB"`
+			Iterations  uint32 `yaml:"Iterations"`
+			Parallelism uint8  `yaml:"Parallelism"`
+		} `yaml:"Argon2"`
+		Pepper      string            `yaml:"Pepper"`
+		PepperID    string            `yaml:"PepperID"`
+		OldPeppers  map[string]string `yaml:"OldPeppers"`
+		HistorySize int               `yaml:"HistorySize"`
+		MaxAgeDays  int               `yaml:"MaxAgeDays"`
+		Policy      struct {
+			MinLength          int     `yaml:"MinLength"`
+			MaxLength          int     `yaml:"MaxLength"`
+			RequireLowercase   bool    `yaml:"RequireLowercase"`
+			RequireUppercase   bool    `yaml:"RequireUppercase"`
+			RequireDigit       bool    `yaml:"RequireDigit"`
+			RequireSymbol      bool    `yaml:"RequireSymbol"`
+			MinEntropyBits     float64 `yaml:"MinEntropyBits"`
+			ForbidPersonalInfo bool    `yaml:"ForbidPersonalInfo"`
+			BreachedListPath   string  `yaml:"BreachedListPath"`
+		} `yaml:"Policy"`
+	}
+	DeletedUsers struct {
+		RetentionDays    int `yaml:"RetentionDays"`
+		PurgeIntervalMin int `yaml:"PurgeIntervalMin"`
+	}
+	MagicLink struct {
+		ExpireMin int    `yaml:"ExpireMin"`
+		URL       string `yaml:"URL"`
+	}
+	Notification struct {
+		Driver string `yaml:"Driver"`
+		Smtp   struct {
+			Addr     string `yaml:"Addr"`
+			Username string `yaml:"Username"`
+			Password string `yaml:"Password"`
+			From     string `yaml:"From"`
+		} `yaml:"Smtp"`
+	}
+	Events struct {
+		Publisher        string `yaml:"Publisher"`
+		File             string `yaml:"File"`
+		RelayIntervalSec int    `yaml:"RelayIntervalSec"`
+		BatchSize        int    `yaml:"BatchSize"`
+		LeaseSec         int    `yaml:"LeaseSec"`
+		RetentionDays    int    `yaml:"RetentionDays"`
+		WatchIntervalMs  int    `yaml:"WatchIntervalMs"`
+	}
+	Webhooks struct {
+		IntervalSec       int `yaml:"IntervalSec"`
+		TimeoutSec        int `yaml:"TimeoutSec"`
+		MaxAttempts       int `yaml:"MaxAttempts"`
+		InitialBackoffSec int `yaml:"InitialBackoffSec"`
+		MaxBackoffMin     int `yaml:"MaxBackoffMin"`
+	}
 	Metric struct {
 		Host        string `yaml:"Host"`
 		ServiceName string `yaml:"ServiceName"`
@@ -0,0 +1,19 @@
+// Package doc holds the generated API documentation served by the gateway.
+package doc
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed swagger/*.json
+var swagger embed.FS
+
+// Swagger returns the OpenAPI definitions built into the binary
+func Swagger() fs.FS {
+	sub, err := fs.Sub(swagger, "swagger")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
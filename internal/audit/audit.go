@@ -0,0 +1,54 @@
+// Package audit builds the entries of the tamper evident audit log: who made
+// a change, what it changed, and the hash chain linking the entries.
+package audit
+
+import (
+	"context"
+)
+
+// Actors of changes without an authenticated caller
+const (
+	// SystemActor makes the changes of background jobs, like the purge of
+	// deleted users
+	SystemActor = "system"
+	// AnonymousActor makes the changes of requests that didn't authenticate,
+	// like a signup
+	AnonymousActor = "anonymous"
+)
+
+// Info is what the audit log records about the request behind a change
+type Info struct {
+	Actor     string
+	RequestID string
+	ClientIP  string
+}
+
+type infoKey struct{}
+
+// WithInfo attaches info to the context. The actor is usually only known once
+// the request is authenticated, so info is shared and SetActor fills it in.
+func WithInfo(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// SetActor records the actor of the request of ctx, if it carries Info
+func SetActor(ctx context.Context, actor string) {
+	if info, ok := ctx.Value(infoKey{}).(*Info); ok {
+		info.Actor = actor
+	}
+}
+
+// FromContext returns the Info of the request of ctx. Changes outside of a
+// request are attributed to SystemActor, and changes of requests without an
+// actor to AnonymousActor.
+func FromContext(ctx context.Context) Info {
+	shared, ok := ctx.Value(infoKey{}).(*Info)
+	if !ok {
+		return Info{Actor: SystemActor}
+	}
+	info := *shared
+	if info.Actor == "" {
+		info.Actor = AnonymousActor
+	}
+	return info
+}
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := &domain.User{ID: 1, Name: "Jane", Email: "jane@example.com", HashedPassword: "h1", UpdatedAt: time.Now()}
+	after := *before
+	after.Name = "Jane Doe"
+	after.HashedPassword = "h2"
+	after.UpdatedAt = time.Now().Add(time.Second)
+
+	testCases := []struct {
+		name      string
+		before    interface{}
+		after     interface{}
+		redactAll bool
+		expected  map[string]FieldChange
+	}{
+		{
+			name:   "Update",
+			before: before,
+			after:  &after,
+			expected: map[string]FieldChange{
+				"name":            {Before: "Jane", After: "Jane Doe"},
+				"hashed_password": {Before: Redacted, After: Redacted},
+			},
+		},
+		{
+			name:     "Unchanged",
+			before:   before,
+			after:    before,
+			expected: map[string]FieldChange{},
+		},
+		{
+			name:   "Delete",
+			before: &domain.OAuthClient{ClientID: "app", HashedSecret: "s"},
+			after:  (*domain.OAuthClient)(nil),
+			expected: map[string]FieldChange{
+				"id":            {Before: 0.0},
+				"client_id":     {Before: "app"},
+				"name":          {Before: ""},
+				"hashed_secret": {Before: Redacted},
+				"scopes":        {},
+				"redirect_uris": {},
+				"created_at":    {Before: "0001-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:      "RedactAll",
+			before:    before,
+			after:     &after,
+			redactAll: true,
+			expected: map[string]FieldChange{
+				"name":            {Before: Redacted, After: Redacted},
+				"hashed_password": {Before: Redacted, After: Redacted},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := Diff(tc.before, tc.after, tc.redactAll)
+			require.NoError(t, err)
+			var diff map[string]FieldChange
+			require.NoError(t, json.Unmarshal(encoded, &diff))
+			require.Equal(t, tc.expected, diff)
+		})
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	userID := 7
+	var events []domain.AuditEvent
+	prevHash := ""
+	for i, action := range []string{domain.AuditActionUserCreate, domain.AuditActionUserUpdate, domain.AuditActionUserDelete} {
+		event := domain.AuditEvent{
+			ID:        i + 1,
+			Actor:     "admin@example.com",
+			Action:    action,
+			Target:    "user:7",
+			UserID:    &userID,
+			Diff:      json.RawMessage(`{"name": {"before": "a", "after": "b"}}`),
+			RequestID: "req",
+			ClientIP:  "203.0.113.7",
+			CreatedAt: time.Now(),
+			PrevHash:  prevHash,
+		}
+		event.PersonalDigest = PersonalDigest(event)
+		event.Hash = Hash(event)
+		prevHash = event.Hash
+		events = append(events, event)
+	}
+
+	verify := func(events []domain.AuditEvent) error {
+		var verifier Verifier
+		for _, event := range events {
+			if err := verifier.Verify(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	require.NoError(t, verify(events))
+
+	// The hash doesn't depend on the JSON formatting of the diff
+	reformatted := append([]domain.AuditEvent{}, events...)
+	reformatted[0].Diff = json.RawMessage(`{"name":{"before":"a","after":"b"}}`)
+	require.NoError(t, verify(reformatted))
+	// Nor on the time zone or the precision stores drop
+	reformatted[1].CreatedAt = events[1].CreatedAt.Truncate(TimePrecision).In(time.FixedZone("X", 3600))
+	require.NoError(t, verify(reformatted))
+
+	changed := append([]domain.AuditEvent{}, events...)
+	changed[1].Actor = "someone@example.com"
+	require.ErrorIs(t, verify(changed), ErrChainBroken)
+
+	rehashed := append([]domain.AuditEvent{}, events...)
+	rehashed[1].Diff = json.RawMessage(`{}`)
+	rehashed[1].Hash = Hash(rehashed[1])
+	require.ErrorIs(t, verify(rehashed), ErrChainBroken)
+
+	// The stored digest of personal data has to match it
+	tampered := append([]domain.AuditEvent{}, events...)
+	tampered[1].PersonalDigest = PersonalDigest(domain.AuditEvent{Actor: "someone@example.com"})
+	require.ErrorIs(t, verify(tampered), ErrChainBroken)
+
+	// Erasing personal data keeps the chain intact
+	erasedEvent, ok, err := Erase(events[1], userID, []string{"jane@example.com"}, "erased-7@erased.invalid", time.Now())
+	require.NoError(t, err)
+	require.True(t, ok)
+	erased := append([]domain.AuditEvent{}, events...)
+	erased[1] = erasedEvent
+	require.NoError(t, verify(erased))
+
+	// but the digest of the erased data still has to match
+	redigested := append([]domain.AuditEvent{}, erased...)
+	redigested[1].PersonalDigest = PersonalDigest(redigested[1])
+	require.ErrorIs(t, verify(redigested), ErrChainBroken)
+
+	removed := []domain.AuditEvent{events[0], events[2]}
+	require.ErrorIs(t, verify(removed), ErrChainBroken)
+	require.ErrorIs(t, verify(events[1:]), ErrChainBroken)
+}
+
+func TestErase(t *testing.T) {
+	userID, otherID := 7, 8
+	emails := []string{"jane@example.com", "jane.doe@example.com"}
+	erasedEmail := "erased-7@erased.invalid"
+
+	testCases := []struct {
+		name     string
+		event    domain.AuditEvent
+		erased   bool
+		actor    string
+		clientIP string
+	}{
+		{
+			name:     "ChangeOfUser",
+			event:    domain.AuditEvent{Actor: "admin@example.com", UserID: &userID, ClientIP: "203.0.113.1"},
+			erased:   true,
+			actor:    "admin@example.com",
+			clientIP: "203.0.113.1",
+		},
+		{
+			name:   "ChangeByUser",
+			event:  domain.AuditEvent{Actor: "jane.doe@example.com", UserID: &otherID, ClientIP: "203.0.113.7"},
+			erased: true,
+			actor:  erasedEmail,
+		},
+		{
+			name:     "Impersonated",
+			event:    domain.AuditEvent{Actor: "admin@example.com" + ImpersonationSeparator + "jane@example.com", UserID: &otherID, ClientIP: "203.0.113.1"},
+			erased:   true,
+			actor:    "admin@example.com" + ImpersonationSeparator + erasedEmail,
+			clientIP: "203.0.113.1",
+		},
+		{
+			name:     "OtherUser",
+			event:    domain.AuditEvent{Actor: "notjane@example.com", UserID: &otherID, ClientIP: "203.0.113.8"},
+			actor:    "notjane@example.com",
+			clientIP: "203.0.113.8",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.event.Diff = json.RawMessage(`{"name":{"before":"Jane","after":"Jane Doe"},"active":{"before":true,"after":false}}`)
+			tc.event.PersonalDigest = PersonalDigest(tc.event)
+
+			event, erased, err := Erase(tc.event, userID, emails, erasedEmail, time.Now())
+			require.NoError(t, err)
+			require.Equal(t, tc.erased, erased)
+			require.Equal(t, tc.actor, event.Actor)
+			require.Equal(t, tc.clientIP, event.ClientIP)
+			require.Equal(t, tc.event.PersonalDigest, event.PersonalDigest)
+			require.Equal(t, tc.erased, event.ErasedAt != nil)
+			require.Equal(t, *tc.event.UserID == userID, IsRedacted(event.Diff))
+			if erased {
+				require.Equal(t, Hash(tc.event), Hash(event))
+			}
+		})
+	}
+
+	events := []domain.AuditEvent{
+		{Diff: json.RawMessage(`{"email":{"before":null,"after":"jane@example.com"}}`)},
+		{Diff: json.RawMessage(`{"email":{"before":"jane@example.com","after":"jane.doe@example.com"}}`)},
+		{Diff: json.RawMessage(`{"email":{"before":"[REDACTED]","after":"[REDACTED]"}}`)},
+	}
+	require.Equal(t, emails, Emails(events))
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+// ErrChainBroken is returned by Verifier for events that were changed,
+// removed or inserted after they were written
+var ErrChainBroken = errors.New("audit chain broken")
+
+// TimePrecision is the precision event times are stored and hashed with, the
+// finest that every store keeps
+const TimePrecision = time.Microsecond
+
+// hashedEvent fixes the fields of an event that its hash covers and their order
+type hashedEvent struct {
+	PrevHash       string `json:"prev_hash"`
+	Action         string `json:"action"`
+	Target         string `json:"target"`
+	UserID         *int   `json:"user_id"`
+	RequestID      string `json:"request_id"`
+	CreatedAt      string `json:"created_at"`
+	PersonalDigest string `json:"personal_digest"`
+}
+
+// personalData fixes the fields of an event that PersonalDigest covers
+type personalData struct {
+	Actor    string          `json:"actor"`
+	Diff     json.RawMessage `json:"diff"`
+	ClientIP string          `json:"client_ip"`
+}
+
+// Hash returns the hash of event, chained to the event before it through
+// event.PrevHash. The ID and Hash of event aren't covered, and the fields
+// holding personal data only through their digest: the one of event, or the
+// stored one once the event is erased.
+func Hash(event domain.AuditEvent) string {
+	digest := event.PersonalDigest
+	if event.ErasedAt == nil {
+		digest = PersonalDigest(event)
+	}
+	encoded, _ := json.Marshal(hashedEvent{
+		PrevHash:       event.PrevHash,
+		Action:         event.Action,
+		Target:         event.Target,
+		UserID:         event.UserID,
+		RequestID:      event.RequestID,
+		CreatedAt:      event.CreatedAt.UTC().Truncate(TimePrecision).Format(time.RFC3339Nano),
+		PersonalDigest: digest,
+	})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalDigest returns the digest of the actor, diff and client IP of event
+func PersonalDigest(event domain.AuditEvent) string {
+	diff := event.Diff
+	if len(diff) == 0 {
+		diff = json.RawMessage("null")
+	}
+	// Marshaling compacts the diff, so the digest doesn't depend on how a
+	// store formats JSON
+	encoded, err := json.Marshal(personalData{
+		Actor:    event.Actor,
+		Diff:     diff,
+		ClientIP: event.ClientIP,
+	})
+	if err != nil {
+		// Only an invalid diff fails to encode, digest it as it is
+		encoded = append([]byte(fmt.Sprintf("%q %q ", event.Actor, event.ClientIP)), diff...)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verifier checks that events, given oldest first from the first event ever
+// written, form an unbroken chain
+type Verifier struct {
+	lastHash string
+	count    int
+}
+
+// Verify checks the next event of the log
+func (v *Verifier) Verify(event domain.AuditEvent) error {
+	if event.PrevHash != v.lastHash {
+		return fmt.Errorf("%w: audit event %d doesn't follow the event before it", ErrChainBroken, event.ID)
+	}
+	if Hash(event) != event.Hash {
+		return fmt.Errorf("%w: audit event %d doesn't match its hash", ErrChainBroken, event.ID)
+	}
+	// Only the digest of the personal data of erased events is left to check
+	if event.ErasedAt == nil && PersonalDigest(event) != event.PersonalDigest {
+		return fmt.Errorf("%w: audit event %d doesn't match its personal digest", ErrChainBroken, event.ID)
+	}
+	v.lastHash = event.Hash
+	v.count++
+	return nil
+}
+
+// Count is the number of events verified so far
+func (v *Verifier) Count() int {
+	return v.count
+}
+
+// LastHash is the hash of the last event verified. Removing the newest events
+// keeps the chain intact, so it's worth keeping aside to compare later.
+func (v *Verifier) LastHash() string {
+	return v.lastHash
+}
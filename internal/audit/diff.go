@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Redacted replaces the values of secret fields in diffs
+const Redacted = "[REDACTED]"
+
+// secretFields are the JSON fields of domain types whose values never reach
+// the audit log
+var secretFields = map[string]bool{
+	"hashed_password": true,
+	"hashed_secret":   true,
+	"secret":          true,
+}
+
+// ignoredFields change with every write and would only add noise
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+	"version":    true,
+}
+
+// FieldChange is the before and after value of a field, nil when the row
+// didn't exist
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff compares the JSON encodings of before and after, either of which can
+// be nil, and returns the changed fields as a JSON object mapping field names
+// to their FieldChange. Secret fields are redacted, and with redactAll every
+// value is, for changes whose values must not be kept, like an erasure.
+func Diff(before, after interface{}, redactAll bool) (json.RawMessage, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make(map[string]FieldChange)
+	for _, name := range names {
+		if ignoredFields[name] {
+			continue
+		}
+		beforeValue, afterValue := beforeFields[name], afterFields[name]
+		if beforeFields != nil && afterFields != nil && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if redactAll || secretFields[name] {
+			beforeValue, afterValue = redact(beforeValue), redact(afterValue)
+		}
+		changes[name] = FieldChange{Before: beforeValue, After: afterValue}
+	}
+	return json.Marshal(changes)
+}
+
+func fields(v interface{}) (map[string]interface{}, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T for audit: %w", v, err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode %T for audit: %w", v, err)
+	}
+	return decoded, nil
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return Redacted
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+// ImpersonationSeparator joins the admin and the impersonated user in the
+// actor of an impersonated change
+const ImpersonationSeparator = " as "
+
+// Erase scrubs the personal data of an erased user from event: the values of
+// its diff when the event is about the user, and the emails of the user from
+// its actor, along with the client IP of the requests the user sent. emails
+// are the emails the user had and are replaced by erasedEmail. Erase returns
+// false when event holds no personal data of the user.
+func Erase(event domain.AuditEvent, userID int, emails []string, erasedEmail string, erasedAt time.Time) (domain.AuditEvent, bool, error) {
+	erased := false
+	if event.UserID != nil && *event.UserID == userID && !IsRedacted(event.Diff) {
+		diff, err := redactDiff(event.Diff)
+		if err != nil {
+			return event, false, fmt.Errorf("failed to erase audit event %d: %w", event.ID, err)
+		}
+		event.Diff = diff
+		erased = true
+	}
+
+	names := strings.Split(event.Actor, ImpersonationSeparator)
+	for i, name := range names {
+		if !slices.Contains(emails, name) {
+			continue
+		}
+		names[i] = erasedEmail
+		// The first name is the one that sent the request
+		if i == 0 {
+			event.ClientIP = ""
+		}
+		erased = true
+	}
+	if !erased {
+		return event, false, nil
+	}
+	event.Actor = strings.Join(names, ImpersonationSeparator)
+	if event.ErasedAt == nil {
+		erasedAt = erasedAt.UTC().Truncate(TimePrecision)
+		event.ErasedAt = &erasedAt
+	}
+	return event, true, nil
+}
+
+// Emails returns the emails that the diffs of events record for their users
+func Emails(events []domain.AuditEvent) []string {
+	var emails []string
+	for _, event := range events {
+		var diff map[string]FieldChange
+		if err := json.Unmarshal(event.Diff, &diff); err != nil {
+			continue
+		}
+		change := diff["email"]
+		for _, value := range []interface{}{change.Before, change.After} {
+			email, ok := value.(string)
+			if ok && email != "" && email != Redacted && !slices.Contains(emails, email) {
+				emails = append(emails, email)
+			}
+		}
+	}
+	return emails
+}
+
+// IsRedacted reports whether diff keeps no values besides empty ones
+func IsRedacted(diff json.RawMessage) bool {
+	if len(diff) == 0 {
+		return true
+	}
+	var changes map[string]FieldChange
+	if err := json.Unmarshal(diff, &changes); err != nil {
+		return false
+	}
+	for _, change := range changes {
+		if !isRedactedValue(change.Before) || !isRedactedValue(change.After) {
+			return false
+		}
+	}
+	return true
+}
+
+func isRedactedValue(value interface{}) bool {
+	return value == nil || value == "" || value == Redacted
+}
+
+func redactDiff(diff json.RawMessage) (json.RawMessage, error) {
+	var changes map[string]FieldChange
+	if err := json.Unmarshal(diff, &changes); err != nil {
+		return nil, err
+	}
+	for name, change := range changes {
+		changes[name] = FieldChange{Before: redact(change.Before), After: redact(change.After)}
+	}
+	return json.Marshal(changes)
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+type APIKey struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	HashedSecret string     `json:"hashed_secret"`
+	Scopes       []string   `json:"scopes"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the key can still be used to authenticate.
+func (k APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
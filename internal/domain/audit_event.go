@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionUserCreate        = "user.create"
+	AuditActionUserUpdate        = "user.update"
+	AuditActionUserDelete        = "user.delete"
+	AuditActionUserRestore       = "user.restore"
+	AuditActionUserPurge         = "user.purge"
+	AuditActionUserErase         = "user.erase"
+	AuditActionAPIKeyCreate      = "api_key.create"
+	AuditActionAPIKeyRevoke      = "api_key.revoke"
+	AuditActionOAuthClientCreate = "oauth_client.create"
+	AuditActionOAuthClientDelete = "oauth_client.delete"
+	AuditActionSessionRevoke     = "session.revoke"
+
+	AuditActionWebhookSubscriptionCreate = "webhook_subscription.create"
+	AuditActionWebhookSubscriptionDelete = "webhook_subscription.delete"
+	AuditActionWebhookDeliveryReplay     = "webhook_delivery.replay"
+)
+
+// AuditEvent is an entry of the append-only audit log. Each entry carries the
+// hash of the entry before it, so changing or removing one breaks the chain
+// from there on.
+//
+// The actor, diff and client IP can hold personal data, so the hash covers
+// them through PersonalDigest. Erasing a user scrubs them and keeps the
+// digest, which leaves the chain intact.
+type AuditEvent struct {
+	ID int `json:"id"`
+	// Actor is who made the change, "system" for background jobs
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// Target is the changed row, like user:12
+	Target string `json:"target"`
+	// UserID is the user the target belongs to, if any
+	UserID *int `json:"user_id"`
+	// Diff maps each changed field to its before and after values, with
+	// secrets redacted
+	Diff      json.RawMessage `json:"diff"`
+	RequestID string          `json:"request_id"`
+	ClientIP  string          `json:"client_ip"`
+	CreatedAt time.Time       `json:"created_at"`
+	// PersonalDigest is the digest of the actor, diff and client IP as they
+	// were written
+	PersonalDigest string `json:"personal_digest"`
+	// ErasedAt is when personal data was scrubbed from the event
+	ErasedAt *time.Time `json:"erased_at"`
+	PrevHash string     `json:"prev_hash"`
+	Hash     string     `json:"hash"`
+}
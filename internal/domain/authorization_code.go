@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// AuthorizationCode is a single-use code issued by the OAuth2 authorization
+// endpoint and redeemed for tokens at the token endpoint. Only the hash of
+// the code is stored.
+type AuthorizationCode struct {
+	ID            int        `json:"id"`
+	CodeHash      string     `json:"code_hash"`
+	ClientID      string     `json:"client_id"`
+	UserID        int        `json:"user_id"`
+	RedirectURI   string     `json:"redirect_uri"`
+	Scopes        []string   `json:"scopes"`
+	Nonce         string     `json:"nonce"`
+	CodeChallenge string     `json:"code_challenge"`
+	AuthTime      time.Time  `json:"auth_time"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Statuses of a device authorization, see RFC 8628
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+	DeviceAuthorizationConsumed = "consumed"
+)
+
+// UserCodeAlphabet is the set of characters user codes are made of. It only
+// has consonants so codes are easy to type and never spell words.
+const UserCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization is a pending sign-in of a device that can't host a
+// redirect URI. The device polls with the device code while the user approves
+// the user code from another, logged in, device. Only the hash of the device
+// code is stored.
+type DeviceAuthorization struct {
+	ID             int        `json:"id"`
+	DeviceCodeHash string     `json:"device_code_hash"`
+	UserCode       string     `json:"user_code"`
+	ClientID       string     `json:"client_id"`
+	Scopes         []string   `json:"scopes"`
+	Status         string     `json:"status"`
+	UserID         *int       `json:"user_id"`
+	Interval       int        `json:"interval"`
+	LastPolledAt   *time.Time `json:"last_polled_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// NormalizeUserCode uppercases a user code and drops the separators users may
+// type, so "bcdf-ghjk" and "BCDFGHJK" match the same code.
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if !strings.ContainsRune(UserCodeAlphabet, r) {
+			return -1
+		}
+		return r
+	}, userCode)
+}
+
+// FormatUserCode groups a normalized user code in two halves, e.g. BCDF-GHJK
+func FormatUserCode(userCode string) string {
+	if len(userCode) < 2 {
+		return userCode
+	}
+	half := len(userCode) / 2
+	return userCode[:half] + "-" + userCode[half:]
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statuses of an erasure request
+const (
+	ErasureStatusPending   = "pending"
+	ErasureStatusCompleted = "completed"
+)
+
+// ErasedUserName is the name erased users are left with
+const ErasedUserName = "erased user"
+
+// ErasureRequest asks for the personal data of a user to be erased. The user
+// row and the records referencing it are kept, with the personal data in them
+// anonymized, and the request is kept after the user is purged as proof of
+// the erasure.
+type ErasureRequest struct {
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	// RequestedBy is the ID of the user that asked for the erasure, the
+	// erased user itself or an admin
+	RequestedBy int        `json:"requested_by"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// ErasedUserEmail is the email erased users are left with. It's unique per
+// user and can't receive mail.
+func ErasedUserEmail(userID int) string {
+	return fmt.Sprintf("erased-%d@erased.invalid", userID)
+}
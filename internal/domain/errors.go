@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+// Sentinel errors the repository wraps its failures in, so callers can tell
+// them apart with errors.Is whatever the storage behind it
+var (
+	// ErrNotFound is returned when the requested row doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when a row with the same unique key exists
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when a write conflicts with the current state,
+	// like a row it references being gone or a concurrent transaction
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch is returned when a write expects another version of
+	// the row than the stored one, because someone else changed it since
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrPermissionDenied is returned when the database refuses the operation
+	ErrPermissionDenied = errors.New("permission denied")
+)
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// Ways a user can sign in, as recorded in the login history
+const (
+	LoginMethodPassword       = "password"
+	LoginMethodMagicLink      = "magic_link"
+	LoginMethodFederation     = "federation"
+	LoginMethodReauthenticate = "reauthenticate"
+)
+
+// LoginEvent is an entry of the login history. UserID is nil for failed
+// attempts with an email no account has.
+type LoginEvent struct {
+	ID            int       `json:"id"`
+	UserID        *int      `json:"user_id"`
+	Email         string    `json:"email"`
+	Method        string    `json:"method"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason"`
+	IPAddress     string    `json:"ip_address"`
+	UserAgent     string    `json:"user_agent"`
+	SessionID     string    `json:"session_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// MagicLink is a single-use login link sent to the email of a user. Only the
+// hash of its token is stored.
+type MagicLink struct {
+	ID        int        `json:"id"`
+	TokenHash string     `json:"token_hash"`
+	UserID    int        `json:"user_id"`
+	Email     string     `json:"email"`
+	Attempts  int        `json:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
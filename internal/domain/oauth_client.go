@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+// OAuthClient is a machine client that can obtain tokens through the
+// OAuth2 client credentials grant.
+type OAuthClient struct {
+	ID           int       `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	HashedSecret string    `json:"hashed_secret"`
+	Scopes       []string  `json:"scopes"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AllowsRedirectURI reports whether the redirect URI is registered for the
+// client. URIs are compared as exact strings.
+func (c OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes reports whether every requested scope is allowed for the client.
+func (c OAuthClient) AllowsScopes(scopes []string) bool {
+	allowed := make(map[string]bool, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		allowed[scope] = true
+	}
+	for _, scope := range scopes {
+		if !allowed[scope] {
+			return false
+		}
+	}
+	return true
+}
@@ -9,6 +9,8 @@ import (
 const (
 	StandardRole = "standard"
 	AdminRole    = "admin"
+	// ServiceRole is carried by tokens issued to OAuth2 clients rather than users
+	ServiceRole = "service"
 )
 
 func StringToRole(roleStr string) userpb.Role {
@@ -16,7 +18,7 @@ func StringToRole(roleStr string) userpb.Role {
 	case "admin":
 		return userpb.Role_ADMIN
 	case "standard":
-		return userpb.Role_ADMIN
+		return userpb.Role_STANDARD
 	default:
 		return userpb.Role_ADMIN
 	}
@@ -0,0 +1,49 @@
+package domain
+
+import "fmt"
+
+// Scopes restrict what a machine credential, such as an API key, may call.
+// Tokens issued by LoginUser are not scoped and are only limited by role.
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	// ScopeSCIM lets an admin or service credential provision users over SCIM
+	ScopeSCIM = "scim"
+)
+
+// OpenID Connect scopes, see OpenID Connect Core section 5.4
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+var knownScopes = map[string]bool{
+	ScopeUsersRead:  true,
+	ScopeUsersWrite: true,
+	ScopeSCIM:       true,
+	ScopeOpenID:     true,
+	ScopeEmail:      true,
+	ScopeProfile:    true,
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !knownScopes[scope] {
+			return fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+	return nil
+}
+
+func ContainsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// Session is a login of a user on a device. Its ID is carried by the access
+// token of the login, and revoking the session invalidates the token.
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    int        `json:"user_id"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the session is neither revoked nor expired at the given time
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -10,4 +10,15 @@ type User struct {
 	HashedPassword    string    `json:"hashed_password"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"create_at"`
+	// ExternalID is the identifier a provisioning client, such as an HR
+	// system pushing users over SCIM, knows the user by
+	ExternalID string `json:"external_id"`
+	// Active is false for deprovisioned users, who can't sign in
+	Active    bool      `json:"active"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set on soft deleted users until they are purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version increases with every write, so writers can tell whether the
+	// user changed since they read it
+	Version int `json:"version"`
 }
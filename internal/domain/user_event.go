@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// Types of the events other services receive about users
+const (
+	UserEventCreated = "user.created"
+	UserEventUpdated = "user.updated"
+	UserEventDeleted = "user.deleted"
+)
+
+// UserEvent announces a change of a user. It is delivered at least once, so
+// receivers should drop events with an ID they have already seen. Events of
+// the same user are delivered in the order of their IDs.
+type UserEvent struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	UserID int    `json:"user_id"`
+	// User is the user after the change
+	User       UserSnapshot `json:"user"`
+	RequestID  string       `json:"request_id"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// UserSnapshot is the part of a user that is shared with other services. It
+// leaves out the credentials.
+type UserSnapshot struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	ExternalID string     `json:"external_id"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	Version    int        `json:"version"`
+}
+
+func NewUserSnapshot(user User) UserSnapshot {
+	return UserSnapshot{
+		ID:         user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Role:       user.Role,
+		ExternalID: user.ExternalID,
+		Active:     user.Active,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+		DeletedAt:  user.DeletedAt,
+		Version:    user.Version,
+	}
+}
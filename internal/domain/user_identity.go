@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// UserIdentity links an account at an upstream identity provider to a user
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
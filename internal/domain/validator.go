@@ -3,6 +3,7 @@ package domain
 import (
 	"fmt"
 	"net/mail"
+	"net/url"
 	"regexp"
 	"strconv"
 
@@ -58,6 +59,63 @@ func ValidateUserIdString(userId string) error {
 	return nil
 }
 
+func ValidateIdString(value string) error {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("must be a valid integer")
+	}
+	if id <= 0 {
+		return fmt.Errorf("must be a positive integer")
+	}
+	return nil
+}
+
+// ValidateRedirectURI checks an OAuth2 redirect URI. It must be absolute,
+// without a fragment, and use https unless it points to localhost.
+func ValidateRedirectURI(value string) error {
+	uri, err := url.Parse(value)
+	if err != nil || !uri.IsAbs() || uri.Host == "" {
+		return fmt.Errorf("must be an absolute URI")
+	}
+	if uri.Fragment != "" {
+		return fmt.Errorf("must not contain a fragment")
+	}
+	if uri.Scheme != "https" && !(uri.Scheme == "http" && (uri.Hostname() == "localhost" || uri.Hostname() == "127.0.0.1")) {
+		return fmt.Errorf("must use https")
+	}
+	return nil
+}
+
+// ValidateWebhookURL checks the URL of a webhook subscription. It must be
+// absolute, without credentials, and use https unless it points to localhost.
+func ValidateWebhookURL(value string) error {
+	uri, err := url.Parse(value)
+	if err != nil || !uri.IsAbs() || uri.Host == "" {
+		return fmt.Errorf("must be an absolute URL")
+	}
+	if uri.User != nil {
+		return fmt.Errorf("must not contain credentials")
+	}
+	if uri.Scheme != "https" && !(uri.Scheme == "http" && (uri.Hostname() == "localhost" || uri.Hostname() == "127.0.0.1")) {
+		return fmt.Errorf("must use https")
+	}
+	return nil
+}
+
+func ValidateUserEventTypes(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return fmt.Errorf("must contain at least one event type")
+	}
+	for _, eventType := range eventTypes {
+		switch eventType {
+		case UserEventCreated, UserEventUpdated, UserEventDeleted:
+		default:
+			return fmt.Errorf("unknown event type: %s", eventType)
+		}
+	}
+	return nil
+}
+
 func ConvertFieldViolationsToAttributes(fieldViolations []*errdetails.BadRequest_FieldViolation) []attribute.KeyValue {
 	var attrs []attribute.KeyValue
 
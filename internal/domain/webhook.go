@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription sends the user events of its EventTypes to URL as HTTP
+// callbacks signed with Secret.
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the subscription receives events of eventType
+func (s WebhookSubscription) Subscribes(eventType string) bool {
+	for _, subscribed := range s.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses. Pending deliveries are retried until they
+// succeed or run out of attempts and become dead.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDelivery is a user event to be sent to a webhook subscription
+type WebhookDelivery struct {
+	ID             int    `json:"id"`
+	SubscriptionID int    `json:"subscription_id"`
+	EventID        int    `json:"event_id"`
+	UserID         int    `json:"user_id"`
+	EventType      string `json:"event_type"`
+	// Payload is the JSON encoded event, sent as the request body
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// WebhookDeliveryAttempt is a request made to deliver a webhook
+type WebhookDeliveryAttempt struct {
+	ID         int `json:"id"`
+	DeliveryID int `json:"delivery_id"`
+	// StatusCode is the HTTP status of the response, 0 when there was none
+	StatusCode  int           `json:"status_code"`
+	Error       string        `json:"error"`
+	Duration    time.Duration `json:"duration"`
+	AttemptedAt time.Time     `json:"attempted_at"`
+}
@@ -0,0 +1,134 @@
+// Package events delivers the user events written to the outbox to other
+// services.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+// Publisher delivers user events to other services. The relay calls it again
+// with an event when it fails, or when the relay stops before it recorded the
+// delivery, so receivers have to handle duplicates.
+type Publisher interface {
+	Publish(ctx context.Context, event domain.UserEvent) error
+}
+
+// Discard drops every event, for deployments where no service listens
+var Discard Publisher = discard{}
+
+type discard struct{}
+
+func (discard) Publish(ctx context.Context, event domain.UserEvent) error {
+	return nil
+}
+
+// Fanout publishes each event to all of publishers, in order. It stops at the
+// first that fails, and the relay publishes the event to all of them again
+// later.
+func Fanout(publishers ...Publisher) Publisher {
+	return fanout(publishers)
+}
+
+type fanout []Publisher
+
+func (f fanout) Publish(ctx context.Context, event domain.UserEvent) error {
+	for _, publisher := range f {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriterPublisher writes events as JSON lines, for a log shipper or a sidecar
+// to forward
+type WriterPublisher struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// NewWriterPublisher returns a publisher that writes to w, e.g. os.Stdout
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// OpenFilePublisher returns a publisher that appends to the file at path,
+// creating it if needed
+func OpenFilePublisher(path string) (*WriterPublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &WriterPublisher{w: file, file: file}, nil
+}
+
+func (p *WriterPublisher) Publish(ctx context.Context, event domain.UserEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	// The event counts as delivered once the relay records it, so it has to
+	// be on disk by then
+	if p.file != nil {
+		if err := p.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync event file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the file of a publisher made by OpenFilePublisher
+func (p *WriterPublisher) Close() error {
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+// MemoryPublisher keeps the events it receives in memory, for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []domain.UserEvent
+	fail   func(event domain.UserEvent) error
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event domain.UserEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		if err := p.fail(event); err != nil {
+			return err
+		}
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in the order they came in
+func (p *MemoryPublisher) Events() []domain.UserEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]domain.UserEvent(nil), p.events...)
+}
+
+// FailWith makes Publish return the error fail returns for an event, until
+// it is called again with nil
+func (p *MemoryPublisher) FailWith(fail func(event domain.UserEvent) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = fail
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/google/uuid"
+)
+
+// cleanupInterval is how often the relay deletes events past their retention
+const cleanupInterval = time.Hour
+
+type RelayConfig struct {
+	// Interval is how long the relay waits before it looks for new events
+	Interval time.Duration
+	// BatchSize is how many events the relay reads from the outbox at once
+	BatchSize int
+	// LeaseDuration is how long the relay of a replica that stopped keeps
+	// the others from publishing. It must be well above the time a batch
+	// takes to publish.
+	LeaseDuration time.Duration
+	// Retention is how long published events stay in the outbox
+	Retention time.Duration
+}
+
+// DefaultRelayConfig returns the default configuration.
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		Interval:      time.Second,
+		BatchSize:     100,
+		LeaseDuration: 30 * time.Second,
+		Retention:     7 * 24 * time.Hour,
+	}
+}
+
+// Relay publishes the events of the outbox. It records every event it
+// published, and publishes it again if it stops before that, so delivery is
+// at least once. Only the relay holding the outbox lease publishes, and it
+// doesn't publish an event while an earlier one of the same user is pending,
+// so the events of a user are published in order.
+type Relay struct {
+	outbox    repository.IOutboxRepository
+	publisher Publisher
+	config    RelayConfig
+	// holder identifies the relay in the outbox lease
+	holder string
+}
+
+func NewRelay(outbox repository.IOutboxRepository, publisher Publisher, config RelayConfig) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		config:    config,
+		holder:    uuid.NewString(),
+	}
+}
+
+// Run publishes the events of the outbox every Interval and deletes the
+// published ones after their Retention, until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		if _, err := r.PublishPending(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf(ctx, "Failed to publish user events: %v", err)
+		}
+
+		if time.Since(lastCleanup) >= cleanupInterval {
+			deleted, err := r.outbox.DeletePublishedUserEvents(ctx, time.Now().Add(-r.config.Retention))
+			if err != nil && ctx.Err() == nil {
+				log.Errorf(ctx, "Failed to delete published user events: %v", err)
+			} else if deleted > 0 {
+				log.Infof(ctx, "Deleted %d published user events", deleted)
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending publishes the pending events of the outbox and returns how
+// many it published. It publishes nothing while another relay holds the
+// lease. Events that fail stay pending along with the later events of their
+// user, until the next call.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	log := logger.FromContext(ctx)
+
+	published := 0
+	for {
+		acquired, err := r.outbox.AcquireOutboxLease(ctx, r.holder, time.Now(), r.config.LeaseDuration)
+		if err != nil {
+			return published, err
+		}
+		if !acquired {
+			return published, nil
+		}
+
+		events, err := r.outbox.ListPendingUserEvents(ctx, r.config.BatchSize)
+		if err != nil {
+			return published, err
+		}
+
+		// blocked holds the users with a pending event that failed
+		blocked := make(map[int]bool)
+		for _, event := range events {
+			if blocked[event.UserID] {
+				continue
+			}
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				blocked[event.UserID] = true
+				log.Warnf(ctx, "Failed to publish user event %d: %v", event.ID, err)
+				if err := r.outbox.MarkUserEventFailed(ctx, event.ID, err.Error()); err != nil {
+					return published, err
+				}
+				continue
+			}
+			if err := r.outbox.MarkUserEventPublished(ctx, event.ID, time.Now()); err != nil {
+				return published, fmt.Errorf("published event %d but failed to record it: %w", event.ID, err)
+			}
+			published++
+		}
+
+		if len(blocked) > 0 || len(events) < r.config.BatchSize {
+			return published, nil
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext() context.Context {
+	return logger.WithLogger(context.Background(), logger.NewDevLogger())
+}
+
+func createUser(t *testing.T, repo repository.IRepository, email string) *domain.User {
+	user, err := repo.CreateUser(context.Background(), repository.CreateUserParams{
+		Name:           "Test",
+		Email:          email,
+		Role:           domain.StandardRole,
+		HashedPassword: "hash",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func eventTypes(events []domain.UserEvent, userID int) []string {
+	var types []string
+	for _, event := range events {
+		if event.UserID == userID {
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+func TestRelay(t *testing.T) {
+	ctx := testContext()
+	repo := repository.NewMemory()
+	publisher := &MemoryPublisher{}
+	config := DefaultRelayConfig()
+	config.BatchSize = 2
+	relay := NewRelay(repo, publisher, config)
+
+	user := createUser(t, repo, "a@example.com")
+	name := "Renamed"
+	_, err := repo.UpdateUser(ctx, user.ID, repository.UpdateUserParams{Name: &name})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUserByEmail(ctx, user.Email, 0))
+
+	published, err := relay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, published)
+	require.Equal(t, []string{domain.UserEventCreated, domain.UserEventUpdated, domain.UserEventDeleted}, eventTypes(publisher.Events(), user.ID))
+	require.Equal(t, "Renamed", publisher.Events()[1].User.Name)
+
+	// Published events aren't published again
+	published, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Zero(t, published)
+	require.Len(t, publisher.Events(), 3)
+}
+
+func TestRelayOrdersEventsPerUser(t *testing.T) {
+	ctx := testContext()
+	repo := repository.NewMemory()
+	publisher := &MemoryPublisher{}
+	relay := NewRelay(repo, publisher, DefaultRelayConfig())
+
+	failing := createUser(t, repo, "failing@example.com")
+	other := createUser(t, repo, "other@example.com")
+	require.NoError(t, repo.DeleteUserByEmail(ctx, failing.Email, 0))
+	require.NoError(t, repo.DeleteUserByEmail(ctx, other.Email, 0))
+
+	errUnavailable := errors.New("unavailable")
+	publisher.FailWith(func(event domain.UserEvent) error {
+		if event.UserID == failing.ID {
+			return errUnavailable
+		}
+		return nil
+	})
+	published, err := relay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Empty(t, eventTypes(publisher.Events(), failing.ID))
+	require.Equal(t, []string{domain.UserEventCreated, domain.UserEventDeleted}, eventTypes(publisher.Events(), other.ID))
+
+	// The events of the failing user come in order once it recovers
+	publisher.FailWith(nil)
+	published, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, []string{domain.UserEventCreated, domain.UserEventDeleted}, eventTypes(publisher.Events(), failing.ID))
+}
+
+func TestRelayLease(t *testing.T) {
+	ctx := testContext()
+	repo := repository.NewMemory()
+	first, second := &MemoryPublisher{}, &MemoryPublisher{}
+	firstRelay := NewRelay(repo, first, DefaultRelayConfig())
+	secondRelay := NewRelay(repo, second, DefaultRelayConfig())
+
+	createUser(t, repo, "a@example.com")
+	published, err := firstRelay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+
+	// The other relay waits for the lease to expire
+	createUser(t, repo, "b@example.com")
+	published, err = secondRelay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Zero(t, published)
+	require.Empty(t, second.Events())
+
+	published, err = firstRelay.PublishPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+}
+
+func TestRelayRun(t *testing.T) {
+	repo := repository.NewMemory()
+	publisher := &MemoryPublisher{}
+	config := DefaultRelayConfig()
+	config.Interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(testContext())
+	done := make(chan struct{})
+	go func() {
+		NewRelay(repo, publisher, config).Run(ctx)
+		close(done)
+	}()
+
+	user := createUser(t, repo, "a@example.com")
+	require.Eventually(t, func() bool {
+		return len(eventTypes(publisher.Events(), user.ID)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	publisher, err := OpenFilePublisher(path)
+	require.NoError(t, err)
+
+	event := domain.UserEvent{ID: 7, Type: domain.UserEventCreated, UserID: 3, User: domain.UserSnapshot{ID: 3, Email: "a@example.com"}}
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		var written domain.UserEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &written))
+		require.Equal(t, event, written)
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, 2, lines)
+}
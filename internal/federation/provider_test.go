@@ -0,0 +1,240 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockClientID     = "sternx"
+	mockClientSecret = "mock-secret"
+	mockKeyID        = "mock-key"
+	mockRedirectURL  = "http://localhost:8080/federation/mock/callback"
+)
+
+// mockIdP is an in-process OpenID Connect provider that issues ID tokens
+// for a single pending authorization code.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	code          string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": mockKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if clientID != mockClientID || clientSecret != mockClientSecret ||
+			r.FormValue("code") != idp.code ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "upstream-access-token",
+			"token_type":   "Bearer",
+			"id_token":     idp.sign(t, idp.claims, mockKeyID),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims jwt.MapClaims, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(idp.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (idp *mockIdP) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "upstream-user-1",
+		"aud":            mockClientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+	}, idp.server.Client())
+}
+
+func TestProviderLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	verifier := "a-long-enough-code-verifier-for-pkce"
+	challenge := sha256.Sum256([]byte(verifier))
+	codeChallenge := base64.RawURLEncoding.EncodeToString(challenge[:])
+
+	authURL, err := provider.AuthCodeURL(ctx, "the-state", "the-nonce", codeChallenge)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, idp.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	query := parsed.Query()
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, mockClientID, query.Get("client_id"))
+	require.Equal(t, mockRedirectURL, query.Get("redirect_uri"))
+	require.Equal(t, "openid email profile", query.Get("scope"))
+	require.Equal(t, "the-state", query.Get("state"))
+	require.Equal(t, "the-nonce", query.Get("nonce"))
+	require.Equal(t, codeChallenge, query.Get("code_challenge"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	idp.code = "upstream-code"
+	idp.codeChallenge = codeChallenge
+	idp.claims = idp.validClaims("the-nonce")
+
+	identity, err := provider.Exchange(ctx, "upstream-code", verifier, "the-nonce")
+	require.NoError(t, err)
+	require.Equal(t, &Identity{
+		Provider:      "mock",
+		Subject:       "upstream-user-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+	}, identity)
+
+	_, err = provider.Exchange(ctx, "upstream-code", "wrong-verifier", "the-nonce")
+	require.Error(t, err)
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	testCases := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		kid    string
+	}{
+		{name: "WrongIssuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "WrongAudience", modify: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "Expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "WrongNonce", modify: func(c jwt.MapClaims) { c["nonce"] = "replayed-nonce" }},
+		{name: "MissingSubject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "UnknownKey", modify: func(c jwt.MapClaims) {}, kid: "rotated-away"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := idp.validClaims("the-nonce")
+			tc.modify(claims)
+			kid := tc.kid
+			if kid == "" {
+				kid = mockKeyID
+			}
+
+			_, err := provider.VerifyIDToken(ctx, idp.sign(t, claims, kid), "the-nonce")
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("AudienceList", func(t *testing.T) {
+		claims := idp.validClaims("the-nonce")
+		claims["aud"] = []string{"another-client", mockClientID}
+
+		identity, err := provider.VerifyIDToken(ctx, idp.sign(t, claims, mockKeyID), "the-nonce")
+		require.NoError(t, err)
+		require.Equal(t, "upstream-user-1", identity.Subject)
+	})
+
+	t.Run("SymmetricAlgorithm", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.validClaims("the-nonce"))
+		signed, err := token.SignedString([]byte("guessable"))
+		require.NoError(t, err)
+
+		_, err = provider.VerifyIDToken(ctx, signed, "the-nonce")
+		require.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+}
+
+func TestLoginState(t *testing.T) {
+	key := []byte("state-signing-key")
+	state := LoginState{
+		Provider:     "mock",
+		State:        "the-state",
+		Nonce:        "the-nonce",
+		CodeVerifier: "the-verifier",
+		ExpiresAt:    time.Now().Add(time.Minute).Truncate(time.Second),
+	}
+
+	encoded, err := EncodeState(key, state)
+	require.NoError(t, err)
+
+	decoded, err := DecodeState(key, encoded)
+	require.NoError(t, err)
+	require.Equal(t, state.Provider, decoded.Provider)
+	require.Equal(t, state.CodeVerifier, decoded.CodeVerifier)
+	require.WithinDuration(t, state.ExpiresAt, decoded.ExpiresAt, time.Second)
+
+	_, err = DecodeState([]byte("another-key"), encoded)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	_, err = DecodeState(key, "x"+encoded)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	state.ExpiresAt = time.Now().Add(-time.Second)
+	expired, err := EncodeState(key, state)
+	require.NoError(t, err)
+	_, err = DecodeState(key, expired)
+	require.ErrorIs(t, err, ErrInvalidState)
+}
@@ -0,0 +1,59 @@
+package federation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("login state is invalid or expired")
+
+// LoginState carries what the callback needs to finish a login. It is kept
+// in a cookie on the user agent, signed so it cannot be forged.
+type LoginState struct {
+	Provider     string    `json:"provider"`
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// EncodeState serializes and signs the login state with HMAC-SHA256
+func EncodeState(key []byte, state LoginState) (string, error) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + sign(key, encoded), nil
+}
+
+// DecodeState verifies the signature and expiry of an encoded login state
+func DecodeState(key []byte, value string) (*LoginState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(key, encoded))) {
+		return nil, ErrInvalidState
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var state LoginState
+	if err := json.Unmarshal(body, &state); err != nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().After(state.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+	return &state, nil
+}
+
+func sign(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
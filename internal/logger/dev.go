@@ -29,58 +29,58 @@ func formatLogEntry(level string, msg string, args ...interface{}) string {
 }
 
 // Helper function to log with level and context
-func logWithLevel(logger zerolog.Logger, level string, msg string, args ...interface{}) {
+func logWithLevel(logger zerolog.Logger, level string, entry string) {
 	switch level {
 	case "info":
-		logger.Info().Msg(formatLogEntry(level, msg, args...))
+		logger.Info().Msg(entry)
 	case "debug":
-		logger.Debug().Msg(formatLogEntry(level, msg, args...))
+		logger.Debug().Msg(entry)
 	case "warn":
-		logger.Warn().Msg(formatLogEntry(level, msg, args...))
+		logger.Warn().Msg(entry)
 	case "error":
-		logger.Error().Msg(formatLogEntry(level, msg, args...))
+		logger.Error().Msg(entry)
 	case "fatal":
-		logger.Fatal().Msg(formatLogEntry(level, msg, args...))
+		logger.Fatal().Msg(entry)
 	}
 }
 
 // Implementations of the Logger interface
 func (l *DevLogger) Info(ctx context.Context, args ...interface{}) {
-	logWithLevel(l.logger, "info", "", args...)
+	logWithLevel(l.logger, "info", fmt.Sprint(args...))
 }
 
 func (l *DevLogger) Infof(ctx context.Context, format string, args ...interface{}) {
-	logWithLevel(l.logger, "info", format, args...)
+	logWithLevel(l.logger, "info", formatLogEntry("info", format, args...))
 }
 
 func (l *DevLogger) Debug(ctx context.Context, args ...interface{}) {
-	logWithLevel(l.logger, "debug", "", args...)
+	logWithLevel(l.logger, "debug", fmt.Sprint(args...))
 }
 
 func (l *DevLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
-	logWithLevel(l.logger, "debug", format, args...)
+	logWithLevel(l.logger, "debug", formatLogEntry("debug", format, args...))
 }
 
 func (l *DevLogger) Warn(ctx context.Context, args ...interface{}) {
-	logWithLevel(l.logger, "warn", "", args...)
+	logWithLevel(l.logger, "warn", fmt.Sprint(args...))
 }
 
 func (l *DevLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
-	logWithLevel(l.logger, "warn", format, args...)
+	logWithLevel(l.logger, "warn", formatLogEntry("warn", format, args...))
 }
 
 func (l *DevLogger) Error(ctx context.Context, args ...interface{}) {
-	logWithLevel(l.logger, "error", "", args...)
+	logWithLevel(l.logger, "error", fmt.Sprint(args...))
 }
 
 func (l *DevLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
-	logWithLevel(l.logger, "error", format, args...)
+	logWithLevel(l.logger, "error", formatLogEntry("error", format, args...))
 }
 
 func (l *DevLogger) Fatal(ctx context.Context, args ...interface{}) {
-	logWithLevel(l.logger, "fatal", "", args...)
+	logWithLevel(l.logger, "fatal", fmt.Sprint(args...))
 }
 
 func (l *DevLogger) Fatalf(ctx context.Context, format string, args ...interface{}) {
-	logWithLevel(l.logger, "fatal", format, args...)
+	logWithLevel(l.logger, "fatal", formatLogEntry("fatal", format, args...))
 }
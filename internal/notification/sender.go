@@ -0,0 +1,68 @@
+// Package notification delivers messages, such as login links, to users.
+package notification
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/utils"
+)
+
+// Message is a notification to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers notifications to users
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes notifications to the log instead of delivering them. It is
+// only meant for development, since the log then holds secrets like login links.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	logger.FromContext(ctx).Infof(ctx, "Notification to %s: %s\n%s", utils.MaskEmail(msg.To), msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPSender sends notifications as plain text emails through an SMTP server
+type SMTPSender struct {
+	// Addr is the host:port of the SMTP server
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("recipient and subject must not contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	body := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + msg.Body
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
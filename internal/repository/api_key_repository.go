@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, hashed_secret, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+type apiKeyModel struct {
+	id           int
+	userID       int
+	name         string
+	prefix       string
+	hashedSecret string
+	scopes       []string
+	expiresAt    time.Time
+	lastUsedAt   *time.Time
+	revokedAt    *time.Time
+	createdAt    time.Time
+}
+
+func (k apiKeyModel) ToDomain() *domain.APIKey {
+	return &domain.APIKey{
+		ID:           k.id,
+		UserID:       k.userID,
+		Name:         k.name,
+		Prefix:       k.prefix,
+		HashedSecret: k.hashedSecret,
+		Scopes:       k.scopes,
+		ExpiresAt:    k.expiresAt,
+		LastUsedAt:   k.lastUsedAt,
+		RevokedAt:    k.revokedAt,
+		CreatedAt:    k.createdAt,
+	}
+}
+
+func (k *apiKeyModel) scanTargets() []interface{} {
+	return []interface{}{&k.id, &k.userID, &k.name, &k.prefix, &k.hashedSecret, &k.scopes, &k.expiresAt, &k.lastUsedAt, &k.revokedAt, &k.createdAt}
+}
+
+type CreateAPIKeyParams struct {
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	Prefix       string    `json:"prefix"`
+	HashedSecret string    `json:"hashed_secret"`
+	Scopes       []string  `json:"scopes"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (p *postgres) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*domain.APIKey, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateAPIKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateAPIKey"),
+		attribute.Int("user.id", params.UserID),
+		attribute.String("api_key.prefix", params.Prefix),
+	)
+
+	createdAt := time.Now()
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insertQuery := "INSERT INTO api_keys (user_id, name, prefix, hashed_secret, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	var keyID int
+	err = tx.QueryRow(ctx, insertQuery, params.UserID, params.Name, params.Prefix, params.HashedSecret, params.Scopes, params.ExpiresAt, createdAt).Scan(&keyID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert api key into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert api key into database: %w", dbError(err))
+	}
+
+	key := &domain.APIKey{
+		ID:           keyID,
+		UserID:       params.UserID,
+		Name:         params.Name,
+		Prefix:       params.Prefix,
+		HashedSecret: params.HashedSecret,
+		Scopes:       params.Scopes,
+		ExpiresAt:    params.ExpiresAt,
+		CreatedAt:    createdAt,
+	}
+	if err := p.recordChanges(ctx, tx, apiKeyChange(domain.AuditActionAPIKeyCreate, nil, key)); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert api key into database: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert api key into database: %w", dbError(err))
+	}
+	return key, nil
+}
+
+func (p *postgres) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetAPIKeyByPrefix")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "GetAPIKeyByPrefix"),
+		attribute.String("api_key.prefix", prefix),
+	)
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE prefix = $1"
+	var key apiKeyModel
+
+	err := p.conn.QueryRow(ctx, query, prefix).Scan(key.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "api key not found with the provided prefix: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("api key not found with the provided prefix: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to find api key by prefix: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("api key not found: %w", dbError(err))
+	}
+	return key.ToDomain(), nil
+}
+
+func (p *postgres) ListAPIKeysByUserID(ctx context.Context, userID int) ([]domain.APIKey, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListAPIKeysByUserID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListAPIKeysByUserID"),
+		attribute.Int("user.id", userID),
+	)
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC"
+	rows, err := p.conn.Query(ctx, query, userID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list api keys: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list api keys: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var keys []domain.APIKey
+	for rows.Next() {
+		var key apiKeyModel
+		if err := rows.Scan(key.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, *key.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list api keys: %w", dbError(err))
+	}
+	span.SetAttributes(attribute.Int("api_key.count", len(keys)))
+
+	return keys, nil
+}
+
+func (p *postgres) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RevokeAPIKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "RevokeAPIKey"),
+		attribute.Int("user.id", userID),
+		attribute.Int("api_key.id", keyID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before, after apiKeyModel
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL FOR UPDATE"
+	if err := tx.QueryRow(ctx, query, keyID, userID).Scan(before.scanTargets()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "active api key %d not found: %v", keyID, domain.ErrNotFound)
+			span.SetAttributes(attribute.Bool("api_key.revoked", false))
+
+			return fmt.Errorf("active api key %d not found: %w", keyID, domain.ErrNotFound)
+		}
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke api key %d: %w", keyID, dbError(err))
+	}
+
+	err = tx.QueryRow(ctx, "UPDATE api_keys SET revoked_at = $1 WHERE id = $2 RETURNING "+apiKeyColumns, time.Now(), keyID).Scan(after.scanTargets()...)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to revoke api key %d: %v", keyID, err)
+		span.RecordError(err)
+
+		return fmt.Errorf("failed to revoke api key %d: %w", keyID, dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, apiKeyChange(domain.AuditActionAPIKeyRevoke, before.ToDomain(), after.ToDomain())); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke api key %d: %w", keyID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke api key %d: %w", keyID, dbError(err))
+	}
+	span.SetAttributes(attribute.Bool("api_key.revoked", true))
+
+	return nil
+}
+
+func (p *postgres) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "TouchAPIKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "TouchAPIKey"),
+		attribute.Int("api_key.id", keyID),
+	)
+
+	_, err := p.conn.Exec(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt, keyID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update api key last used time: %w", dbError(err))
+	}
+	return nil
+}
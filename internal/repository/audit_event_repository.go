@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// auditLockID is the Postgres advisory lock that writers of audit events hold
+// until they commit, so each event chains to the one committed before it
+const auditLockID int64 = 0x617564697473
+
+const auditEventColumns = "id, actor, action, target, user_id, diff, request_id, client_ip, created_at, personal_digest, erased_at, prev_hash, hash"
+
+const insertAuditEventQuery = "INSERT INTO audit_events (actor, action, target, user_id, diff, request_id, client_ip, created_at, personal_digest, prev_hash, hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)"
+
+// eraseAuditEventQuery writes back an event that personal data was scrubbed
+// from. It's the only update the audit log allows.
+const eraseAuditEventQuery = "UPDATE audit_events SET actor = $1, diff = $2, client_ip = $3, erased_at = $4 WHERE id = $5"
+
+type auditEventModel struct {
+	id        int
+	actor     string
+	action    string
+	target    string
+	userID    *int
+	diff      string
+	requestID string
+	clientIP  string
+	createdAt time.Time
+	digest    string
+	erasedAt  *time.Time
+	prevHash  string
+	hash      string
+}
+
+func (e auditEventModel) ToDomain() *domain.AuditEvent {
+	return &domain.AuditEvent{
+		ID:             e.id,
+		Actor:          e.actor,
+		Action:         e.action,
+		Target:         e.target,
+		UserID:         e.userID,
+		Diff:           []byte(e.diff),
+		RequestID:      e.requestID,
+		ClientIP:       e.clientIP,
+		CreatedAt:      e.createdAt,
+		PersonalDigest: e.digest,
+		ErasedAt:       e.erasedAt,
+		PrevHash:       e.prevHash,
+		Hash:           e.hash,
+	}
+}
+
+func (e *auditEventModel) scanTargets() []interface{} {
+	return []interface{}{&e.id, &e.actor, &e.action, &e.target, &e.userID, &e.diff, &e.requestID, &e.clientIP, &e.createdAt, &e.digest, &e.erasedAt, &e.prevHash, &e.hash}
+}
+
+// auditEventInsertArgs are the arguments of insertAuditEventQuery
+func auditEventInsertArgs(event domain.AuditEvent) []interface{} {
+	return []interface{}{event.Actor, event.Action, event.Target, event.UserID, string(event.Diff), event.RequestID, event.ClientIP, event.CreatedAt, event.PersonalDigest, event.PrevHash, event.Hash}
+}
+
+// ListAuditEventsParams pages through the audit log, oldest first. Empty
+// filters match every event.
+type ListAuditEventsParams struct {
+	Actor  string `json:"actor"`
+	Target string `json:"target"`
+	UserID *int   `json:"user_id"`
+	// AfterID only lists the events written after the event with this ID
+	AfterID int `json:"after_id"`
+	Limit   int `json:"limit"`
+}
+
+const listAuditEventsWhere = "($1 = '' OR actor = $1) AND ($2 = '' OR target = $2) AND ($3::INTEGER IS NULL OR user_id = $3) AND id > $4"
+
+// change is a write that the audit log records in the transaction of the write
+type change struct {
+	action string
+	target string
+	// userID is the user the changed row belongs to, if any
+	userID *int
+	// before and after are the row before and after the change, nil when it
+	// didn't exist
+	before interface{}
+	after  interface{}
+	// redact hides every value of the change, for changes that remove
+	// personal data which the log must not keep
+	redact bool
+}
+
+func userChange(action string, before, after *domain.User) change {
+	userID := 0
+	if after != nil {
+		userID = after.ID
+	} else if before != nil {
+		userID = before.ID
+	}
+	return change{
+		action: action,
+		target: "user:" + strconv.Itoa(userID),
+		userID: &userID,
+		before: before,
+		after:  after,
+	}
+}
+
+// purgeChange records the purge of a deleted user. The values of the user are
+// redacted, the log only keeps that it existed.
+func purgeChange(user domain.User) change {
+	c := userChange(domain.AuditActionUserPurge, &user, nil)
+	c.redact = true
+	return c
+}
+
+// eraseChange records the erasure of a user, with the erased values redacted
+func eraseChange(before, after domain.User) change {
+	c := userChange(domain.AuditActionUserErase, &before, &after)
+	c.redact = true
+	return c
+}
+
+func apiKeyChange(action string, before, after *domain.APIKey) change {
+	key := after
+	if key == nil {
+		key = before
+	}
+	userID := key.UserID
+	return change{
+		action: action,
+		target: "api_key:" + strconv.Itoa(key.ID),
+		userID: &userID,
+		before: before,
+		after:  after,
+	}
+}
+
+func oauthClientChange(action string, before, after *domain.OAuthClient) change {
+	client := after
+	if client == nil {
+		client = before
+	}
+	return change{
+		action: action,
+		target: "oauth_client:" + client.ClientID,
+		before: before,
+		after:  after,
+	}
+}
+
+func sessionChange(action string, before, after *domain.Session) change {
+	userID := after.UserID
+	return change{
+		action: action,
+		target: "session:" + after.ID,
+		userID: &userID,
+		before: before,
+		after:  after,
+	}
+}
+
+// newAuditEvents builds the audit events of changes made by the request of
+// ctx, chained after the event with hash prevHash
+func newAuditEvents(ctx context.Context, prevHash string, changes []change, now time.Time) ([]domain.AuditEvent, error) {
+	info := audit.FromContext(ctx)
+	events := make([]domain.AuditEvent, 0, len(changes))
+	for _, c := range changes {
+		diff, err := audit.Diff(c.before, c.after, c.redact)
+		if err != nil {
+			return nil, err
+		}
+		event := domain.AuditEvent{
+			Actor:     info.Actor,
+			Action:    c.action,
+			Target:    c.target,
+			UserID:    c.userID,
+			Diff:      diff,
+			RequestID: info.RequestID,
+			ClientIP:  info.ClientIP,
+			CreatedAt: now.UTC().Truncate(audit.TimePrecision),
+			PrevHash:  prevHash,
+		}
+		event.PersonalDigest = audit.PersonalDigest(event)
+		event.Hash = audit.Hash(event)
+		prevHash = event.Hash
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// eraseAuditEvents scrubs the personal data of an erased user, whose email was
+// email, from the audit log. Older emails of the user are found in the diffs
+// of its events. listByUser lists the audit events of the user, listByActor
+// the events with text in their actor, and update writes back an erased event.
+func eraseAuditEvents(userID int, email string, now time.Time, listByUser func() ([]domain.AuditEvent, error), listByActor func(text string) ([]domain.AuditEvent, error), update func(event domain.AuditEvent) error) error {
+	events, err := listByUser()
+	if err != nil {
+		return fmt.Errorf("failed to list audit events of user %d: %w", userID, err)
+	}
+	listed := make(map[int]bool, len(events))
+	for _, event := range events {
+		listed[event.ID] = true
+	}
+
+	emails := audit.Emails(events)
+	if !slices.Contains(emails, email) {
+		emails = append(emails, email)
+	}
+	for _, email := range emails {
+		byActor, err := listByActor(email)
+		if err != nil {
+			return fmt.Errorf("failed to list audit events of user %d: %w", userID, err)
+		}
+		for _, event := range byActor {
+			if !listed[event.ID] {
+				listed[event.ID] = true
+				events = append(events, event)
+			}
+		}
+	}
+
+	for _, event := range events {
+		erased, ok, err := audit.Erase(event, userID, emails, domain.ErasedUserEmail(userID), now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := update(erased); err != nil {
+			return fmt.Errorf("failed to erase audit event %d: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// recordChanges appends the audit events of changes in tx, which must commit
+// the changes themselves, and writes the user events they emit to the outbox
+func (p *postgres) recordChanges(ctx context.Context, tx pgx.Tx, changes ...change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockID); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", dbError(err))
+	}
+
+	var prevHash string
+	err := tx.QueryRow(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to find last audit event: %w", dbError(err))
+	}
+
+	now := time.Now()
+	events, err := newAuditEvents(ctx, prevHash, changes, now)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if _, err := tx.Exec(ctx, insertAuditEventQuery, auditEventInsertArgs(event)...); err != nil {
+			return fmt.Errorf("failed to insert audit event: %w", dbError(err))
+		}
+	}
+	return p.insertUserEvents(ctx, tx, changes, now)
+}
+
+// eraseUserAuditEvents scrubs the personal data of an erased user from the
+// audit log in tx
+func (p *postgres) eraseUserAuditEvents(ctx context.Context, tx pgx.Tx, userID int, email string, now time.Time) error {
+	list := func(where string, arg interface{}) ([]domain.AuditEvent, error) {
+		rows, err := tx.Query(ctx, "SELECT "+auditEventColumns+" FROM audit_events WHERE "+where+" ORDER BY id", arg)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		defer rows.Close()
+
+		var events []domain.AuditEvent
+		for rows.Next() {
+			var event auditEventModel
+			if err := rows.Scan(event.scanTargets()...); err != nil {
+				return nil, err
+			}
+			events = append(events, *event.ToDomain())
+		}
+		return events, dbError(rows.Err())
+	}
+	return eraseAuditEvents(userID, email, now,
+		func() ([]domain.AuditEvent, error) { return list("user_id = $1", userID) },
+		func(text string) ([]domain.AuditEvent, error) { return list("strpos(actor, $1) > 0", text) },
+		func(event domain.AuditEvent) error {
+			_, err := tx.Exec(ctx, eraseAuditEventQuery, event.Actor, string(event.Diff), event.ClientIP, event.ErasedAt, event.ID)
+			return dbError(err)
+		},
+	)
+}
+
+// ListAuditEvents returns a page of the audit log, oldest first
+func (p *postgres) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]domain.AuditEvent, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListAuditEvents")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListAuditEvents"),
+		attribute.Int("list.after_id", params.AfterID),
+		attribute.Int("list.limit", params.Limit),
+	)
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events WHERE " + listAuditEventsWhere + " ORDER BY id LIMIT $5"
+	rows, err := p.conn.Query(ctx, query, params.Actor, params.Target, params.UserID, params.AfterID, params.Limit)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list audit events: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list audit events: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var event auditEventModel
+		if err := rows.Scan(event.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, *event.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list audit events: %w", dbError(err))
+	}
+	return events, nil
+}
+
+// recordChanges appends the audit events of changes in tx and writes the user
+// events they emit to the outbox. SQLite write transactions hold the database
+// lock, so the chain can't fork.
+func (s *sqlite) recordChanges(ctx context.Context, tx sqliteQuerier, changes ...change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	var prevHash string
+	err := sqliteQueryRow(ctx, tx, []interface{}{&prevHash}, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1")
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("failed to find last audit event: %w", err)
+	}
+
+	now := time.Now()
+	events, err := newAuditEvents(ctx, prevHash, changes, now)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if _, err := sqliteExec(ctx, tx, insertAuditEventQuery, auditEventInsertArgs(event)...); err != nil {
+			return fmt.Errorf("failed to insert audit event: %w", err)
+		}
+	}
+	return s.insertUserEvents(ctx, tx, changes, now)
+}
+
+// eraseUserAuditEvents scrubs the personal data of an erased user from the
+// audit log in tx
+func (s *sqlite) eraseUserAuditEvents(ctx context.Context, tx sqliteQuerier, userID int, email string, now time.Time) error {
+	list := func(where string, arg interface{}) ([]domain.AuditEvent, error) {
+		var events []domain.AuditEvent
+		err := sqliteQuery(ctx, tx, func() ([]interface{}, func()) {
+			var event auditEventModel
+			return event.scanTargets(), func() { events = append(events, *event.ToDomain()) }
+		}, "SELECT "+auditEventColumns+" FROM audit_events WHERE "+where+" ORDER BY id", arg)
+		return events, err
+	}
+	return eraseAuditEvents(userID, email, now,
+		func() ([]domain.AuditEvent, error) { return list("user_id = $1", userID) },
+		func(text string) ([]domain.AuditEvent, error) { return list("instr(actor, $1) > 0", text) },
+		func(event domain.AuditEvent) error {
+			_, err := sqliteExec(ctx, tx, eraseAuditEventQuery, event.Actor, string(event.Diff), event.ClientIP, event.ErasedAt, event.ID)
+			return err
+		},
+	)
+}
+
+func (s *sqlite) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]domain.AuditEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAuditEvents")
+	defer span.End()
+
+	// Like listAuditEventsWhere, without the Postgres cast
+	where := "($1 = '' OR actor = $1) AND ($2 = '' OR target = $2) AND ($3 IS NULL OR user_id = $3) AND id > $4"
+	var events []domain.AuditEvent
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var event auditEventModel
+		return event.scanTargets(), func() { events = append(events, *event.ToDomain()) }
+	}, "SELECT "+auditEventColumns+" FROM audit_events WHERE "+where+" ORDER BY id LIMIT $5", params.Actor, params.Target, params.UserID, params.AfterID, params.Limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
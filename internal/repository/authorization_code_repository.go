@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const authorizationCodeColumns = "id, code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at, used_at, created_at"
+
+type authorizationCodeModel struct {
+	id            int
+	codeHash      string
+	clientID      string
+	userID        int
+	redirectURI   string
+	scopes        []string
+	nonce         string
+	codeChallenge string
+	authTime      time.Time
+	expiresAt     time.Time
+	usedAt        *time.Time
+	createdAt     time.Time
+}
+
+func (c authorizationCodeModel) ToDomain() *domain.AuthorizationCode {
+	return &domain.AuthorizationCode{
+		ID:            c.id,
+		CodeHash:      c.codeHash,
+		ClientID:      c.clientID,
+		UserID:        c.userID,
+		RedirectURI:   c.redirectURI,
+		Scopes:        c.scopes,
+		Nonce:         c.nonce,
+		CodeChallenge: c.codeChallenge,
+		AuthTime:      c.authTime,
+		ExpiresAt:     c.expiresAt,
+		UsedAt:        c.usedAt,
+		CreatedAt:     c.createdAt,
+	}
+}
+
+func (c *authorizationCodeModel) scanTargets() []interface{} {
+	return []interface{}{&c.id, &c.codeHash, &c.clientID, &c.userID, &c.redirectURI, &c.scopes, &c.nonce, &c.codeChallenge, &c.authTime, &c.expiresAt, &c.usedAt, &c.createdAt}
+}
+
+type CreateAuthorizationCodeParams struct {
+	CodeHash      string    `json:"code_hash"`
+	ClientID      string    `json:"client_id"`
+	UserID        int       `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"code_challenge"`
+	AuthTime      time.Time `json:"auth_time"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (p *postgres) CreateAuthorizationCode(ctx context.Context, params CreateAuthorizationCodeParams) (*domain.AuthorizationCode, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateAuthorizationCode")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateAuthorizationCode"),
+		attribute.String("oauth_client.client_id", params.ClientID),
+		attribute.Int("user.id", params.UserID),
+	)
+
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+	var id int
+	err := p.conn.QueryRow(ctx, insertQuery, params.CodeHash, params.ClientID, params.UserID, params.RedirectURI, params.Scopes, params.Nonce, params.CodeChallenge, params.AuthTime, params.ExpiresAt, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert authorization code into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert authorization code into database: %w", dbError(err))
+	}
+
+	return &domain.AuthorizationCode{
+		ID:            id,
+		CodeHash:      params.CodeHash,
+		ClientID:      params.ClientID,
+		UserID:        params.UserID,
+		RedirectURI:   params.RedirectURI,
+		Scopes:        params.Scopes,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		AuthTime:      params.AuthTime,
+		ExpiresAt:     params.ExpiresAt,
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+// ConsumeAuthorizationCode marks an unused code as used and returns it, so a
+// code can be redeemed at most once even with concurrent requests.
+func (p *postgres) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ConsumeAuthorizationCode")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "ConsumeAuthorizationCode"))
+
+	query := "UPDATE oauth_authorization_codes SET used_at = $1 WHERE code_hash = $2 AND used_at IS NULL RETURNING " + authorizationCodeColumns
+	var code authorizationCodeModel
+
+	err := p.conn.QueryRow(ctx, query, time.Now(), codeHash).Scan(code.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "authorization code not found or already used: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("authorization code not found or already used: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to consume authorization code: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to consume authorization code: %w", dbError(err))
+	}
+	return code.ToDomain(), nil
+}
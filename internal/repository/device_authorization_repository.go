@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const deviceAuthorizationColumns = "id, device_code_hash, user_code, client_id, scopes, status, user_id, interval, last_polled_at, expires_at, created_at"
+
+type deviceAuthorizationModel struct {
+	id             int
+	deviceCodeHash string
+	userCode       string
+	clientID       string
+	scopes         []string
+	status         string
+	userID         *int
+	interval       int
+	lastPolledAt   *time.Time
+	expiresAt      time.Time
+	createdAt      time.Time
+}
+
+func (d deviceAuthorizationModel) ToDomain() *domain.DeviceAuthorization {
+	return &domain.DeviceAuthorization{
+		ID:             d.id,
+		DeviceCodeHash: d.deviceCodeHash,
+		UserCode:       d.userCode,
+		ClientID:       d.clientID,
+		Scopes:         d.scopes,
+		Status:         d.status,
+		UserID:         d.userID,
+		Interval:       d.interval,
+		LastPolledAt:   d.lastPolledAt,
+		ExpiresAt:      d.expiresAt,
+		CreatedAt:      d.createdAt,
+	}
+}
+
+func (d *deviceAuthorizationModel) scanTargets() []interface{} {
+	return []interface{}{&d.id, &d.deviceCodeHash, &d.userCode, &d.clientID, &d.scopes, &d.status, &d.userID, &d.interval, &d.lastPolledAt, &d.expiresAt, &d.createdAt}
+}
+
+type CreateDeviceAuthorizationParams struct {
+	DeviceCodeHash string    `json:"device_code_hash"`
+	UserCode       string    `json:"user_code"`
+	ClientID       string    `json:"client_id"`
+	Scopes         []string  `json:"scopes"`
+	Interval       int       `json:"interval"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (p *postgres) CreateDeviceAuthorization(ctx context.Context, params CreateDeviceAuthorizationParams) (*domain.DeviceAuthorization, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateDeviceAuthorization")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateDeviceAuthorization"),
+		attribute.String("oauth_client.client_id", params.ClientID),
+	)
+
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO oauth_device_authorizations (device_code_hash, user_code, client_id, scopes, status, interval, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	var id int
+	err := p.conn.QueryRow(ctx, insertQuery, params.DeviceCodeHash, params.UserCode, params.ClientID, params.Scopes, domain.DeviceAuthorizationPending, params.Interval, params.ExpiresAt, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert device authorization into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert device authorization into database: %w", dbError(err))
+	}
+
+	return &domain.DeviceAuthorization{
+		ID:             id,
+		DeviceCodeHash: params.DeviceCodeHash,
+		UserCode:       params.UserCode,
+		ClientID:       params.ClientID,
+		Scopes:         params.Scopes,
+		Status:         domain.DeviceAuthorizationPending,
+		Interval:       params.Interval,
+		ExpiresAt:      params.ExpiresAt,
+		CreatedAt:      createdAt,
+	}, nil
+}
+
+// CompleteDeviceAuthorization approves or denies a pending, unexpired device
+// authorization on behalf of a user.
+func (p *postgres) CompleteDeviceAuthorization(ctx context.Context, userCode string, userID int, status string) (*domain.DeviceAuthorization, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CompleteDeviceAuthorization")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CompleteDeviceAuthorization"),
+		attribute.Int("user.id", userID),
+		attribute.String("device_authorization.status", status),
+	)
+
+	query := "UPDATE oauth_device_authorizations SET status = $1, user_id = $2 WHERE user_code = $3 AND status = $4 AND expires_at > $5 RETURNING " + deviceAuthorizationColumns
+	var authorization deviceAuthorizationModel
+
+	err := p.conn.QueryRow(ctx, query, status, userID, userCode, domain.DeviceAuthorizationPending, time.Now()).Scan(authorization.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "device authorization not found, expired or already completed: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("device authorization not found, expired or already completed: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to complete device authorization: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to complete device authorization: %w", dbError(err))
+	}
+	return authorization.ToDomain(), nil
+}
+
+// PollDeviceAuthorization records a poll of the device and returns the
+// authorization with the time of the poll before it, so callers can tell
+// whether the device polls faster than its interval.
+func (p *postgres) PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, polledAt time.Time) (*domain.DeviceAuthorization, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "PollDeviceAuthorization")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "PollDeviceAuthorization"))
+
+	query := `UPDATE oauth_device_authorizations d SET last_polled_at = $1
+		FROM (SELECT id, last_polled_at FROM oauth_device_authorizations WHERE device_code_hash = $2 FOR UPDATE) previous
+		WHERE d.id = previous.id
+		RETURNING d.id, d.device_code_hash, d.user_code, d.client_id, d.scopes, d.status, d.user_id, d.interval, previous.last_polled_at, d.expires_at, d.created_at`
+	var authorization deviceAuthorizationModel
+
+	err := p.conn.QueryRow(ctx, query, polledAt, deviceCodeHash).Scan(authorization.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "device authorization not found: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("device authorization not found: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to poll device authorization: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to poll device authorization: %w", dbError(err))
+	}
+	return authorization.ToDomain(), nil
+}
+
+func (p *postgres) SlowDownDeviceAuthorization(ctx context.Context, id int, interval int) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "SlowDownDeviceAuthorization")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "SlowDownDeviceAuthorization"),
+		attribute.Int("device_authorization.interval", interval),
+	)
+
+	_, err := p.conn.Exec(ctx, "UPDATE oauth_device_authorizations SET interval = $1 WHERE id = $2", interval, id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to update device authorization interval: %v", err)
+		span.RecordError(err)
+
+		return fmt.Errorf("failed to update device authorization interval: %w", dbError(err))
+	}
+	return nil
+}
+
+// ConsumeDeviceAuthorization marks an approved authorization as consumed and
+// returns it, so a device code is exchanged for tokens at most once.
+func (p *postgres) ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*domain.DeviceAuthorization, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ConsumeDeviceAuthorization")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "ConsumeDeviceAuthorization"))
+
+	query := "UPDATE oauth_device_authorizations SET status = $1 WHERE device_code_hash = $2 AND status = $3 RETURNING " + deviceAuthorizationColumns
+	var authorization deviceAuthorizationModel
+
+	err := p.conn.QueryRow(ctx, query, domain.DeviceAuthorizationConsumed, deviceCodeHash, domain.DeviceAuthorizationApproved).Scan(authorization.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "device authorization not approved or already used: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("device authorization not approved or already used: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to consume device authorization: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to consume device authorization: %w", dbError(err))
+	}
+	return authorization.ToDomain(), nil
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const erasureRequestColumns = "id, user_id, requested_by, status, created_at, completed_at"
+
+type erasureRequestModel struct {
+	id          int
+	userID      int
+	requestedBy int
+	status      string
+	createdAt   time.Time
+	completedAt *time.Time
+}
+
+func (r erasureRequestModel) ToDomain() *domain.ErasureRequest {
+	return &domain.ErasureRequest{
+		ID:          r.id,
+		UserID:      r.userID,
+		RequestedBy: r.requestedBy,
+		Status:      r.status,
+		CreatedAt:   r.createdAt,
+		CompletedAt: r.completedAt,
+	}
+}
+
+func (r *erasureRequestModel) scanTargets() []interface{} {
+	return []interface{}{&r.id, &r.userID, &r.requestedBy, &r.status, &r.createdAt, &r.completedAt}
+}
+
+type ListErasureRequestsParams struct {
+	// Status only lists the requests with this status when set
+	Status string `json:"status"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+type erasureStatement struct {
+	query string
+	args  []interface{}
+}
+
+// eraseUserStatements anonymize the personal data of a user whose email was
+// email, for both the Postgres and SQLite repositories. Tokens and links that
+// could sign the user in are revoked or dropped.
+func eraseUserStatements(userID int, email string, now time.Time) []erasureStatement {
+	erasedEmail := domain.ErasedUserEmail(userID)
+	return []erasureStatement{
+		{"UPDATE users SET name = $1, email = $2, hashed_password = '', external_id = '', active = FALSE, updated_at = $3, version = version + 1 WHERE id = $4", []interface{}{domain.ErasedUserName, erasedEmail, now, userID}},
+		// Failed logins with the email of the user don't reference it
+		{"UPDATE login_events SET email = $1, ip_address = '', user_agent = '' WHERE user_id = $2 OR (user_id IS NULL AND email = $3)", []interface{}{erasedEmail, userID, email}},
+		{"UPDATE sessions SET ip_address = '', user_agent = '', revoked_at = COALESCE(revoked_at, $1) WHERE user_id = $2", []interface{}{now, userID}},
+		{"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE user_id = $2", []interface{}{now, userID}},
+		{"DELETE FROM user_identities WHERE user_id = $1", []interface{}{userID}},
+		{"DELETE FROM magic_links WHERE user_id = $1", []interface{}{userID}},
+		{"DELETE FROM password_history WHERE user_id = $1", []interface{}{userID}},
+	}
+}
+
+// CreateErasureRequest records a pending erasure of a user. A user has at most
+// one pending request, which is returned when there is one already.
+func (p *postgres) CreateErasureRequest(ctx context.Context, userID int, requestedBy int) (*domain.ErasureRequest, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateErasureRequest")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateErasureRequest"),
+		attribute.Int("user.id", userID),
+	)
+
+	query := `INSERT INTO erasure_requests (user_id, requested_by, status, created_at)
+		SELECT id, $2, $3, $4 FROM users WHERE id = $1
+		ON CONFLICT (user_id) WHERE status = 'pending' DO UPDATE SET status = erasure_requests.status
+		RETURNING ` + erasureRequestColumns
+	var request erasureRequestModel
+	err := p.conn.QueryRow(ctx, query, userID, requestedBy, domain.ErasureStatusPending, time.Now()).Scan(request.scanTargets()...)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert erasure request into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create erasure request of user %d: %w", userID, dbError(err))
+	}
+	return request.ToDomain(), nil
+}
+
+// EraseUser anonymizes the personal data of the user of a pending erasure
+// request and completes the request, in one transaction
+func (p *postgres) EraseUser(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "EraseUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "EraseUser"),
+		attribute.Int("erasure_request.id", requestID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	var request erasureRequestModel
+	completeQuery := "UPDATE erasure_requests SET status = $1, completed_at = $2 WHERE id = $3 AND status = $4 RETURNING " + erasureRequestColumns
+	err = tx.QueryRow(ctx, completeQuery, domain.ErasureStatusCompleted, now, requestID, domain.ErasureStatusPending).Scan(request.scanTargets()...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("pending erasure request %d not found: %w", requestID, dbError(err))
+	}
+
+	var before, after userModel
+	if err := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", request.userID).Scan(before.scanTargets()...); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("user %d of erasure request not found: %w", request.userID, dbError(err))
+	}
+	for _, stmt := range eraseUserStatements(request.userID, before.email, now) {
+		if _, err := tx.Exec(ctx, stmt.query, stmt.args...); err != nil {
+			logFromCtx.Errorf(ctx, "failed to erase user %d: %v", request.userID, err)
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to erase user %d: %w", request.userID, dbError(err))
+		}
+	}
+	if err := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", request.userID).Scan(after.scanTargets()...); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to erase user %d: %w", request.userID, dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, eraseChange(*before.ToDomain(), *after.ToDomain())); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to erase user %d: %w", request.userID, err)
+	}
+	// The erasure is recorded first, so the event of a user erasing itself
+	// is scrubbed too
+	if err := p.eraseUserAuditEvents(ctx, tx, request.userID, before.email, now); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to erase user %d: %w", request.userID, err)
+	}
+	if err := p.eraseUserEvents(ctx, tx, request.userID); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to erase user %d: %w", request.userID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to commit erasure of user %d: %w", request.userID, dbError(err))
+	}
+	span.SetAttributes(attribute.Int("user.id", request.userID))
+	return request.ToDomain(), nil
+}
+
+func (p *postgres) GetErasureRequest(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetErasureRequest")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "GetErasureRequest"),
+		attribute.Int("erasure_request.id", requestID),
+	)
+
+	var request erasureRequestModel
+	err := p.conn.QueryRow(ctx, "SELECT "+erasureRequestColumns+" FROM erasure_requests WHERE id = $1", requestID).Scan(request.scanTargets()...)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to find erasure request: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find erasure request %d: %w", requestID, dbError(err))
+	}
+	return request.ToDomain(), nil
+}
+
+// ListErasureRequests returns a page of erasure requests, the oldest first,
+// and the number of requests matching params
+func (p *postgres) ListErasureRequests(ctx context.Context, params ListErasureRequestsParams) ([]domain.ErasureRequest, int, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListErasureRequests")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListErasureRequests"),
+		attribute.String("erasure_request.status", params.Status),
+	)
+
+	where := "($1 = '' OR status = $1)"
+	var total int
+	if err := p.conn.QueryRow(ctx, "SELECT COUNT(*) FROM erasure_requests WHERE "+where, params.Status).Scan(&total); err != nil {
+		logFromCtx.Errorf(ctx, "failed to count erasure requests: %v", err)
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to count erasure requests: %w", dbError(err))
+	}
+
+	query := "SELECT " + erasureRequestColumns + " FROM erasure_requests WHERE " + where + " ORDER BY id LIMIT $2 OFFSET $3"
+	rows, err := p.conn.Query(ctx, query, params.Status, params.Limit, params.Offset)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list erasure requests: %v", err)
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list erasure requests: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var requests []domain.ErasureRequest
+	for rows.Next() {
+		var request erasureRequestModel
+		if err := rows.Scan(request.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, 0, fmt.Errorf("failed to scan erasure request: %w", err)
+		}
+		requests = append(requests, *request.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list erasure requests: %w", dbError(err))
+	}
+	return requests, total, nil
+}
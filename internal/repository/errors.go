@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Postgres error codes translated to sentinel errors
+const (
+	foreignKeyViolation   = "23503"
+	uniqueViolation       = "23505"
+	checkViolation        = "23514"
+	serializationFailure  = "40001"
+	deadlockDetected      = "40P01"
+	insufficientPrivilege = "42501"
+)
+
+// dbError wraps err in the sentinel error of the domain it stands for, keeping
+// err in the chain. Errors without one are returned as they are.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", domain.ErrNotFound, err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case uniqueViolation:
+		return fmt.Errorf("%w: %w", domain.ErrAlreadyExists, err)
+	case foreignKeyViolation, checkViolation, serializationFailure, deadlockDetected:
+		return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+	case insufficientPrivilege:
+		return fmt.Errorf("%w: %w", domain.ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// uniqueViolationError is the error of a write that breaks a unique
+// constraint in the stores that don't report Postgres errors
+func uniqueViolationError(constraint string) error {
+	return fmt.Errorf("%w: duplicate key value violates unique constraint %q", domain.ErrAlreadyExists, constraint)
+}
+
+// foreignKeyViolationError is the error of a write that breaks a foreign key
+// constraint in the stores that don't report Postgres errors
+func foreignKeyViolationError(constraint string) error {
+	return fmt.Errorf("%w: insert or update violates foreign key constraint %q", domain.ErrConflict, constraint)
+}
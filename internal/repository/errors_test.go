@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBError(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want error
+	}{
+		"no rows":                {err: pgx.ErrNoRows, want: domain.ErrNotFound},
+		"unique violation":       {err: &pgconn.PgError{Code: uniqueViolation}, want: domain.ErrAlreadyExists},
+		"foreign key violation":  {err: &pgconn.PgError{Code: foreignKeyViolation}, want: domain.ErrConflict},
+		"serialization failure":  {err: &pgconn.PgError{Code: serializationFailure}, want: domain.ErrConflict},
+		"insufficient privilege": {err: &pgconn.PgError{Code: insufficientPrivilege}, want: domain.ErrPermissionDenied},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := dbError(tc.err)
+			require.ErrorIs(t, err, tc.want)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	other := errors.New("connection refused")
+	require.Equal(t, other, dbError(other))
+	require.NoError(t, dbError(nil))
+}
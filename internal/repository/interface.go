@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/fibonachyy/sternx/internal/domain"
 )
@@ -9,15 +10,117 @@ import (
 type IRepository interface {
 	IMigrateTable
 	IUserRepository
+	IAPIKeyRepository
+	IOAuthClientRepository
+	IAuthorizationCodeRepository
+	IUserIdentityRepository
+	IDeviceAuthorizationRepository
+	IMagicLinkRepository
+	ISessionRepository
+	ILoginEventRepository
+	IPasswordHistoryRepository
+	IErasureRequestRepository
+	IAuditEventRepository
+	IOutboxRepository
+	IWebhookRepository
 }
 type IMigrateTable interface {
-	Migrate(path string) error
+	MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error)
+	MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error)
+	MigrateRedo(ctx context.Context, migrations []Migration) (*Migration, error)
+	MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error)
 }
 type IUserRepository interface {
 	CreateUser(ctx context.Context, params CreateUserParams) (*domain.User, error)
 	GetUserByEmail(ctx context.Context, userEmail string) (*domain.User, error)
 	GetUserByID(ctx context.Context, userID int) (*domain.User, error)
 	PartialUpdateUserByEmail(ctx context.Context, email string, updatedUser domain.User) (*domain.User, error)
-	DeleteUserByEmail(ctx context.Context, email string) error
+	DeleteUserByEmail(ctx context.Context, email string, expectedVersion int) error
 	AuthenticateUser(ctx context.Context, email, password string) (*domain.User, error)
+	UpdateUser(ctx context.Context, userID int, params UpdateUserParams) (*domain.User, error)
+	ListUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error)
+	RehashPassword(ctx context.Context, userID int, currentHash string, newHash string) error
+	RestoreUser(ctx context.Context, userID int) (*domain.User, error)
+	ListDeletedUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error)
+}
+type IAPIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*domain.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error)
+	ListAPIKeysByUserID(ctx context.Context, userID int) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int, keyID int) error
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+}
+type IOAuthClientRepository interface {
+	CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*domain.OAuthClient, error)
+	GetOAuthClientByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+}
+type IAuthorizationCodeRepository interface {
+	CreateAuthorizationCode(ctx context.Context, params CreateAuthorizationCodeParams) (*domain.AuthorizationCode, error)
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error)
+}
+type IUserIdentityRepository interface {
+	CreateUserIdentity(ctx context.Context, params CreateUserIdentityParams) (*domain.UserIdentity, error)
+	GetUserIdentity(ctx context.Context, provider string, subject string) (*domain.UserIdentity, error)
+	ListUserIdentitiesByUserID(ctx context.Context, userID int) ([]domain.UserIdentity, error)
+}
+type IDeviceAuthorizationRepository interface {
+	CreateDeviceAuthorization(ctx context.Context, params CreateDeviceAuthorizationParams) (*domain.DeviceAuthorization, error)
+	CompleteDeviceAuthorization(ctx context.Context, userCode string, userID int, status string) (*domain.DeviceAuthorization, error)
+	PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, polledAt time.Time) (*domain.DeviceAuthorization, error)
+	SlowDownDeviceAuthorization(ctx context.Context, id int, interval int) error
+	ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*domain.DeviceAuthorization, error)
+}
+type IMagicLinkRepository interface {
+	CreateMagicLink(ctx context.Context, params CreateMagicLinkParams) (*domain.MagicLink, error)
+	CountMagicLinksSince(ctx context.Context, email string, since time.Time) (int, error)
+	ConsumeMagicLink(ctx context.Context, tokenHash string, email string, maxAttempts int) (*domain.MagicLink, error)
+	RecordMagicLinkFailure(ctx context.Context, email string) error
+}
+type ISessionRepository interface {
+	CreateSession(ctx context.Context, params CreateSessionParams) (*domain.Session, error)
+	GetSession(ctx context.Context, sessionID string) (*domain.Session, error)
+	ListSessionsByUserID(ctx context.Context, userID int) ([]domain.Session, error)
+	ListSessionHistoryByUserID(ctx context.Context, userID int) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+}
+type ILoginEventRepository interface {
+	CreateLoginEvent(ctx context.Context, params CreateLoginEventParams) (*domain.LoginEvent, error)
+	ListLoginEventsByUserID(ctx context.Context, userID int, limit int) ([]domain.LoginEvent, error)
+}
+type IPasswordHistoryRepository interface {
+	AddPasswordHistory(ctx context.Context, userID int, hashedPassword string, keep int) error
+	ListPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error)
+}
+type IErasureRequestRepository interface {
+	CreateErasureRequest(ctx context.Context, userID int, requestedBy int) (*domain.ErasureRequest, error)
+	EraseUser(ctx context.Context, requestID int) (*domain.ErasureRequest, error)
+	GetErasureRequest(ctx context.Context, requestID int) (*domain.ErasureRequest, error)
+	ListErasureRequests(ctx context.Context, params ListErasureRequestsParams) ([]domain.ErasureRequest, int, error)
+}
+type IAuditEventRepository interface {
+	ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]domain.AuditEvent, error)
+}
+type IOutboxRepository interface {
+	ListPendingUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error)
+	ListUserEvents(ctx context.Context, afterID int, limit int) ([]domain.UserEvent, error)
+	LastUserEventID(ctx context.Context) (int, error)
+	MarkUserEventPublished(ctx context.Context, eventID int, publishedAt time.Time) error
+	MarkUserEventFailed(ctx context.Context, eventID int, reason string) error
+	AcquireOutboxLease(ctx context.Context, holder string, now time.Time, duration time.Duration) (bool, error)
+	DeletePublishedUserEvents(ctx context.Context, publishedBefore time.Time) (int, error)
+}
+type IWebhookRepository interface {
+	CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (*domain.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, subscriptionID int) (*domain.WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, subscriptionID int) error
+	CreateWebhookDelivery(ctx context.Context, params CreateWebhookDeliveryParams) error
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, claimFor time.Duration, limit int) ([]domain.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, params RecordWebhookAttemptParams) error
+	ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]domain.WebhookDelivery, error)
+	ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int) ([]domain.WebhookDeliveryAttempt, error)
+	ReplayWebhookDelivery(ctx context.Context, deliveryID int, now time.Time) (*domain.WebhookDelivery, error)
 }
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const loginEventColumns = "id, user_id, email, method, success, failure_reason, ip_address, user_agent, COALESCE(session_id::text, ''), created_at"
+
+type loginEventModel struct {
+	id            int
+	userID        *int
+	email         string
+	method        string
+	success       bool
+	failureReason string
+	ipAddress     string
+	userAgent     string
+	sessionID     string
+	createdAt     time.Time
+}
+
+func (e loginEventModel) ToDomain() *domain.LoginEvent {
+	return &domain.LoginEvent{
+		ID:            e.id,
+		UserID:        e.userID,
+		Email:         e.email,
+		Method:        e.method,
+		Success:       e.success,
+		FailureReason: e.failureReason,
+		IPAddress:     e.ipAddress,
+		UserAgent:     e.userAgent,
+		SessionID:     e.sessionID,
+		CreatedAt:     e.createdAt,
+	}
+}
+
+func (e *loginEventModel) scanTargets() []interface{} {
+	return []interface{}{&e.id, &e.userID, &e.email, &e.method, &e.success, &e.failureReason, &e.ipAddress, &e.userAgent, &e.sessionID, &e.createdAt}
+}
+
+type CreateLoginEventParams struct {
+	UserID        *int   `json:"user_id"`
+	Email         string `json:"email"`
+	Method        string `json:"method"`
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failure_reason"`
+	IPAddress     string `json:"ip_address"`
+	UserAgent     string `json:"user_agent"`
+	// SessionID is empty for failed logins
+	SessionID string `json:"session_id"`
+}
+
+func (p *postgres) CreateLoginEvent(ctx context.Context, params CreateLoginEventParams) (*domain.LoginEvent, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateLoginEvent")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateLoginEvent"),
+		attribute.String("login_event.method", params.Method),
+		attribute.Bool("login_event.success", params.Success),
+	)
+
+	var sessionID *string
+	if params.SessionID != "" {
+		sessionID = &params.SessionID
+	}
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO login_events (user_id, email, method, success, failure_reason, ip_address, user_agent, session_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
+	var id int
+	err := p.conn.QueryRow(ctx, insertQuery, params.UserID, params.Email, params.Method, params.Success, params.FailureReason, params.IPAddress, params.UserAgent, sessionID, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert login event into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert login event into database: %w", dbError(err))
+	}
+
+	return &domain.LoginEvent{
+		ID:            id,
+		UserID:        params.UserID,
+		Email:         params.Email,
+		Method:        params.Method,
+		Success:       params.Success,
+		FailureReason: params.FailureReason,
+		IPAddress:     params.IPAddress,
+		UserAgent:     params.UserAgent,
+		SessionID:     params.SessionID,
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+// ListLoginEventsByUserID returns the latest login events of a user, newest
+// first. A negative limit returns all of them.
+func (p *postgres) ListLoginEventsByUserID(ctx context.Context, userID int, limit int) ([]domain.LoginEvent, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListLoginEventsByUserID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListLoginEventsByUserID"),
+		attribute.Int("user.id", userID),
+	)
+
+	var limitArg interface{} = limit
+	if limit < 0 {
+		limitArg = nil // LIMIT NULL doesn't limit
+	}
+	query := "SELECT " + loginEventColumns + " FROM login_events WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2"
+	rows, err := p.conn.Query(ctx, query, userID, limitArg)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list login events: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list login events: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var events []domain.LoginEvent
+	for rows.Next() {
+		var event loginEventModel
+		if err := rows.Scan(event.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan login event: %w", err)
+		}
+		events = append(events, *event.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list login events: %w", dbError(err))
+	}
+	span.SetAttributes(attribute.Int("login_event.count", len(events)))
+
+	return events, nil
+}
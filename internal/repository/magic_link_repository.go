@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const magicLinkColumns = "id, token_hash, user_id, email, attempts, expires_at, used_at, created_at"
+
+type magicLinkModel struct {
+	id        int
+	tokenHash string
+	userID    int
+	email     string
+	attempts  int
+	expiresAt time.Time
+	usedAt    *time.Time
+	createdAt time.Time
+}
+
+func (m magicLinkModel) ToDomain() *domain.MagicLink {
+	return &domain.MagicLink{
+		ID:        m.id,
+		TokenHash: m.tokenHash,
+		UserID:    m.userID,
+		Email:     m.email,
+		Attempts:  m.attempts,
+		ExpiresAt: m.expiresAt,
+		UsedAt:    m.usedAt,
+		CreatedAt: m.createdAt,
+	}
+}
+
+func (m *magicLinkModel) scanTargets() []interface{} {
+	return []interface{}{&m.id, &m.tokenHash, &m.userID, &m.email, &m.attempts, &m.expiresAt, &m.usedAt, &m.createdAt}
+}
+
+type CreateMagicLinkParams struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (p *postgres) CreateMagicLink(ctx context.Context, params CreateMagicLinkParams) (*domain.MagicLink, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateMagicLink")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateMagicLink"),
+		attribute.Int("user.id", params.UserID),
+	)
+
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO magic_links (token_hash, user_id, email, expires_at, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := p.conn.QueryRow(ctx, insertQuery, params.TokenHash, params.UserID, params.Email, params.ExpiresAt, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert magic link into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert magic link into database: %w", dbError(err))
+	}
+
+	return &domain.MagicLink{
+		ID:        id,
+		TokenHash: params.TokenHash,
+		UserID:    params.UserID,
+		Email:     params.Email,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// CountMagicLinksSince returns how many links were requested for an email
+// since the given time, to rate limit requests.
+func (p *postgres) CountMagicLinksSince(ctx context.Context, email string, since time.Time) (int, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CountMagicLinksSince")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "CountMagicLinksSince"))
+
+	var count int
+	err := p.conn.QueryRow(ctx, "SELECT COUNT(*) FROM magic_links WHERE LOWER(email) = LOWER($1) AND created_at > $2", email, since).Scan(&count)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to count magic links: %v", err)
+		span.RecordError(err)
+
+		return 0, fmt.Errorf("failed to count magic links: %w", dbError(err))
+	}
+	return count, nil
+}
+
+// ConsumeMagicLink marks an unused, unexpired link requested for the email as
+// used and returns it, so a link signs a user in at most once. Links that saw
+// maxAttempts failed redemptions can't be used anymore.
+func (p *postgres) ConsumeMagicLink(ctx context.Context, tokenHash string, email string, maxAttempts int) (*domain.MagicLink, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ConsumeMagicLink")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "ConsumeMagicLink"))
+
+	query := `UPDATE magic_links SET used_at = $1
+		WHERE token_hash = $2 AND LOWER(email) = LOWER($3) AND used_at IS NULL AND expires_at > $1 AND attempts < $4
+		RETURNING ` + magicLinkColumns
+	var link magicLinkModel
+
+	err := p.conn.QueryRow(ctx, query, time.Now(), tokenHash, email, maxAttempts).Scan(link.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "magic link not found, expired or already used: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("magic link not found, expired or already used: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to consume magic link: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to consume magic link: %w", dbError(err))
+	}
+	return link.ToDomain(), nil
+}
+
+// RecordMagicLinkFailure counts a failed redemption against every pending link
+// of the email, so guessing tokens burns the links instead of finding one.
+func (p *postgres) RecordMagicLinkFailure(ctx context.Context, email string) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RecordMagicLinkFailure")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "RecordMagicLinkFailure"))
+
+	_, err := p.conn.Exec(ctx, "UPDATE magic_links SET attempts = attempts + 1 WHERE LOWER(email) = LOWER($1) AND used_at IS NULL AND expires_at > $2", email, time.Now())
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to record magic link failure: %v", err)
+		span.RecordError(err)
+
+		return fmt.Errorf("failed to record magic link failure: %w", dbError(err))
+	}
+	return nil
+}
@@ -0,0 +1,1615 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memory is an IRepository kept in process memory. It has the semantics of
+// the Postgres repository, including its constraints and errors, which makes
+// it suited for tests and local demos. All data is lost on exit.
+type memory struct {
+	mu sync.RWMutex
+
+	users                []domain.User
+	apiKeys              []domain.APIKey
+	oauthClients         []domain.OAuthClient
+	authorizationCodes   []domain.AuthorizationCode
+	userIdentities       []domain.UserIdentity
+	deviceAuthorizations []domain.DeviceAuthorization
+	magicLinks           []domain.MagicLink
+	sessions             []domain.Session
+	loginEvents          []domain.LoginEvent
+	passwordHistory      []passwordHistoryEntry
+	erasureRequests      []domain.ErasureRequest
+	auditEvents          []domain.AuditEvent
+	outboxEvents         []outboxEntry
+	outboxLease          outboxLease
+
+	webhookSubscriptions    []domain.WebhookSubscription
+	webhookDeliveries       []domain.WebhookDelivery
+	webhookDeliveryAttempts []domain.WebhookDeliveryAttempt
+
+	// lastIDs holds the last serial ID handed out per table
+	lastIDs map[string]int
+}
+
+type outboxEntry struct {
+	event       domain.UserEvent
+	attempts    int
+	lastError   string
+	publishedAt *time.Time
+}
+
+type outboxLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+type passwordHistoryEntry struct {
+	id             int
+	userID         int
+	hashedPassword string
+	createdAt      time.Time
+}
+
+// NewMemory returns an empty in-memory repository that is safe for concurrent use
+func NewMemory() IRepository {
+	return &memory{lastIDs: make(map[string]int)}
+}
+
+func (m *memory) nextID(table string) int {
+	m.lastIDs[table]++
+	return m.lastIDs[table]
+}
+
+// The memory store has no schema, so there is nothing to migrate
+
+func (m *memory) MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return nil, nil
+}
+
+func (m *memory) MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return nil, nil
+}
+
+func (m *memory) MigrateRedo(ctx context.Context, migrations []Migration) (*Migration, error) {
+	return nil, nil
+}
+
+func (m *memory) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	return nil, nil
+}
+
+func (m *memory) userIndexByID(userID int) int {
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) userIndexByEmail(email string) int {
+	for i := range m.users {
+		if m.users[i].Email == email {
+			return i
+		}
+	}
+	return -1
+}
+
+// liveUserIndexByID is userIndexByID for users that aren't soft deleted. The
+// plain lookups stand for constraints, which deleted users still hold.
+func (m *memory) liveUserIndexByID(userID int) int {
+	if i := m.userIndexByID(userID); i >= 0 && m.users[i].DeletedAt == nil {
+		return i
+	}
+	return -1
+}
+
+func (m *memory) liveUserIndexByEmail(email string) int {
+	if i := m.userIndexByEmail(email); i >= 0 && m.users[i].DeletedAt == nil {
+		return i
+	}
+	return -1
+}
+
+// recordChanges appends the audit events of changes and writes the user
+// events they emit to the outbox. Callers record changes before applying
+// them, so a failure leaves the store as it was.
+func (m *memory) recordChanges(ctx context.Context, changes ...change) error {
+	prevHash := ""
+	if n := len(m.auditEvents); n > 0 {
+		prevHash = m.auditEvents[n-1].Hash
+	}
+	now := time.Now()
+	events, err := newAuditEvents(ctx, prevHash, changes, now)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		event.ID = m.nextID("audit_events")
+		m.auditEvents = append(m.auditEvents, event)
+	}
+	for _, event := range newUserEvents(ctx, changes, now) {
+		event.ID = m.nextID("outbox_events")
+		m.outboxEvents = append(m.outboxEvents, outboxEntry{event: event})
+	}
+	return nil
+}
+
+func (m *memory) oauthClientIndex(clientID string) int {
+	for i := range m.oauthClients {
+		if m.oauthClients[i].ClientID == clientID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) CreateUser(ctx context.Context, params CreateUserParams) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByEmail(params.Email) >= 0 {
+		return nil, fmt.Errorf("failed to insert user into database: %w", uniqueViolationError("users_email_key"))
+	}
+
+	now := time.Now()
+	user := domain.User{
+		ID:                m.nextID("users"),
+		Name:              params.Name,
+		Email:             params.Email,
+		Role:              params.Role,
+		HashedPassword:    params.HashedPassword,
+		PasswordChangedAt: now,
+		CreatedAt:         now,
+		ExternalID:        params.ExternalID,
+		Active:            true,
+		UpdatedAt:         now,
+		Version:           1,
+	}
+	if err := m.recordChanges(ctx, userChange(domain.AuditActionUserCreate, nil, &user)); err != nil {
+		return nil, err
+	}
+	m.users = append(m.users, user)
+	return &user, nil
+}
+
+func (m *memory) GetUserByEmail(ctx context.Context, userEmail string) (*domain.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.liveUserIndexByEmail(userEmail)
+	if i < 0 {
+		return nil, fmt.Errorf("user not found: %w", domain.ErrNotFound)
+	}
+	user := m.users[i]
+	return &user, nil
+}
+
+func (m *memory) GetUserByID(ctx context.Context, userID int) (*domain.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.liveUserIndexByID(userID)
+	if i < 0 {
+		return nil, fmt.Errorf("user not found: %w", domain.ErrNotFound)
+	}
+	user := m.users[i]
+	return &user, nil
+}
+
+func (m *memory) PartialUpdateUserByEmail(ctx context.Context, email string, updatedUser domain.User) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.liveUserIndexByEmail(email)
+	if i < 0 {
+		return nil, fmt.Errorf("failed to partially update user by Email %s: %w", email, domain.ErrNotFound)
+	}
+	if err := checkUserVersion(m.users[i].Version, updatedUser.Version); err != nil {
+		return nil, fmt.Errorf("failed to partially update user by Email %s: %w", email, err)
+	}
+	user := m.users[i]
+	user.Name = updatedUser.Name
+	user.UpdatedAt = time.Now()
+	user.Version++
+	if err := m.recordChanges(ctx, userChange(domain.AuditActionUserUpdate, &m.users[i], &user)); err != nil {
+		return nil, err
+	}
+	m.users[i] = user
+	return &user, nil
+}
+
+func (m *memory) DeleteUserByEmail(ctx context.Context, email string, expectedVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.liveUserIndexByEmail(email)
+	if i < 0 {
+		return fmt.Errorf("user with Email %s not found: %w", email, domain.ErrNotFound)
+	}
+	if err := checkUserVersion(m.users[i].Version, expectedVersion); err != nil {
+		return fmt.Errorf("failed to delete user by Email %s: %w", email, err)
+	}
+	now := time.Now()
+	user := m.users[i]
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	user.Version++
+	if err := m.recordChanges(ctx, userChange(domain.AuditActionUserDelete, &m.users[i], &user)); err != nil {
+		return err
+	}
+	m.users[i] = user
+	for j := range m.sessions {
+		if m.sessions[j].UserID == m.users[i].ID && m.sessions[j].RevokedAt == nil {
+			m.sessions[j].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memory) RestoreUser(ctx context.Context, userID int) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.userIndexByID(userID)
+	if i < 0 || m.users[i].DeletedAt == nil {
+		return nil, fmt.Errorf("deleted user %d not found: %w", userID, domain.ErrNotFound)
+	}
+	user := m.users[i]
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+	user.Version++
+	if err := m.recordChanges(ctx, userChange(domain.AuditActionUserRestore, &m.users[i], &user)); err != nil {
+		return nil, err
+	}
+	m.users[i] = user
+	return &user, nil
+}
+
+func (m *memory) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changes []change
+	var users []domain.User
+	for i := range m.users {
+		if user := m.users[i]; user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			changes = append(changes, purgeChange(user))
+			users = append(users, user)
+		}
+	}
+	// Like in EraseUser, restoring these undoes the changes below
+	auditEvents, outboxEvents, deliveries := m.auditEvents, m.outboxEvents, m.webhookDeliveries
+	if err := m.recordChanges(ctx, changes...); err != nil {
+		return 0, err
+	}
+	// Purged users leave no personal data in the audit log, the outbox or
+	// the webhook deliveries either
+	now := time.Now()
+	for _, user := range users {
+		err := m.eraseUserAuditEvents(user.ID, user.Email, now)
+		if err == nil {
+			err = m.eraseUserEvents(user.ID)
+		}
+		if err != nil {
+			m.auditEvents, m.outboxEvents, m.webhookDeliveries = auditEvents, outboxEvents, deliveries
+			return 0, err
+		}
+	}
+
+	purged := 0
+	m.users = deleteWhere(m.users, func(u domain.User) bool {
+		if u.DeletedAt == nil || !u.DeletedAt.Before(deletedBefore) {
+			return false
+		}
+		m.deleteUserRows(u.ID)
+		purged++
+		return true
+	})
+	return purged, nil
+}
+
+// deleteUserRows removes the rows referencing a user, like the ON DELETE
+// CASCADE foreign keys of the Postgres schema
+func (m *memory) deleteUserRows(userID int) {
+	m.apiKeys = deleteWhere(m.apiKeys, func(k domain.APIKey) bool { return k.UserID == userID })
+	m.authorizationCodes = deleteWhere(m.authorizationCodes, func(c domain.AuthorizationCode) bool { return c.UserID == userID })
+	m.userIdentities = deleteWhere(m.userIdentities, func(i domain.UserIdentity) bool { return i.UserID == userID })
+	m.deviceAuthorizations = deleteWhere(m.deviceAuthorizations, func(d domain.DeviceAuthorization) bool {
+		return d.UserID != nil && *d.UserID == userID
+	})
+	m.magicLinks = deleteWhere(m.magicLinks, func(l domain.MagicLink) bool { return l.UserID == userID })
+	m.sessions = deleteWhere(m.sessions, func(s domain.Session) bool { return s.UserID == userID })
+	m.loginEvents = deleteWhere(m.loginEvents, func(e domain.LoginEvent) bool { return e.UserID != nil && *e.UserID == userID })
+	m.passwordHistory = deleteWhere(m.passwordHistory, func(e passwordHistoryEntry) bool { return e.userID == userID })
+}
+
+func deleteWhere[T any](rows []T, match func(T) bool) []T {
+	kept := rows[:0]
+	for _, row := range rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func (m *memory) AuthenticateUser(ctx context.Context, email, password string) (*domain.User, error) {
+	user, err := m.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("user with email %s not found: %w", email, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)); err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+	return user, nil
+}
+
+func (m *memory) UpdateUser(ctx context.Context, userID int, params UpdateUserParams) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.liveUserIndexByID(userID)
+	if i < 0 {
+		return nil, fmt.Errorf("failed to update user %d: %w", userID, domain.ErrNotFound)
+	}
+	if params.Email != nil {
+		if j := m.userIndexByEmail(*params.Email); j >= 0 && j != i {
+			return nil, fmt.Errorf("failed to update user %d: %w", userID, uniqueViolationError("users_email_key"))
+		}
+	}
+	if err := checkUserVersion(m.users[i].Version, params.ExpectedVersion); err != nil {
+		return nil, fmt.Errorf("failed to update user %d: %w", userID, err)
+	}
+
+	now := time.Now()
+	user := m.users[i]
+	if params.Name != nil {
+		user.Name = *params.Name
+	}
+	if params.Email != nil {
+		user.Email = *params.Email
+	}
+	if params.Role != nil {
+		user.Role = *params.Role
+	}
+	if params.ExternalID != nil {
+		user.ExternalID = *params.ExternalID
+	}
+	if params.Active != nil {
+		user.Active = *params.Active
+	}
+	if params.HashedPassword != nil {
+		user.HashedPassword = *params.HashedPassword
+		user.PasswordChangedAt = now
+	}
+	user.UpdatedAt = now
+	user.Version++
+
+	if err := m.recordChanges(ctx, userChange(domain.AuditActionUserUpdate, &m.users[i], &user)); err != nil {
+		return nil, err
+	}
+	m.users[i] = user
+	return &user, nil
+}
+
+func (m *memory) RehashPassword(ctx context.Context, userID int, currentHash string, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.liveUserIndexByID(userID); i >= 0 && m.users[i].HashedPassword == currentHash {
+		m.users[i].HashedPassword = newHash
+	}
+	return nil
+}
+
+func (m *memory) ListUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return m.listUsers(false, params)
+}
+
+func (m *memory) ListDeletedUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return m.listUsers(true, params)
+}
+
+func (m *memory) listUsers(deleted bool, params ListUsersParams) ([]domain.User, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []domain.User
+	for _, user := range m.users {
+		if (user.DeletedAt != nil) != deleted {
+			continue
+		}
+		if params.Filter != nil {
+			ok, err := params.Filter.match(user)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid user filter: %w", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = append(matched, user)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	total := len(matched)
+	if params.Limit <= 0 {
+		return nil, total, nil
+	}
+	return page(matched, params.Offset, params.Limit), total, nil
+}
+
+// page returns the rows a LIMIT and OFFSET clause would return
+func page[T any](rows []T, offset int, limit int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(rows) {
+		return nil
+	}
+	end := len(rows)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return rows[offset:end]
+}
+
+func (m *memory) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*domain.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert api key into database: %w", foreignKeyViolationError("api_keys_user_id_fkey"))
+	}
+	for _, key := range m.apiKeys {
+		if key.Prefix == params.Prefix {
+			return nil, fmt.Errorf("failed to insert api key into database: %w", uniqueViolationError("api_keys_prefix_key"))
+		}
+	}
+
+	key := domain.APIKey{
+		ID:           m.nextID("api_keys"),
+		UserID:       params.UserID,
+		Name:         params.Name,
+		Prefix:       params.Prefix,
+		HashedSecret: params.HashedSecret,
+		Scopes:       cloneStrings(params.Scopes),
+		ExpiresAt:    params.ExpiresAt,
+		CreatedAt:    time.Now(),
+	}
+	if err := m.recordChanges(ctx, apiKeyChange(domain.AuditActionAPIKeyCreate, nil, &key)); err != nil {
+		return nil, err
+	}
+	m.apiKeys = append(m.apiKeys, key)
+	return cloneAPIKey(key), nil
+}
+
+func (m *memory) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return cloneAPIKey(key), nil
+		}
+	}
+	return nil, fmt.Errorf("api key not found with the provided prefix: %w", domain.ErrNotFound)
+}
+
+func (m *memory) ListAPIKeysByUserID(ctx context.Context, userID int) ([]domain.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []domain.APIKey
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, *cloneAPIKey(key))
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (m *memory) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		key := m.apiKeys[i]
+		if key.ID == keyID && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			if err := m.recordChanges(ctx, apiKeyChange(domain.AuditActionAPIKeyRevoke, &m.apiKeys[i], &key)); err != nil {
+				return err
+			}
+			m.apiKeys[i] = key
+			return nil
+		}
+	}
+	return fmt.Errorf("active api key %d not found: %w", keyID, domain.ErrNotFound)
+}
+
+func (m *memory) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == keyID {
+			m.apiKeys[i].LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func cloneAPIKey(key domain.APIKey) *domain.APIKey {
+	key.Scopes = cloneStrings(key.Scopes)
+	return &key
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return append([]string{}, values...)
+}
+
+func (m *memory) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*domain.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.oauthClientIndex(params.ClientID) >= 0 {
+		return nil, fmt.Errorf("failed to insert oauth client into database: %w", uniqueViolationError("oauth_clients_client_id_key"))
+	}
+
+	client := domain.OAuthClient{
+		ID:           m.nextID("oauth_clients"),
+		ClientID:     params.ClientID,
+		Name:         params.Name,
+		HashedSecret: params.HashedSecret,
+		Scopes:       cloneStrings(params.Scopes),
+		RedirectURIs: cloneStrings(params.RedirectURIs),
+		CreatedAt:    time.Now(),
+	}
+	if err := m.recordChanges(ctx, oauthClientChange(domain.AuditActionOAuthClientCreate, nil, &client)); err != nil {
+		return nil, err
+	}
+	m.oauthClients = append(m.oauthClients, client)
+	return cloneOAuthClient(client), nil
+}
+
+func (m *memory) GetOAuthClientByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.oauthClientIndex(clientID)
+	if i < 0 {
+		return nil, fmt.Errorf("oauth client not found with the provided client id: %w", domain.ErrNotFound)
+	}
+	return cloneOAuthClient(m.oauthClients[i]), nil
+}
+
+func (m *memory) ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var clients []domain.OAuthClient
+	for _, client := range m.oauthClients {
+		clients = append(clients, *cloneOAuthClient(client))
+	}
+	sort.SliceStable(clients, func(i, j int) bool { return clients[i].CreatedAt.After(clients[j].CreatedAt) })
+	return clients, nil
+}
+
+func (m *memory) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.oauthClientIndex(clientID)
+	if i < 0 {
+		return fmt.Errorf("oauth client %s not found: %w", clientID, domain.ErrNotFound)
+	}
+	if err := m.recordChanges(ctx, oauthClientChange(domain.AuditActionOAuthClientDelete, &m.oauthClients[i], nil)); err != nil {
+		return err
+	}
+	m.oauthClients = append(m.oauthClients[:i], m.oauthClients[i+1:]...)
+	m.authorizationCodes = deleteWhere(m.authorizationCodes, func(c domain.AuthorizationCode) bool { return c.ClientID == clientID })
+	m.deviceAuthorizations = deleteWhere(m.deviceAuthorizations, func(d domain.DeviceAuthorization) bool { return d.ClientID == clientID })
+	return nil
+}
+
+func cloneOAuthClient(client domain.OAuthClient) *domain.OAuthClient {
+	client.Scopes = cloneStrings(client.Scopes)
+	client.RedirectURIs = cloneStrings(client.RedirectURIs)
+	return &client
+}
+
+func (m *memory) CreateAuthorizationCode(ctx context.Context, params CreateAuthorizationCodeParams) (*domain.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.oauthClientIndex(params.ClientID) < 0 {
+		return nil, fmt.Errorf("failed to insert authorization code into database: %w", foreignKeyViolationError("oauth_authorization_codes_client_id_fkey"))
+	}
+	if m.userIndexByID(params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert authorization code into database: %w", foreignKeyViolationError("oauth_authorization_codes_user_id_fkey"))
+	}
+	for _, code := range m.authorizationCodes {
+		if code.CodeHash == params.CodeHash {
+			return nil, fmt.Errorf("failed to insert authorization code into database: %w", uniqueViolationError("oauth_authorization_codes_code_hash_key"))
+		}
+	}
+
+	code := domain.AuthorizationCode{
+		ID:            m.nextID("oauth_authorization_codes"),
+		CodeHash:      params.CodeHash,
+		ClientID:      params.ClientID,
+		UserID:        params.UserID,
+		RedirectURI:   params.RedirectURI,
+		Scopes:        cloneStrings(params.Scopes),
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		AuthTime:      params.AuthTime,
+		ExpiresAt:     params.ExpiresAt,
+		CreatedAt:     time.Now(),
+	}
+	m.authorizationCodes = append(m.authorizationCodes, code)
+	code.Scopes = cloneStrings(code.Scopes)
+	return &code, nil
+}
+
+func (m *memory) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.authorizationCodes {
+		code := &m.authorizationCodes[i]
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			consumed := *code
+			consumed.Scopes = cloneStrings(code.Scopes)
+			return &consumed, nil
+		}
+	}
+	return nil, fmt.Errorf("authorization code not found or already used: %w", domain.ErrNotFound)
+}
+
+func (m *memory) CreateUserIdentity(ctx context.Context, params CreateUserIdentityParams) (*domain.UserIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert user identity into database: %w", foreignKeyViolationError("user_identities_user_id_fkey"))
+	}
+	for _, identity := range m.userIdentities {
+		if identity.Provider == params.Provider && identity.Subject == params.Subject {
+			return nil, fmt.Errorf("failed to insert user identity into database: %w", uniqueViolationError("user_identities_provider_subject_key"))
+		}
+	}
+
+	identity := domain.UserIdentity{
+		ID:        m.nextID("user_identities"),
+		UserID:    params.UserID,
+		Provider:  params.Provider,
+		Subject:   params.Subject,
+		Email:     params.Email,
+		CreatedAt: time.Now(),
+	}
+	m.userIdentities = append(m.userIdentities, identity)
+	return &identity, nil
+}
+
+func (m *memory) GetUserIdentity(ctx context.Context, provider string, subject string) (*domain.UserIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, identity := range m.userIdentities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, fmt.Errorf("user identity not found: %w", domain.ErrNotFound)
+}
+
+func (m *memory) ListUserIdentitiesByUserID(ctx context.Context, userID int) ([]domain.UserIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var identities []domain.UserIdentity
+	for _, identity := range m.userIdentities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *memory) CreateDeviceAuthorization(ctx context.Context, params CreateDeviceAuthorizationParams) (*domain.DeviceAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.oauthClientIndex(params.ClientID) < 0 {
+		return nil, fmt.Errorf("failed to insert device authorization into database: %w", foreignKeyViolationError("oauth_device_authorizations_client_id_fkey"))
+	}
+	for _, authorization := range m.deviceAuthorizations {
+		if authorization.DeviceCodeHash == params.DeviceCodeHash {
+			return nil, fmt.Errorf("failed to insert device authorization into database: %w", uniqueViolationError("oauth_device_authorizations_device_code_hash_key"))
+		}
+		if authorization.UserCode == params.UserCode {
+			return nil, fmt.Errorf("failed to insert device authorization into database: %w", uniqueViolationError("oauth_device_authorizations_user_code_key"))
+		}
+	}
+
+	authorization := domain.DeviceAuthorization{
+		ID:             m.nextID("oauth_device_authorizations"),
+		DeviceCodeHash: params.DeviceCodeHash,
+		UserCode:       params.UserCode,
+		ClientID:       params.ClientID,
+		Scopes:         cloneStrings(params.Scopes),
+		Status:         domain.DeviceAuthorizationPending,
+		Interval:       params.Interval,
+		ExpiresAt:      params.ExpiresAt,
+		CreatedAt:      time.Now(),
+	}
+	m.deviceAuthorizations = append(m.deviceAuthorizations, authorization)
+	return cloneDeviceAuthorization(authorization), nil
+}
+
+func (m *memory) CompleteDeviceAuthorization(ctx context.Context, userCode string, userID int, status string) (*domain.DeviceAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(userID) < 0 {
+		return nil, fmt.Errorf("failed to complete device authorization: %w", foreignKeyViolationError("oauth_device_authorizations_user_id_fkey"))
+	}
+	now := time.Now()
+	for i := range m.deviceAuthorizations {
+		authorization := &m.deviceAuthorizations[i]
+		if authorization.UserCode == userCode && authorization.Status == domain.DeviceAuthorizationPending && authorization.ExpiresAt.After(now) {
+			authorization.Status = status
+			authorization.UserID = &userID
+			return cloneDeviceAuthorization(*authorization), nil
+		}
+	}
+	return nil, fmt.Errorf("device authorization not found, expired or already completed: %w", domain.ErrNotFound)
+}
+
+func (m *memory) PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, polledAt time.Time) (*domain.DeviceAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deviceAuthorizations {
+		authorization := &m.deviceAuthorizations[i]
+		if authorization.DeviceCodeHash == deviceCodeHash {
+			previous := cloneDeviceAuthorization(*authorization)
+			authorization.LastPolledAt = &polledAt
+			return previous, nil
+		}
+	}
+	return nil, fmt.Errorf("device authorization not found: %w", domain.ErrNotFound)
+}
+
+func (m *memory) SlowDownDeviceAuthorization(ctx context.Context, id int, interval int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deviceAuthorizations {
+		if m.deviceAuthorizations[i].ID == id {
+			m.deviceAuthorizations[i].Interval = interval
+		}
+	}
+	return nil
+}
+
+func (m *memory) ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*domain.DeviceAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deviceAuthorizations {
+		authorization := &m.deviceAuthorizations[i]
+		if authorization.DeviceCodeHash == deviceCodeHash && authorization.Status == domain.DeviceAuthorizationApproved {
+			authorization.Status = domain.DeviceAuthorizationConsumed
+			return cloneDeviceAuthorization(*authorization), nil
+		}
+	}
+	return nil, fmt.Errorf("device authorization not approved or already used: %w", domain.ErrNotFound)
+}
+
+func cloneDeviceAuthorization(authorization domain.DeviceAuthorization) *domain.DeviceAuthorization {
+	authorization.Scopes = cloneStrings(authorization.Scopes)
+	if authorization.UserID != nil {
+		userID := *authorization.UserID
+		authorization.UserID = &userID
+	}
+	if authorization.LastPolledAt != nil {
+		lastPolledAt := *authorization.LastPolledAt
+		authorization.LastPolledAt = &lastPolledAt
+	}
+	return &authorization
+}
+
+func (m *memory) CreateMagicLink(ctx context.Context, params CreateMagicLinkParams) (*domain.MagicLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert magic link into database: %w", foreignKeyViolationError("magic_links_user_id_fkey"))
+	}
+	for _, link := range m.magicLinks {
+		if link.TokenHash == params.TokenHash {
+			return nil, fmt.Errorf("failed to insert magic link into database: %w", uniqueViolationError("magic_links_token_hash_key"))
+		}
+	}
+
+	link := domain.MagicLink{
+		ID:        m.nextID("magic_links"),
+		TokenHash: params.TokenHash,
+		UserID:    params.UserID,
+		Email:     params.Email,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.magicLinks = append(m.magicLinks, link)
+	return &link, nil
+}
+
+func (m *memory) CountMagicLinksSince(ctx context.Context, email string, since time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, link := range m.magicLinks {
+		if strings.EqualFold(link.Email, email) && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memory) ConsumeMagicLink(ctx context.Context, tokenHash string, email string, maxAttempts int) (*domain.MagicLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for i := range m.magicLinks {
+		link := &m.magicLinks[i]
+		if link.TokenHash == tokenHash && strings.EqualFold(link.Email, email) && link.UsedAt == nil && link.ExpiresAt.After(now) && link.Attempts < maxAttempts {
+			link.UsedAt = &now
+			consumed := *link
+			return &consumed, nil
+		}
+	}
+	return nil, fmt.Errorf("magic link not found, expired or already used: %w", domain.ErrNotFound)
+}
+
+func (m *memory) RecordMagicLinkFailure(ctx context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for i := range m.magicLinks {
+		link := &m.magicLinks[i]
+		if strings.EqualFold(link.Email, email) && link.UsedAt == nil && link.ExpiresAt.After(now) {
+			link.Attempts++
+		}
+	}
+	return nil
+}
+
+func (m *memory) CreateSession(ctx context.Context, params CreateSessionParams) (*domain.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert session into database: %w", foreignKeyViolationError("sessions_user_id_fkey"))
+	}
+	for _, session := range m.sessions {
+		if session.ID == params.ID {
+			return nil, fmt.Errorf("failed to insert session into database: %w", uniqueViolationError("sessions_pkey"))
+		}
+	}
+
+	session := domain.Session{
+		ID:        params.ID,
+		UserID:    params.UserID,
+		IPAddress: params.IPAddress,
+		UserAgent: params.UserAgent,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.sessions = append(m.sessions, session)
+	return &session, nil
+}
+
+func (m *memory) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.sessions {
+		if session.ID == sessionID {
+			return &session, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found: %w", domain.ErrNotFound)
+}
+
+func (m *memory) ListSessionsByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []domain.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.IsActive(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+func (m *memory) ListSessionHistoryByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []domain.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+func (m *memory) RevokeSession(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.sessions {
+		session := m.sessions[i]
+		if session.ID == sessionID && session.RevokedAt == nil {
+			now := time.Now()
+			session.RevokedAt = &now
+			if err := m.recordChanges(ctx, sessionChange(domain.AuditActionSessionRevoke, &m.sessions[i], &session)); err != nil {
+				return err
+			}
+			m.sessions[i] = session
+			return nil
+		}
+	}
+	return fmt.Errorf("active session not found: %w", domain.ErrNotFound)
+}
+
+func (m *memory) CreateLoginEvent(ctx context.Context, params CreateLoginEventParams) (*domain.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if params.UserID != nil && m.userIndexByID(*params.UserID) < 0 {
+		return nil, fmt.Errorf("failed to insert login event into database: %w", foreignKeyViolationError("login_events_user_id_fkey"))
+	}
+
+	event := domain.LoginEvent{
+		ID:            m.nextID("login_events"),
+		UserID:        params.UserID,
+		Email:         params.Email,
+		Method:        params.Method,
+		Success:       params.Success,
+		FailureReason: params.FailureReason,
+		IPAddress:     params.IPAddress,
+		UserAgent:     params.UserAgent,
+		SessionID:     params.SessionID,
+		CreatedAt:     time.Now(),
+	}
+	if params.UserID != nil {
+		userID := *params.UserID
+		event.UserID = &userID
+	}
+	m.loginEvents = append(m.loginEvents, event)
+	return &event, nil
+}
+
+func (m *memory) ListLoginEventsByUserID(ctx context.Context, userID int, limit int) ([]domain.LoginEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []domain.LoginEvent
+	// Events are appended in creation order, so walking backwards is newest first
+	for i := len(m.loginEvents) - 1; i >= 0; i-- {
+		event := m.loginEvents[i]
+		if event.UserID != nil && *event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return page(events, 0, limit), nil
+}
+
+func (m *memory) AddPasswordHistory(ctx context.Context, userID int, hashedPassword string, keep int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(userID) < 0 {
+		return fmt.Errorf("failed to insert password history: %w", foreignKeyViolationError("password_history_user_id_fkey"))
+	}
+	m.passwordHistory = append(m.passwordHistory, passwordHistoryEntry{
+		id:             m.nextID("password_history"),
+		userID:         userID,
+		hashedPassword: hashedPassword,
+		createdAt:      time.Now(),
+	})
+
+	// Drop all but the latest keep entries of the user
+	kept := 0
+	for i := len(m.passwordHistory) - 1; i >= 0; i-- {
+		if m.passwordHistory[i].userID != userID {
+			continue
+		}
+		kept++
+		if kept > keep {
+			m.passwordHistory = append(m.passwordHistory[:i], m.passwordHistory[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (m *memory) ListPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hashes []string
+	for i := len(m.passwordHistory) - 1; i >= 0 && len(hashes) < limit; i-- {
+		if m.passwordHistory[i].userID == userID {
+			hashes = append(hashes, m.passwordHistory[i].hashedPassword)
+		}
+	}
+	return hashes, nil
+}
+
+func (m *memory) CreateErasureRequest(ctx context.Context, userID int, requestedBy int) (*domain.ErasureRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userIndexByID(userID) < 0 {
+		return nil, fmt.Errorf("failed to create erasure request of user %d: %w", userID, domain.ErrNotFound)
+	}
+	for _, request := range m.erasureRequests {
+		if request.UserID == userID && request.Status == domain.ErasureStatusPending {
+			return &request, nil
+		}
+	}
+	request := domain.ErasureRequest{
+		ID:          m.nextID("erasure_requests"),
+		UserID:      userID,
+		RequestedBy: requestedBy,
+		Status:      domain.ErasureStatusPending,
+		CreatedAt:   time.Now(),
+	}
+	m.erasureRequests = append(m.erasureRequests, request)
+	return &request, nil
+}
+
+func (m *memory) EraseUser(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var request *domain.ErasureRequest
+	for i := range m.erasureRequests {
+		if m.erasureRequests[i].ID == requestID && m.erasureRequests[i].Status == domain.ErasureStatusPending {
+			request = &m.erasureRequests[i]
+		}
+	}
+	if request == nil {
+		return nil, fmt.Errorf("pending erasure request %d not found: %w", requestID, domain.ErrNotFound)
+	}
+	i := m.userIndexByID(request.UserID)
+	if i < 0 {
+		return nil, fmt.Errorf("user %d of erasure request not found: %w", request.UserID, domain.ErrNotFound)
+	}
+
+	now := time.Now()
+	erased := m.users[i]
+	email, erasedEmail := erased.Email, domain.ErasedUserEmail(erased.ID)
+	erased.Name = domain.ErasedUserName
+	erased.Email = erasedEmail
+	erased.HashedPassword = ""
+	erased.ExternalID = ""
+	erased.Active = false
+	erased.UpdatedAt = now
+	erased.Version++
+	// The changes below append to these or replace them with changed copies,
+	// so restoring them undoes the changes
+	auditEvents, outboxEvents, deliveries := m.auditEvents, m.outboxEvents, m.webhookDeliveries
+	if err := m.recordChanges(ctx, eraseChange(m.users[i], erased)); err != nil {
+		return nil, err
+	}
+	err := m.eraseUserAuditEvents(erased.ID, email, now)
+	if err == nil {
+		err = m.eraseUserEvents(erased.ID)
+	}
+	if err != nil {
+		m.auditEvents, m.outboxEvents, m.webhookDeliveries = auditEvents, outboxEvents, deliveries
+		return nil, err
+	}
+	m.users[i] = erased
+	user := &m.users[i]
+	for j := range m.loginEvents {
+		event := &m.loginEvents[j]
+		if (event.UserID != nil && *event.UserID == user.ID) || (event.UserID == nil && event.Email == email) {
+			event.Email, event.IPAddress, event.UserAgent = erasedEmail, "", ""
+		}
+	}
+	for j := range m.sessions {
+		session := &m.sessions[j]
+		if session.UserID == user.ID {
+			session.IPAddress, session.UserAgent = "", ""
+			if session.RevokedAt == nil {
+				session.RevokedAt = &now
+			}
+		}
+	}
+	for j := range m.apiKeys {
+		if m.apiKeys[j].UserID == user.ID && m.apiKeys[j].RevokedAt == nil {
+			m.apiKeys[j].RevokedAt = &now
+		}
+	}
+	m.userIdentities = deleteWhere(m.userIdentities, func(identity domain.UserIdentity) bool { return identity.UserID == user.ID })
+	m.magicLinks = deleteWhere(m.magicLinks, func(l domain.MagicLink) bool { return l.UserID == user.ID })
+	m.passwordHistory = deleteWhere(m.passwordHistory, func(e passwordHistoryEntry) bool { return e.userID == user.ID })
+
+	request.Status = domain.ErasureStatusCompleted
+	request.CompletedAt = &now
+	completed := *request
+	return &completed, nil
+}
+
+func (m *memory) GetErasureRequest(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, request := range m.erasureRequests {
+		if request.ID == requestID {
+			return &request, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find erasure request %d: %w", requestID, domain.ErrNotFound)
+}
+
+func (m *memory) ListErasureRequests(ctx context.Context, params ListErasureRequestsParams) ([]domain.ErasureRequest, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []domain.ErasureRequest
+	for _, request := range m.erasureRequests {
+		if params.Status == "" || request.Status == params.Status {
+			matched = append(matched, request)
+		}
+	}
+	if params.Limit <= 0 {
+		return nil, len(matched), nil
+	}
+	return page(matched, params.Offset, params.Limit), len(matched), nil
+}
+
+func (m *memory) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]domain.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []domain.AuditEvent
+	for _, event := range m.auditEvents {
+		if event.ID <= params.AfterID ||
+			(params.Actor != "" && event.Actor != params.Actor) ||
+			(params.Target != "" && event.Target != params.Target) ||
+			(params.UserID != nil && (event.UserID == nil || *event.UserID != *params.UserID)) {
+			continue
+		}
+		matched = append(matched, *cloneAuditEvent(event))
+	}
+	return page(matched, 0, params.Limit), nil
+}
+
+// eraseUserAuditEvents scrubs the personal data of an erased user from the
+// audit log. It works on a copy, so a failure leaves the log as it was.
+func (m *memory) eraseUserAuditEvents(userID int, email string, now time.Time) error {
+	auditEvents := slices.Clone(m.auditEvents)
+	err := eraseAuditEvents(userID, email, now,
+		func() ([]domain.AuditEvent, error) {
+			return m.auditEventsWhere(func(event domain.AuditEvent) bool {
+				return event.UserID != nil && *event.UserID == userID
+			}), nil
+		},
+		func(text string) ([]domain.AuditEvent, error) {
+			return m.auditEventsWhere(func(event domain.AuditEvent) bool { return strings.Contains(event.Actor, text) }), nil
+		},
+		func(event domain.AuditEvent) error {
+			for i := range auditEvents {
+				if auditEvents[i].ID == event.ID {
+					auditEvents[i] = event
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+	m.auditEvents = auditEvents
+	return nil
+}
+
+// auditEventsWhere returns copies of the audit events that match, oldest first
+func (m *memory) auditEventsWhere(match func(event domain.AuditEvent) bool) []domain.AuditEvent {
+	var matched []domain.AuditEvent
+	for _, event := range m.auditEvents {
+		if match(event) {
+			matched = append(matched, *cloneAuditEvent(event))
+		}
+	}
+	return matched
+}
+
+func cloneAuditEvent(event domain.AuditEvent) *domain.AuditEvent {
+	event.Diff = bytes.Clone(event.Diff)
+	if event.UserID != nil {
+		userID := *event.UserID
+		event.UserID = &userID
+	}
+	if event.ErasedAt != nil {
+		erasedAt := *event.ErasedAt
+		event.ErasedAt = &erasedAt
+	}
+	return &event
+}
+
+// eraseUserEvents scrubs the personal data of an erased user from its events
+// in the outbox, published or not, and from their webhook deliveries. Like
+// eraseUserAuditEvents, it works on copies.
+func (m *memory) eraseUserEvents(userID int) error {
+	outboxEvents := slices.Clone(m.outboxEvents)
+	for i := range outboxEvents {
+		if event := &outboxEvents[i].event; event.UserID == userID {
+			eraseUserSnapshot(&event.User)
+		}
+	}
+	deliveries := slices.Clone(m.webhookDeliveries)
+	for i := range deliveries {
+		if deliveries[i].UserID != userID {
+			continue
+		}
+		payload, err := eraseWebhookPayload(deliveries[i].Payload)
+		if err != nil {
+			return fmt.Errorf("failed to erase webhook delivery %d: %w", deliveries[i].ID, err)
+		}
+		deliveries[i].Payload = payload
+	}
+	m.outboxEvents, m.webhookDeliveries = outboxEvents, deliveries
+	return nil
+}
+
+func (m *memory) outboxEntryIndex(eventID int) int {
+	for i := range m.outboxEvents {
+		if m.outboxEvents[i].event.ID == eventID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) ListPendingUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var pending []domain.UserEvent
+	for _, entry := range m.outboxEvents {
+		if entry.publishedAt == nil {
+			pending = append(pending, entry.event)
+		}
+	}
+	return page(pending, 0, limit), nil
+}
+
+func (m *memory) ListUserEvents(ctx context.Context, afterID int, limit int) ([]domain.UserEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []domain.UserEvent
+	for _, entry := range m.outboxEvents {
+		if entry.event.ID > afterID {
+			events = append(events, entry.event)
+		}
+	}
+	return page(events, 0, limit), nil
+}
+
+func (m *memory) LastUserEventID(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.outboxEvents) == 0 {
+		return 0, nil
+	}
+	return m.outboxEvents[len(m.outboxEvents)-1].event.ID, nil
+}
+
+func (m *memory) MarkUserEventPublished(ctx context.Context, eventID int, publishedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.outboxEntryIndex(eventID); i >= 0 {
+		m.outboxEvents[i].publishedAt = &publishedAt
+		m.outboxEvents[i].lastError = ""
+	}
+	return nil
+}
+
+func (m *memory) MarkUserEventFailed(ctx context.Context, eventID int, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.outboxEntryIndex(eventID); i >= 0 {
+		m.outboxEvents[i].attempts++
+		m.outboxEvents[i].lastError = reason
+	}
+	return nil
+}
+
+func (m *memory) AcquireOutboxLease(ctx context.Context, holder string, now time.Time, duration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease := m.outboxLease
+	if lease.holder != "" && lease.holder != holder && lease.expiresAt.After(now) {
+		return false, nil
+	}
+	m.outboxLease = outboxLease{holder: holder, expiresAt: now.Add(duration)}
+	return true, nil
+}
+
+func (m *memory) DeletePublishedUserEvents(ctx context.Context, publishedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	m.outboxEvents = deleteWhere(m.outboxEvents, func(entry outboxEntry) bool {
+		if entry.publishedAt == nil || !entry.publishedAt.Before(publishedBefore) {
+			return false
+		}
+		deleted++
+		return true
+	})
+	return deleted, nil
+}
+
+func (m *memory) webhookSubscriptionIndex(subscriptionID int) int {
+	for i := range m.webhookSubscriptions {
+		if m.webhookSubscriptions[i].ID == subscriptionID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) webhookDeliveryIndex(deliveryID int) int {
+	for i := range m.webhookDeliveries {
+		if m.webhookDeliveries[i].ID == deliveryID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (*domain.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscription := domain.WebhookSubscription{
+		ID:         m.nextID("webhook_subscriptions"),
+		URL:        params.URL,
+		EventTypes: cloneStrings(params.EventTypes),
+		Secret:     params.Secret,
+		CreatedAt:  time.Now(),
+	}
+	if err := m.recordChanges(ctx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionCreate, nil, &subscription)); err != nil {
+		return nil, err
+	}
+	m.webhookSubscriptions = append(m.webhookSubscriptions, subscription)
+	return cloneWebhookSubscription(subscription), nil
+}
+
+func (m *memory) GetWebhookSubscription(ctx context.Context, subscriptionID int) (*domain.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.webhookSubscriptionIndex(subscriptionID)
+	if i < 0 {
+		return nil, fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, domain.ErrNotFound)
+	}
+	return cloneWebhookSubscription(m.webhookSubscriptions[i]), nil
+}
+
+func (m *memory) ListWebhookSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subscriptions []domain.WebhookSubscription
+	for _, subscription := range m.webhookSubscriptions {
+		subscriptions = append(subscriptions, *cloneWebhookSubscription(subscription))
+	}
+	return subscriptions, nil
+}
+
+func (m *memory) DeleteWebhookSubscription(ctx context.Context, subscriptionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.webhookSubscriptionIndex(subscriptionID)
+	if i < 0 {
+		return fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, domain.ErrNotFound)
+	}
+	if err := m.recordChanges(ctx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionDelete, &m.webhookSubscriptions[i], nil)); err != nil {
+		return err
+	}
+	m.webhookSubscriptions = append(m.webhookSubscriptions[:i], m.webhookSubscriptions[i+1:]...)
+
+	deleted := make(map[int]bool)
+	m.webhookDeliveries = deleteWhere(m.webhookDeliveries, func(d domain.WebhookDelivery) bool {
+		if d.SubscriptionID != subscriptionID {
+			return false
+		}
+		deleted[d.ID] = true
+		return true
+	})
+	m.webhookDeliveryAttempts = deleteWhere(m.webhookDeliveryAttempts, func(a domain.WebhookDeliveryAttempt) bool { return deleted[a.DeliveryID] })
+	return nil
+}
+
+func (m *memory) CreateWebhookDelivery(ctx context.Context, params CreateWebhookDeliveryParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.webhookSubscriptionIndex(params.SubscriptionID) < 0 {
+		return fmt.Errorf("failed to insert webhook delivery into database: %w", foreignKeyViolationError("webhook_deliveries_subscription_id_fkey"))
+	}
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.SubscriptionID == params.SubscriptionID && delivery.EventID == params.EventID {
+			return nil
+		}
+	}
+
+	now := time.Now()
+	m.webhookDeliveries = append(m.webhookDeliveries, domain.WebhookDelivery{
+		ID:             m.nextID("webhook_deliveries"),
+		SubscriptionID: params.SubscriptionID,
+		EventID:        params.EventID,
+		UserID:         params.UserID,
+		EventType:      params.EventType,
+		Payload:        bytes.Clone(params.Payload),
+		Status:         domain.WebhookDeliveryPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	return nil
+}
+
+func (m *memory) ClaimWebhookDeliveries(ctx context.Context, now time.Time, claimFor time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []int
+	for i, delivery := range m.webhookDeliveries {
+		if delivery.Status == domain.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return m.webhookDeliveries[due[i]].NextAttemptAt.Before(m.webhookDeliveries[due[j]].NextAttemptAt)
+	})
+
+	var claimed []domain.WebhookDelivery
+	for _, i := range page(due, 0, limit) {
+		m.webhookDeliveries[i].NextAttemptAt = now.Add(claimFor)
+		claimed = append(claimed, *cloneWebhookDelivery(m.webhookDeliveries[i]))
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID < claimed[j].ID })
+	return claimed, nil
+}
+
+func (m *memory) RecordWebhookAttempt(ctx context.Context, params RecordWebhookAttemptParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.webhookDeliveryIndex(params.DeliveryID)
+	if i < 0 {
+		return fmt.Errorf("failed to insert webhook delivery attempt: %w", foreignKeyViolationError("webhook_delivery_attempts_delivery_id_fkey"))
+	}
+	m.webhookDeliveryAttempts = append(m.webhookDeliveryAttempts, domain.WebhookDeliveryAttempt{
+		ID:          m.nextID("webhook_delivery_attempts"),
+		DeliveryID:  params.DeliveryID,
+		StatusCode:  params.StatusCode,
+		Error:       params.Error,
+		Duration:    params.Duration.Truncate(time.Millisecond),
+		AttemptedAt: params.AttemptedAt,
+	})
+
+	delivery := &m.webhookDeliveries[i]
+	delivery.Status = params.Status
+	delivery.Attempts++
+	delivery.NextAttemptAt = params.NextAttemptAt
+	delivery.LastError = params.Error
+	delivery.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memory) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]domain.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []domain.WebhookDelivery
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.ID <= params.AfterID ||
+			(params.SubscriptionID != 0 && delivery.SubscriptionID != params.SubscriptionID) ||
+			(params.Status != "" && delivery.Status != params.Status) {
+			continue
+		}
+		matched = append(matched, *cloneWebhookDelivery(delivery))
+	}
+	return page(matched, 0, params.Limit), nil
+}
+
+func (m *memory) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int) ([]domain.WebhookDeliveryAttempt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var attempts []domain.WebhookDeliveryAttempt
+	for _, attempt := range m.webhookDeliveryAttempts {
+		if attempt.DeliveryID == deliveryID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+func (m *memory) ReplayWebhookDelivery(ctx context.Context, deliveryID int, now time.Time) (*domain.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.webhookDeliveryIndex(deliveryID)
+	if i < 0 {
+		return nil, fmt.Errorf("webhook delivery %d not found: %w", deliveryID, domain.ErrNotFound)
+	}
+	delivery := *cloneWebhookDelivery(m.webhookDeliveries[i])
+	delivery.Status = domain.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.LastError = ""
+	delivery.UpdatedAt = now
+	if err := m.recordChanges(ctx, webhookDeliveryChange(domain.AuditActionWebhookDeliveryReplay, &m.webhookDeliveries[i], &delivery)); err != nil {
+		return nil, err
+	}
+	m.webhookDeliveries[i] = delivery
+	return cloneWebhookDelivery(delivery), nil
+}
+
+func cloneWebhookSubscription(subscription domain.WebhookSubscription) *domain.WebhookSubscription {
+	subscription.EventTypes = cloneStrings(subscription.EventTypes)
+	return &subscription
+}
+
+func cloneWebhookDelivery(delivery domain.WebhookDelivery) *domain.WebhookDelivery {
+	delivery.Payload = bytes.Clone(delivery.Payload)
+	return &delivery
+}
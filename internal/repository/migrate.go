@@ -2,34 +2,404 @@ package repository
 
 import (
 	"context"
-	"os"
-	"path/filepath"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func (p postgres) Migrate(path string) error {
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var embeddedMigrations embed.FS
+
+// migrationLockID is the key of the Postgres advisory lock held while
+// migrating, so replicas starting at the same time apply every migration once
+const migrationLockID int64 = 0x737465726e78 // "sternx"
+
+const createSchemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL
+)`
+
+// ErrMigrationModified is returned when the file of an applied migration no
+// longer matches what was applied. Migrations must not be edited once
+// released; add a new one instead.
+var ErrMigrationModified = errors.New("migration was modified after it was applied")
+
+// Migration is a versioned schema change, read from a
+// {version}_{name}.up.sql file and its optional {version}_{name}.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the SHA-256 of Up, stored when the migration is applied
+	Checksum string
+}
+
+// MigrationStatus tells whether a migration is applied to the database
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is zero for pending migrations
+	AppliedAt time.Time
+	// Modified is set when the up file changed since it was applied
+	Modified bool
+	// Missing is set for applied migrations without a file
+	Missing bool
+}
 
-	rootDir, err := os.Getwd()
+func (s MigrationStatus) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// EmbeddedMigrations returns the Postgres migrations built into the binary
+func EmbeddedMigrations() fs.FS {
+	sub, err := fs.Sub(embeddedMigrations, "migrations")
 	if err != nil {
-		return err
+		panic(err)
 	}
-	migrationDir := filepath.Join(rootDir, path)
+	return sub
+}
 
-	files, err := os.ReadDir(migrationDir)
+// LoadMigrations reads the migrations in the root of source, ordered by version
+func LoadMigrations(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		base, direction, ok := cutMigrationDirection(fileName)
+		if !ok {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", fileName)
+		}
+
+		content, err := fs.ReadFile(source, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migrations %d_%s and %d_%s share a version", version, migration.Name, version, name)
+		}
+		if direction == "up" {
+			if migration.Up != "" {
+				return nil, fmt.Errorf("duplicate up migration for version %d", version)
+			}
+			migration.Up = string(content)
+		} else {
+			if migration.Down != "" {
+				return nil, fmt.Errorf("duplicate down migration for version %d", version)
+			}
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		checksum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(checksum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutMigrationDirection(fileName string) (base string, direction string, ok bool) {
+	if base, ok := strings.CutSuffix(fileName, ".up.sql"); ok {
+		return base, "up", true
 	}
+	if base, ok := strings.CutSuffix(fileName, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+// migrationSession applies and reverts migrations while the migration lock is
+// held
+type migrationSession interface {
+	applyMigration(ctx context.Context, migration Migration) error
+	revertMigration(ctx context.Context, migration Migration) error
+}
+
+// migrationLocker runs fn while holding the migration lock of a database, with
+// the migrations applied so far
+type migrationLocker func(ctx context.Context, fn func(session migrationSession, applied map[int64]appliedMigration) error) error
+
+func (p *postgres) MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return migrateUp(ctx, p.withMigrationLock, migrations, steps)
+}
+
+func (p *postgres) MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return migrateDown(ctx, p.withMigrationLock, migrations, steps)
+}
+
+func (p *postgres) MigrateRedo(ctx context.Context, migrations []Migration) (*Migration, error) {
+	return migrateRedo(ctx, p.withMigrationLock, migrations)
+}
 
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".sql" {
-			migrationSQL, err := os.ReadFile(filepath.Join(migrationDir, file.Name()))
-			if err != nil {
+func (p *postgres) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, p.withMigrationLock, migrations)
+}
+
+// migrateUp applies up to steps pending migrations in version order, or all of
+// them when steps is not positive, and returns the applied ones.
+func migrateUp(ctx context.Context, lock migrationLocker, migrations []Migration, steps int) ([]Migration, error) {
+	var done []Migration
+	err := lock(ctx, func(session migrationSession, applied map[int64]appliedMigration) error {
+		if err := checkAppliedMigrations(migrations, applied); err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := session.applyMigration(ctx, migration); err != nil {
 				return err
 			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
 
-			_, err = p.conn.Exec(context.Background(), string(migrationSQL))
-			if err != nil {
+// migrateDown reverts the latest steps applied migrations, newest first, and
+// returns the reverted ones.
+func migrateDown(ctx context.Context, lock migrationLocker, migrations []Migration, steps int) ([]Migration, error) {
+	var done []Migration
+	err := lock(ctx, func(session migrationSession, applied map[int64]appliedMigration) error {
+		if err := checkAppliedMigrations(migrations, applied); err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := session.revertMigration(ctx, migration); err != nil {
 				return err
 			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// migrateRedo reverts the latest applied migration and applies it again, under
+// a single lock. It returns the migration, or nil when none is applied.
+func migrateRedo(ctx context.Context, lock migrationLocker, migrations []Migration) (*Migration, error) {
+	var redone *Migration
+	err := lock(ctx, func(session migrationSession, applied map[int64]appliedMigration) error {
+		if err := checkAppliedMigrations(migrations, applied); err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := session.revertMigration(ctx, migration); err != nil {
+				return err
+			}
+			if err := session.applyMigration(ctx, migration); err != nil {
+				return err
+			}
+			redone = &migration
+			return nil
+		}
+		return nil
+	})
+	return redone, err
+}
+
+// migrationStatus lists every known migration, and applied migrations whose
+// file is gone, ordered by version.
+func migrationStatus(ctx context.Context, lock migrationLocker, migrations []Migration) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := lock(ctx, func(session migrationSession, applied map[int64]appliedMigration) error {
+		known := make(map[int64]bool, len(migrations))
+		for _, migration := range migrations {
+			known[migration.Version] = true
+			status := MigrationStatus{Migration: migration}
+			if row, ok := applied[migration.Version]; ok {
+				status.AppliedAt = row.appliedAt
+				status.Modified = row.checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		for version, row := range applied {
+			if !known[version] {
+				statuses = append(statuses, MigrationStatus{
+					Migration: Migration{Version: version, Name: row.name, Checksum: row.checksum},
+					AppliedAt: row.appliedAt,
+					Missing:   true,
+				})
+			}
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, err
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock, with the migrations applied so far.
+func (p *postgres) withMigrationLock(ctx context.Context, fn func(session migrationSession, applied map[int64]appliedMigration) error) error {
+	conn, err := p.conn.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Advisory locks belong to the session, so they are taken and released on
+	// the same connection
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			p.logger.Errorf(ctx, "Failed to unlock migrations: %v", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	rows.Close()
+
+	return fn(postgresMigrationSession{conn: conn, logger: p.logger}, applied)
+}
+
+// postgresMigrationSession runs migrations on the connection holding the lock
+type postgresMigrationSession struct {
+	conn   *pgxpool.Conn
+	logger logger.Logger
+}
+
+func (s postgresMigrationSession) applyMigration(ctx context.Context, migration Migration) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, migration.Up); err != nil {
+		return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+		migration.Version, migration.Name, migration.Checksum, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	s.logger.Infof(ctx, "Applied migration %d_%s", migration.Version, migration.Name)
+	return nil
+}
+
+func (s postgresMigrationSession) revertMigration(ctx context.Context, migration Migration) error {
+	if strings.TrimSpace(migration.Down) == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, migration.Down); err != nil {
+		return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	s.logger.Infof(ctx, "Reverted migration %d_%s", migration.Version, migration.Name)
+	return nil
+}
+
+// checkAppliedMigrations refuses to migrate a database whose applied
+// migrations don't match the files, since their effect is then unknown
+func checkAppliedMigrations(migrations []Migration, applied map[int64]appliedMigration) error {
+	known := make(map[int64]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		if row, ok := applied[migration.Version]; ok && row.checksum != migration.Checksum {
+			return fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, ErrMigrationModified)
+		}
+	}
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("applied migration %d_%s has no file", version, row.name)
 		}
 	}
 	return nil
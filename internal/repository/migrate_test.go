@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"10_create_b.up.sql":  {Data: []byte("CREATE TABLE b ();")},
+		"2_create_a.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+		"2_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"README.md":           {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	require.Equal(t, int64(2), migrations[0].Version)
+	require.Equal(t, "create_a", migrations[0].Name)
+	require.Equal(t, "DROP TABLE a;", migrations[0].Down)
+	require.Len(t, migrations[0].Checksum, 64)
+
+	require.Equal(t, int64(10), migrations[1].Version)
+	require.Empty(t, migrations[1].Down)
+	require.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	testCases := map[string]fstest.MapFS{
+		"no direction":   {"1_a.sql": {Data: []byte("SELECT 1;")}},
+		"no version":     {"a.up.sql": {Data: []byte("SELECT 1;")}},
+		"no up file":     {"1_a.down.sql": {Data: []byte("SELECT 1;")}},
+		"shared version": {"1_a.up.sql": {Data: []byte("SELECT 1;")}, "01_b.up.sql": {Data: []byte("SELECT 1;")}},
+	}
+	for name, source := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadMigrations(source)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(EmbeddedMigrations())
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for _, migration := range migrations {
+		require.NotEmpty(t, migration.Down, "migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS oauth_device_authorizations (
+    id SERIAL PRIMARY KEY,
+    device_code_hash VARCHAR(255) UNIQUE NOT NULL,
+    user_code VARCHAR(16) UNIQUE NOT NULL,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    interval INTEGER NOT NULL,
+    last_polled_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS active;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,13 @@
+-- Erasure requests don't reference users, so they outlive the purge of their
+-- user as proof of the erasure
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    requested_by INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS erasure_requests_pending_idx ON erasure_requests (user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS erasure_requests_status_idx ON erasure_requests (status, id);
@@ -0,0 +1,45 @@
+-- Audit events don't reference what they record, so they outlive it. The
+-- diff is JSON rather than JSONB to keep it as it was hashed. The hash covers
+-- the actor, diff and client IP through personal_digest, so erasing a user can
+-- scrub them.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    user_id INTEGER,
+    diff JSON NOT NULL,
+    request_id VARCHAR(255) NOT NULL,
+    client_ip VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    personal_digest VARCHAR(64) NOT NULL,
+    erased_at TIMESTAMPTZ,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_user_id_idx ON audit_events (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target, id);
+
+-- The log is append-only, besides erasures scrubbing personal data
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.erased_at IS NOT NULL
+        AND NEW.id = OLD.id
+        AND NEW.action = OLD.action
+        AND NEW.target = OLD.target
+        AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+        AND NEW.request_id = OLD.request_id
+        AND NEW.created_at = OLD.created_at
+        AND NEW.personal_digest = OLD.personal_digest
+        AND NEW.prev_hash = OLD.prev_hash
+        AND NEW.hash = OLD.hash THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,24 @@
+-- Events about users, written in the transaction of the change they announce
+-- and delivered by the relay. Like audit events they outlive their user.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    payload JSON NOT NULL,
+    request_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_published_at_idx ON outbox_events (published_at);
+
+-- The relay that holds the lease is the only one publishing, which keeps the
+-- events of a user in order
+CREATE TABLE IF NOT EXISTS outbox_leases (
+    name VARCHAR(64) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
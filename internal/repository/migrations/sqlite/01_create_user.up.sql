@@ -0,0 +1,9 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    role TEXT NOT NULL,
+    hashed_password TEXT NOT NULL,
+    password_changed_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
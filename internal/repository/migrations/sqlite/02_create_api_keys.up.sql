@@ -0,0 +1,15 @@
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT UNIQUE NOT NULL,
+    hashed_secret TEXT NOT NULL,
+    -- JSON array of scope names
+    scopes TEXT NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
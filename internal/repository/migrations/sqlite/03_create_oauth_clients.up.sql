@@ -0,0 +1,8 @@
+CREATE TABLE oauth_clients (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client_id TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    hashed_secret TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS oauth_authorization_codes;
+
+ALTER TABLE oauth_clients DROP COLUMN redirect_uris;
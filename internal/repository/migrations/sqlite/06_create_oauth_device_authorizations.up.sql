@@ -0,0 +1,13 @@
+CREATE TABLE oauth_device_authorizations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_code_hash TEXT UNIQUE NOT NULL,
+    user_code TEXT UNIQUE NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    interval INTEGER NOT NULL,
+    last_polled_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN updated_at;
+ALTER TABLE users DROP COLUMN active;
+ALTER TABLE users DROP COLUMN external_id;
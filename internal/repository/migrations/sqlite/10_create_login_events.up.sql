@@ -0,0 +1,14 @@
+CREATE TABLE login_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    method TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    session_id TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_events_user_id_idx ON login_events (user_id, created_at);
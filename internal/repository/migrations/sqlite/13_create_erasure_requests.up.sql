@@ -0,0 +1,11 @@
+CREATE TABLE erasure_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    requested_by INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX erasure_requests_pending_idx ON erasure_requests (user_id) WHERE status = 'pending';
+CREATE INDEX erasure_requests_status_idx ON erasure_requests (status, id);
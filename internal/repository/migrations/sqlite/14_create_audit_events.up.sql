@@ -0,0 +1,39 @@
+CREATE TABLE audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL,
+    user_id INTEGER,
+    diff TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    personal_digest TEXT NOT NULL,
+    erased_at TIMESTAMP,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, id);
+CREATE INDEX audit_events_target_idx ON audit_events (target, id);
+
+-- The log is append-only, besides erasures scrubbing personal data
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+WHEN NOT (NEW.erased_at IS NOT NULL
+    AND NEW.id = OLD.id
+    AND NEW.action = OLD.action
+    AND NEW.target = OLD.target
+    AND NEW.user_id IS OLD.user_id
+    AND NEW.request_id = OLD.request_id
+    AND NEW.created_at = OLD.created_at
+    AND NEW.personal_digest = OLD.personal_digest
+    AND NEW.prev_hash = OLD.prev_hash
+    AND NEW.hash = OLD.hash)
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
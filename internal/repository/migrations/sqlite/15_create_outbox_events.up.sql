@@ -0,0 +1,20 @@
+CREATE TABLE outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (id) WHERE published_at IS NULL;
+CREATE INDEX outbox_events_published_at_idx ON outbox_events (published_at);
+
+CREATE TABLE outbox_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const oauthClientColumns = "id, client_id, name, hashed_secret, scopes, redirect_uris, created_at"
+
+type oauthClientModel struct {
+	id           int
+	clientID     string
+	name         string
+	hashedSecret string
+	scopes       []string
+	redirectURIs []string
+	createdAt    time.Time
+}
+
+func (c oauthClientModel) ToDomain() *domain.OAuthClient {
+	return &domain.OAuthClient{
+		ID:           c.id,
+		ClientID:     c.clientID,
+		Name:         c.name,
+		HashedSecret: c.hashedSecret,
+		Scopes:       c.scopes,
+		RedirectURIs: c.redirectURIs,
+		CreatedAt:    c.createdAt,
+	}
+}
+
+func (c *oauthClientModel) scanTargets() []interface{} {
+	return []interface{}{&c.id, &c.clientID, &c.name, &c.hashedSecret, &c.scopes, &c.redirectURIs, &c.createdAt}
+}
+
+type CreateOAuthClientParams struct {
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	HashedSecret string   `json:"hashed_secret"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+func (p *postgres) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*domain.OAuthClient, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateOAuthClient")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateOAuthClient"),
+		attribute.String("oauth_client.client_id", params.ClientID),
+	)
+
+	createdAt := time.Now()
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insertQuery := "INSERT INTO oauth_clients (client_id, name, hashed_secret, scopes, redirect_uris, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	var id int
+	err = tx.QueryRow(ctx, insertQuery, params.ClientID, params.Name, params.HashedSecret, params.Scopes, params.RedirectURIs, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert oauth client into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert oauth client into database: %w", dbError(err))
+	}
+
+	client := &domain.OAuthClient{
+		ID:           id,
+		ClientID:     params.ClientID,
+		Name:         params.Name,
+		HashedSecret: params.HashedSecret,
+		Scopes:       params.Scopes,
+		RedirectURIs: params.RedirectURIs,
+		CreatedAt:    createdAt,
+	}
+	if err := p.recordChanges(ctx, tx, oauthClientChange(domain.AuditActionOAuthClientCreate, nil, client)); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert oauth client into database: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert oauth client into database: %w", dbError(err))
+	}
+	return client, nil
+}
+
+func (p *postgres) GetOAuthClientByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetOAuthClientByClientID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "GetOAuthClientByClientID"),
+		attribute.String("oauth_client.client_id", clientID),
+	)
+
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients WHERE client_id = $1"
+	var client oauthClientModel
+
+	err := p.conn.QueryRow(ctx, query, clientID).Scan(client.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "oauth client not found with the provided client id: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("oauth client not found with the provided client id: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to find oauth client by client id: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("oauth client not found: %w", dbError(err))
+	}
+	return client.ToDomain(), nil
+}
+
+func (p *postgres) ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListOAuthClients")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "ListOAuthClients"))
+
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY created_at DESC"
+	rows, err := p.conn.Query(ctx, query)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list oauth clients: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list oauth clients: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var clients []domain.OAuthClient
+	for rows.Next() {
+		var client oauthClientModel
+		if err := rows.Scan(client.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan oauth client: %w", err)
+		}
+		clients = append(clients, *client.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list oauth clients: %w", dbError(err))
+	}
+	return clients, nil
+}
+
+func (p *postgres) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "DeleteOAuthClient")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "DeleteOAuthClient"),
+		attribute.String("oauth_client.client_id", clientID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var client oauthClientModel
+	err = tx.QueryRow(ctx, "DELETE FROM oauth_clients WHERE client_id = $1 RETURNING "+oauthClientColumns, clientID).Scan(client.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "oauth client %s not found: %v", clientID, domain.ErrNotFound)
+			span.SetAttributes(attribute.Bool("oauth_client.deleted", false))
+
+			return fmt.Errorf("oauth client %s not found: %w", clientID, domain.ErrNotFound)
+		}
+		logFromCtx.Errorf(ctx, "failed to delete oauth client %s: %v", clientID, err)
+		span.RecordError(err)
+
+		return fmt.Errorf("failed to delete oauth client %s: %w", clientID, dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, oauthClientChange(domain.AuditActionOAuthClientDelete, client.ToDomain(), nil)); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete oauth client %s: %w", clientID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete oauth client %s: %w", clientID, dbError(err))
+	}
+	span.SetAttributes(attribute.Bool("oauth_client.deleted", true))
+
+	return nil
+}
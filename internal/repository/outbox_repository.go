@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// outboxRelayLease is the name of the lease relays take before publishing
+const outboxRelayLease = "relay"
+
+const outboxEventColumns = "id, user_id, type, payload, request_id, created_at"
+
+const lastUserEventIDQuery = "SELECT COALESCE(MAX(id), 0) FROM outbox_events"
+
+const insertOutboxEventQuery = "INSERT INTO outbox_events (user_id, type, payload, request_id, created_at) VALUES ($1, $2, $3, $4, $5)"
+
+const acquireOutboxLeaseQuery = `INSERT INTO outbox_leases (name, holder, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+WHERE outbox_leases.holder = excluded.holder OR outbox_leases.expires_at <= $4`
+
+// userEventTypes are the types of the events that changes of users emit, by
+// the action of the change. Purges emit none, since their users were deleted
+// before.
+var userEventTypes = map[string]string{
+	domain.AuditActionUserCreate:  domain.UserEventCreated,
+	domain.AuditActionUserUpdate:  domain.UserEventUpdated,
+	domain.AuditActionUserRestore: domain.UserEventUpdated,
+	domain.AuditActionUserErase:   domain.UserEventUpdated,
+	domain.AuditActionUserDelete:  domain.UserEventDeleted,
+}
+
+type outboxEventModel struct {
+	id        int
+	userID    int
+	eventType string
+	payload   string
+	requestID string
+	createdAt time.Time
+}
+
+func (e outboxEventModel) ToDomain() (*domain.UserEvent, error) {
+	event := &domain.UserEvent{
+		ID:         e.id,
+		Type:       e.eventType,
+		UserID:     e.userID,
+		RequestID:  e.requestID,
+		OccurredAt: e.createdAt,
+	}
+	if err := json.Unmarshal([]byte(e.payload), &event.User); err != nil {
+		return nil, fmt.Errorf("invalid payload of event %d: %w", e.id, err)
+	}
+	return event, nil
+}
+
+func (e *outboxEventModel) scanTargets() []interface{} {
+	return []interface{}{&e.id, &e.userID, &e.eventType, &e.payload, &e.requestID, &e.createdAt}
+}
+
+func outboxEventsToDomain(models []outboxEventModel) ([]domain.UserEvent, error) {
+	events := make([]domain.UserEvent, 0, len(models))
+	for _, model := range models {
+		event, err := model.ToDomain()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, nil
+}
+
+// outboxEventInsertArgs are the arguments of insertOutboxEventQuery
+func outboxEventInsertArgs(event domain.UserEvent) ([]interface{}, error) {
+	payload, err := json.Marshal(event.User)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	return []interface{}{event.UserID, event.Type, string(payload), event.RequestID, event.OccurredAt}, nil
+}
+
+// eraseUserSnapshot replaces the personal data in a snapshot of an erased user
+// with the values erasure leaves
+func eraseUserSnapshot(user *domain.UserSnapshot) {
+	user.Name = domain.ErasedUserName
+	user.Email = domain.ErasedUserEmail(user.ID)
+	user.ExternalID = ""
+}
+
+// eraseOutboxEvents replaces the personal data of an erased user in the
+// payloads of its events with the values erasure leaves. list lists the events
+// of the user and update writes back the payload of an event.
+func eraseOutboxEvents(userID int, list func() ([]outboxEventModel, error), update func(eventID int, payload string) error) error {
+	models, err := list()
+	if err != nil {
+		return fmt.Errorf("failed to list user events of user %d: %w", userID, err)
+	}
+	events, err := outboxEventsToDomain(models)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		eraseUserSnapshot(&event.User)
+		payload, err := json.Marshal(event.User)
+		if err != nil {
+			return fmt.Errorf("failed to encode event payload: %w", err)
+		}
+		if err := update(event.ID, string(payload)); err != nil {
+			return fmt.Errorf("failed to erase user event %d: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// newUserEvents builds the events that changes made by the request of ctx
+// emit. They get their IDs when inserted.
+func newUserEvents(ctx context.Context, changes []change, now time.Time) []domain.UserEvent {
+	info := audit.FromContext(ctx)
+	var events []domain.UserEvent
+	for _, c := range changes {
+		eventType, ok := userEventTypes[c.action]
+		if !ok {
+			continue
+		}
+		user, _ := c.after.(*domain.User)
+		if user == nil {
+			user, _ = c.before.(*domain.User)
+		}
+		events = append(events, domain.UserEvent{
+			Type:       eventType,
+			UserID:     user.ID,
+			User:       domain.NewUserSnapshot(*user),
+			RequestID:  info.RequestID,
+			OccurredAt: now.UTC().Truncate(audit.TimePrecision),
+		})
+	}
+	return events
+}
+
+// insertUserEvents writes the events of changes to the outbox in tx. Callers
+// hold the audit lock, so event IDs increase in the order of the commits.
+func (p *postgres) insertUserEvents(ctx context.Context, tx pgx.Tx, changes []change, now time.Time) error {
+	for _, event := range newUserEvents(ctx, changes, now) {
+		args, err := outboxEventInsertArgs(event)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, insertOutboxEventQuery, args...); err != nil {
+			return fmt.Errorf("failed to insert outbox event: %w", dbError(err))
+		}
+	}
+	return nil
+}
+
+// eraseUserEvents scrubs the personal data of an erased user from its events
+// in the outbox in tx, published or not, and from their webhook deliveries
+func (p *postgres) eraseUserEvents(ctx context.Context, tx pgx.Tx, userID int) error {
+	err := eraseOutboxEvents(userID,
+		func() ([]outboxEventModel, error) {
+			rows, err := tx.Query(ctx, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE user_id = $1 ORDER BY id", userID)
+			if err != nil {
+				return nil, dbError(err)
+			}
+			defer rows.Close()
+
+			var models []outboxEventModel
+			for rows.Next() {
+				var model outboxEventModel
+				if err := rows.Scan(model.scanTargets()...); err != nil {
+					return nil, err
+				}
+				models = append(models, model)
+			}
+			return models, dbError(rows.Err())
+		},
+		func(eventID int, payload string) error {
+			_, err := tx.Exec(ctx, "UPDATE outbox_events SET payload = $1 WHERE id = $2", payload, eventID)
+			return dbError(err)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return p.eraseUserWebhookDeliveries(ctx, tx, userID)
+}
+
+// ListPendingUserEvents returns the oldest events that weren't published yet
+func (p *postgres) ListPendingUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListPendingUserEvents")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListPendingUserEvents"),
+		attribute.Int("list.limit", limit),
+	)
+
+	rows, err := p.conn.Query(ctx, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list pending user events: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list pending user events: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var models []outboxEventModel
+	for rows.Next() {
+		var model outboxEventModel
+		if err := rows.Scan(model.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan user event: %w", err)
+		}
+		models = append(models, model)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list pending user events: %w", dbError(err))
+	}
+	return outboxEventsToDomain(models)
+}
+
+// ListUserEvents returns the events after afterID, published or not, oldest
+// first. IDs increase in commit order, so a reader that keeps the ID of the
+// last event it saw doesn't miss any.
+func (p *postgres) ListUserEvents(ctx context.Context, afterID int, limit int) ([]domain.UserEvent, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListUserEvents")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListUserEvents"),
+		attribute.Int("list.after_id", afterID),
+		attribute.Int("list.limit", limit),
+	)
+
+	rows, err := p.conn.Query(ctx, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user events: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var models []outboxEventModel
+	for rows.Next() {
+		var model outboxEventModel
+		if err := rows.Scan(model.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan user event: %w", err)
+		}
+		models = append(models, model)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user events: %w", dbError(err))
+	}
+	return outboxEventsToDomain(models)
+}
+
+// LastUserEventID returns the ID of the newest event, 0 when there is none
+func (p *postgres) LastUserEventID(ctx context.Context) (int, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "LastUserEventID")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "LastUserEventID"))
+
+	var id int
+	if err := p.conn.QueryRow(ctx, lastUserEventIDQuery).Scan(&id); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to get last user event: %w", dbError(err))
+	}
+	return id, nil
+}
+
+func (p *postgres) MarkUserEventPublished(ctx context.Context, eventID int, publishedAt time.Time) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "MarkUserEventPublished")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "MarkUserEventPublished"),
+		attribute.Int("user_event.id", eventID),
+	)
+
+	_, err := p.conn.Exec(ctx, "UPDATE outbox_events SET published_at = $1, last_error = '' WHERE id = $2", publishedAt, eventID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to mark user event published: %w", dbError(err))
+	}
+	return nil
+}
+
+// MarkUserEventFailed counts a failed attempt to publish an event, which stays
+// pending
+func (p *postgres) MarkUserEventFailed(ctx context.Context, eventID int, reason string) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "MarkUserEventFailed")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "MarkUserEventFailed"),
+		attribute.Int("user_event.id", eventID),
+	)
+
+	_, err := p.conn.Exec(ctx, "UPDATE outbox_events SET attempts = attempts + 1, last_error = $1 WHERE id = $2", reason, eventID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to mark user event failed: %w", dbError(err))
+	}
+	return nil
+}
+
+// AcquireOutboxLease takes or renews the relay lease for holder until now +
+// duration. It returns false while another holder has an unexpired lease.
+func (p *postgres) AcquireOutboxLease(ctx context.Context, holder string, now time.Time, duration time.Duration) (bool, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "AcquireOutboxLease")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "AcquireOutboxLease"))
+
+	tag, err := p.conn.Exec(ctx, acquireOutboxLeaseQuery, outboxRelayLease, holder, now.Add(duration), now)
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to acquire outbox lease: %w", dbError(err))
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeletePublishedUserEvents removes the events published before publishedBefore
+func (p *postgres) DeletePublishedUserEvents(ctx context.Context, publishedBefore time.Time) (int, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "DeletePublishedUserEvents")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "DeletePublishedUserEvents"))
+
+	tag, err := p.conn.Exec(ctx, "DELETE FROM outbox_events WHERE published_at < $1", publishedBefore)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete published user events: %w", dbError(err))
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// insertUserEvents writes the events of changes to the outbox in tx
+func (s *sqlite) insertUserEvents(ctx context.Context, tx sqliteQuerier, changes []change, now time.Time) error {
+	for _, event := range newUserEvents(ctx, changes, now) {
+		args, err := outboxEventInsertArgs(event)
+		if err != nil {
+			return err
+		}
+		if _, err := sqliteExec(ctx, tx, insertOutboxEventQuery, args...); err != nil {
+			return fmt.Errorf("failed to insert outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+// eraseUserEvents scrubs the personal data of an erased user from its events
+// in the outbox in tx, published or not, and from their webhook deliveries
+func (s *sqlite) eraseUserEvents(ctx context.Context, tx sqliteQuerier, userID int) error {
+	err := eraseOutboxEvents(userID,
+		func() ([]outboxEventModel, error) {
+			var models []outboxEventModel
+			err := sqliteQuery(ctx, tx, func() ([]interface{}, func()) {
+				var model outboxEventModel
+				return model.scanTargets(), func() { models = append(models, model) }
+			}, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE user_id = $1 ORDER BY id", userID)
+			return models, err
+		},
+		func(eventID int, payload string) error {
+			_, err := sqliteExec(ctx, tx, "UPDATE outbox_events SET payload = $1 WHERE id = $2", payload, eventID)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return s.eraseUserWebhookDeliveries(ctx, tx, userID)
+}
+
+func (s *sqlite) ListPendingUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListPendingUserEvents")
+	defer span.End()
+
+	var models []outboxEventModel
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var model outboxEventModel
+		return model.scanTargets(), func() { models = append(models, model) }
+	}, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list pending user events: %w", err)
+	}
+	return outboxEventsToDomain(models)
+}
+
+func (s *sqlite) ListUserEvents(ctx context.Context, afterID int, limit int) ([]domain.UserEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListUserEvents")
+	defer span.End()
+
+	var models []outboxEventModel
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var model outboxEventModel
+		return model.scanTargets(), func() { models = append(models, model) }
+	}, "SELECT "+outboxEventColumns+" FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user events: %w", err)
+	}
+	return outboxEventsToDomain(models)
+}
+
+func (s *sqlite) LastUserEventID(ctx context.Context) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "LastUserEventID")
+	defer span.End()
+
+	var id int
+	if err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, lastUserEventIDQuery); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to get last user event: %w", err)
+	}
+	return id, nil
+}
+
+func (s *sqlite) MarkUserEventPublished(ctx context.Context, eventID int, publishedAt time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "MarkUserEventPublished")
+	defer span.End()
+
+	if _, err := sqliteExec(ctx, s.db, "UPDATE outbox_events SET published_at = $1, last_error = '' WHERE id = $2", publishedAt, eventID); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to mark user event published: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) MarkUserEventFailed(ctx context.Context, eventID int, reason string) error {
+	ctx, span := startSQLiteSpan(ctx, "MarkUserEventFailed")
+	defer span.End()
+
+	if _, err := sqliteExec(ctx, s.db, "UPDATE outbox_events SET attempts = attempts + 1, last_error = $1 WHERE id = $2", reason, eventID); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to mark user event failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) AcquireOutboxLease(ctx context.Context, holder string, now time.Time, duration time.Duration) (bool, error) {
+	ctx, span := startSQLiteSpan(ctx, "AcquireOutboxLease")
+	defer span.End()
+
+	acquired, err := sqliteExec(ctx, s.db, acquireOutboxLeaseQuery, outboxRelayLease, holder, now.Add(duration), now)
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to acquire outbox lease: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+func (s *sqlite) DeletePublishedUserEvents(ctx context.Context, publishedBefore time.Time) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "DeletePublishedUserEvents")
+	defer span.End()
+
+	deleted, err := sqliteExec(ctx, s.db, "DELETE FROM outbox_events WHERE published_at < $1", publishedBefore)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete published user events: %w", err)
+	}
+	return int(deleted), nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AddPasswordHistory records a password hash of a user and drops all but the
+// latest keep hashes of the user.
+func (p *postgres) AddPasswordHistory(ctx context.Context, userID int, hashedPassword string, keep int) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "AddPasswordHistory")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "AddPasswordHistory"),
+		attribute.Int("user.id", userID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "INSERT INTO password_history (user_id, hashed_password, created_at) VALUES ($1, $2, $3)", userID, hashedPassword, time.Now())
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert password history: %v", err)
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert password history: %w", dbError(err))
+	}
+
+	trimQuery := `DELETE FROM password_history WHERE user_id = $1 AND id NOT IN
+		(SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2)`
+	if _, err := tx.Exec(ctx, trimQuery, userID, keep); err != nil {
+		logFromCtx.Errorf(ctx, "failed to trim password history: %v", err)
+		span.RecordError(err)
+		return fmt.Errorf("failed to trim password history: %w", dbError(err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to commit password history: %w", dbError(err))
+	}
+	return nil
+}
+
+// ListPasswordHistory returns the latest password hashes of a user, newest first
+func (p *postgres) ListPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListPasswordHistory")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListPasswordHistory"),
+		attribute.Int("user.id", userID),
+	)
+
+	rows, err := p.conn.Query(ctx, "SELECT hashed_password FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list password history: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list password history: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list password history: %w", dbError(err))
+	}
+	return hashes, nil
+}
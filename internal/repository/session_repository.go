@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const sessionColumns = "id, user_id, ip_address, user_agent, expires_at, revoked_at, created_at"
+
+type sessionModel struct {
+	id        string
+	userID    int
+	ipAddress string
+	userAgent string
+	expiresAt time.Time
+	revokedAt *time.Time
+	createdAt time.Time
+}
+
+func (s sessionModel) ToDomain() *domain.Session {
+	return &domain.Session{
+		ID:        s.id,
+		UserID:    s.userID,
+		IPAddress: s.ipAddress,
+		UserAgent: s.userAgent,
+		ExpiresAt: s.expiresAt,
+		RevokedAt: s.revokedAt,
+		CreatedAt: s.createdAt,
+	}
+}
+
+func (s *sessionModel) scanTargets() []interface{} {
+	return []interface{}{&s.id, &s.userID, &s.ipAddress, &s.userAgent, &s.expiresAt, &s.revokedAt, &s.createdAt}
+}
+
+type CreateSessionParams struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (p *postgres) CreateSession(ctx context.Context, params CreateSessionParams) (*domain.Session, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateSession")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateSession"),
+		attribute.Int("user.id", params.UserID),
+	)
+
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO sessions (id, user_id, ip_address, user_agent, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := p.conn.Exec(ctx, insertQuery, params.ID, params.UserID, params.IPAddress, params.UserAgent, params.ExpiresAt, createdAt)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert session into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert session into database: %w", dbError(err))
+	}
+
+	return &domain.Session{
+		ID:        params.ID,
+		UserID:    params.UserID,
+		IPAddress: params.IPAddress,
+		UserAgent: params.UserAgent,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (p *postgres) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetSession")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "GetSession"))
+
+	var session sessionModel
+	err := p.conn.QueryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1", sessionID).Scan(session.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "session not found: %v", err)
+			span.RecordError(err)
+
+			return nil, fmt.Errorf("session not found: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to get session: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to get session: %w", dbError(err))
+	}
+	return session.ToDomain(), nil
+}
+
+// ListSessionsByUserID returns the sessions of a user that are neither revoked
+// nor expired, newest first.
+func (p *postgres) ListSessionsByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	return p.listSessions(ctx, "ListSessionsByUserID", userID, true)
+}
+
+// ListSessionHistoryByUserID returns every session of a user, including the
+// revoked and expired ones, newest first
+func (p *postgres) ListSessionHistoryByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	return p.listSessions(ctx, "ListSessionHistoryByUserID", userID, false)
+}
+
+func (p *postgres) listSessions(ctx context.Context, method string, userID int, activeOnly bool) ([]domain.Session, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, method)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", method),
+		attribute.Int("user.id", userID),
+	)
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = $1 AND (NOT $2 OR (revoked_at IS NULL AND expires_at > $3)) ORDER BY created_at DESC"
+	rows, err := p.conn.Query(ctx, query, userID, activeOnly, time.Now())
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list sessions: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list sessions: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		var session sessionModel
+		if err := rows.Scan(session.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, *session.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list sessions: %w", dbError(err))
+	}
+	span.SetAttributes(attribute.Int("session.count", len(sessions)))
+
+	return sessions, nil
+}
+
+func (p *postgres) RevokeSession(ctx context.Context, sessionID string) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RevokeSession")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "RevokeSession"))
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before, after sessionModel
+	err = tx.QueryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1 AND revoked_at IS NULL FOR UPDATE", sessionID).Scan(before.scanTargets()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logFromCtx.Errorf(ctx, "active session not found: %v", domain.ErrNotFound)
+			span.SetAttributes(attribute.Bool("session.revoked", false))
+
+			return fmt.Errorf("active session not found: %w", domain.ErrNotFound)
+		}
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke session: %w", dbError(err))
+	}
+
+	err = tx.QueryRow(ctx, "UPDATE sessions SET revoked_at = $1 WHERE id = $2 RETURNING "+sessionColumns, time.Now(), sessionID).Scan(after.scanTargets()...)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to revoke session: %v", err)
+		span.RecordError(err)
+
+		return fmt.Errorf("failed to revoke session: %w", dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, sessionChange(domain.AuditActionSessionRevoke, before.ToDomain(), after.ToDomain())); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke session: %w", dbError(err))
+	}
+	span.SetAttributes(attribute.Bool("session.revoked", true))
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlite is an IRepository stored in a SQLite database file, for deployments
+// without a Postgres server. It reports the same errors as the Postgres repository,
+// so callers can't tell the two stores apart.
+//
+// Times are stored as UTC text, which SQLite compares in time order, and
+// string lists as JSON arrays.
+type sqlite struct {
+	db     *sql.DB
+	logger logger.Logger
+}
+
+// NewSQLite opens, and creates if needed, the SQLite database at path
+func NewSQLite(path string, logger logger.Logger) IRepository {
+	db, err := openSQLite(path)
+	if err != nil {
+		panic(err)
+	}
+	return &sqlite{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_time_format", "sqlite")
+	// Write transactions take the database lock when they begin, so reads in
+	// them can't go stale before the write
+	q.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite db. %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening sqlite db. %w", err)
+	}
+	return db, nil
+}
+
+func startSQLiteSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, method)
+	span.SetAttributes(
+		attribute.String("repository.method.name", method),
+		attribute.String("repository.driver", "sqlite"),
+	)
+	return ctx, span
+}
+
+// sqliteArgs converts query arguments to their stored form
+func sqliteArgs(args ...interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case time.Time:
+			converted[i] = value.UTC()
+		case *time.Time:
+			if value != nil {
+				converted[i] = value.UTC()
+			}
+		case []string:
+			converted[i] = sqliteStrings{values: &value}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// sqliteTargets wraps the scan targets of a model that SQLite can't scan into
+func sqliteTargets(targets []interface{}) []interface{} {
+	for i, target := range targets {
+		if values, ok := target.(*[]string); ok {
+			targets[i] = sqliteStrings{values: values}
+		}
+	}
+	return targets
+}
+
+// sqliteStrings stores a string list as a JSON array
+type sqliteStrings struct {
+	values *[]string
+}
+
+func (s sqliteStrings) Value() (driver.Value, error) {
+	if *s.values == nil {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal(*s.values)
+	return string(encoded), err
+}
+
+func (s sqliteStrings) Scan(src interface{}) error {
+	var encoded []byte
+	switch value := src.(type) {
+	case string:
+		encoded = []byte(value)
+	case []byte:
+		encoded = value
+	default:
+		return fmt.Errorf("can't scan %T into a string list", src)
+	}
+	*s.values = []string{}
+	return json.Unmarshal(encoded, s.values)
+}
+
+// sqliteError translates SQLite errors to the sentinel errors of the domain
+func sqliteError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", domain.ErrNotFound, err)
+	}
+	var sqliteErr *sqlitedriver.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	// The message is like "UNIQUE constraint failed: users.email (2067)"
+	constraint := sqliteErr.Error()
+	if _, detail, ok := strings.Cut(constraint, "constraint failed: "); ok {
+		constraint, _, _ = strings.Cut(detail, " (")
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return uniqueViolationError(constraint)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return foreignKeyViolationError(constraint)
+	}
+	return err
+}
+
+// sqliteQuerier is what sqlite and its transactions run queries with
+type sqliteQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func sqliteQueryRow(ctx context.Context, q sqliteQuerier, targets []interface{}, query string, args ...interface{}) error {
+	err := q.QueryRowContext(ctx, query, sqliteArgs(args...)...).Scan(sqliteTargets(targets)...)
+	if err != nil {
+		return sqliteError(err)
+	}
+	return nil
+}
+
+func sqliteExec(ctx context.Context, q sqliteQuerier, query string, args ...interface{}) (int64, error) {
+	result, err := q.ExecContext(ctx, query, sqliteArgs(args...)...)
+	if err != nil {
+		return 0, sqliteError(err)
+	}
+	return result.RowsAffected()
+}
+
+// sqliteQuery scans every row of a query with the targets newRow returns,
+// calling add after each row
+func sqliteQuery(ctx context.Context, q sqliteQuerier, newRow func() (targets []interface{}, add func()), query string, args ...interface{}) error {
+	rows, err := q.QueryContext(ctx, query, sqliteArgs(args...)...)
+	if err != nil {
+		return sqliteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		targets, add := newRow()
+		if err := rows.Scan(sqliteTargets(targets)...); err != nil {
+			return err
+		}
+		add()
+	}
+	return rows.Err()
+}
+
+// withTx runs fn in a transaction, committing it when fn succeeds
+func (s *sqlite) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
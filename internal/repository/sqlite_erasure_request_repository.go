@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+func (s *sqlite) CreateErasureRequest(ctx context.Context, userID int, requestedBy int) (*domain.ErasureRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateErasureRequest")
+	defer span.End()
+
+	query := `INSERT INTO erasure_requests (user_id, requested_by, status, created_at)
+		SELECT id, $2, $3, $4 FROM users WHERE id = $1
+		ON CONFLICT (user_id) WHERE status = 'pending' DO UPDATE SET status = erasure_requests.status
+		RETURNING ` + erasureRequestColumns
+	var request erasureRequestModel
+	err := sqliteQueryRow(ctx, s.db, request.scanTargets(), query, userID, requestedBy, domain.ErasureStatusPending, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create erasure request of user %d: %w", userID, err)
+	}
+	return request.ToDomain(), nil
+}
+
+func (s *sqlite) EraseUser(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "EraseUser")
+	defer span.End()
+
+	var request erasureRequestModel
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		completeQuery := "UPDATE erasure_requests SET status = $1, completed_at = $2 WHERE id = $3 AND status = $4 RETURNING " + erasureRequestColumns
+		err := sqliteQueryRow(ctx, tx, request.scanTargets(), completeQuery, domain.ErasureStatusCompleted, now, requestID, domain.ErasureStatusPending)
+		if err != nil {
+			return fmt.Errorf("pending erasure request %d not found: %w", requestID, err)
+		}
+
+		var before, after userModel
+		if err := sqliteQueryRow(ctx, tx, before.scanTargets(), "SELECT "+userColumns+" FROM users WHERE id = $1", request.userID); err != nil {
+			return fmt.Errorf("user %d of erasure request not found: %w", request.userID, err)
+		}
+		for _, stmt := range eraseUserStatements(request.userID, before.email, now) {
+			if _, err := sqliteExec(ctx, tx, stmt.query, stmt.args...); err != nil {
+				return fmt.Errorf("failed to erase user %d: %w", request.userID, err)
+			}
+		}
+		if err := sqliteQueryRow(ctx, tx, after.scanTargets(), "SELECT "+userColumns+" FROM users WHERE id = $1", request.userID); err != nil {
+			return fmt.Errorf("failed to erase user %d: %w", request.userID, err)
+		}
+		if err := s.recordChanges(ctx, tx, eraseChange(*before.ToDomain(), *after.ToDomain())); err != nil {
+			return err
+		}
+		if err := s.eraseUserAuditEvents(ctx, tx, request.userID, before.email, now); err != nil {
+			return err
+		}
+		return s.eraseUserEvents(ctx, tx, request.userID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return request.ToDomain(), nil
+}
+
+func (s *sqlite) GetErasureRequest(ctx context.Context, requestID int) (*domain.ErasureRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetErasureRequest")
+	defer span.End()
+
+	var request erasureRequestModel
+	err := sqliteQueryRow(ctx, s.db, request.scanTargets(), "SELECT "+erasureRequestColumns+" FROM erasure_requests WHERE id = $1", requestID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find erasure request %d: %w", requestID, err)
+	}
+	return request.ToDomain(), nil
+}
+
+func (s *sqlite) ListErasureRequests(ctx context.Context, params ListErasureRequestsParams) ([]domain.ErasureRequest, int, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListErasureRequests")
+	defer span.End()
+
+	where := "($1 = '' OR status = $1)"
+	var total int
+	if err := sqliteQueryRow(ctx, s.db, []interface{}{&total}, "SELECT COUNT(*) FROM erasure_requests WHERE "+where, params.Status); err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to count erasure requests: %w", err)
+	}
+
+	var requests []domain.ErasureRequest
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var request erasureRequestModel
+		return request.scanTargets(), func() { requests = append(requests, *request.ToDomain()) }
+	}, "SELECT "+erasureRequestColumns+" FROM erasure_requests WHERE "+where+" ORDER BY id LIMIT $2 OFFSET $3", params.Status, params.Limit, params.Offset)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list erasure requests: %w", err)
+	}
+	return requests, total, nil
+}
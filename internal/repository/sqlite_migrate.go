@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+const createSQLiteSchemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// EmbeddedSQLiteMigrations returns the SQLite migrations built into the
+// binary. They share versions and names with the Postgres ones.
+func EmbeddedSQLiteMigrations() fs.FS {
+	sub, err := fs.Sub(embeddedMigrations, "migrations/sqlite")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+func (s *sqlite) MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return migrateUp(ctx, s.withMigrationLock, migrations, steps)
+}
+
+func (s *sqlite) MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return migrateDown(ctx, s.withMigrationLock, migrations, steps)
+}
+
+func (s *sqlite) MigrateRedo(ctx context.Context, migrations []Migration) (*Migration, error) {
+	return migrateRedo(ctx, s.withMigrationLock, migrations)
+}
+
+func (s *sqlite) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, s.withMigrationLock, migrations)
+}
+
+// withMigrationLock runs fn with the migrations applied so far. SQLite has no
+// advisory locks; a migration applied concurrently by another process makes
+// the insert into schema_migrations fail, which rolls the migration back.
+func (s *sqlite) withMigrationLock(ctx context.Context, fn func(session migrationSession, applied map[int64]appliedMigration) error) error {
+	if _, err := s.db.ExecContext(ctx, createSQLiteSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]appliedMigration)
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var version int64
+		var row appliedMigration
+		return []interface{}{&version, &row.name, &row.checksum, &row.appliedAt}, func() {
+			applied[version] = row
+		}
+	}, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	return fn(s, applied)
+}
+
+func (s *sqlite) applyMigration(ctx context.Context, migration Migration) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		_, err := sqliteExec(ctx, tx, "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+			migration.Version, migration.Name, migration.Checksum, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infof(ctx, "Applied migration %d_%s", migration.Version, migration.Name)
+	return nil
+}
+
+func (s *sqlite) revertMigration(ctx context.Context, migration Migration) error {
+	if strings.TrimSpace(migration.Down) == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := sqliteExec(ctx, tx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infof(ctx, "Reverted migration %d_%s", migration.Version, migration.Name)
+	return nil
+}
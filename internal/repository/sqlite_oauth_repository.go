@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+func (s *sqlite) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*domain.APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateAPIKey")
+	defer span.End()
+
+	key := &domain.APIKey{
+		UserID:       params.UserID,
+		Name:         params.Name,
+		Prefix:       params.Prefix,
+		HashedSecret: params.HashedSecret,
+		Scopes:       params.Scopes,
+		ExpiresAt:    params.ExpiresAt,
+		CreatedAt:    time.Now(),
+	}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		insertQuery := "INSERT INTO api_keys (user_id, name, prefix, hashed_secret, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+		err := sqliteQueryRow(ctx, tx, []interface{}{&key.ID}, insertQuery, params.UserID, params.Name, params.Prefix, params.HashedSecret, params.Scopes, params.ExpiresAt, key.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, apiKeyChange(domain.AuditActionAPIKeyCreate, nil, key))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert api key into database: %w", err)
+	}
+	return key, nil
+}
+
+func (s *sqlite) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAPIKeyByPrefix")
+	defer span.End()
+
+	var key apiKeyModel
+	if err := sqliteQueryRow(ctx, s.db, key.scanTargets(), "SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = $1", prefix); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("api key not found with the provided prefix: %w", err)
+	}
+	return key.ToDomain(), nil
+}
+
+func (s *sqlite) ListAPIKeysByUserID(ctx context.Context, userID int) ([]domain.APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAPIKeysByUserID")
+	defer span.End()
+
+	var keys []domain.APIKey
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var key apiKeyModel
+		return key.scanTargets(), func() { keys = append(keys, *key.ToDomain()) }
+	}, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *sqlite) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	ctx, span := startSQLiteSpan(ctx, "RevokeAPIKey")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var before, after apiKeyModel
+		query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+		if err := sqliteQueryRow(ctx, tx, before.scanTargets(), query, keyID, userID); err != nil {
+			return err
+		}
+		err := sqliteQueryRow(ctx, tx, after.scanTargets(), "UPDATE api_keys SET revoked_at = $1 WHERE id = $2 RETURNING "+apiKeyColumns, time.Now(), keyID)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, apiKeyChange(domain.AuditActionAPIKeyRevoke, before.ToDomain(), after.ToDomain()))
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("active api key %d not found: %w", keyID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke api key %d: %w", keyID, err)
+	}
+	return nil
+}
+
+func (s *sqlite) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "TouchAPIKey")
+	defer span.End()
+
+	if _, err := sqliteExec(ctx, s.db, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt, keyID); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update api key last used time: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*domain.OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateOAuthClient")
+	defer span.End()
+
+	client := &domain.OAuthClient{
+		ClientID:     params.ClientID,
+		Name:         params.Name,
+		HashedSecret: params.HashedSecret,
+		Scopes:       params.Scopes,
+		RedirectURIs: params.RedirectURIs,
+		CreatedAt:    time.Now(),
+	}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		insertQuery := "INSERT INTO oauth_clients (client_id, name, hashed_secret, scopes, redirect_uris, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+		err := sqliteQueryRow(ctx, tx, []interface{}{&client.ID}, insertQuery, params.ClientID, params.Name, params.HashedSecret, params.Scopes, params.RedirectURIs, client.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, oauthClientChange(domain.AuditActionOAuthClientCreate, nil, client))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert oauth client into database: %w", err)
+	}
+	return client, nil
+}
+
+func (s *sqlite) GetOAuthClientByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOAuthClientByClientID")
+	defer span.End()
+
+	var client oauthClientModel
+	if err := sqliteQueryRow(ctx, s.db, client.scanTargets(), "SELECT "+oauthClientColumns+" FROM oauth_clients WHERE client_id = $1", clientID); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("oauth client not found with the provided client id: %w", err)
+	}
+	return client.ToDomain(), nil
+}
+
+func (s *sqlite) ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListOAuthClients")
+	defer span.End()
+
+	var clients []domain.OAuthClient
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var client oauthClientModel
+		return client.scanTargets(), func() { clients = append(clients, *client.ToDomain()) }
+	}, "SELECT "+oauthClientColumns+" FROM oauth_clients ORDER BY created_at DESC")
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (s *sqlite) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteOAuthClient")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var client oauthClientModel
+		err := sqliteQueryRow(ctx, tx, client.scanTargets(), "DELETE FROM oauth_clients WHERE client_id = $1 RETURNING "+oauthClientColumns, clientID)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, oauthClientChange(domain.AuditActionOAuthClientDelete, client.ToDomain(), nil))
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("oauth client %s not found: %w", clientID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete oauth client %s: %w", clientID, err)
+	}
+	return nil
+}
+
+func (s *sqlite) CreateAuthorizationCode(ctx context.Context, params CreateAuthorizationCodeParams) (*domain.AuthorizationCode, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateAuthorizationCode")
+	defer span.End()
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+	var id int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, insertQuery, params.CodeHash, params.ClientID, params.UserID, params.RedirectURI, params.Scopes, params.Nonce, params.CodeChallenge, params.AuthTime, params.ExpiresAt, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert authorization code into database: %w", err)
+	}
+
+	return &domain.AuthorizationCode{
+		ID:            id,
+		CodeHash:      params.CodeHash,
+		ClientID:      params.ClientID,
+		UserID:        params.UserID,
+		RedirectURI:   params.RedirectURI,
+		Scopes:        params.Scopes,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		AuthTime:      params.AuthTime,
+		ExpiresAt:     params.ExpiresAt,
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+func (s *sqlite) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	ctx, span := startSQLiteSpan(ctx, "ConsumeAuthorizationCode")
+	defer span.End()
+
+	var code authorizationCodeModel
+	query := "UPDATE oauth_authorization_codes SET used_at = $1 WHERE code_hash = $2 AND used_at IS NULL RETURNING " + authorizationCodeColumns
+	if err := sqliteQueryRow(ctx, s.db, code.scanTargets(), query, time.Now(), codeHash); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("authorization code not found or already used: %w", err)
+	}
+	return code.ToDomain(), nil
+}
+
+func (s *sqlite) CreateUserIdentity(ctx context.Context, params CreateUserIdentityParams) (*domain.UserIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateUserIdentity")
+	defer span.End()
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, insertQuery, params.UserID, params.Provider, params.Subject, params.Email, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert user identity into database: %w", err)
+	}
+
+	return &domain.UserIdentity{
+		ID:        id,
+		UserID:    params.UserID,
+		Provider:  params.Provider,
+		Subject:   params.Subject,
+		Email:     params.Email,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (s *sqlite) GetUserIdentity(ctx context.Context, provider string, subject string) (*domain.UserIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetUserIdentity")
+	defer span.End()
+
+	var identity domain.UserIdentity
+	targets := []interface{}{&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt}
+	query := "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2"
+	if err := sqliteQueryRow(ctx, s.db, targets, query, provider, subject); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("user identity not found: %w", err)
+	}
+	return &identity, nil
+}
+
+func (s *sqlite) ListUserIdentitiesByUserID(ctx context.Context, userID int) ([]domain.UserIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListUserIdentitiesByUserID")
+	defer span.End()
+
+	var identities []domain.UserIdentity
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var identity domain.UserIdentity
+		return []interface{}{&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt},
+			func() { identities = append(identities, identity) }
+	}, "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+	return identities, nil
+}
+
+func (s *sqlite) CreateDeviceAuthorization(ctx context.Context, params CreateDeviceAuthorizationParams) (*domain.DeviceAuthorization, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateDeviceAuthorization")
+	defer span.End()
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO oauth_device_authorizations (device_code_hash, user_code, client_id, scopes, status, interval, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	var id int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, insertQuery, params.DeviceCodeHash, params.UserCode, params.ClientID, params.Scopes, domain.DeviceAuthorizationPending, params.Interval, params.ExpiresAt, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert device authorization into database: %w", err)
+	}
+
+	return &domain.DeviceAuthorization{
+		ID:             id,
+		DeviceCodeHash: params.DeviceCodeHash,
+		UserCode:       params.UserCode,
+		ClientID:       params.ClientID,
+		Scopes:         params.Scopes,
+		Status:         domain.DeviceAuthorizationPending,
+		Interval:       params.Interval,
+		ExpiresAt:      params.ExpiresAt,
+		CreatedAt:      createdAt,
+	}, nil
+}
+
+func (s *sqlite) CompleteDeviceAuthorization(ctx context.Context, userCode string, userID int, status string) (*domain.DeviceAuthorization, error) {
+	ctx, span := startSQLiteSpan(ctx, "CompleteDeviceAuthorization")
+	defer span.End()
+
+	var authorization deviceAuthorizationModel
+	query := "UPDATE oauth_device_authorizations SET status = $1, user_id = $2 WHERE user_code = $3 AND status = $4 AND expires_at > $5 RETURNING " + deviceAuthorizationColumns
+	err := sqliteQueryRow(ctx, s.db, authorization.scanTargets(), query, status, userID, userCode, domain.DeviceAuthorizationPending, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("device authorization not found, expired or already completed: %w", err)
+	}
+	return authorization.ToDomain(), nil
+}
+
+func (s *sqlite) PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, polledAt time.Time) (*domain.DeviceAuthorization, error) {
+	ctx, span := startSQLiteSpan(ctx, "PollDeviceAuthorization")
+	defer span.End()
+
+	// RETURNING sees the new poll time, so the previous one is read first in
+	// the same transaction
+	var authorization deviceAuthorizationModel
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		query := "SELECT " + deviceAuthorizationColumns + " FROM oauth_device_authorizations WHERE device_code_hash = $1"
+		if err := sqliteQueryRow(ctx, tx, authorization.scanTargets(), query, deviceCodeHash); err != nil {
+			return err
+		}
+		_, err := sqliteExec(ctx, tx, "UPDATE oauth_device_authorizations SET last_polled_at = $1 WHERE id = $2", polledAt, authorization.id)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("device authorization not found: %w", err)
+	}
+	return authorization.ToDomain(), nil
+}
+
+func (s *sqlite) SlowDownDeviceAuthorization(ctx context.Context, id int, interval int) error {
+	ctx, span := startSQLiteSpan(ctx, "SlowDownDeviceAuthorization")
+	defer span.End()
+
+	if _, err := sqliteExec(ctx, s.db, "UPDATE oauth_device_authorizations SET interval = $1 WHERE id = $2", interval, id); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update device authorization interval: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*domain.DeviceAuthorization, error) {
+	ctx, span := startSQLiteSpan(ctx, "ConsumeDeviceAuthorization")
+	defer span.End()
+
+	var authorization deviceAuthorizationModel
+	query := "UPDATE oauth_device_authorizations SET status = $1 WHERE device_code_hash = $2 AND status = $3 RETURNING " + deviceAuthorizationColumns
+	err := sqliteQueryRow(ctx, s.db, authorization.scanTargets(), query, domain.DeviceAuthorizationConsumed, deviceCodeHash, domain.DeviceAuthorizationApproved)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("device authorization not approved or already used: %w", err)
+	}
+	return authorization.ToDomain(), nil
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+// sqliteLoginEventColumns are loginEventColumns without the Postgres cast
+const sqliteLoginEventColumns = "id, user_id, email, method, success, failure_reason, ip_address, user_agent, COALESCE(session_id, ''), created_at"
+
+func (s *sqlite) CreateMagicLink(ctx context.Context, params CreateMagicLinkParams) (*domain.MagicLink, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateMagicLink")
+	defer span.End()
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO magic_links (token_hash, user_id, email, expires_at, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, insertQuery, params.TokenHash, params.UserID, params.Email, params.ExpiresAt, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert magic link into database: %w", err)
+	}
+
+	return &domain.MagicLink{
+		ID:        id,
+		TokenHash: params.TokenHash,
+		UserID:    params.UserID,
+		Email:     params.Email,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (s *sqlite) CountMagicLinksSince(ctx context.Context, email string, since time.Time) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "CountMagicLinksSince")
+	defer span.End()
+
+	var count int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&count}, "SELECT COUNT(*) FROM magic_links WHERE LOWER(email) = LOWER($1) AND created_at > $2", email, since)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to count magic links: %w", err)
+	}
+	return count, nil
+}
+
+func (s *sqlite) ConsumeMagicLink(ctx context.Context, tokenHash string, email string, maxAttempts int) (*domain.MagicLink, error) {
+	ctx, span := startSQLiteSpan(ctx, "ConsumeMagicLink")
+	defer span.End()
+
+	query := `UPDATE magic_links SET used_at = $1
+		WHERE token_hash = $2 AND LOWER(email) = LOWER($3) AND used_at IS NULL AND expires_at > $1 AND attempts < $4
+		RETURNING ` + magicLinkColumns
+	var link magicLinkModel
+	if err := sqliteQueryRow(ctx, s.db, link.scanTargets(), query, time.Now(), tokenHash, email, maxAttempts); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("magic link not found, expired or already used: %w", err)
+	}
+	return link.ToDomain(), nil
+}
+
+func (s *sqlite) RecordMagicLinkFailure(ctx context.Context, email string) error {
+	ctx, span := startSQLiteSpan(ctx, "RecordMagicLinkFailure")
+	defer span.End()
+
+	_, err := sqliteExec(ctx, s.db, "UPDATE magic_links SET attempts = attempts + 1 WHERE LOWER(email) = LOWER($1) AND used_at IS NULL AND expires_at > $2", email, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to record magic link failure: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) CreateSession(ctx context.Context, params CreateSessionParams) (*domain.Session, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateSession")
+	defer span.End()
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO sessions (id, user_id, ip_address, user_agent, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := sqliteExec(ctx, s.db, insertQuery, params.ID, params.UserID, params.IPAddress, params.UserAgent, params.ExpiresAt, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert session into database: %w", err)
+	}
+
+	return &domain.Session{
+		ID:        params.ID,
+		UserID:    params.UserID,
+		IPAddress: params.IPAddress,
+		UserAgent: params.UserAgent,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (s *sqlite) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetSession")
+	defer span.End()
+
+	var session sessionModel
+	if err := sqliteQueryRow(ctx, s.db, session.scanTargets(), "SELECT "+sessionColumns+" FROM sessions WHERE id = $1", sessionID); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return session.ToDomain(), nil
+}
+
+func (s *sqlite) ListSessionsByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	return s.listSessions(ctx, "ListSessionsByUserID", userID, true)
+}
+
+func (s *sqlite) ListSessionHistoryByUserID(ctx context.Context, userID int) ([]domain.Session, error) {
+	return s.listSessions(ctx, "ListSessionHistoryByUserID", userID, false)
+}
+
+func (s *sqlite) listSessions(ctx context.Context, method string, userID int, activeOnly bool) ([]domain.Session, error) {
+	ctx, span := startSQLiteSpan(ctx, method)
+	defer span.End()
+
+	var sessions []domain.Session
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var session sessionModel
+		return session.scanTargets(), func() { sessions = append(sessions, *session.ToDomain()) }
+	}, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND (NOT $2 OR (revoked_at IS NULL AND expires_at > $3)) ORDER BY created_at DESC", userID, activeOnly, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (s *sqlite) RevokeSession(ctx context.Context, sessionID string) error {
+	ctx, span := startSQLiteSpan(ctx, "RevokeSession")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var before, after sessionModel
+		if err := sqliteQueryRow(ctx, tx, before.scanTargets(), "SELECT "+sessionColumns+" FROM sessions WHERE id = $1 AND revoked_at IS NULL", sessionID); err != nil {
+			return err
+		}
+		if err := sqliteQueryRow(ctx, tx, after.scanTargets(), "UPDATE sessions SET revoked_at = $1 WHERE id = $2 RETURNING "+sessionColumns, time.Now(), sessionID); err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, sessionChange(domain.AuditActionSessionRevoke, before.ToDomain(), after.ToDomain()))
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("active session not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) CreateLoginEvent(ctx context.Context, params CreateLoginEventParams) (*domain.LoginEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateLoginEvent")
+	defer span.End()
+
+	var sessionID *string
+	if params.SessionID != "" {
+		sessionID = &params.SessionID
+	}
+
+	createdAt := time.Now()
+	insertQuery := "INSERT INTO login_events (user_id, email, method, success, failure_reason, ip_address, user_agent, session_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
+	var id int
+	err := sqliteQueryRow(ctx, s.db, []interface{}{&id}, insertQuery, params.UserID, params.Email, params.Method, params.Success, params.FailureReason, params.IPAddress, params.UserAgent, sessionID, createdAt)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert login event into database: %w", err)
+	}
+
+	return &domain.LoginEvent{
+		ID:            id,
+		UserID:        params.UserID,
+		Email:         params.Email,
+		Method:        params.Method,
+		Success:       params.Success,
+		FailureReason: params.FailureReason,
+		IPAddress:     params.IPAddress,
+		UserAgent:     params.UserAgent,
+		SessionID:     params.SessionID,
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+func (s *sqlite) ListLoginEventsByUserID(ctx context.Context, userID int, limit int) ([]domain.LoginEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListLoginEventsByUserID")
+	defer span.End()
+
+	var events []domain.LoginEvent
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var event loginEventModel
+		return event.scanTargets(), func() { events = append(events, *event.ToDomain()) }
+	}, "SELECT "+sqliteLoginEventColumns+" FROM login_events WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list login events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *sqlite) AddPasswordHistory(ctx context.Context, userID int, hashedPassword string, keep int) error {
+	ctx, span := startSQLiteSpan(ctx, "AddPasswordHistory")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := sqliteExec(ctx, tx, "INSERT INTO password_history (user_id, hashed_password, created_at) VALUES ($1, $2, $3)", userID, hashedPassword, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to insert password history: %w", err)
+		}
+		trimQuery := `DELETE FROM password_history WHERE user_id = $1 AND id NOT IN
+			(SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2)`
+		if _, err := sqliteExec(ctx, tx, trimQuery, userID, keep); err != nil {
+			return fmt.Errorf("failed to trim password history: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *sqlite) ListPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListPasswordHistory")
+	defer span.End()
+
+	var hashes []string
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var hash string
+		return []interface{}{&hash}, func() { hashes = append(hashes, hash) }
+	}, "SELECT hashed_password FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list password history: %w", err)
+	}
+	return hashes, nil
+}
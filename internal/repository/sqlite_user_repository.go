@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *sqlite) CreateUser(ctx context.Context, params CreateUserParams) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateUser")
+	defer span.End()
+
+	now := time.Now()
+	user := &domain.User{
+		Name:              params.Name,
+		Email:             params.Email,
+		Role:              params.Role,
+		HashedPassword:    params.HashedPassword,
+		PasswordChangedAt: now,
+		CreatedAt:         now,
+		ExternalID:        params.ExternalID,
+		Active:            true,
+		UpdatedAt:         now,
+		Version:           1,
+	}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		insertQuery := "INSERT INTO users (name, email, role, hashed_password, password_changed_at, created_at, external_id, active, updated_at) VALUES ($1, $2, $3, $4, $5, $5, $6, TRUE, $5) RETURNING id"
+		err := sqliteQueryRow(ctx, tx, []interface{}{&user.ID}, insertQuery, params.Name, params.Email, params.Role, params.HashedPassword, now, params.ExternalID)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, userChange(domain.AuditActionUserCreate, nil, user))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert user into database: %w", err)
+	}
+	return user, nil
+}
+
+// updateUser checks the user that matches where is at expectedVersion unless
+// that is 0, runs update, an UPDATE returning the userColumns of that user,
+// and records the change in the audit log
+func (s *sqlite) updateUser(ctx context.Context, tx *sql.Tx, action string, where string, whereArg interface{}, expectedVersion int, update string, args ...interface{}) (*domain.User, error) {
+	var before, after userModel
+	if err := sqliteQueryRow(ctx, tx, before.scanTargets(), "SELECT "+userColumns+" FROM users WHERE "+where, whereArg); err != nil {
+		return nil, err
+	}
+	if err := checkUserVersion(before.version, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := sqliteQueryRow(ctx, tx, after.scanTargets(), update, args...); err != nil {
+		return nil, err
+	}
+	if err := s.recordChanges(ctx, tx, userChange(action, before.ToDomain(), after.ToDomain())); err != nil {
+		return nil, err
+	}
+	return after.ToDomain(), nil
+}
+
+func (s *sqlite) getUser(ctx context.Context, where string, arg interface{}) (*domain.User, error) {
+	var user userModel
+	if err := sqliteQueryRow(ctx, s.db, user.scanTargets(), "SELECT "+userColumns+" FROM users WHERE deleted_at IS NULL AND "+where, arg); err != nil {
+		return nil, err
+	}
+	return user.ToDomain(), nil
+}
+
+func (s *sqlite) GetUserByEmail(ctx context.Context, userEmail string) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetUserByEmail")
+	defer span.End()
+
+	user, err := s.getUser(ctx, "email = $1", userEmail)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("user not found with the provided email: %w", err)
+	}
+	return user, nil
+}
+
+func (s *sqlite) GetUserByID(ctx context.Context, userID int) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetUserByID")
+	defer span.End()
+
+	user, err := s.getUser(ctx, "id = $1", userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("user not found with the provided ID: %w", err)
+	}
+	return user, nil
+}
+
+func (s *sqlite) PartialUpdateUserByEmail(ctx context.Context, email string, updatedUser domain.User) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "PartialUpdateUserByEmail")
+	defer span.End()
+
+	var user *domain.User
+	err := s.withTx(ctx, func(tx *sql.Tx) (err error) {
+		update := "UPDATE users SET name = $1, updated_at = $2, version = version + 1 WHERE email = $3 AND deleted_at IS NULL RETURNING " + userColumns
+		user, err = s.updateUser(ctx, tx, domain.AuditActionUserUpdate, "email = $1 AND deleted_at IS NULL", email, updatedUser.Version, update, updatedUser.Name, time.Now(), email)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to partially update user by Email %s: %w", email, err)
+	}
+	return user, nil
+}
+
+func (s *sqlite) DeleteUserByEmail(ctx context.Context, email string, expectedVersion int) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteUserByEmail")
+	defer span.End()
+
+	var deleted int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		update := "UPDATE users SET deleted_at = $1, updated_at = $1, version = version + 1 WHERE email = $2 AND deleted_at IS NULL RETURNING " + userColumns
+		user, err := s.updateUser(ctx, tx, domain.AuditActionUserDelete, "email = $1 AND deleted_at IS NULL", email, expectedVersion, update, now, email)
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		deleted = 1
+		_, err = sqliteExec(ctx, tx, "UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", now, user.ID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete user by Email %s: %w", email, err)
+	}
+	span.SetAttributes(attribute.Bool("user.deleted", deleted > 0))
+	if deleted == 0 {
+		return fmt.Errorf("user with Email %s not found: %w", email, domain.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *sqlite) RestoreUser(ctx context.Context, userID int) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "RestoreUser")
+	defer span.End()
+
+	var user *domain.User
+	err := s.withTx(ctx, func(tx *sql.Tx) (err error) {
+		update := "UPDATE users SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NOT NULL RETURNING " + userColumns
+		user, err = s.updateUser(ctx, tx, domain.AuditActionUserRestore, "id = $1 AND deleted_at IS NOT NULL", userID, 0, update, time.Now(), userID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("deleted user %d not found: %w", userID, err)
+	}
+	return user, nil
+}
+
+func (s *sqlite) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeDeletedUsers")
+	defer span.End()
+
+	var purged int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var changes []change
+		var users []domain.User
+		err := sqliteQuery(ctx, tx, func() ([]interface{}, func()) {
+			var user userModel
+			return user.scanTargets(), func() {
+				changes = append(changes, purgeChange(*user.ToDomain()))
+				users = append(users, *user.ToDomain())
+			}
+		}, "SELECT "+userColumns+" FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1 ORDER BY id", deletedBefore)
+		if err != nil {
+			return err
+		}
+		if err := s.recordChanges(ctx, tx, changes...); err != nil {
+			return err
+		}
+		// Purged users leave no personal data in the audit log, the outbox or
+		// the webhook deliveries either
+		now := time.Now()
+		for _, user := range users {
+			if err := s.eraseUserAuditEvents(ctx, tx, user.ID, user.Email, now); err != nil {
+				return err
+			}
+			if err := s.eraseUserEvents(ctx, tx, user.ID); err != nil {
+				return err
+			}
+		}
+		purged, err = sqliteExec(ctx, tx, "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1", deletedBefore)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.purged", purged))
+	return int(purged), nil
+}
+
+func (s *sqlite) AuthenticateUser(ctx context.Context, email, password string) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "AuthenticateUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, "email = $1", email)
+	if err != nil {
+		return nil, fmt.Errorf("user with email %s not found: %w", email, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)); err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+	span.SetAttributes(attribute.Bool("user.authenticated", true), attribute.Int("user.id", user.ID))
+	return user, nil
+}
+
+func (s *sqlite) UpdateUser(ctx context.Context, userID int, params UpdateUserParams) (*domain.User, error) {
+	ctx, span := startSQLiteSpan(ctx, "UpdateUser")
+	defer span.End()
+
+	query := `UPDATE users SET
+		name = COALESCE($1, name),
+		email = COALESCE($2, email),
+		role = COALESCE($3, role),
+		external_id = COALESCE($4, external_id),
+		active = COALESCE($5, active),
+		hashed_password = COALESCE($6, hashed_password),
+		password_changed_at = CASE WHEN $6 IS NULL THEN password_changed_at ELSE $7 END,
+		updated_at = $7,
+		version = version + 1
+		WHERE id = $8 AND deleted_at IS NULL RETURNING ` + userColumns
+
+	var user *domain.User
+	err := s.withTx(ctx, func(tx *sql.Tx) (err error) {
+		user, err = s.updateUser(ctx, tx, domain.AuditActionUserUpdate, "id = $1 AND deleted_at IS NULL", userID, params.ExpectedVersion, query, params.Name, params.Email, params.Role, params.ExternalID, params.Active, params.HashedPassword, time.Now(), userID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to update user %d: %w", userID, err)
+	}
+	return user, nil
+}
+
+func (s *sqlite) RehashPassword(ctx context.Context, userID int, currentHash string, newHash string) error {
+	ctx, span := startSQLiteSpan(ctx, "RehashPassword")
+	defer span.End()
+
+	_, err := sqliteExec(ctx, s.db, "UPDATE users SET hashed_password = $1 WHERE id = $2 AND hashed_password = $3 AND deleted_at IS NULL", newHash, userID, currentHash)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to rehash password of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *sqlite) ListUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return s.listUsers(ctx, "ListUsers", "deleted_at IS NULL", params)
+}
+
+func (s *sqlite) ListDeletedUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return s.listUsers(ctx, "ListDeletedUsers", "deleted_at IS NOT NULL", params)
+}
+
+func (s *sqlite) listUsers(ctx context.Context, method string, scope string, params ListUsersParams) ([]domain.User, int, error) {
+	ctx, span := startSQLiteSpan(ctx, method)
+	defer span.End()
+
+	where := scope
+	var args []interface{}
+	if params.Filter != nil {
+		filter, err := params.Filter.toSQL(sqliteDialect, &args)
+		if err != nil {
+			span.RecordError(err)
+			return nil, 0, fmt.Errorf("invalid user filter: %w", err)
+		}
+		where += " AND (" + filter + ")"
+	}
+	var total int
+	if err := sqliteQueryRow(ctx, s.db, []interface{}{&total}, "SELECT COUNT(*) FROM users WHERE "+where, args...); err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	if params.Limit <= 0 {
+		return nil, total, nil
+	}
+
+	var users []domain.User
+	query := fmt.Sprintf("SELECT %s FROM users WHERE %s ORDER BY id LIMIT %d OFFSET %d", userColumns, where, params.Limit, params.Offset)
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var user userModel
+		return user.scanTargets(), func() { users = append(users, *user.ToDomain()) }
+	}, query, args...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, total, nil
+}
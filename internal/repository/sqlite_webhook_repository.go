@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+func (s *sqlite) CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (*domain.WebhookSubscription, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateWebhookSubscription")
+	defer span.End()
+
+	subscription := &domain.WebhookSubscription{
+		URL:        params.URL,
+		EventTypes: params.EventTypes,
+		Secret:     params.Secret,
+		CreatedAt:  time.Now(),
+	}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		insertQuery := "INSERT INTO webhook_subscriptions (url, event_types, secret, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+		err := sqliteQueryRow(ctx, tx, []interface{}{&subscription.ID}, insertQuery, params.URL, params.EventTypes, params.Secret, subscription.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionCreate, nil, subscription))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert webhook subscription into database: %w", err)
+	}
+	return subscription, nil
+}
+
+func (s *sqlite) GetWebhookSubscription(ctx context.Context, subscriptionID int) (*domain.WebhookSubscription, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetWebhookSubscription")
+	defer span.End()
+
+	var subscription webhookSubscriptionModel
+	if err := sqliteQueryRow(ctx, s.db, subscription.scanTargets(), "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = $1", subscriptionID); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, err)
+	}
+	return subscription.ToDomain(), nil
+}
+
+func (s *sqlite) ListWebhookSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListWebhookSubscriptions")
+	defer span.End()
+
+	var subscriptions []domain.WebhookSubscription
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var subscription webhookSubscriptionModel
+		return subscription.scanTargets(), func() { subscriptions = append(subscriptions, *subscription.ToDomain()) }
+	}, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (s *sqlite) DeleteWebhookSubscription(ctx context.Context, subscriptionID int) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteWebhookSubscription")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var subscription webhookSubscriptionModel
+		err := sqliteQueryRow(ctx, tx, subscription.scanTargets(), "DELETE FROM webhook_subscriptions WHERE id = $1 RETURNING "+webhookSubscriptionColumns, subscriptionID)
+		if err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionDelete, subscription.ToDomain(), nil))
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete webhook subscription %d: %w", subscriptionID, err)
+	}
+	return nil
+}
+
+func (s *sqlite) CreateWebhookDelivery(ctx context.Context, params CreateWebhookDeliveryParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateWebhookDelivery")
+	defer span.End()
+
+	now := time.Now()
+	_, err := sqliteExec(ctx, s.db, insertWebhookDeliveryQuery, params.SubscriptionID, params.EventID, params.UserID, params.EventType, string(params.Payload), domain.WebhookDeliveryPending, now, now)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert webhook delivery into database: %w", err)
+	}
+	return nil
+}
+
+// eraseUserWebhookDeliveries scrubs the personal data of an erased user from
+// the deliveries of its events in tx
+func (s *sqlite) eraseUserWebhookDeliveries(ctx context.Context, tx sqliteQuerier, userID int) error {
+	return eraseWebhookDeliveries(userID,
+		func() ([]domain.WebhookDelivery, error) {
+			var deliveries []domain.WebhookDelivery
+			err := sqliteQuery(ctx, tx, func() ([]interface{}, func()) {
+				var delivery webhookDeliveryModel
+				return delivery.scanTargets(), func() { deliveries = append(deliveries, *delivery.ToDomain()) }
+			}, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE user_id = $1 ORDER BY id", userID)
+			return deliveries, err
+		},
+		func(deliveryID int, payload string) error {
+			_, err := sqliteExec(ctx, tx, "UPDATE webhook_deliveries SET payload = $1 WHERE id = $2", payload, deliveryID)
+			return err
+		},
+	)
+}
+
+// ClaimWebhookDeliveries is like the Postgres one. SQLite serializes writes,
+// so the update alone keeps others from claiming the same deliveries.
+func (s *sqlite) ClaimWebhookDeliveries(ctx context.Context, now time.Time, claimFor time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ClaimWebhookDeliveries")
+	defer span.End()
+
+	query := `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id IN (
+    SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt_at <= $3 ORDER BY next_attempt_at, id LIMIT $4
+) RETURNING ` + webhookDeliveryColumns
+	var deliveries []domain.WebhookDelivery
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var delivery webhookDeliveryModel
+		return delivery.scanTargets(), func() { deliveries = append(deliveries, *delivery.ToDomain()) }
+	}, query, now.Add(claimFor), domain.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	// RETURNING has no order
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+func (s *sqlite) RecordWebhookAttempt(ctx context.Context, params RecordWebhookAttemptParams) error {
+	ctx, span := startSQLiteSpan(ctx, "RecordWebhookAttempt")
+	defer span.End()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := sqliteExec(ctx, tx, insertWebhookDeliveryAttemptQuery, params.DeliveryID, params.StatusCode, params.Error, params.Duration.Milliseconds(), params.AttemptedAt)
+		if err != nil {
+			return err
+		}
+		_, err = sqliteExec(ctx, tx, updateWebhookDeliveryAttemptQuery, params.Status, params.NextAttemptAt, params.Error, time.Now(), params.DeliveryID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlite) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]domain.WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListWebhookDeliveries")
+	defer span.End()
+
+	var deliveries []domain.WebhookDelivery
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var delivery webhookDeliveryModel
+		return delivery.scanTargets(), func() { deliveries = append(deliveries, *delivery.ToDomain()) }
+	}, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE "+listWebhookDeliveriesWhere+" ORDER BY id LIMIT $4", params.SubscriptionID, params.Status, params.AfterID, params.Limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *sqlite) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int) ([]domain.WebhookDeliveryAttempt, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListWebhookDeliveryAttempts")
+	defer span.End()
+
+	var attempts []domain.WebhookDeliveryAttempt
+	err := sqliteQuery(ctx, s.db, func() ([]interface{}, func()) {
+		var attempt webhookDeliveryAttemptModel
+		return attempt.scanTargets(), func() { attempts = append(attempts, *attempt.ToDomain()) }
+	}, "SELECT "+webhookDeliveryAttemptColumns+" FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id", deliveryID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+func (s *sqlite) ReplayWebhookDelivery(ctx context.Context, deliveryID int, now time.Time) (*domain.WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ReplayWebhookDelivery")
+	defer span.End()
+
+	var before, after webhookDeliveryModel
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := sqliteQueryRow(ctx, tx, before.scanTargets(), "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = $1", deliveryID); err != nil {
+			return err
+		}
+		if err := sqliteQueryRow(ctx, tx, after.scanTargets(), replayWebhookDeliveryQuery, domain.WebhookDeliveryPending, now, deliveryID); err != nil {
+			return err
+		}
+		return s.recordChanges(ctx, tx, webhookDeliveryChange(domain.AuditActionWebhookDeliveryReplay, before.ToDomain(), after.ToDomain()))
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, fmt.Errorf("webhook delivery %d not found: %w", deliveryID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to replay webhook delivery %d: %w", deliveryID, err)
+	}
+	return after.ToDomain(), nil
+}
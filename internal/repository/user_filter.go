@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+)
+
+// UserField names a user attribute a UserFilter can test
+type UserField string
+
+const (
+	UserFieldID         UserField = "id"
+	UserFieldName       UserField = "name"
+	UserFieldEmail      UserField = "email"
+	UserFieldRole       UserField = "role"
+	UserFieldExternalID UserField = "external_id"
+	UserFieldActive     UserField = "active"
+	UserFieldCreatedAt  UserField = "created_at"
+	UserFieldUpdatedAt  UserField = "updated_at"
+)
+
+// Operators of a UserFilter. They follow the SCIM filter operators of RFC 7644
+// section 3.4.2.2, string comparisons are case-insensitive.
+const (
+	FilterAnd            = "and"
+	FilterOr             = "or"
+	FilterNot            = "not"
+	FilterEqual          = "eq"
+	FilterNotEqual       = "ne"
+	FilterContains       = "co"
+	FilterStartsWith     = "sw"
+	FilterEndsWith       = "ew"
+	FilterGreater        = "gt"
+	FilterGreaterOrEqual = "ge"
+	FilterLess           = "lt"
+	FilterLessOrEqual    = "le"
+	FilterPresent        = "pr"
+)
+
+// UserFilter is a boolean expression over user fields. Logical filters combine
+// their Operands, every other filter compares Field against Value, which is a
+// string, int, bool or time.Time depending on the field.
+type UserFilter struct {
+	Op       string
+	Field    UserField
+	Value    interface{}
+	Operands []UserFilter
+}
+
+type ListUsersParams struct {
+	Filter *UserFilter `json:"filter"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+var userFieldColumns = map[UserField]string{
+	UserFieldID:         "id",
+	UserFieldName:       "name",
+	UserFieldEmail:      "email",
+	UserFieldRole:       "role",
+	UserFieldExternalID: "external_id",
+	UserFieldActive:     "active",
+	UserFieldCreatedAt:  "created_at",
+	UserFieldUpdatedAt:  "updated_at",
+}
+
+var filterComparisons = map[string]string{
+	FilterEqual:          "=",
+	FilterNotEqual:       "<>",
+	FilterGreater:        ">",
+	FilterGreaterOrEqual: ">=",
+	FilterLess:           "<",
+	FilterLessOrEqual:    "<=",
+}
+
+// sqlDialect holds what differs between the databases a filter compiles for
+type sqlDialect struct {
+	// like is the case-insensitive pattern match operator
+	like string
+}
+
+var (
+	postgresDialect = sqlDialect{like: "ILIKE"}
+	// SQLite's LIKE ignores the case of ASCII letters
+	sqliteDialect = sqlDialect{like: "LIKE"}
+)
+
+// toSQL compiles the filter to a boolean expression of the dialect, appending
+// the values it compares against to args.
+func (f UserFilter) toSQL(dialect sqlDialect, args *[]interface{}) (string, error) {
+	switch f.Op {
+	case FilterAnd, FilterOr:
+		if len(f.Operands) == 0 {
+			return "", fmt.Errorf("%s filter without operands", f.Op)
+		}
+		parts := make([]string, 0, len(f.Operands))
+		for _, operand := range f.Operands {
+			part, err := operand.toSQL(dialect, args)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(f.Op)+" ") + ")", nil
+	case FilterNot:
+		if len(f.Operands) != 1 {
+			return "", fmt.Errorf("not filter needs exactly one operand")
+		}
+		part, err := f.Operands[0].toSQL(dialect, args)
+		if err != nil {
+			return "", err
+		}
+		return "(NOT " + part + ")", nil
+	}
+
+	column, ok := userFieldColumns[f.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown user field: %s", f.Field)
+	}
+	if f.Op == FilterPresent {
+		if isStringField(f.Field) {
+			return "(" + column + " <> '')", nil
+		}
+		return "TRUE", nil // The other columns are NOT NULL
+	}
+
+	placeholder := func(value interface{}) string {
+		*args = append(*args, value)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+
+	switch value := f.Value.(type) {
+	case string:
+		if !isStringField(f.Field) {
+			return "", fmt.Errorf("field %s can't be compared with a string", f.Field)
+		}
+		switch f.Op {
+		case FilterContains:
+			return "(" + column + " " + dialect.like + " " + placeholder("%"+escapeLike(value)+"%") + " ESCAPE '\\')", nil
+		case FilterStartsWith:
+			return "(" + column + " " + dialect.like + " " + placeholder(escapeLike(value)+"%") + " ESCAPE '\\')", nil
+		case FilterEndsWith:
+			return "(" + column + " " + dialect.like + " " + placeholder("%"+escapeLike(value)) + " ESCAPE '\\')", nil
+		}
+		operator, ok := filterComparisons[f.Op]
+		if !ok {
+			return "", fmt.Errorf("unsupported filter operator: %s", f.Op)
+		}
+		return "(LOWER(" + column + ") " + operator + " LOWER(" + placeholder(value) + "))", nil
+	case bool:
+		if f.Field != UserFieldActive || (f.Op != FilterEqual && f.Op != FilterNotEqual) {
+			return "", fmt.Errorf("field %s can't be compared with a boolean using %s", f.Field, f.Op)
+		}
+		return "(" + column + " " + filterComparisons[f.Op] + " " + placeholder(value) + ")", nil
+	case int:
+		if f.Field != UserFieldID {
+			return "", fmt.Errorf("field %s can't be compared with a number", f.Field)
+		}
+	case time.Time:
+		if f.Field != UserFieldCreatedAt && f.Field != UserFieldUpdatedAt {
+			return "", fmt.Errorf("field %s can't be compared with a time", f.Field)
+		}
+	default:
+		return "", fmt.Errorf("unsupported filter value for field %s: %v", f.Field, f.Value)
+	}
+
+	operator, ok := filterComparisons[f.Op]
+	if !ok {
+		return "", fmt.Errorf("operator %s is not supported for field %s", f.Op, f.Field)
+	}
+	return "(" + column + " " + operator + " " + placeholder(f.Value) + ")", nil
+}
+
+func isStringField(field UserField) bool {
+	switch field {
+	case UserFieldName, UserFieldEmail, UserFieldRole, UserFieldExternalID:
+		return true
+	}
+	return false
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// match evaluates the filter against a user with the semantics of toSQL, for
+// stores that don't speak SQL. Every operand is checked, so an invalid filter
+// fails the same way regardless of the users it is applied to.
+func (f UserFilter) match(user domain.User) (bool, error) {
+	switch f.Op {
+	case FilterAnd, FilterOr:
+		if len(f.Operands) == 0 {
+			return false, fmt.Errorf("%s filter without operands", f.Op)
+		}
+		result := f.Op == FilterAnd
+		for _, operand := range f.Operands {
+			matched, err := operand.match(user)
+			if err != nil {
+				return false, err
+			}
+			if f.Op == FilterAnd {
+				result = result && matched
+			} else {
+				result = result || matched
+			}
+		}
+		return result, nil
+	case FilterNot:
+		if len(f.Operands) != 1 {
+			return false, fmt.Errorf("not filter needs exactly one operand")
+		}
+		matched, err := f.Operands[0].match(user)
+		return !matched, err
+	}
+
+	if _, ok := userFieldColumns[f.Field]; !ok {
+		return false, fmt.Errorf("unknown user field: %s", f.Field)
+	}
+	if f.Op == FilterPresent {
+		if isStringField(f.Field) {
+			return userStringField(user, f.Field) != "", nil
+		}
+		return true, nil
+	}
+
+	switch value := f.Value.(type) {
+	case string:
+		if !isStringField(f.Field) {
+			return false, fmt.Errorf("field %s can't be compared with a string", f.Field)
+		}
+		actual, expected := strings.ToLower(userStringField(user, f.Field)), strings.ToLower(value)
+		switch f.Op {
+		case FilterContains:
+			return strings.Contains(actual, expected), nil
+		case FilterStartsWith:
+			return strings.HasPrefix(actual, expected), nil
+		case FilterEndsWith:
+			return strings.HasSuffix(actual, expected), nil
+		}
+		if _, ok := filterComparisons[f.Op]; !ok {
+			return false, fmt.Errorf("unsupported filter operator: %s", f.Op)
+		}
+		return compareWith(f.Op, strings.Compare(actual, expected)), nil
+	case bool:
+		if f.Field != UserFieldActive || (f.Op != FilterEqual && f.Op != FilterNotEqual) {
+			return false, fmt.Errorf("field %s can't be compared with a boolean using %s", f.Field, f.Op)
+		}
+		return (user.Active == value) == (f.Op == FilterEqual), nil
+	case int:
+		if f.Field != UserFieldID {
+			return false, fmt.Errorf("field %s can't be compared with a number", f.Field)
+		}
+		if _, ok := filterComparisons[f.Op]; !ok {
+			return false, fmt.Errorf("operator %s is not supported for field %s", f.Op, f.Field)
+		}
+		return compareWith(f.Op, compareInts(user.ID, value)), nil
+	case time.Time:
+		if f.Field != UserFieldCreatedAt && f.Field != UserFieldUpdatedAt {
+			return false, fmt.Errorf("field %s can't be compared with a time", f.Field)
+		}
+		if _, ok := filterComparisons[f.Op]; !ok {
+			return false, fmt.Errorf("operator %s is not supported for field %s", f.Op, f.Field)
+		}
+		actual := user.CreatedAt
+		if f.Field == UserFieldUpdatedAt {
+			actual = user.UpdatedAt
+		}
+		return compareWith(f.Op, actual.Compare(value)), nil
+	default:
+		return false, fmt.Errorf("unsupported filter value for field %s: %v", f.Field, f.Value)
+	}
+}
+
+func userStringField(user domain.User, field UserField) string {
+	switch field {
+	case UserFieldName:
+		return user.Name
+	case UserFieldEmail:
+		return user.Email
+	case UserFieldRole:
+		return user.Role
+	case UserFieldExternalID:
+		return user.ExternalID
+	}
+	return ""
+}
+
+// compareWith applies a comparison operator to the result of a three-way comparison
+func compareWith(op string, cmp int) bool {
+	switch op {
+	case FilterEqual:
+		return cmp == 0
+	case FilterNotEqual:
+		return cmp != 0
+	case FilterGreater:
+		return cmp > 0
+	case FilterGreaterOrEqual:
+		return cmp >= 0
+	case FilterLess:
+		return cmp < 0
+	case FilterLessOrEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type CreateUserIdentityParams struct {
+	UserID   int    `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+}
+
+func (p *postgres) CreateUserIdentity(ctx context.Context, params CreateUserIdentityParams) (*domain.UserIdentity, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateUserIdentity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateUserIdentity"),
+		attribute.Int("user.id", params.UserID),
+		attribute.String("identity.provider", params.Provider),
+	)
+
+	createdAt := time.Now()
+
+	insertQuery := "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := p.conn.QueryRow(ctx, insertQuery, params.UserID, params.Provider, params.Subject, params.Email, createdAt).Scan(&id)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert user identity into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert user identity into database: %w", dbError(err))
+	}
+
+	return &domain.UserIdentity{
+		ID:        id,
+		UserID:    params.UserID,
+		Provider:  params.Provider,
+		Subject:   params.Subject,
+		Email:     params.Email,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (p *postgres) GetUserIdentity(ctx context.Context, provider string, subject string) (*domain.UserIdentity, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetUserIdentity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "GetUserIdentity"),
+		attribute.String("identity.provider", provider),
+	)
+
+	query := "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2"
+	var identity domain.UserIdentity
+
+	err := p.conn.QueryRow(ctx, query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			span.RecordError(err)
+			return nil, fmt.Errorf("user identity not found: %w", dbError(err))
+		}
+		logFromCtx.Errorf(ctx, "failed to find user identity: %v", err)
+		span.RecordError(err)
+
+		return nil, fmt.Errorf("failed to find user identity: %w", dbError(err))
+	}
+	return &identity, nil
+}
+
+// ListUserIdentitiesByUserID returns the identities linked to a user, oldest first
+func (p *postgres) ListUserIdentitiesByUserID(ctx context.Context, userID int) ([]domain.UserIdentity, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListUserIdentitiesByUserID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListUserIdentitiesByUserID"),
+		attribute.Int("user.id", userID),
+	)
+
+	query := "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY id"
+	rows, err := p.conn.Query(ctx, query, userID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list user identities: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user identities: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var identities []domain.UserIdentity
+	for rows.Next() {
+		var identity domain.UserIdentity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list user identities: %w", dbError(err))
+	}
+	return identities, nil
+}
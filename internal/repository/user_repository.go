@@ -3,13 +3,13 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/fibonachyy/sternx/internal/domain"
 	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
@@ -23,6 +23,11 @@ type userModel struct {
 	role              string
 	passwordChangedAt time.Time
 	createdAt         time.Time
+	externalID        string
+	active            bool
+	updatedAt         time.Time
+	deletedAt         *time.Time
+	version           int
 }
 
 func (u userModel) ToDomain() *domain.User {
@@ -34,14 +39,26 @@ func (u userModel) ToDomain() *domain.User {
 		HashedPassword:    u.hashedPassword,
 		PasswordChangedAt: u.passwordChangedAt,
 		CreatedAt:         u.createdAt,
+		ExternalID:        u.externalID,
+		Active:            u.active,
+		UpdatedAt:         u.updatedAt,
+		DeletedAt:         u.deletedAt,
+		Version:           u.version,
 	}
 }
 
+const userColumns = "id, name, email, role, hashed_password, password_changed_at, created_at, external_id, active, updated_at, deleted_at, version"
+
+func (u *userModel) scanTargets() []interface{} {
+	return []interface{}{&u.id, &u.name, &u.email, &u.role, &u.hashedPassword, &u.passwordChangedAt, &u.createdAt, &u.externalID, &u.active, &u.updatedAt, &u.deletedAt, &u.version}
+}
+
 type CreateUserParams struct {
 	Name           string `json:"name"`
 	Email          string `json:"email"`
 	Role           string `json:"role"`
 	HashedPassword string `json:"hashed_password"`
+	ExternalID     string `json:"external_id"`
 }
 
 func (p *postgres) CreateUser(ctx context.Context, params CreateUserParams) (*domain.User, error) {
@@ -59,13 +76,20 @@ func (p *postgres) CreateUser(ctx context.Context, params CreateUserParams) (*do
 	createdAt := time.Now()
 	passwordChangedAt := time.Now()
 
-	insertQuery := "INSERT INTO users (name, email, role, hashed_password, password_changed_at, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insertQuery := "INSERT INTO users (name, email, role, hashed_password, password_changed_at, created_at, external_id, active, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, TRUE, $6) RETURNING id"
 	var userID int
-	err := p.conn.QueryRow(ctx, insertQuery, params.Name, params.Email, params.Role, params.HashedPassword, passwordChangedAt, createdAt).Scan(&userID)
+	err = tx.QueryRow(ctx, insertQuery, params.Name, params.Email, params.Role, params.HashedPassword, passwordChangedAt, createdAt, params.ExternalID).Scan(&userID)
 	if err != nil {
 		logFromCtx.Errorf(ctx, "failed to insert user into database: %v", err)
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to insert user into database: %w", err)
+		return nil, fmt.Errorf("failed to insert user into database: %w", dbError(err))
 	}
 
 	user := &domain.User{
@@ -76,6 +100,18 @@ func (p *postgres) CreateUser(ctx context.Context, params CreateUserParams) (*do
 		HashedPassword:    params.HashedPassword,
 		PasswordChangedAt: passwordChangedAt,
 		CreatedAt:         createdAt,
+		ExternalID:        params.ExternalID,
+		Active:            true,
+		UpdatedAt:         createdAt,
+		Version:           1,
+	}
+	if err := p.recordChanges(ctx, tx, userChange(domain.AuditActionUserCreate, nil, user)); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert user into database: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert user into database: %w", dbError(err))
 	}
 
 	logFromCtx.Infof(ctx, "user created successfully: ID=%d, Email=%s, Role=%s", user.ID, user.Email, user.Role)
@@ -83,6 +119,44 @@ func (p *postgres) CreateUser(ctx context.Context, params CreateUserParams) (*do
 	return user, nil
 }
 
+// updateUser locks the user matching where, checks it is at expectedVersion
+// unless that is 0, runs update, an UPDATE returning the userColumns of that
+// user, and records the change in the audit log
+func (p *postgres) updateUser(ctx context.Context, tx pgx.Tx, action string, where string, whereArg interface{}, expectedVersion int, update string, args ...interface{}) (*domain.User, error) {
+	var before, after userModel
+	if err := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE "+where+" FOR UPDATE", whereArg).Scan(before.scanTargets()...); err != nil {
+		return nil, dbError(err)
+	}
+	if err := checkUserVersion(before.version, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, update, args...).Scan(after.scanTargets()...); err != nil {
+		return nil, dbError(err)
+	}
+	if err := p.recordChanges(ctx, tx, userChange(action, before.ToDomain(), after.ToDomain())); err != nil {
+		return nil, err
+	}
+	return after.ToDomain(), nil
+}
+
+// updateUserTx is updateUser in a transaction of its own
+func (p *postgres) updateUserTx(ctx context.Context, action string, where string, whereArg interface{}, expectedVersion int, update string, args ...interface{}) (*domain.User, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	user, err := p.updateUser(ctx, tx, action, where, whereArg, expectedVersion, update, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, dbError(err)
+	}
+	return user, nil
+}
+
 func (p *postgres) GetUserByEmail(ctx context.Context, userEmail string) (*domain.User, error) {
 	logFromCtx := logger.FromContext(ctx)
 
@@ -95,23 +169,21 @@ func (p *postgres) GetUserByEmail(ctx context.Context, userEmail string) (*domai
 		attribute.String("user.email", userEmail),
 	)
 
-	query := "SELECT id, name, email, role, hashed_password, password_changed_at, created_at FROM users WHERE email = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE email = $1 AND deleted_at IS NULL"
 	var user userModel
 
-	err := p.conn.QueryRow(ctx, query, userEmail).Scan(
-		&user.id, &user.name, &user.email, &user.role, &user.hashedPassword, &user.passwordChangedAt, &user.createdAt,
-	)
+	err := p.conn.QueryRow(ctx, query, userEmail).Scan(user.scanTargets()...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			logFromCtx.Errorf(ctx, "user not found with the provided email: %v", err)
 			span.RecordError(err)
 
-			return nil, fmt.Errorf("user not found with the provided email: %w", err)
+			return nil, fmt.Errorf("user not found with the provided email: %w", dbError(err))
 		}
 		logFromCtx.Errorf(ctx, "failed to find user by email: %v", err)
 		span.RecordError(err)
 
-		return nil, fmt.Errorf("user not found: %w", err)
+		return nil, fmt.Errorf("user not found: %w", dbError(err))
 	}
 	return user.ToDomain(), nil
 }
@@ -128,27 +200,27 @@ func (p *postgres) GetUserByID(ctx context.Context, userID int) (*domain.User, e
 		attribute.Int("user.id", userID),
 	)
 
-	query := "SELECT id, name, email, role, hashed_password, password_changed_at, created_at FROM users WHERE id = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1 AND deleted_at IS NULL"
 	var user userModel
 
-	err := p.conn.QueryRow(ctx, query, userID).Scan(
-		&user.id, &user.name, &user.email, &user.role, &user.hashedPassword, &user.passwordChangedAt, &user.createdAt,
-	)
+	err := p.conn.QueryRow(ctx, query, userID).Scan(user.scanTargets()...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			logFromCtx.Errorf(ctx, "user not found with the provided ID: %v", err)
 			span.RecordError(err)
 
-			return nil, fmt.Errorf("user not found with the provided ID: %w", err)
+			return nil, fmt.Errorf("user not found with the provided ID: %w", dbError(err))
 		}
 		logFromCtx.Errorf(ctx, "failed to find user by id: %v", err)
 		span.RecordError(err)
 
-		return nil, fmt.Errorf("user not found: %w", err)
+		return nil, fmt.Errorf("user not found: %w", dbError(err))
 	}
 	return user.ToDomain(), nil
 }
 
+// PartialUpdateUserByEmail renames the user with email. When updatedUser has
+// a version, the user must still be at it.
 func (p *postgres) PartialUpdateUserByEmail(ctx context.Context, email string, updatedUser domain.User) (*domain.User, error) {
 	logFromCtx := logger.FromContext(ctx)
 
@@ -161,32 +233,22 @@ func (p *postgres) PartialUpdateUserByEmail(ctx context.Context, email string, u
 		attribute.String("user.email", email),
 	)
 
-	updatedUser.Email = ""
-	updatedUser.Role = ""
-	updatedUser.PasswordChangedAt = time.Time{}
-	updatedUser.CreatedAt = time.Time{}
-	updatedUser.HashedPassword = ""
+	query := "UPDATE users SET name = $1, updated_at = $2, version = version + 1 WHERE email = $3 AND deleted_at IS NULL RETURNING " + userColumns
 
-	query := "UPDATE users SET name = $1 WHERE email = $2 RETURNING id, password_changed_at, created_at, hashed_password, email, role"
-
-	var newUserID int
-	var newPasswordChangedAt, newCreatedAt time.Time
-	var newHashedPassword, userEmail, role string
-	err := p.conn.QueryRow(ctx, query, updatedUser.Name, email).Scan(&newUserID, &newPasswordChangedAt, &newCreatedAt, &newHashedPassword, &userEmail, &role)
+	user, err := p.updateUserTx(ctx, domain.AuditActionUserUpdate, "email = $1 AND deleted_at IS NULL", email, updatedUser.Version, query, updatedUser.Name, time.Now(), email)
 	if err != nil {
 		logFromCtx.Errorf(ctx, "failed to update user info by email: %s: %v", email, err)
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to partially update user by Email %s: %w", email, err)
 	}
-
-	updatedUser.ID = newUserID
-	updatedUser.PasswordChangedAt = newPasswordChangedAt
-	updatedUser.CreatedAt = newCreatedAt
-	updatedUser.Email = userEmail
-	updatedUser.Role = role
-	return &updatedUser, nil
+	return user, nil
 }
-func (p *postgres) DeleteUserByEmail(ctx context.Context, email string) error {
+
+// DeleteUserByEmail soft deletes a user: the user disappears from every read
+// and loses its sessions, but keeps its email until PurgeDeletedUsers
+// removes the row, so RestoreUser can bring it back meanwhile. A non-zero
+// expectedVersion is the version the user must still be at.
+func (p *postgres) DeleteUserByEmail(ctx context.Context, email string, expectedVersion int) error {
 
 	logFromCtx := logger.FromContext(ctx)
 
@@ -200,28 +262,140 @@ func (p *postgres) DeleteUserByEmail(ctx context.Context, email string) error {
 		attribute.String("user.email", email),
 	)
 
-	query := "DELETE FROM users WHERE email = $1"
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	result, err := p.conn.Exec(ctx, query, email)
+	now := time.Now()
+	query := "UPDATE users SET deleted_at = $1, updated_at = $1, version = version + 1 WHERE email = $2 AND deleted_at IS NULL RETURNING " + userColumns
+	user, err := p.updateUser(ctx, tx, domain.AuditActionUserDelete, "email = $1 AND deleted_at IS NULL", email, expectedVersion, query, now, email)
 	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			logFromCtx.Errorf(ctx, "user with Email %s not found: %v", email, domain.ErrNotFound)
+			span.SetAttributes(attribute.Bool("user.deleted", false))
+
+			return fmt.Errorf("user with Email %s not found: %w", email, domain.ErrNotFound)
+		}
 		logFromCtx.Errorf(ctx, "failed to delete user by email: %s: %v", email, err)
 		span.RecordError(err)
 
 		return fmt.Errorf("failed to delete user by Email %s: %w", email, err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		logFromCtx.Errorf(ctx, "user with Email %s not found: %v", email, sql.ErrNoRows)
-		span.SetAttributes(attribute.Bool("user.deleted", false))
+	_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", now, user.ID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to revoke sessions of user %d: %v", user.ID, err)
+		span.RecordError(err)
 
-		return fmt.Errorf("user with Email %s not found: %w", email, sql.ErrNoRows)
+		return fmt.Errorf("failed to delete user by Email %s: %w", email, dbError(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete user by Email %s: %w", email, dbError(err))
 	}
 	span.SetAttributes(attribute.Bool("user.deleted", true))
 
 	return nil
 }
 
+// RestoreUser undoes the soft delete of a user that wasn't purged yet
+func (p *postgres) RestoreUser(ctx context.Context, userID int) (*domain.User, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RestoreUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "RestoreUser"),
+		attribute.Int("user.id", userID),
+	)
+
+	query := "UPDATE users SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NOT NULL RETURNING " + userColumns
+
+	user, err := p.updateUserTx(ctx, domain.AuditActionUserRestore, "id = $1 AND deleted_at IS NOT NULL", userID, 0, query, time.Now(), userID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to restore user %d: %v", userID, err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("deleted user %d not found: %w", userID, err)
+	}
+	return user, nil
+}
+
+// PurgeDeletedUsers hard deletes the users soft deleted before deletedBefore,
+// along with everything that references them, and returns how many it removed
+func (p *postgres) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "PurgeDeletedUsers")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "PurgeDeletedUsers"),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING "+userColumns, deletedBefore)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to purge deleted users: %v", err)
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge deleted users: %w", dbError(err))
+	}
+	var changes []change
+	var purged []domain.User
+	for rows.Next() {
+		var user userModel
+		if err := rows.Scan(user.scanTargets()...); err != nil {
+			rows.Close()
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		changes = append(changes, purgeChange(*user.ToDomain()))
+		purged = append(purged, *user.ToDomain())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logFromCtx.Errorf(ctx, "failed to purge deleted users: %v", err)
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge deleted users: %w", dbError(err))
+	}
+
+	if err := p.recordChanges(ctx, tx, changes...); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+	// Purged users leave no personal data in the audit log, the outbox or
+	// the webhook deliveries either
+	now := time.Now()
+	for _, user := range purged {
+		if err := p.eraseUserAuditEvents(ctx, tx, user.ID, user.Email, now); err != nil {
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+		}
+		if err := p.eraseUserEvents(ctx, tx, user.ID); err != nil {
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge deleted users: %w", dbError(err))
+	}
+	span.SetAttributes(attribute.Int("user.purged", len(changes)))
+
+	return len(changes), nil
+}
+
 func (p *postgres) AuthenticateUser(ctx context.Context, email, password string) (*domain.User, error) {
 	logFromCtx := logger.FromContext(ctx)
 
@@ -234,17 +408,17 @@ func (p *postgres) AuthenticateUser(ctx context.Context, email, password string)
 		attribute.String("user.email", email),
 	)
 
-	query := "SELECT id, name, email, role, hashed_password, password_changed_at, created_at FROM users WHERE email = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE email = $1 AND deleted_at IS NULL"
 	var user userModel
 
-	err := p.conn.QueryRow(ctx, query, email).Scan(&user.id, &user.name, &user.email, &user.role, &user.hashedPassword, &user.passwordChangedAt, &user.createdAt)
+	err := p.conn.QueryRow(ctx, query, email).Scan(user.scanTargets()...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			logFromCtx.Errorf(ctx, "user with email %s not found: %v", email, err)
-			return nil, fmt.Errorf("user with email %s not found: %w", email, err)
+			return nil, fmt.Errorf("user with email %s not found: %w", email, dbError(err))
 		}
 		logFromCtx.Errorf(ctx, "failed to retrieve user by email: %v", err)
-		return nil, fmt.Errorf("failed to retrieve user by email: %w", err)
+		return nil, fmt.Errorf("failed to retrieve user by email: %w", dbError(err))
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.hashedPassword), []byte(password))
@@ -262,3 +436,156 @@ func (p *postgres) AuthenticateUser(ctx context.Context, email, password string)
 
 	return user.ToDomain(), nil
 }
+
+// UpdateUserParams holds the user fields to change, nil fields are kept.
+// Setting HashedPassword also moves the password change time.
+type UpdateUserParams struct {
+	// ExpectedVersion is the version the user must still be at, unless it's 0
+	ExpectedVersion int `json:"expected_version"`
+
+	Name           *string `json:"name"`
+	Email          *string `json:"email"`
+	Role           *string `json:"role"`
+	ExternalID     *string `json:"external_id"`
+	Active         *bool   `json:"active"`
+	HashedPassword *string `json:"hashed_password"`
+}
+
+// checkUserVersion returns ErrVersionMismatch when expectedVersion is set and
+// isn't version, the version of the stored user
+func checkUserVersion(version int, expectedVersion int) error {
+	if expectedVersion != 0 && version != expectedVersion {
+		return fmt.Errorf("%w: user is at version %d, not %d", domain.ErrVersionMismatch, version, expectedVersion)
+	}
+	return nil
+}
+
+func (p *postgres) UpdateUser(ctx context.Context, userID int, params UpdateUserParams) (*domain.User, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "UpdateUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "UpdateUser"),
+		attribute.Int("user.id", userID),
+	)
+
+	query := `UPDATE users SET
+		name = COALESCE($1, name),
+		email = COALESCE($2, email),
+		role = COALESCE($3, role),
+		external_id = COALESCE($4, external_id),
+		active = COALESCE($5, active),
+		hashed_password = COALESCE($6, hashed_password),
+		password_changed_at = CASE WHEN $6::VARCHAR IS NULL THEN password_changed_at ELSE $7 END,
+		updated_at = $7,
+		version = version + 1
+		WHERE id = $8 AND deleted_at IS NULL RETURNING ` + userColumns
+
+	user, err := p.updateUserTx(ctx, domain.AuditActionUserUpdate, "id = $1 AND deleted_at IS NULL", userID, params.ExpectedVersion, query, params.Name, params.Email, params.Role, params.ExternalID, params.Active, params.HashedPassword, time.Now(), userID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to update user %d: %v", userID, err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to update user %d: %w", userID, err)
+	}
+	return user, nil
+}
+
+// RehashPassword replaces the password hash of a user with a fresh hash of the
+// same password. Unlike UpdateUser it keeps password_changed_at, and it only
+// applies while the stored hash is still currentHash, so a concurrent
+// password change wins. It keeps the version too: the user didn't change, and
+// a rehash on login must not fail the next write of a client holding its etag.
+func (p *postgres) RehashPassword(ctx context.Context, userID int, currentHash string, newHash string) error {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RehashPassword")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "RehashPassword"),
+		attribute.Int("user.id", userID),
+	)
+
+	_, err := p.conn.Exec(ctx, "UPDATE users SET hashed_password = $1 WHERE id = $2 AND hashed_password = $3 AND deleted_at IS NULL", newHash, userID, currentHash)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to rehash password of user %d: %v", userID, err)
+		span.RecordError(err)
+		return fmt.Errorf("failed to rehash password of user %d: %w", userID, dbError(err))
+	}
+	return nil
+}
+
+// ListUsers returns the users matching the filter ordered by ID, along with
+// the number of matching users. Users are only fetched for a positive limit.
+func (p *postgres) ListUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return p.listUsers(ctx, "ListUsers", "deleted_at IS NULL", params)
+}
+
+// ListDeletedUsers is ListUsers for the soft deleted users that weren't
+// purged yet
+func (p *postgres) ListDeletedUsers(ctx context.Context, params ListUsersParams) ([]domain.User, int, error) {
+	return p.listUsers(ctx, "ListDeletedUsers", "deleted_at IS NOT NULL", params)
+}
+
+func (p *postgres) listUsers(ctx context.Context, method string, scope string, params ListUsersParams) ([]domain.User, int, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, method)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", method),
+		attribute.Int("list.offset", params.Offset),
+		attribute.Int("list.limit", params.Limit),
+	)
+
+	where := scope
+	var args []interface{}
+	if params.Filter != nil {
+		filter, err := params.Filter.toSQL(postgresDialect, &args)
+		if err != nil {
+			span.RecordError(err)
+			return nil, 0, fmt.Errorf("invalid user filter: %w", err)
+		}
+		where += " AND (" + filter + ")"
+	}
+	var total int
+	err := p.conn.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to count users: %v", err)
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to count users: %w", dbError(err))
+	}
+	if params.Limit <= 0 {
+		return nil, total, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM users WHERE %s ORDER BY id LIMIT %d OFFSET %d", userColumns, where, params.Limit, params.Offset)
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list users: %v", err)
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list users: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var user userModel
+		if err := rows.Scan(user.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to list users: %w", dbError(err))
+	}
+	return users, total, nil
+}
@@ -0,0 +1,584 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const webhookSubscriptionColumns = "id, url, event_types, secret, created_at"
+
+const webhookDeliveryColumns = "id, subscription_id, event_id, user_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at"
+
+const webhookDeliveryAttemptColumns = "id, delivery_id, status_code, error, duration_ms, attempted_at"
+
+const insertWebhookDeliveryQuery = `INSERT INTO webhook_deliveries (subscription_id, event_id, user_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8) ON CONFLICT (subscription_id, event_id) DO NOTHING`
+
+const insertWebhookDeliveryAttemptQuery = "INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms, attempted_at) VALUES ($1, $2, $3, $4, $5)"
+
+const updateWebhookDeliveryAttemptQuery = "UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_error = $3, updated_at = $4 WHERE id = $5"
+
+const replayWebhookDeliveryQuery = "UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, last_error = '', updated_at = $2 WHERE id = $3 RETURNING " + webhookDeliveryColumns
+
+const listWebhookDeliveriesWhere = "($1 = 0 OR subscription_id = $1) AND ($2 = '' OR status = $2) AND id > $3"
+
+type webhookSubscriptionModel struct {
+	id         int
+	url        string
+	eventTypes []string
+	secret     string
+	createdAt  time.Time
+}
+
+func (s webhookSubscriptionModel) ToDomain() *domain.WebhookSubscription {
+	return &domain.WebhookSubscription{
+		ID:         s.id,
+		URL:        s.url,
+		EventTypes: s.eventTypes,
+		Secret:     s.secret,
+		CreatedAt:  s.createdAt,
+	}
+}
+
+func (s *webhookSubscriptionModel) scanTargets() []interface{} {
+	return []interface{}{&s.id, &s.url, &s.eventTypes, &s.secret, &s.createdAt}
+}
+
+type webhookDeliveryModel struct {
+	id             int
+	subscriptionID int
+	eventID        int
+	userID         int
+	eventType      string
+	payload        string
+	status         string
+	attempts       int
+	nextAttemptAt  time.Time
+	lastError      string
+	createdAt      time.Time
+	updatedAt      time.Time
+}
+
+func (d webhookDeliveryModel) ToDomain() *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID:             d.id,
+		SubscriptionID: d.subscriptionID,
+		EventID:        d.eventID,
+		UserID:         d.userID,
+		EventType:      d.eventType,
+		Payload:        json.RawMessage(d.payload),
+		Status:         d.status,
+		Attempts:       d.attempts,
+		NextAttemptAt:  d.nextAttemptAt,
+		LastError:      d.lastError,
+		CreatedAt:      d.createdAt,
+		UpdatedAt:      d.updatedAt,
+	}
+}
+
+func (d *webhookDeliveryModel) scanTargets() []interface{} {
+	return []interface{}{&d.id, &d.subscriptionID, &d.eventID, &d.userID, &d.eventType, &d.payload, &d.status, &d.attempts, &d.nextAttemptAt, &d.lastError, &d.createdAt, &d.updatedAt}
+}
+
+type webhookDeliveryAttemptModel struct {
+	id          int
+	deliveryID  int
+	statusCode  int
+	error       string
+	durationMS  int64
+	attemptedAt time.Time
+}
+
+func (a webhookDeliveryAttemptModel) ToDomain() *domain.WebhookDeliveryAttempt {
+	return &domain.WebhookDeliveryAttempt{
+		ID:          a.id,
+		DeliveryID:  a.deliveryID,
+		StatusCode:  a.statusCode,
+		Error:       a.error,
+		Duration:    time.Duration(a.durationMS) * time.Millisecond,
+		AttemptedAt: a.attemptedAt,
+	}
+}
+
+func (a *webhookDeliveryAttemptModel) scanTargets() []interface{} {
+	return []interface{}{&a.id, &a.deliveryID, &a.statusCode, &a.error, &a.durationMS, &a.attemptedAt}
+}
+
+type CreateWebhookSubscriptionParams struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+type CreateWebhookDeliveryParams struct {
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        int             `json:"event_id"`
+	UserID         int             `json:"user_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// RecordWebhookAttemptParams is an attempt to deliver a webhook, along with
+// the state of the delivery after it
+type RecordWebhookAttemptParams struct {
+	DeliveryID    int           `json:"delivery_id"`
+	StatusCode    int           `json:"status_code"`
+	Error         string        `json:"error"`
+	Duration      time.Duration `json:"duration"`
+	AttemptedAt   time.Time     `json:"attempted_at"`
+	Status        string        `json:"status"`
+	NextAttemptAt time.Time     `json:"next_attempt_at"`
+}
+
+// ListWebhookDeliveriesParams pages through the deliveries, oldest first.
+// Zero filters match every delivery.
+type ListWebhookDeliveriesParams struct {
+	SubscriptionID int    `json:"subscription_id"`
+	Status         string `json:"status"`
+	AfterID        int    `json:"after_id"`
+	Limit          int    `json:"limit"`
+}
+
+func webhookSubscriptionChange(action string, before, after *domain.WebhookSubscription) change {
+	subscription := after
+	if subscription == nil {
+		subscription = before
+	}
+	return change{
+		action: action,
+		target: "webhook_subscription:" + strconv.Itoa(subscription.ID),
+		before: before,
+		after:  after,
+	}
+}
+
+func webhookDeliveryChange(action string, before, after *domain.WebhookDelivery) change {
+	return change{
+		action: action,
+		target: "webhook_delivery:" + strconv.Itoa(after.ID),
+		before: before,
+		after:  after,
+	}
+}
+
+func (p *postgres) CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (*domain.WebhookSubscription, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateWebhookSubscription")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateWebhookSubscription"),
+		attribute.StringSlice("webhook_subscription.event_types", params.EventTypes),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	subscription := &domain.WebhookSubscription{
+		URL:        params.URL,
+		EventTypes: params.EventTypes,
+		Secret:     params.Secret,
+		CreatedAt:  time.Now(),
+	}
+	insertQuery := "INSERT INTO webhook_subscriptions (url, event_types, secret, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	err = tx.QueryRow(ctx, insertQuery, params.URL, params.EventTypes, params.Secret, subscription.CreatedAt).Scan(&subscription.ID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to insert webhook subscription into database: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert webhook subscription into database: %w", dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionCreate, nil, subscription)); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert webhook subscription into database: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to insert webhook subscription into database: %w", dbError(err))
+	}
+	return subscription, nil
+}
+
+func (p *postgres) GetWebhookSubscription(ctx context.Context, subscriptionID int) (*domain.WebhookSubscription, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "GetWebhookSubscription")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "GetWebhookSubscription"),
+		attribute.Int("webhook_subscription.id", subscriptionID),
+	)
+
+	var subscription webhookSubscriptionModel
+	err := p.conn.QueryRow(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = $1", subscriptionID).Scan(subscription.scanTargets()...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, dbError(err))
+	}
+	return subscription.ToDomain(), nil
+}
+
+func (p *postgres) ListWebhookSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListWebhookSubscriptions")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("repository.method.name", "ListWebhookSubscriptions"))
+
+	rows, err := p.conn.Query(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list webhook subscriptions: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var subscriptions []domain.WebhookSubscription
+	for rows.Next() {
+		var subscription webhookSubscriptionModel
+		if err := rows.Scan(subscription.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, *subscription.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", dbError(err))
+	}
+	return subscriptions, nil
+}
+
+// DeleteWebhookSubscription removes a subscription along with its deliveries
+func (p *postgres) DeleteWebhookSubscription(ctx context.Context, subscriptionID int) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "DeleteWebhookSubscription")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "DeleteWebhookSubscription"),
+		attribute.Int("webhook_subscription.id", subscriptionID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var subscription webhookSubscriptionModel
+	err = tx.QueryRow(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1 RETURNING "+webhookSubscriptionColumns, subscriptionID).Scan(subscription.scanTargets()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("webhook subscription %d not found: %w", subscriptionID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete webhook subscription %d: %w", subscriptionID, dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, webhookSubscriptionChange(domain.AuditActionWebhookSubscriptionDelete, subscription.ToDomain(), nil)); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete webhook subscription %d: %w", subscriptionID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete webhook subscription %d: %w", subscriptionID, dbError(err))
+	}
+	return nil
+}
+
+// eraseWebhookPayload replaces the personal data of an erased user in the
+// payload of a delivery of one of its events
+func eraseWebhookPayload(payload json.RawMessage) (json.RawMessage, error) {
+	var event domain.UserEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	eraseUserSnapshot(&event.User)
+	return json.Marshal(event)
+}
+
+// eraseWebhookDeliveries scrubs the personal data of an erased user from the
+// deliveries of its events, dead ones included. list lists the deliveries of
+// the user and update writes back the payload of a delivery.
+func eraseWebhookDeliveries(userID int, list func() ([]domain.WebhookDelivery, error), update func(deliveryID int, payload string) error) error {
+	deliveries, err := list()
+	if err != nil {
+		return fmt.Errorf("failed to list webhook deliveries of user %d: %w", userID, err)
+	}
+	for _, delivery := range deliveries {
+		payload, err := eraseWebhookPayload(delivery.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to erase webhook delivery %d: %w", delivery.ID, err)
+		}
+		if err := update(delivery.ID, string(payload)); err != nil {
+			return fmt.Errorf("failed to erase webhook delivery %d: %w", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// eraseUserWebhookDeliveries scrubs the personal data of an erased user from
+// the deliveries of its events in tx
+func (p *postgres) eraseUserWebhookDeliveries(ctx context.Context, tx pgx.Tx, userID int) error {
+	return eraseWebhookDeliveries(userID,
+		func() ([]domain.WebhookDelivery, error) {
+			rows, err := tx.Query(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE user_id = $1 ORDER BY id", userID)
+			if err != nil {
+				return nil, dbError(err)
+			}
+			defer rows.Close()
+
+			var deliveries []domain.WebhookDelivery
+			for rows.Next() {
+				var delivery webhookDeliveryModel
+				if err := rows.Scan(delivery.scanTargets()...); err != nil {
+					return nil, err
+				}
+				deliveries = append(deliveries, *delivery.ToDomain())
+			}
+			return deliveries, dbError(rows.Err())
+		},
+		func(deliveryID int, payload string) error {
+			_, err := tx.Exec(ctx, "UPDATE webhook_deliveries SET payload = $1 WHERE id = $2", payload, deliveryID)
+			return dbError(err)
+		},
+	)
+}
+
+// CreateWebhookDelivery queues an event for a subscription. An event that is
+// already queued for the subscription isn't queued again.
+func (p *postgres) CreateWebhookDelivery(ctx context.Context, params CreateWebhookDeliveryParams) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "CreateWebhookDelivery")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "CreateWebhookDelivery"),
+		attribute.Int("webhook_subscription.id", params.SubscriptionID),
+		attribute.Int("user_event.id", params.EventID),
+	)
+
+	now := time.Now()
+	_, err := p.conn.Exec(ctx, insertWebhookDeliveryQuery, params.SubscriptionID, params.EventID, params.UserID, params.EventType, string(params.Payload), domain.WebhookDeliveryPending, now, now)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert webhook delivery into database: %w", dbError(err))
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries returns the pending deliveries due at now and
+// postpones their next attempt by claimFor, so no one else attempts them
+// meanwhile. Deliveries of a caller that stops are attempted again after that.
+func (p *postgres) ClaimWebhookDeliveries(ctx context.Context, now time.Time, claimFor time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ClaimWebhookDeliveries")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ClaimWebhookDeliveries"),
+		attribute.Int("list.limit", limit),
+	)
+
+	query := `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id IN (
+    SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt_at <= $3 ORDER BY next_attempt_at, id LIMIT $4 FOR UPDATE SKIP LOCKED
+) RETURNING ` + webhookDeliveryColumns
+	rows, err := p.conn.Query(ctx, query, now.Add(claimFor), domain.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to claim webhook deliveries: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		var delivery webhookDeliveryModel
+		if err := rows.Scan(delivery.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", dbError(err))
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt logs an attempt of a delivery and updates the delivery
+func (p *postgres) RecordWebhookAttempt(ctx context.Context, params RecordWebhookAttemptParams) error {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "RecordWebhookAttempt")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "RecordWebhookAttempt"),
+		attribute.Int("webhook_delivery.id", params.DeliveryID),
+		attribute.String("webhook_delivery.status", params.Status),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, insertWebhookDeliveryAttemptQuery, params.DeliveryID, params.StatusCode, params.Error, params.Duration.Milliseconds(), params.AttemptedAt)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert webhook delivery attempt: %w", dbError(err))
+	}
+	_, err = tx.Exec(ctx, updateWebhookDeliveryAttemptQuery, params.Status, params.NextAttemptAt, params.Error, time.Now(), params.DeliveryID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update webhook delivery: %w", dbError(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", dbError(err))
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a page of the deliveries, oldest first
+func (p *postgres) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]domain.WebhookDelivery, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListWebhookDeliveries")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListWebhookDeliveries"),
+		attribute.Int("list.after_id", params.AfterID),
+		attribute.Int("list.limit", params.Limit),
+	)
+
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE " + listWebhookDeliveriesWhere + " ORDER BY id LIMIT $4"
+	rows, err := p.conn.Query(ctx, query, params.SubscriptionID, params.Status, params.AfterID, params.Limit)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list webhook deliveries: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		var delivery webhookDeliveryModel
+		if err := rows.Scan(delivery.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", dbError(err))
+	}
+	return deliveries, nil
+}
+
+// ListWebhookDeliveryAttempts returns the attempts of a delivery, oldest first
+func (p *postgres) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int) ([]domain.WebhookDeliveryAttempt, error) {
+	logFromCtx := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ListWebhookDeliveryAttempts")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ListWebhookDeliveryAttempts"),
+		attribute.Int("webhook_delivery.id", deliveryID),
+	)
+
+	rows, err := p.conn.Query(ctx, "SELECT "+webhookDeliveryAttemptColumns+" FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id", deliveryID)
+	if err != nil {
+		logFromCtx.Errorf(ctx, "failed to list webhook delivery attempts: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var attempts []domain.WebhookDeliveryAttempt
+	for rows.Next() {
+		var attempt webhookDeliveryAttemptModel
+		if err := rows.Scan(attempt.scanTargets()...); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to scan webhook delivery attempt: %w", err)
+		}
+		attempts = append(attempts, *attempt.ToDomain())
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", dbError(err))
+	}
+	return attempts, nil
+}
+
+// ReplayWebhookDelivery makes a delivery pending again with a fresh set of
+// attempts, the first one at now
+func (p *postgres) ReplayWebhookDelivery(ctx context.Context, deliveryID int, now time.Time) (*domain.WebhookDelivery, error) {
+	tracer := otel.Tracer("repository")
+	ctx, span := tracer.Start(ctx, "ReplayWebhookDelivery")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("repository.method.name", "ReplayWebhookDelivery"),
+		attribute.Int("webhook_delivery.id", deliveryID),
+	)
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before, after webhookDeliveryModel
+	err = tx.QueryRow(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = $1 FOR UPDATE", deliveryID).Scan(before.scanTargets()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook delivery %d not found: %w", deliveryID, domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to replay webhook delivery %d: %w", deliveryID, dbError(err))
+	}
+	err = tx.QueryRow(ctx, replayWebhookDeliveryQuery, domain.WebhookDeliveryPending, now, deliveryID).Scan(after.scanTargets()...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to replay webhook delivery %d: %w", deliveryID, dbError(err))
+	}
+	if err := p.recordChanges(ctx, tx, webhookDeliveryChange(domain.AuditActionWebhookDeliveryReplay, before.ToDomain(), after.ToDomain())); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to replay webhook delivery %d: %w", deliveryID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to replay webhook delivery %d: %w", deliveryID, dbError(err))
+	}
+	return after.ToDomain(), nil
+}
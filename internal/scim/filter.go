@@ -0,0 +1,376 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Filter operators, see RFC 7644 section 3.4.2.2
+const (
+	OpAnd            = "and"
+	OpOr             = "or"
+	OpNot            = "not"
+	OpEqual          = "eq"
+	OpNotEqual       = "ne"
+	OpContains       = "co"
+	OpStartsWith     = "sw"
+	OpEndsWith       = "ew"
+	OpGreater        = "gt"
+	OpGreaterOrEqual = "ge"
+	OpLess           = "lt"
+	OpLessOrEqual    = "le"
+	OpPresent        = "pr"
+)
+
+var comparisonOps = map[string]bool{
+	OpEqual: true, OpNotEqual: true, OpContains: true, OpStartsWith: true, OpEndsWith: true,
+	OpGreater: true, OpGreaterOrEqual: true, OpLess: true, OpLessOrEqual: true,
+}
+
+// Filter is a parsed SCIM filter expression. Logical filters (and, or, not)
+// hold their Operands, every other filter tests the attribute at Path against
+// Value, which is a string, bool, float64 or nil.
+type Filter struct {
+	Op       string
+	Path     string
+	Value    interface{}
+	Operands []*Filter
+}
+
+// Parse parses a filter such as `userName eq "jane@example.com" and active eq true`.
+// Attribute paths are returned without the core schema URN, and value path
+// filters like `emails[type eq "work"]` are flattened to `emails.type eq "work"`.
+func Parse(filter string) (*Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, Errorf(ErrInvalidFilter, "unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+// Match evaluates the filter against a resource. values returns the values of
+// an attribute by its lowercase path, e.g. "emails.value". Multi-valued
+// attributes match when any of their values does, and strings are compared
+// case-insensitively.
+func (f *Filter) Match(values func(path string) []interface{}) bool {
+	switch f.Op {
+	case OpAnd:
+		for _, operand := range f.Operands {
+			if !operand.Match(values) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, operand := range f.Operands {
+			if operand.Match(values) {
+				return true
+			}
+		}
+		return false
+	case OpNot:
+		return !f.Operands[0].Match(values)
+	}
+
+	attributeValues := values(strings.ToLower(f.Path))
+	if f.Op == OpPresent {
+		for _, value := range attributeValues {
+			if value != nil && value != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.Op == OpNotEqual {
+		return !(&Filter{Op: OpEqual, Path: f.Path, Value: f.Value}).Match(values)
+	}
+	for _, value := range attributeValues {
+		if compare(f.Op, value, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(op string, actual interface{}, expected interface{}) bool {
+	switch expectedValue := expected.(type) {
+	case string:
+		actualValue, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		a, e := strings.ToLower(actualValue), strings.ToLower(expectedValue)
+		switch op {
+		case OpEqual:
+			return a == e
+		case OpContains:
+			return strings.Contains(a, e)
+		case OpStartsWith:
+			return strings.HasPrefix(a, e)
+		case OpEndsWith:
+			return strings.HasSuffix(a, e)
+		case OpGreater:
+			return a > e
+		case OpGreaterOrEqual:
+			return a >= e
+		case OpLess:
+			return a < e
+		case OpLessOrEqual:
+			return a <= e
+		}
+	case bool:
+		actualValue, ok := actual.(bool)
+		return ok && op == OpEqual && actualValue == expectedValue
+	case float64:
+		actualValue, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case OpEqual:
+			return actualValue == expectedValue
+		case OpGreater:
+			return actualValue > expectedValue
+		case OpGreaterOrEqual:
+			return actualValue >= expectedValue
+		case OpLess:
+			return actualValue < expectedValue
+		case OpLessOrEqual:
+			return actualValue <= expectedValue
+		}
+	case nil:
+		return op == OpEqual && actual == nil
+	}
+	return false
+}
+
+// NormalizePath strips the core User or Group schema URN from an attribute
+// path. Paths of other schemas, such as extensions, are returned unchanged.
+func NormalizePath(path string) string {
+	lower := strings.ToLower(path)
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		prefix := strings.ToLower(schema) + ":"
+		if strings.HasPrefix(lower, prefix) {
+			return path[len(prefix):]
+		}
+	}
+	return path
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(filter string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, Errorf(ErrInvalidFilter, "unterminated string in filter")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &value); err != nil {
+				return nil, Errorf(ErrInvalidFilter, "invalid string %s in filter", filter[i:end+1])
+			}
+			tokens = append(tokens, filterToken{text: value, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t()[]\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{text: filter[i:end]})
+			i = end
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, Errorf(ErrInvalidFilter, "empty filter")
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, Errorf(ErrInvalidFilter, "unexpected end of filter")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *filterParser) expect(text string) error {
+	token, err := p.next()
+	if err != nil {
+		return err
+	}
+	if token.quoted || token.text != text {
+		return Errorf(ErrInvalidFilter, "expected %q but found %q in filter", text, token.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (*Filter, error) {
+	return p.parseLogical(OpOr, p.parseAnd)
+}
+
+func (p *filterParser) parseAnd() (*Filter, error) {
+	return p.parseLogical(OpAnd, p.parseUnary)
+}
+
+func (p *filterParser) parseLogical(op string, operand func() (*Filter, error)) (*Filter, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*Filter{first}
+	for p.peekKeyword(op) {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &Filter{Op: op, Operands: operands}, nil
+}
+
+func (p *filterParser) parseUnary() (*Filter, error) {
+	if p.peekKeyword(OpNot) {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Filter{Op: OpNot, Operands: []*Filter{operand}}, nil
+	}
+	if p.peekKeyword("(") {
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	return p.parseAttribute()
+}
+
+func (p *filterParser) parseAttribute() (*Filter, error) {
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if token.quoted || strings.ContainsAny(token.text, "()") {
+		return nil, Errorf(ErrInvalidFilter, "expected an attribute but found %q in filter", token.text)
+	}
+	path := NormalizePath(token.text)
+
+	if p.peekKeyword("[") {
+		p.pos++
+		valueFilter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		prefixPaths(valueFilter, path+".")
+		return valueFilter, nil
+	}
+
+	opToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(opToken.text)
+	if opToken.quoted {
+		return nil, Errorf(ErrInvalidFilter, "expected an operator but found %q in filter", opToken.text)
+	}
+	if op == OpPresent {
+		return &Filter{Op: OpPresent, Path: path}, nil
+	}
+	if !comparisonOps[op] {
+		return nil, Errorf(ErrInvalidFilter, "unknown operator %q in filter", opToken.text)
+	}
+
+	valueToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseValue(valueToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Op: op, Path: path, Value: value}, nil
+}
+
+func parseValue(token filterToken) (interface{}, error) {
+	if token.quoted {
+		return token.text, nil
+	}
+	switch token.text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(token.text, 64)
+	if err != nil {
+		return nil, Errorf(ErrInvalidFilter, "invalid value %q in filter", token.text)
+	}
+	return number, nil
+}
+
+func prefixPaths(f *Filter, prefix string) {
+	if f.Path != "" {
+		f.Path = prefix + f.Path
+	}
+	for _, operand := range f.Operands {
+		prefixPaths(operand, prefix)
+	}
+}
@@ -0,0 +1,149 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   string
+		expected *Filter
+	}{
+		{
+			name:     "Equal",
+			filter:   `userName eq "jane@example.com"`,
+			expected: &Filter{Op: OpEqual, Path: "userName", Value: "jane@example.com"},
+		},
+		{
+			name:     "SchemaURN",
+			filter:   `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "J"`,
+			expected: &Filter{Op: OpStartsWith, Path: "userName", Value: "J"},
+		},
+		{
+			name:     "Present",
+			filter:   `externalId PR`,
+			expected: &Filter{Op: OpPresent, Path: "externalId"},
+		},
+		{
+			name:   "Precedence",
+			filter: `active eq true or name.formatted co "doe" and not (emails co "example.org")`,
+			expected: &Filter{Op: OpOr, Operands: []*Filter{
+				{Op: OpEqual, Path: "active", Value: true},
+				{Op: OpAnd, Operands: []*Filter{
+					{Op: OpContains, Path: "name.formatted", Value: "doe"},
+					{Op: OpNot, Operands: []*Filter{{Op: OpContains, Path: "emails", Value: "example.org"}}},
+				}},
+			}},
+		},
+		{
+			name:   "ValuePath",
+			filter: `emails[type eq "work" and value ew "@example.com"]`,
+			expected: &Filter{Op: OpAnd, Operands: []*Filter{
+				{Op: OpEqual, Path: "emails.type", Value: "work"},
+				{Op: OpEndsWith, Path: "emails.value", Value: "@example.com"},
+			}},
+		},
+		{
+			name:     "EscapedString",
+			filter:   `displayName eq "say \"hi\""`,
+			expected: &Filter{Op: OpEqual, Path: "displayName", Value: `say "hi"`},
+		},
+		{
+			name:     "Number",
+			filter:   `meta.version gt 1.5`,
+			expected: &Filter{Op: OpGreater, Path: "meta.version", Value: 1.5},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := Parse(tc.filter)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, f)
+		})
+	}
+}
+
+func TestParseInvalidFilter(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName like "x"`,
+		`userName eq "unterminated`,
+		`(userName eq "x"`,
+		`userName eq "x" and`,
+		`userName eq unquoted`,
+		`emails[type eq "work"`,
+	} {
+		_, err := Parse(filter)
+		require.Error(t, err, filter)
+
+		scimErr, ok := err.(*Error)
+		require.True(t, ok, filter)
+		require.Equal(t, ErrInvalidFilter, scimErr.ScimType)
+		require.Equal(t, 400, scimErr.StatusCode())
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	values := func(path string) []interface{} {
+		switch path {
+		case "username":
+			return []interface{}{"Jane@Example.com"}
+		case "emails.value":
+			return []interface{}{"jane@example.com", "jd@example.org"}
+		case "active":
+			return []interface{}{true}
+		}
+		return nil
+	}
+
+	testCases := []struct {
+		filter  string
+		matches bool
+	}{
+		{`userName eq "jane@example.com"`, true},
+		{`userName ne "jane@example.com"`, false},
+		{`emails[value ew ".org"]`, true},
+		{`emails.value sw "john"`, false},
+		{`active eq true and userName co "EXAMPLE"`, true},
+		{`not (active eq true)`, false},
+		{`externalId pr or active eq false`, false},
+		{`externalId pr or userName pr`, true},
+	}
+
+	for _, tc := range testCases {
+		f, err := Parse(tc.filter)
+		require.NoError(t, err)
+		require.Equal(t, tc.matches, f.Match(values), tc.filter)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath(`name.givenName`)
+	require.NoError(t, err)
+	require.Equal(t, Path{Attribute: "name", SubAttribute: "givenname"}, path)
+
+	path, err = ParsePath(`members[value eq "2819c223"]`)
+	require.NoError(t, err)
+	require.Equal(t, "members", path.Attribute)
+	require.Equal(t, &Filter{Op: OpEqual, Path: "value", Value: "2819c223"}, path.ValueFilter)
+
+	path, err = ParsePath(`emails[type eq "work"].value`)
+	require.NoError(t, err)
+	require.Equal(t, "emails", path.Attribute)
+	require.Equal(t, "value", path.SubAttribute)
+
+	path, err = ParsePath(`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department`)
+	require.NoError(t, err)
+	require.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", path.Attribute)
+
+	for _, invalid := range []string{``, `[value eq "x"]`, `members[value eq "x"`, `members[value eq "x"]value`, `members[value eq]`} {
+		_, err := ParsePath(invalid)
+		require.Error(t, err, invalid)
+	}
+}
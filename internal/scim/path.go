@@ -0,0 +1,52 @@
+package scim
+
+import "strings"
+
+// Path is the target of a PATCH operation, see RFC 7644 section 3.5.2.
+// `emails[type eq "work"].value` has the attribute "emails", a value filter
+// relative to the emails and the sub-attribute "value".
+type Path struct {
+	Attribute    string
+	SubAttribute string
+	ValueFilter  *Filter
+}
+
+// ParsePath parses a PATCH path. Attribute names are lowercased and the core
+// schema URN is stripped, paths of other schemas keep their URN.
+func ParsePath(path string) (Path, error) {
+	path = NormalizePath(strings.TrimSpace(path))
+	if path == "" {
+		return Path{}, Errorf(ErrInvalidPath, "empty path")
+	}
+
+	open := strings.IndexByte(path, '[')
+	if open < 0 {
+		if strings.HasPrefix(strings.ToLower(path), "urn:") {
+			return Path{Attribute: path}, nil
+		}
+		attribute, subAttribute, _ := strings.Cut(path, ".")
+		if attribute == "" || strings.ContainsAny(path, "] ") {
+			return Path{}, Errorf(ErrInvalidPath, "invalid path %q", path)
+		}
+		return Path{Attribute: strings.ToLower(attribute), SubAttribute: strings.ToLower(subAttribute)}, nil
+	}
+
+	closing := strings.LastIndexByte(path, ']')
+	if closing < open || open == 0 {
+		return Path{}, Errorf(ErrInvalidPath, "invalid path %q", path)
+	}
+	valueFilter, err := Parse(path[open+1 : closing])
+	if err != nil {
+		return Path{}, Errorf(ErrInvalidPath, "invalid value filter in path %q", path)
+	}
+
+	rest := path[closing+1:]
+	if rest != "" && (!strings.HasPrefix(rest, ".") || len(rest) == 1) {
+		return Path{}, Errorf(ErrInvalidPath, "invalid path %q", path)
+	}
+	return Path{
+		Attribute:    strings.ToLower(path[:open]),
+		SubAttribute: strings.ToLower(strings.TrimPrefix(rest, ".")),
+		ValueFilter:  valueFilter,
+	}, nil
+}
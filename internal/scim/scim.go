@@ -0,0 +1,169 @@
+// Package scim implements the protocol parts of SCIM 2.0 (RFC 7643 and
+// RFC 7644): resource representations, filters, PATCH paths and errors.
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Schema URNs of the resources and messages, see RFC 7643 section 8.7
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// MediaType is the content type of SCIM requests and responses
+const MediaType = "application/scim+json"
+
+// Detail error types, see RFC 7644 section 3.12
+const (
+	ErrInvalidFilter = "invalidFilter"
+	ErrTooMany       = "tooMany"
+	ErrUniqueness    = "uniqueness"
+	ErrMutability    = "mutability"
+	ErrInvalidSyntax = "invalidSyntax"
+	ErrInvalidPath   = "invalidPath"
+	ErrNoTarget      = "noTarget"
+	ErrInvalidValue  = "invalidValue"
+)
+
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+}
+
+// MultiValued is an entry of a multi-valued attribute such as emails or members
+type MultiValued struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type User struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id,omitempty"`
+	ExternalID  string        `json:"externalId,omitempty"`
+	UserName    string        `json:"userName"`
+	Name        *Name         `json:"name,omitempty"`
+	DisplayName string        `json:"displayName,omitempty"`
+	Emails      []MultiValued `json:"emails,omitempty"`
+	Active      *bool         `json:"active,omitempty"`
+	Password    string        `json:"password,omitempty"`
+	Groups      []MultiValued `json:"groups,omitempty"`
+	Meta        *Meta         `json:"meta,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id"`
+	DisplayName string        `json:"displayName"`
+	Members     []MultiValued `json:"members,omitempty"`
+	Meta        *Meta         `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// NewListResponse builds a page of resources starting at the 1-based startIndex
+func NewListResponse(resources []interface{}, total int, startIndex int) ListResponse {
+	if resources == nil {
+		resources = []interface{}{}
+	}
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove operation. The value is
+// kept raw since its type depends on the target of the path.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is the SCIM error response, see RFC 7644 section 3.12
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewError returns an error with the HTTP status code and an optional detail
+// error type, e.g. NewError(http.StatusConflict, ErrUniqueness, "...").
+func NewError(statusCode int, scimType string, detail string) *Error {
+	return &Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(statusCode),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// Errorf returns a bad request error of the detail error type
+func Errorf(scimType string, format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, scimType, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return fmt.Sprintf("scim %s (%s): %s", e.Status, e.ScimType, e.Detail)
+	}
+	return fmt.Sprintf("scim %s: %s", e.Status, e.Detail)
+}
+
+// StatusCode returns the HTTP status code of the error
+func (e *Error) StatusCode() int {
+	code, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+// ETag returns a weak entity tag over the JSON representation of a resource.
+// The representation must not include the version itself.
+func ETag(resource interface{}) (string, error) {
+	body, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
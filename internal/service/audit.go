@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	requestIDHeader    = "x-request-id"
+	maxRequestIDLength = 128
+)
+
+// withAuditInfo attaches the request ID and client address that the audit log
+// records to the context of a gRPC call. The actor is filled in once the
+// caller is authorized.
+func withAuditInfo(ctx context.Context, proxies *Proxies) context.Context {
+	ctx = proxies.withGRPCClientInfo(ctx)
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDHeader); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	return audit.WithInfo(ctx, &audit.Info{
+		RequestID: auditRequestID(requestID),
+		ClientIP:  clientInfoFromContext(ctx).IPAddress,
+	})
+}
+
+// withHTTPAuditInfo is withAuditInfo for requests served outside of the gRPC
+// server
+func withHTTPAuditInfo(ctx context.Context, proxies *Proxies, r *http.Request) context.Context {
+	ctx = proxies.withClientInfo(ctx, r)
+	return audit.WithInfo(ctx, &audit.Info{
+		RequestID: auditRequestID(r.Header.Get(requestIDHeader)),
+		ClientIP:  clientInfoFromContext(ctx).IPAddress,
+	})
+}
+
+// auditRequestID keeps the request ID the client sent, so the audit log can be
+// matched with its logs, and makes one up otherwise
+func auditRequestID(requestID string) string {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return uuid.NewString()
+	}
+	return requestID
+}
+
+// setAuditActor records the caller of an authorized request as the actor of
+// the changes it makes. Impersonated changes name both users.
+func setAuditActor(ctx context.Context, payload *token.Payload) {
+	actor := auditName(payload.Email, payload.Subject)
+	if payload.IsImpersonated() {
+		actor = auditName(payload.Actor.Email, payload.Actor.Subject) + audit.ImpersonationSeparator + actor
+	}
+	audit.SetActor(ctx, actor)
+}
+
+// auditName names a user by email, and callers without one, like OAuth2
+// clients, by subject
+func auditName(email, subject string) string {
+	if email != "" {
+		return email
+	}
+	return subject
+}
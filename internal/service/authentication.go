@@ -2,24 +2,148 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
 	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
 const (
 	authorizationHeader = "authorization"
 	authorizationBearer = "bearer"
+	authorizationAPIKey = "apikey"
+	apiKeyHeader        = "x-api-key"
 )
 
+// methodScopes lists the scope a scoped credential needs for each RPC.
+// RPCs missing from this map can only be called with an unscoped login token.
+var methodScopes = map[string]string{
+	"/userpb.UserService/GetUser":     domain.ScopeUsersRead,
+	"/userpb.UserService/CreateAdmin": domain.ScopeUsersWrite,
+	"/userpb.UserService/UpdateUser":  domain.ScopeUsersWrite,
+	"/userpb.UserService/DeleteUser":  domain.ScopeUsersWrite,
+}
+
+// impersonationForbidden lists the RPCs an impersonated token can't call,
+// since they destroy the account or hand out credentials that outlive the token.
+var impersonationForbidden = map[string]bool{
+	"/userpb.UserService/DeleteUser":                true,
+	"/userpb.UserService/CreateAdmin":               true,
+	"/userpb.UserService/CreateAPIKey":              true,
+	"/userpb.UserService/CreateOAuthClient":         true,
+	"/userpb.UserService/DeleteOAuthClient":         true,
+	"/userpb.UserService/CreateWebhookSubscription": true,
+	"/userpb.UserService/VerifyDeviceCode":          true,
+	"/userpb.UserService/Reauthenticate":            true,
+	"/userpb.UserService/ExportMyData":              true,
+	"/userpb.UserService/RequestErasure":            true,
+}
+
+// readOnlyMethods don't change any state. Calls of every other RPC with an
+// impersonated token are logged with both identities.
+var readOnlyMethods = map[string]bool{
+	"/userpb.UserService/GetUser":                     true,
+	"/userpb.UserService/ListAPIKeys":                 true,
+	"/userpb.UserService/ListOAuthClients":            true,
+	"/userpb.UserService/ListSessions":                true,
+	"/userpb.UserService/ListLoginEvents":             true,
+	"/userpb.UserService/WatchUsers":                  true,
+	"/userpb.UserService/ListDeletedUsers":            true,
+	"/userpb.UserService/GetErasureRequest":           true,
+	"/userpb.UserService/ListErasureRequests":         true,
+	"/userpb.UserService/ListAuditEvents":             true,
+	"/userpb.UserService/ListWebhookSubscriptions":    true,
+	"/userpb.UserService/ListWebhookDeliveries":       true,
+	"/userpb.UserService/ListWebhookDeliveryAttempts": true,
+}
+
+// methodMaxAuthAge lists RPCs that need a recent credential check on top of a
+// valid token, with how long ago the user may have last proved their
+// credentials. Callers with an older login get a reauthentication required
+// error and have to call Reauthenticate first.
+var methodMaxAuthAge = map[string]time.Duration{
+	"/userpb.UserService/DeleteUser":                5 * time.Minute,
+	"/userpb.UserService/CreateAdmin":               5 * time.Minute,
+	"/userpb.UserService/CreateAPIKey":              15 * time.Minute,
+	"/userpb.UserService/CreateOAuthClient":         15 * time.Minute,
+	"/userpb.UserService/DeleteOAuthClient":         15 * time.Minute,
+	"/userpb.UserService/CreateWebhookSubscription": 15 * time.Minute,
+	"/userpb.UserService/ExportMyData":              15 * time.Minute,
+	"/userpb.UserService/RequestErasure":            5 * time.Minute,
+}
+
+// staleLoginError is returned by authorizeUser when the login
+// behind a token is older than the RPC allows
+type staleLoginError struct {
+	method string
+	maxAge time.Duration
+}
+
+func (e *staleLoginError) Error() string {
+	return fmt.Sprintf("%s requires a login within the last %s", e.method, e.maxAge)
+}
+
+// errImpersonationForbidden is returned by authorizeUser when an impersonated
+// token calls an RPC listed in impersonationForbidden
+var errImpersonationForbidden = errors.New("impersonated tokens are not allowed")
+
 func (server *UserServiceServer) authorizeUser(ctx context.Context, accessibleRoles []string) (*token.Payload, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("missing metadata")
 	}
 
+	payload, err := server.authenticate(ctx, md)
+	if err != nil {
+		return nil, err
+	}
+	if !hasPermission(payload.Role, accessibleRoles) {
+		return nil, fmt.Errorf("permission denied")
+	}
+
+	method, _ := grpc.Method(ctx)
+	if payload.IsScoped() {
+		scope, ok := methodScopes[method]
+		if !ok || !payload.HasScope(scope) {
+			return nil, fmt.Errorf("credential is not allowed to call %s", method)
+		}
+	}
+	if payload.IsImpersonated() {
+		if impersonationForbidden[method] {
+			return nil, fmt.Errorf("%w to call %s", errImpersonationForbidden, method)
+		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("token.actor.subject", payload.Actor.Subject),
+			attribute.String("token.actor.role", payload.Actor.Role),
+		)
+		if !readOnlyMethods[method] {
+			logger.FromContext(ctx).Infof(ctx, "Impersonated write: Method=%s, Subject=%s, Actor=%s (%s)",
+				method, utils.MaskEmail(payload.Email), payload.Actor.Subject, utils.MaskEmail(payload.Actor.Email))
+		}
+	}
+
+	if maxAge, ok := methodMaxAuthAge[method]; ok && payload.AuthAge() > maxAge {
+		return nil, &staleLoginError{method: method, maxAge: maxAge}
+	}
+
+	setAuditActor(ctx, payload)
+	return payload, nil
+}
+
+func (server *UserServiceServer) authenticate(ctx context.Context, md metadata.MD) (*token.Payload, error) {
+	if values := md.Get(apiKeyHeader); len(values) > 0 {
+		return server.verifyAPIKey(ctx, values[0])
+	}
+
 	values := md.Get(authorizationHeader)
 	if len(values) == 0 {
 		return nil, fmt.Errorf("missing authorization header")
@@ -32,22 +156,89 @@ func (server *UserServiceServer) authorizeUser(ctx context.Context, accessibleRo
 	}
 
 	authType := strings.ToLower(fields[0])
-	if authType != authorizationBearer {
+	switch authType {
+	case authorizationBearer:
+		return server.verifyAccessToken(ctx, fields[1])
+	case authorizationAPIKey:
+		return server.verifyAPIKey(ctx, fields[1])
+	default:
 		return nil, fmt.Errorf("unsupported authorization type: %s", authType)
 	}
+}
 
-	accessToken := fields[1]
+// verifyAccessToken checks an access token sent as bearer token or handed
+// in as the subject token of a token exchange. Tokens of users are only
+// valid as long as the session they are bound to.
+func (server *UserServiceServer) verifyAccessToken(ctx context.Context, accessToken string) (*token.Payload, error) {
 	payload, err := server.tokenMaker.VerifyToken(accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("invalid access token: %s", err)
 	}
-	if !hasPermission(payload.Role, accessibleRoles) {
-		return nil, fmt.Errorf("permission denied")
+	if payload.SessionID == "" {
+		// Only tokens of OAuth2 clients aren't issued for a session
+		if payload.Role != domain.ServiceRole {
+			return nil, fmt.Errorf("access token is not bound to a session")
+		}
+		return payload, nil
+	}
+	session, err := server.UserRepo.GetSession(ctx, payload.SessionID)
+	if err != nil || !session.IsActive(time.Now()) {
+		return nil, fmt.Errorf("session is revoked")
+	}
+	// The user may have been deleted, deactivated or given another role since
+	// the token was issued
+	user, err := server.UserRepo.GetUserByEmail(ctx, payload.Email)
+	if err != nil {
+		return nil, fmt.Errorf("user of the access token not found")
+	}
+	if !user.Active || user.Role != payload.Role {
+		return nil, fmt.Errorf("user of the access token is deactivated or has another role")
 	}
-
 	return payload, nil
 }
 
+// verifyAPIKey checks an API key of the form <prefix>.<secret> and returns a
+// payload for its owner, restricted to the scopes of the key.
+func (server *UserServiceServer) verifyAPIKey(ctx context.Context, key string) (*token.Payload, error) {
+	log := logger.FromContext(ctx)
+
+	prefix, secret, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, fmt.Errorf("invalid api key format")
+	}
+
+	apiKey, err := server.UserRepo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil || !utils.CheckSecret(secret, apiKey.HashedSecret) {
+		return nil, fmt.Errorf("invalid api key")
+	}
+
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return nil, fmt.Errorf("api key is revoked or expired")
+	}
+
+	owner, err := server.UserRepo.GetUserByID(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("api key owner not found")
+	}
+	if !owner.Active {
+		return nil, fmt.Errorf("api key owner is deactivated")
+	}
+
+	if err := server.UserRepo.TouchAPIKey(ctx, apiKey.ID, now); err != nil {
+		log.Warnf(ctx, "Failed to update last used time of api key %s: %v", apiKey.Prefix, err)
+	}
+
+	return &token.Payload{
+		Subject:   owner.Email,
+		Email:     owner.Email,
+		Role:      owner.Role,
+		Scopes:    apiKey.Scopes,
+		IssuedAt:  apiKey.CreatedAt,
+		ExpiredAt: apiKey.ExpiresAt,
+	}, nil
+}
+
 func hasPermission(userRole string, accessibleRoles []string) bool {
 	for _, role := range accessibleRoles {
 		if userRole == role {
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	forwardedForHeader     = "x-forwarded-for"
+	gatewayHeader          = "x-sternx-gateway"
+	userAgentHeader        = "user-agent"
+	gatewayUserAgentHeader = "grpcgateway-user-agent"
+	maxUserAgentLength     = 512
+)
+
+// clientInfo describes the device a request comes from, as recorded in the
+// login history and on sessions
+type clientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+type clientInfoKey struct{}
+
+// Proxies decides whose word the server takes for the address of a client.
+// Any client can send an X-Forwarded-For header, so its entries are only read
+// as far as they were added by the reverse proxies the server trusts.
+type Proxies struct {
+	trusted []netip.Prefix
+	// gatewaySecret is sent by the gateway on its calls to the gRPC server, so
+	// the address it forwards can be told apart from one a direct gRPC client
+	// made up
+	gatewaySecret string
+}
+
+// NewProxies trusts the reverse proxies at the given addresses or CIDR ranges
+func NewProxies(trusted []string) (*Proxies, error) {
+	secret, err := utils.RandomSecret(32)
+	if err != nil {
+		return nil, err
+	}
+	proxies := &Proxies{gatewaySecret: secret}
+	for _, proxy := range trusted {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies.trusted = append(proxies.trusted, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// GatewayCredentials are the credentials the gateway calls the gRPC server
+// with
+func (p *Proxies) GatewayCredentials() credentials.PerRPCCredentials {
+	return gatewayCredentials{secret: p.gatewaySecret}
+}
+
+// withClientInfo attaches the client of an HTTP request to the context, for
+// login flows served outside of the gRPC server
+func (p *Proxies) withClientInfo(ctx context.Context, r *http.Request) context.Context {
+	info := clientInfo{
+		IPAddress: p.clientIP(forwardedHops(r.Header.Get(forwardedForHeader), hostOnly(r.RemoteAddr))),
+		UserAgent: r.UserAgent(),
+	}
+	return context.WithValue(ctx, clientInfoKey{}, info.truncated())
+}
+
+// withGRPCClientInfo attaches the client of a gRPC call to the context. Calls
+// through the gateway carry the address and user agent of the HTTP client in
+// metadata, direct gRPC calls are from their peer address.
+func (p *Proxies) withGRPCClientInfo(ctx context.Context) context.Context {
+	info := peerClientInfo(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok && p.fromGateway(md) {
+		// The gateway adds the address of the HTTP client after the entries
+		// of the X-Forwarded-For header it got, so it is the last value
+		if values := md.Get(forwardedForHeader); len(values) > 0 {
+			info.IPAddress = p.clientIP(forwardedHops(values[len(values)-1], ""))
+		}
+		if values := md.Get(gatewayUserAgentHeader); len(values) > 0 {
+			info.UserAgent = values[0]
+		}
+	}
+	return context.WithValue(ctx, clientInfoKey{}, info.truncated())
+}
+
+// fromGateway reports whether a call was made by the gateway of this process
+func (p *Proxies) fromGateway(md metadata.MD) bool {
+	for _, value := range md.Get(gatewayHeader) {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(p.gatewaySecret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the client of a request that went through hops, the
+// addresses it was forwarded from with the nearest last. Hops are walked back
+// for as long as they are trusted proxies, and the first one that isn't is
+// the client. An entry that isn't an address stops the walk at the proxy that
+// added it.
+func (p *Proxies) clientIP(hops []string) string {
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			if i == len(hops)-1 {
+				return ""
+			}
+			return hops[i+1]
+		}
+		if i == 0 || !p.isTrusted(addr) {
+			return addr.Unmap().String()
+		}
+	}
+	return ""
+}
+
+func (p *Proxies) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientInfoFromContext returns the client of a request, as attached by the
+// interceptors or the HTTP handlers. Requests without one are from their
+// peer address.
+func clientInfoFromContext(ctx context.Context) clientInfo {
+	if info, ok := ctx.Value(clientInfoKey{}).(clientInfo); ok {
+		return info
+	}
+	return peerClientInfo(ctx).truncated()
+}
+
+// peerClientInfo is the client of a gRPC call as its connection tells
+func peerClientInfo(ctx context.Context) clientInfo {
+	var info clientInfo
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(userAgentHeader); len(values) > 0 {
+			info.UserAgent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.IPAddress = hostOnly(p.Addr.String())
+	}
+	return info
+}
+
+// truncated cuts the user agent to the length the login history stores
+func (info clientInfo) truncated() clientInfo {
+	if len(info.UserAgent) > maxUserAgentLength {
+		info.UserAgent = info.UserAgent[:maxUserAgentLength]
+	}
+	return info
+}
+
+// forwardedHops returns the entries of an X-Forwarded-For header followed by
+// the address the request came from, if known
+func forwardedHops(header string, remoteAddr string) []string {
+	var hops []string
+	if header != "" {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if remoteAddr != "" {
+		hops = append(hops, remoteAddr)
+	}
+	return hops
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// gatewayCredentials attach the gateway secret to the calls of the gateway
+type gatewayCredentials struct {
+	secret string
+}
+
+func (c gatewayCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{gatewayHeader: c.secret}, nil
+}
+
+// RequireTransportSecurity is false since the gateway calls the server over
+// loopback, and the secret changes with every start
+func (c gatewayCredentials) RequireTransportSecurity() bool {
+	return false
+}
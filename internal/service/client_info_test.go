@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestHTTPClientInfo(t *testing.T) {
+	proxies, err := NewProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		"Direct":                  {remoteAddr: "203.0.113.7:4000", want: "203.0.113.7"},
+		"ForwardedByUntrusted":    {remoteAddr: "203.0.113.7:4000", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		"ForwardedByTrusted":      {remoteAddr: "10.1.2.3:4000", forwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		"SpoofedBehindTrusted":    {remoteAddr: "10.1.2.3:4000", forwardedFor: "1.1.1.1, 198.51.100.1", want: "198.51.100.1"},
+		"ChainOfTrusted":          {remoteAddr: "10.1.2.3:4000", forwardedFor: "198.51.100.1, 192.168.1.1", want: "198.51.100.1"},
+		"OnlyTrusted":             {remoteAddr: "10.1.2.3:4000", forwardedFor: "10.9.9.9", want: "10.9.9.9"},
+		"GarbageBehindTrusted":    {remoteAddr: "10.1.2.3:4000", forwardedFor: "not-an-ip", want: "10.1.2.3"},
+		"TrustedWithoutForwarded": {remoteAddr: "10.1.2.3:4000", want: "10.1.2.3"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			info := clientInfoFromContext(proxies.withClientInfo(context.Background(), r))
+			require.Equal(t, test.want, info.IPAddress)
+		})
+	}
+}
+
+func TestGRPCClientInfo(t *testing.T) {
+	proxies, err := NewProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	gatewayMetadata, err := proxies.GatewayCredentials().GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		md   metadata.MD
+		want string
+	}{
+		"Direct": {
+			md:   metadata.Pairs("user-agent", "grpc-go"),
+			want: "127.0.0.1",
+		},
+		"DirectWithForwardedFor": {
+			md:   metadata.Pairs(forwardedForHeader, "198.51.100.1"),
+			want: "127.0.0.1",
+		},
+		"DirectWithWrongGatewaySecret": {
+			md:   metadata.Pairs(forwardedForHeader, "198.51.100.1", gatewayHeader, "guess"),
+			want: "127.0.0.1",
+		},
+		"Gateway": {
+			md:   metadata.Pairs(forwardedForHeader, "203.0.113.7", gatewayHeader, gatewayMetadata[gatewayHeader]),
+			want: "203.0.113.7",
+		},
+		"GatewaySpoofedByClient": {
+			md:   metadata.Pairs(forwardedForHeader, "1.1.1.1, 203.0.113.7", gatewayHeader, gatewayMetadata[gatewayHeader]),
+			want: "203.0.113.7",
+		},
+		"GatewayBehindTrustedProxy": {
+			md:   metadata.Pairs(forwardedForHeader, "1.1.1.1, 198.51.100.1, 10.1.2.3", gatewayHeader, gatewayMetadata[gatewayHeader]),
+			want: "198.51.100.1",
+		},
+		"GatewayWithForwardedForMetadataFromClient": {
+			md:   metadata.Pairs(forwardedForHeader, "1.1.1.1", forwardedForHeader, "203.0.113.7", gatewayHeader, gatewayMetadata[gatewayHeader]),
+			want: "203.0.113.7",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}})
+			ctx = metadata.NewIncomingContext(ctx, test.md)
+			info := clientInfoFromContext(proxies.withGRPCClientInfo(ctx))
+			require.Equal(t, test.want, info.IPAddress)
+		})
+	}
+}
+
+func TestNewProxies(t *testing.T) {
+	_, err := NewProxies([]string{"10.0.0.0/8", "::1", "2001:db8::/32"})
+	require.NoError(t, err)
+	_, err = NewProxies([]string{"proxy.internal"})
+	require.Error(t, err)
+}
@@ -3,17 +3,82 @@ package service
 import (
 	"fmt"
 	"time"
+
+	"github.com/fibonachyy/sternx/internal/federation"
+	"github.com/fibonachyy/sternx/internal/notification"
+	"github.com/fibonachyy/sternx/pkg/password"
 )
 
 type Config struct {
-	JWTDuration       time.Duration
-	TokenSymmetricKey string
+	JWTDuration         time.Duration
+	TokenSymmetricKey   string
+	APIKeyDuration      time.Duration
+	ClientTokenDuration time.Duration
+	// Issuer is the public base URL of the OpenID provider, e.g. https://sso.example.com
+	Issuer string
+	// IDTokenSigningKey is the path of a PEM encoded RSA key used to sign ID tokens
+	IDTokenSigningKey string
+	AuthCodeDuration  time.Duration
+	// DeviceCodeDuration is how long a device has to get its user code approved
+	DeviceCodeDuration time.Duration
+	// DevicePollInterval is the minimum time a device waits between token requests
+	DevicePollInterval time.Duration
+	// DeviceVerificationURI is the page where users enter the code shown by a
+	// device; it calls the VerifyDeviceCode RPC. Defaults to {Issuer}/device
+	DeviceVerificationURI string
+	// ImpersonationDuration is the lifetime of tokens admins get through token
+	// exchange to act as another user
+	ImpersonationDuration time.Duration
+	// MagicLinkDuration is how long a login link sent by RequestMagicLink stays valid
+	MagicLinkDuration time.Duration
+	// MagicLinkURL is the page login links point to; it calls the RedeemMagicLink
+	// RPC with the token and email from its query. Defaults to {Issuer}/magic-link
+	MagicLinkURL string
+	// NotificationSender delivers login links to users. Defaults to logging them.
+	NotificationSender notification.Sender
+	// PasswordHashing tunes the argon2id cost of new password hashes and sets
+	// the optional pepper. Existing hashes are upgraded on login.
+	PasswordHashing password.Config
+	// PasswordPolicy decides which passwords users may choose. Defaults to
+	// password.DefaultPolicy.
+	PasswordPolicy password.Policy
+	// PasswordHistorySize is how many previous passwords of a user can't be
+	// reused. Defaults to 5, a negative value turns the check off.
+	PasswordHistorySize int
+	// PasswordMaxAge makes LoginUser ask for a password change once a password
+	// is older than this. Zero lets passwords live forever.
+	PasswordMaxAge time.Duration
+	// DeletedUserRetention is how long deleted users can be restored before
+	// they're purged and their emails can be registered again
+	DeletedUserRetention time.Duration
+	// UserPurgeInterval is how often PurgeDeletedUsers looks for users to purge
+	UserPurgeInterval time.Duration
+	// Proxies decides which X-Forwarded-For entries the login history and
+	// sessions take the client address from. Defaults to trusting no proxies.
+	Proxies *Proxies
+	// WatchPollInterval is how often WatchUsers streams look for new events
+	// in the outbox
+	WatchPollInterval time.Duration
+	// FederationProviders are the upstream OpenID Connect providers users can sign in with
+	FederationProviders []federation.ProviderConfig
 }
 
 // DefaultConfig returns the default configuration.
 func DefaultConfig() Config {
 	return Config{
-		JWTDuration: 15 * time.Minute, // Default JWT duration of 15 minutes
+		JWTDuration:           15 * time.Minute,    // Default JWT duration of 15 minutes
+		APIKeyDuration:        90 * 24 * time.Hour, // API keys expire after 90 days unless told otherwise
+		ClientTokenDuration:   time.Hour,           // Tokens issued to OAuth2 clients live for an hour
+		Issuer:                "http://localhost:8080",
+		AuthCodeDuration:      2 * time.Minute,
+		DeviceCodeDuration:    10 * time.Minute,
+		DevicePollInterval:    5 * time.Second,
+		ImpersonationDuration: 10 * time.Minute,
+		MagicLinkDuration:     15 * time.Minute,
+		PasswordHistorySize:   5,
+		DeletedUserRetention:  30 * 24 * time.Hour,
+		UserPurgeInterval:     time.Hour,
+		WatchPollInterval:     500 * time.Millisecond,
 	}
 }
 func validateConfig(config Config) error {
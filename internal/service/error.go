@@ -1,6 +1,10 @@
 package service
 
 import (
+	"errors"
+	"strconv"
+
+	"github.com/fibonachyy/sternx/internal/domain"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -26,5 +30,80 @@ func invalidArgumentError(violations []*errdetails.BadRequest_FieldViolation) er
 }
 
 func unauthenticatedError(err error) error {
+	if errors.Is(err, errImpersonationForbidden) {
+		return status.Errorf(codes.PermissionDenied, "permission denied: %s", err)
+	}
+	var reauthErr *staleLoginError
+	if errors.As(err, &reauthErr) {
+		return reauthenticationRequiredError(reauthErr)
+	}
 	return status.Errorf(codes.Unauthenticated, "unauthorized: %s", err)
 }
+
+// ReauthenticationRequiredReason is the ErrorInfo reason telling clients to
+// confirm the password of the user through Reauthenticate and retry
+const ReauthenticationRequiredReason = "REAUTHENTICATION_REQUIRED"
+
+func reauthenticationRequiredError(err *staleLoginError) error {
+	statusReauth := status.New(codes.Unauthenticated, "reauthentication required: "+err.Error())
+
+	statusDetails, detailsErr := statusReauth.WithDetails(&errdetails.ErrorInfo{
+		Reason: ReauthenticationRequiredReason,
+		Domain: errorInfoDomain,
+		Metadata: map[string]string{
+			"method":          err.method,
+			"max_age_seconds": strconv.Itoa(int(err.maxAge.Seconds())),
+		},
+	})
+	if detailsErr != nil {
+		return statusReauth.Err()
+	}
+
+	return statusDetails.Err()
+}
+
+// ErrorInfo reasons of the sentinel errors of the domain
+const (
+	NotFoundReason         = "NOT_FOUND"
+	AlreadyExistsReason    = "ALREADY_EXISTS"
+	ConflictReason         = "CONFLICT"
+	EtagMismatchReason     = "ETAG_MISMATCH"
+	PermissionDeniedReason = "PERMISSION_DENIED"
+)
+
+// errorInfoDomain is the ErrorInfo domain of every error the service returns
+const errorInfoDomain = "sternx"
+
+var sentinelErrors = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{domain.ErrNotFound, codes.NotFound, NotFoundReason},
+	{domain.ErrAlreadyExists, codes.AlreadyExists, AlreadyExistsReason},
+	{domain.ErrConflict, codes.Aborted, ConflictReason},
+	{domain.ErrVersionMismatch, codes.Aborted, EtagMismatchReason},
+	{domain.ErrPermissionDenied, codes.PermissionDenied, PermissionDeniedReason},
+}
+
+// repositoryError converts an error of the repository to a gRPC status. A
+// sentinel error of the domain gets its code and an ErrorInfo with its reason;
+// anything else is internal and its details stay in the logs.
+func repositoryError(err error, message string) error {
+	for _, sentinel := range sentinelErrors {
+		if !errors.Is(err, sentinel.err) {
+			continue
+		}
+		statusSentinel := status.New(sentinel.code, message+": "+sentinel.err.Error())
+
+		statusDetails, detailsErr := statusSentinel.WithDetails(&errdetails.ErrorInfo{
+			Reason: sentinel.reason,
+			Domain: errorInfoDomain,
+		})
+		if detailsErr != nil {
+			return statusSentinel.Err()
+		}
+		return statusDetails.Err()
+	}
+	return status.Error(codes.Internal, message)
+}
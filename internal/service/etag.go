@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys of etags. The gateway forwards the If-Match header of a
+// request as ifMatchHeader and returns etagHeader as the ETag header.
+const (
+	ifMatchHeader = "if-match"
+	etagHeader    = "etag"
+)
+
+// userETag is the etag of a user, its version
+func userETag(user domain.User) string {
+	return strconv.Itoa(user.Version)
+}
+
+// requestETag returns the etag a write expects the user to have: the one in
+// the request, or else the one of the If-Match header
+func requestETag(ctx context.Context, etag string) string {
+	if etag != "" {
+		return etag
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ifMatchHeader); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// parseETag returns the user version of an etag, bare or quoted like in HTTP
+// headers. It is 0 for no etag and for "*", which match any version.
+func parseETag(etag string) (int, error) {
+	if etag == "" || etag == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(etag, "W/") {
+		return 0, fmt.Errorf("weak etags can't be matched")
+	}
+	version, err := strconv.Atoi(strings.Trim(etag, `"`))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid etag")
+	}
+	return version, nil
+}
+
+// setUserETagHeader sends the etag of user as the ETag header of the response
+func setUserETagHeader(ctx context.Context, user domain.User) {
+	// Fails only outside of an RPC, the etag is in the response anyway
+	_ = grpc.SetHeader(ctx, metadata.Pairs(etagHeader, strconv.Quote(userETag(user))))
+}
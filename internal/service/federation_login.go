@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/federation"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// FederationPathPrefix serves /federation/{provider}/login and /federation/{provider}/callback
+	FederationPathPrefix   = "/federation/"
+	federationStateCookie  = "sternx_federation"
+	federationStateTimeout = 10 * time.Minute
+)
+
+// Errors of resolveFederatedUser that can be shown to the user. Other errors
+// are logged, the user only learns that the login failed.
+var (
+	errFederatedEmailMissing    = errors.New("identity provider did not return an email address")
+	errFederatedEmailUnverified = errors.New("identity provider did not verify the email address")
+	errFederatedUserNotLinked   = errors.New("no account is linked to this identity")
+	errFederatedUserDeactivated = errors.New("user is deactivated")
+)
+
+type federationErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// FederationHandler signs users in through the configured upstream OpenID
+// Connect providers. The login endpoint redirects to the provider and the
+// callback links the verified identity to a local user, provisioning one
+// just in time when the provider allows it.
+func (s *UserServiceServer) FederationHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logger.WithLogger(r.Context(), log)
+
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, FederationPathPrefix), "/")
+		provider, ok := s.federationProviders[name]
+		if !ok || r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch action {
+		case "login":
+			s.federationLogin(ctx, w, r, provider)
+		case "callback":
+			s.federationCallback(ctx, w, r, provider)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (s *UserServiceServer) federationLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, provider *federation.Provider) {
+	log := logger.FromContext(ctx)
+
+	state, errState := utils.RandomSecret(16)
+	nonce, errNonce := utils.RandomSecret(16)
+	verifier, errVerifier := utils.RandomSecret(32)
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		writeJSON(w, http.StatusInternalServerError, federationErrorResponse{Error: "failed to start login"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		log.Errorf(ctx, "Failed to build authorization url for provider %s: %v", provider.Config().Name, err)
+		writeJSON(w, http.StatusBadGateway, federationErrorResponse{Error: "identity provider is unavailable"})
+		return
+	}
+
+	cookie, err := federation.EncodeState(s.federationStateKey, federation.LoginState{
+		Provider:     provider.Config().Name,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(federationStateTimeout),
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, federationErrorResponse{Error: "failed to start login"})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookie,
+		Value:    cookie,
+		Path:     FederationPathPrefix + provider.Config().Name,
+		MaxAge:   int(federationStateTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.Config.Issuer, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *UserServiceServer) federationCallback(ctx context.Context, w http.ResponseWriter, r *http.Request, provider *federation.Provider) {
+	log := logger.FromContext(ctx)
+	ctx = withHTTPAuditInfo(ctx, s.Config.Proxies, r)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "Federation/Callback")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("identity.provider", provider.Config().Name))
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		log.Warnf(ctx, "Identity provider %s returned error: %s", provider.Config().Name, errCode)
+		writeJSON(w, http.StatusBadRequest, federationErrorResponse{Error: "login was rejected by the identity provider: " + errCode})
+		return
+	}
+
+	cookie, err := r.Cookie(federationStateCookie)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, federationErrorResponse{Error: "login state is missing"})
+		return
+	}
+	state, err := federation.DecodeState(s.federationStateKey, cookie.Value)
+	if err != nil || state.Provider != provider.Config().Name ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		writeJSON(w, http.StatusBadRequest, federationErrorResponse{Error: federation.ErrInvalidState.Error()})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: federationStateCookie, Path: cookie.Path, MaxAge: -1})
+
+	identity, err := provider.Exchange(ctx, query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Errorf(ctx, "Failed to verify login with provider %s: %v", provider.Config().Name, err)
+		span.RecordError(err)
+		writeJSON(w, http.StatusUnauthorized, federationErrorResponse{Error: "failed to verify login with the identity provider"})
+		return
+	}
+
+	user, err := s.resolveFederatedUser(ctx, provider.Config(), identity)
+	if err != nil {
+		log.Errorf(ctx, "Failed to resolve user for identity of provider %s: %v", provider.Config().Name, err)
+		span.RecordError(err)
+		code, message := federationLoginError(err)
+		if identity.Email != "" {
+			s.recordLogin(ctx, domain.LoginMethodFederation, identity.Email, nil, "", errors.New(message))
+		}
+		writeJSON(w, code, federationErrorResponse{Error: message})
+		return
+	}
+
+	rsp, err := s.createLoginResponse(ctx, user)
+	if err != nil {
+		span.RecordError(err)
+		writeJSON(w, http.StatusInternalServerError, federationErrorResponse{Error: "failed to create access token"})
+		return
+	}
+	s.recordLogin(ctx, domain.LoginMethodFederation, user.Email, user, rsp.GetSessionId(), nil)
+	s.setSSOSession(w, rsp.GetSessionId(), rsp.GetAccessTokenExpiresAt().AsTime())
+
+	log.Infof(ctx, "Federated login successful: Provider=%s, ID=%d, Email=%s", provider.Config().Name, user.ID, utils.MaskEmail(user.Email))
+
+	body, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(rsp)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, federationErrorResponse{Error: "failed to encode response"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(body)
+}
+
+// resolveFederatedUser returns the user linked to an upstream identity. An
+// unlinked identity is linked to the account with the same verified email, or
+// to a newly provisioned account when the provider allows it.
+func (s *UserServiceServer) resolveFederatedUser(ctx context.Context, config federation.ProviderConfig, identity *federation.Identity) (*domain.User, error) {
+	linked, err := s.UserRepo.GetUserIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		user, err := s.UserRepo.GetUserByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.Active {
+			return nil, errFederatedUserDeactivated
+		}
+		return user, nil
+	}
+
+	if identity.Email == "" {
+		return nil, errFederatedEmailMissing
+	}
+
+	// The account owns the email, so only a verified email can be linked to
+	// an account or provisioned one
+	user, err := s.UserRepo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified {
+			return nil, errFederatedEmailUnverified
+		}
+		if !user.Active {
+			return nil, errFederatedUserDeactivated
+		}
+	case !errors.Is(err, domain.ErrNotFound):
+		return nil, err
+	case !config.AutoProvision:
+		return nil, errFederatedUserNotLinked
+	case !identity.EmailVerified:
+		return nil, errFederatedEmailUnverified
+	default:
+		user, err = s.provisionFederatedUser(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = s.UserRepo.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return user, nil
+}
+
+// federationLoginError returns the status and message of a failed login. The
+// error itself may come from the database, so only known errors are shown.
+func federationLoginError(err error) (int, string) {
+	for _, known := range []error{errFederatedEmailMissing, errFederatedEmailUnverified, errFederatedUserNotLinked, errFederatedUserDeactivated} {
+		if errors.Is(err, known) {
+			return http.StatusForbidden, known.Error()
+		}
+	}
+	return http.StatusInternalServerError, "failed to sign in with the identity provider"
+}
+
+// provisionFederatedUser creates a standard user for an identity. The account
+// gets a random password, so it can only sign in through the provider until
+// the password is reset.
+func (s *UserServiceServer) provisionFederatedUser(ctx context.Context, identity *federation.Identity) (*domain.User, error) {
+	password, err := utils.RandomSecret(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user, err := s.UserRepo.CreateUser(ctx, repository.CreateUserParams{
+		Name:           name,
+		Email:          identity.Email,
+		HashedPassword: hashedPassword,
+		Role:           domain.StandardRole,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+	return user, nil
+}
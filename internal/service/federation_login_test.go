@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/federation"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveFederatedUser(t *testing.T) {
+	server := newTestServer(t)
+	existing := createTestUser(t, server, domain.StandardRole, "secret")
+	provision := federation.ProviderConfig{Name: "upstream", AutoProvision: true}
+
+	tests := map[string]struct {
+		config   federation.ProviderConfig
+		email    string
+		verified bool
+		wantErr  bool
+	}{
+		"LinkVerified":        {config: provision, email: existing.Email, verified: true},
+		"LinkUnverified":      {config: provision, email: existing.Email, wantErr: true},
+		"ProvisionVerified":   {config: provision, email: utils.RandomString(12) + "@example.com", verified: true},
+		"ProvisionUnverified": {config: provision, email: utils.RandomString(12) + "@example.com", wantErr: true},
+		"ProvisioningOff":     {config: federation.ProviderConfig{Name: "upstream"}, email: utils.RandomString(12) + "@example.com", verified: true, wantErr: true},
+		"MissingEmail":        {config: provision, verified: true, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			identity := &federation.Identity{
+				Provider:      "upstream",
+				Subject:       utils.RandomString(16),
+				Email:         test.email,
+				EmailVerified: test.verified,
+			}
+			user, err := server.resolveFederatedUser(testContext(), test.config, identity)
+			if test.wantErr {
+				require.Error(t, err)
+				code, _ := federationLoginError(err)
+				require.Equal(t, http.StatusForbidden, code)
+				_, err := server.UserRepo.GetUserIdentity(testContext(), identity.Provider, identity.Subject)
+				require.ErrorIs(t, err, domain.ErrNotFound)
+				if test.email != "" && test.email != existing.Email {
+					_, err = server.UserRepo.GetUserByEmail(testContext(), test.email)
+					require.ErrorIs(t, err, domain.ErrNotFound)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.email, user.Email)
+
+			// The identity is linked, later logins find the user through it
+			again, err := server.resolveFederatedUser(testContext(), test.config, identity)
+			require.NoError(t, err)
+			require.Equal(t, user.ID, again.ID)
+		})
+	}
+}
+
+// failingIdentityRepository fails to look up identities the way a broken
+// database connection would
+type failingIdentityRepository struct {
+	repository.IRepository
+}
+
+func (r failingIdentityRepository) GetUserIdentity(ctx context.Context, provider string, subject string) (*domain.UserIdentity, error) {
+	return nil, errors.New(`pq: relation "user_identities" does not exist`)
+}
+
+func TestFederatedLoginHidesRepositoryErrors(t *testing.T) {
+	server := newTestServer(t)
+	server.UserRepo = failingIdentityRepository{IRepository: server.UserRepo}
+
+	identity := &federation.Identity{Provider: "upstream", Subject: "subject", Email: "user@example.com", EmailVerified: true}
+	_, err := server.resolveFederatedUser(testContext(), federation.ProviderConfig{Name: "upstream", AutoProvision: true}, identity)
+	require.Error(t, err)
+
+	code, message := federationLoginError(err)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.NotContains(t, message, "user_identities")
+}
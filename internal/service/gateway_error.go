@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// gatewayError is the JSON body of every error the gateway returns, wrapped
+// in an "error" object. Its fields don't change with the protobuf runtime.
+type gatewayError struct {
+	// Code is the HTTP status code
+	Code int `json:"code"`
+	// Status is the name of the gRPC code, like NOT_FOUND
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Reason and Metadata come from the ErrorInfo of the status, if any
+	Reason          string                  `json:"reason,omitempty"`
+	Metadata        map[string]string       `json:"metadata,omitempty"`
+	FieldViolations []gatewayFieldViolation `json:"field_violations,omitempty"`
+}
+
+type gatewayFieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// GatewayErrorHandler writes the gRPC status of err as a gatewayError. It's
+// meant for runtime.WithErrorHandler.
+func GatewayErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	body := gatewayError{
+		Code:    runtime.HTTPStatusFromCode(st.Code()),
+		Status:  code.Code(st.Code()).String(),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			body.Reason = detail.GetReason()
+			body.Metadata = detail.GetMetadata()
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				body.FieldViolations = append(body.FieldViolations, gatewayFieldViolation{
+					Field:       violation.GetField(),
+					Description: violation.GetDescription(),
+				})
+			}
+		}
+	}
+
+	// The etag of an If-Match header, or of the request, didn't match
+	if body.Reason == EtagMismatchReason {
+		body.Code = http.StatusPreconditionFailed
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", "application/json")
+	if body.Code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", st.Message())
+	}
+	w.WriteHeader(body.Code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error gatewayError `json:"error"`
+	}{body})
+}
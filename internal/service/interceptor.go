@@ -15,11 +15,12 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func UnaryInterceptor(myLogger logger.Logger, meter metric.Meter) grpc.UnaryServerInterceptor {
+func UnaryInterceptor(myLogger logger.Logger, meter metric.Meter, proxies *Proxies) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		// Set the logger in the context
 		ctx = logger.WithLogger(ctx, myLogger)
 		ctx = metrics.WithMeter(ctx, meter)
+		ctx = withAuditInfo(ctx, proxies)
 
 		startTime := time.Now()
 
@@ -54,3 +55,49 @@ func UnaryInterceptor(myLogger logger.Logger, meter metric.Meter) grpc.UnaryServ
 		return resp, err
 	}
 }
+
+// StreamInterceptor is UnaryInterceptor for server streaming RPCs. The
+// duration it records is how long the stream was open.
+func StreamInterceptor(myLogger logger.Logger, meter metric.Meter, proxies *Proxies) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := logger.WithLogger(stream.Context(), myLogger)
+		ctx = metrics.WithMeter(ctx, meter)
+		ctx = withAuditInfo(ctx, proxies)
+
+		startTime := time.Now()
+
+		myLogger.Info(ctx, "Received gRPC stream")
+
+		tracer := otel.Tracer("grpc-server")
+		ctx, span := tracer.Start(ctx, info.FullMethod)
+		defer span.End()
+
+		ctx = trace.ContextWithSpan(ctx, span)
+		span.SetAttributes(attribute.String("interceptor.method", info.FullMethod))
+
+		err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+
+		duration := time.Since(startTime)
+
+		statusCode := codes.Unknown
+		if st, ok := status.FromError(err); ok {
+			statusCode = st.Code()
+		}
+
+		metrics.RecordGRPCMetrics(ctx, meter, info.FullMethod, err, duration)
+
+		myLogger.Info(ctx, "Completed gRPC stream", "method", info.FullMethod, "statusCode", statusCode.String(), "duration", duration)
+
+		return err
+	}
+}
+
+// contextStream is a grpc.ServerStream with the context the interceptor built
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"google.golang.org/grpc/status"
+)
+
+const maxFailureReasonLength = 255
+
+// recordLogin adds a login attempt to the login history of the user, together
+// with the device it came from. loginErr is nil for successful logins. Failing
+// to record the attempt is logged and doesn't fail the login.
+func (server *UserServiceServer) recordLogin(ctx context.Context, method string, email string, user *domain.User, sessionID string, loginErr error) {
+	log := logger.FromContext(ctx)
+
+	client := clientInfoFromContext(ctx)
+	params := repository.CreateLoginEventParams{
+		Email:     email,
+		Method:    method,
+		Success:   loginErr == nil,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		SessionID: sessionID,
+	}
+	if user == nil {
+		user, _ = server.UserRepo.GetUserByEmail(ctx, email)
+	}
+	if user != nil {
+		params.UserID = &user.ID
+		params.Email = user.Email
+	}
+	if loginErr != nil {
+		params.FailureReason = status.Convert(loginErr).Message()
+		if len(params.FailureReason) > maxFailureReasonLength {
+			params.FailureReason = params.FailureReason[:maxFailureReasonLength]
+		}
+	}
+
+	if _, err := server.UserRepo.CreateLoginEvent(ctx, params); err != nil {
+		log.Warnf(ctx, "Failed to record login event of %s: %v", utils.MaskEmail(email), err)
+	}
+}
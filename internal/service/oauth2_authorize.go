@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	responseTypeCode        = "code"
+	codeChallengeMethodS256 = "S256"
+	authorizationCodeBytes  = 32
+	ssoSessionCookie        = "sternx_sso"
+	ssoSessionCookiePath    = "/oauth2"
+	csrfCookie              = "sternx_csrf"
+	csrfField               = "csrf_token"
+	csrfSecretBytes         = 32
+)
+
+// authorizeRequest holds the parameters of an OAuth2 authorization request,
+// see RFC 6749 section 4.1.1, RFC 7636 and OpenID Connect Core section 3.1.2.1.
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+func parseAuthorizeRequest(values url.Values) authorizeRequest {
+	return authorizeRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Prompt:              values.Get("prompt"),
+	}
+}
+
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Email <input type="email" name="email" required></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// OAuth2AuthorizeHandler serves the authorization endpoint of the OpenID
+// provider. Users sign in with the same credential check as LoginUser, and a
+// session cookie lets them skip the form for other clients (single sign-on).
+// Only the authorization code flow with PKCE (S256) is supported.
+func (s *UserServiceServer) OAuth2AuthorizeHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withHTTPAuditInfo(logger.WithLogger(r.Context(), log), s.Config.Proxies, r)
+
+		tracer := otel.Tracer("http-server")
+		ctx, span := tracer.Start(ctx, "OAuth2/Authorize")
+		defer span.End()
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "malformed request", http.StatusBadRequest)
+			return
+		}
+
+		req := parseAuthorizeRequest(r.Form)
+		span.SetAttributes(attribute.String("oauth_client.client_id", req.ClientID))
+
+		// The redirect URI can only be trusted once it is matched against the
+		// client registry, until then errors are shown to the user directly.
+		client, err := s.UserRepo.GetOAuthClientByClientID(ctx, req.ClientID)
+		if err != nil {
+			http.Error(w, "unknown client", http.StatusBadRequest)
+			return
+		}
+		if !client.AllowsRedirectURI(req.RedirectURI) {
+			http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+			return
+		}
+
+		if req.ResponseType != responseTypeCode {
+			redirectAuthorizeError(w, r, req, oauth2UnsupportedResponseType, "only the code response type is supported")
+			return
+		}
+		scopes := strings.Fields(req.Scope)
+		if len(scopes) == 0 || !client.AllowsScopes(scopes) {
+			redirectAuthorizeError(w, r, req, oauth2InvalidScope, "requested scope is not allowed for this client")
+			return
+		}
+		if req.CodeChallenge == "" || req.CodeChallengeMethod != codeChallengeMethodS256 {
+			redirectAuthorizeError(w, r, req, oauth2InvalidRequest, "PKCE with the S256 method is required")
+			return
+		}
+
+		user, authTime := s.ssoSessionUser(ctx, r)
+		if user == nil || req.Prompt == "login" {
+			email := r.PostForm.Get("email")
+			if r.Method != http.MethodPost || email == "" {
+				if req.Prompt == "none" {
+					redirectAuthorizeError(w, r, req, oauth2LoginRequired, "the user is not signed in")
+					return
+				}
+				s.renderLoginForm(w, r, req, http.StatusOK, "")
+				return
+			}
+
+			// Another site could post the form with the browser of the user
+			if !s.checkAuthorizeCSRF(r, req) {
+				log.Warnf(ctx, "Rejected sign in form without a valid csrf token: ClientID=%s", client.ClientID)
+				s.renderLoginForm(w, r, req, http.StatusForbidden, "The sign in form expired, please try again")
+				return
+			}
+			user, err = s.checkCredentials(ctx, email, r.PostForm.Get("password"))
+			if err != nil {
+				span.RecordError(err)
+				s.recordLogin(ctx, domain.LoginMethodPassword, email, nil, "", err)
+				s.renderLoginForm(w, r, req, http.StatusUnauthorized, "Invalid email or password")
+				return
+			}
+			authTime = time.Now()
+			sessionID, expiresAt := uuid.NewString(), authTime.Add(s.Config.JWTDuration)
+			if err := s.startSession(ctx, user, sessionID, expiresAt); err != nil {
+				log.Errorf(ctx, "Failed to start sso session for user %s: %v", utils.MaskEmail(user.Email), err)
+				span.RecordError(err)
+				redirectAuthorizeError(w, r, req, oauth2ServerError, "failed to sign in")
+				return
+			}
+			s.recordLogin(ctx, domain.LoginMethodPassword, user.Email, user, sessionID, nil)
+			s.setSSOSession(w, sessionID, expiresAt)
+		}
+
+		code, err := utils.RandomSecret(authorizationCodeBytes)
+		if err != nil {
+			span.RecordError(err)
+			redirectAuthorizeError(w, r, req, oauth2ServerError, "failed to issue authorization code")
+			return
+		}
+
+		_, err = s.UserRepo.CreateAuthorizationCode(ctx, repository.CreateAuthorizationCodeParams{
+			CodeHash:      utils.HashSecret(code),
+			ClientID:      client.ClientID,
+			UserID:        user.ID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopes,
+			Nonce:         req.Nonce,
+			CodeChallenge: req.CodeChallenge,
+			AuthTime:      authTime,
+			ExpiresAt:     time.Now().Add(s.Config.AuthCodeDuration),
+		})
+		if err != nil {
+			log.Errorf(ctx, "Failed to store authorization code: %v", err)
+			span.RecordError(err)
+			redirectAuthorizeError(w, r, req, oauth2ServerError, "failed to issue authorization code")
+			return
+		}
+
+		log.Infof(ctx, "Authorization code issued: ClientID=%s, UserID=%d", client.ClientID, user.ID)
+
+		redirectAuthorize(w, r, req, url.Values{"code": {code}})
+	})
+}
+
+// ssoSessionUser returns the user of a valid single sign-on session cookie
+// and the time they entered their credentials.
+func (s *UserServiceServer) ssoSessionUser(ctx context.Context, r *http.Request) (*domain.User, time.Time) {
+	cookie, err := r.Cookie(ssoSessionCookie)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	sessionID, mac, ok := strings.Cut(cookie.Value, "~")
+	if !ok || !hmac.Equal([]byte(mac), []byte(s.ssoCookieMAC(sessionID))) {
+		return nil, time.Time{}
+	}
+	session, err := s.UserRepo.GetSession(ctx, sessionID)
+	if err != nil || !session.IsActive(time.Now()) {
+		return nil, time.Time{}
+	}
+	user, err := s.UserRepo.GetUserByID(ctx, session.UserID)
+	if err != nil || !user.Active {
+		return nil, time.Time{}
+	}
+	return user, session.CreatedAt
+}
+
+// setSSOSession signs the browser in to the authorization endpoint for as
+// long as the login session lasts. The cookie only names the session, it
+// can't be used as a bearer token for the API, and revoking the session signs
+// the browser out.
+func (s *UserServiceServer) setSSOSession(w http.ResponseWriter, sessionID string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoSessionCookie,
+		Value:    sessionID + "~" + s.ssoCookieMAC(sessionID),
+		Path:     ssoSessionCookiePath,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.Config.Issuer, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *UserServiceServer) ssoCookieMAC(value string) string {
+	mac := hmac.New(sha256.New, s.ssoCookieKey)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// renderLoginForm shows the sign in form of an authorize request, with a
+// csrf token that only this browser can submit it with
+func (s *UserServiceServer) renderLoginForm(w http.ResponseWriter, r *http.Request, req authorizeRequest, status int, errorMessage string) {
+	secret, err := s.csrfSecret(w, r)
+	if err != nil {
+		http.Error(w, "failed to render sign in form", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	_ = loginFormTemplate.Execute(w, struct {
+		Request   authorizeRequest
+		CSRFToken string
+		Error     string
+	}{req, s.authorizeCSRFToken(secret, req), errorMessage})
+}
+
+// csrfSecret returns the csrf secret of the browser, and sets a new one if it
+// has none. The cookie isn't sent along with posts from other sites.
+func (s *UserServiceServer) csrfSecret(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	secret, err := utils.RandomSecret(csrfSecretBytes)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    secret,
+		Path:     ssoSessionCookiePath,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.Config.Issuer, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return secret, nil
+}
+
+// authorizeCSRFToken binds a sign in form to the csrf secret of the browser
+// and to the authorize request it was rendered for
+func (s *UserServiceServer) authorizeCSRFToken(secret string, req authorizeRequest) string {
+	mac := hmac.New(sha256.New, s.authorizeCSRFKey)
+	for _, value := range []string{
+		secret, req.ClientID, req.RedirectURI, req.ResponseType, req.Scope,
+		req.State, req.Nonce, req.CodeChallenge, req.CodeChallengeMethod,
+	} {
+		mac.Write([]byte(value))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkAuthorizeCSRF reports whether a posted sign in form carries the csrf
+// token of its authorize request and of the browser that posted it
+func (s *UserServiceServer) checkAuthorizeCSRF(r *http.Request, req authorizeRequest) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return hmac.Equal([]byte(r.PostForm.Get(csrfField)), []byte(s.authorizeCSRFToken(cookie.Value, req)))
+}
+
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, errCode string, description string) {
+	redirectAuthorize(w, r, req, url.Values{"error": {errCode}, "error_description": {description}})
+}
+
+func redirectAuthorize(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	target, _ := url.Parse(req.RedirectURI) // It's matched against the client registry before
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against the S256 challenge
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+var csrfTokenPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// authorize sends a request to the authorization endpoint with the cookies
+func authorize(server *UserServiceServer, method string, values url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var r *http.Request
+	if method == http.MethodPost {
+		r = httptest.NewRequest(method, OAuth2AuthorizePath, strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, OAuth2AuthorizePath+"?"+values.Encode(), nil)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.OAuth2AuthorizeHandler(logger.NewDevLogger()).ServeHTTP(w, r)
+	return w
+}
+
+// loginForm opens the sign in form of an authorize request and returns the
+// csrf cookie and token it was rendered with
+func loginForm(t *testing.T, server *UserServiceServer, params url.Values) (*http.Cookie, string) {
+	w := authorize(server, http.MethodGet, params)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var csrf *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == csrfCookie {
+			csrf = cookie
+		}
+	}
+	require.NotNil(t, csrf)
+	match := csrfTokenPattern.FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+	return csrf, match[1]
+}
+
+// signInForm is the sign in form of params filled in by user
+func signInForm(params url.Values, user *domain.User, password string, csrfToken string) url.Values {
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	form.Set("email", user.Email)
+	form.Set("password", password)
+	form.Set(csrfField, csrfToken)
+	return form
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	client, secret := createTestOAuthClient(t, server, []string{domain.ScopeOpenID, domain.ScopeUsersRead}, testRedirectURI)
+	otherClient, otherSecret := createTestOAuthClient(t, server, []string{domain.ScopeOpenID}, testRedirectURI)
+	verifier := utils.RandomString(43)
+	params := url.Values{
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {responseTypeCode},
+		"scope":                 {domain.ScopeOpenID},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {codeChallengeMethodS256},
+	}
+
+	// signIn goes through the sign in form and returns the code it redirects with
+	signIn := func(t *testing.T) string {
+		csrf, csrfToken := loginForm(t, server, params)
+		w := authorize(server, http.MethodPost, signInForm(params, user, "secret", csrfToken), csrf)
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(location.String(), testRedirectURI))
+		require.Equal(t, "xyz", location.Query().Get("state"))
+		require.NotEmpty(t, location.Query().Get("code"))
+		return location.Query().Get("code")
+	}
+	exchange := func(code string, verifier string, clientID string, clientSecret string) *httptest.ResponseRecorder {
+		return postOAuth2Token(server, url.Values{
+			"grant_type":    {grantTypeAuthorizationCode},
+			"code":          {code},
+			"code_verifier": {verifier},
+			"redirect_uri":  {testRedirectURI},
+		}, clientID, clientSecret)
+	}
+
+	t.Run("WrongVerifier", func(t *testing.T) {
+		code := signIn(t)
+		requireOAuth2Error(t, exchange(code, "wrong-verifier", client.ClientID, secret), http.StatusBadRequest, oauth2InvalidGrant)
+		// The code is spent by the failed attempt
+		requireOAuth2Error(t, exchange(code, verifier, client.ClientID, secret), http.StatusBadRequest, oauth2InvalidGrant)
+	})
+	t.Run("OtherClient", func(t *testing.T) {
+		code := signIn(t)
+		requireOAuth2Error(t, exchange(code, verifier, otherClient.ClientID, otherSecret), http.StatusBadRequest, oauth2InvalidGrant)
+	})
+	t.Run("OtherRedirectURI", func(t *testing.T) {
+		code := signIn(t)
+		w := postOAuth2Token(server, url.Values{
+			"grant_type":    {grantTypeAuthorizationCode},
+			"code":          {code},
+			"code_verifier": {verifier},
+			"redirect_uri":  {"https://evil.example.com/callback"},
+		}, client.ClientID, secret)
+		requireOAuth2Error(t, w, http.StatusBadRequest, oauth2InvalidGrant)
+	})
+	t.Run("ReusedCode", func(t *testing.T) {
+		code := signIn(t)
+		rsp := requireOAuth2Token(t, exchange(code, verifier, client.ClientID, secret))
+		require.NotEmpty(t, rsp.IDToken)
+		payload, err := server.verifyAccessToken(testContext(), rsp.AccessToken)
+		require.NoError(t, err)
+		require.Equal(t, user.Email, payload.Email)
+		require.NotEmpty(t, payload.SessionID)
+
+		requireOAuth2Error(t, exchange(code, verifier, client.ClientID, secret), http.StatusBadRequest, oauth2InvalidGrant)
+	})
+}
+
+func TestAuthorizeRejections(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := createTestOAuthClient(t, server, []string{domain.ScopeOpenID}, testRedirectURI)
+	params := func(change func(url.Values)) url.Values {
+		values := url.Values{
+			"client_id":             {client.ClientID},
+			"redirect_uri":          {testRedirectURI},
+			"response_type":         {responseTypeCode},
+			"scope":                 {domain.ScopeOpenID},
+			"code_challenge":        {codeChallenge("verifier")},
+			"code_challenge_method": {codeChallengeMethodS256},
+		}
+		change(values)
+		return values
+	}
+
+	tests := map[string]struct {
+		values url.Values
+		// errCode is the error sent to the redirect URI, or empty when the
+		// error is shown to the user instead
+		errCode string
+	}{
+		"UnknownClient":        {values: params(func(v url.Values) { v.Set("client_id", "unknown") })},
+		"UnregisteredRedirect": {values: params(func(v url.Values) { v.Set("redirect_uri", "https://evil.example.com/callback") })},
+		"MissingPKCE":          {values: params(func(v url.Values) { v.Del("code_challenge") }), errCode: oauth2InvalidRequest},
+		"PlainPKCE":            {values: params(func(v url.Values) { v.Set("code_challenge_method", "plain") }), errCode: oauth2InvalidRequest},
+		"ScopeNotAllowed":      {values: params(func(v url.Values) { v.Set("scope", domain.ScopeUsersWrite) }), errCode: oauth2InvalidScope},
+		"TokenResponseType":    {values: params(func(v url.Values) { v.Set("response_type", "token") }), errCode: oauth2UnsupportedResponseType},
+		"PromptNone":           {values: params(func(v url.Values) { v.Set("prompt", "none") }), errCode: oauth2LoginRequired},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := authorize(server, http.MethodGet, test.values)
+			if test.errCode == "" {
+				require.Equal(t, http.StatusBadRequest, w.Code)
+				require.Empty(t, w.Header().Get("Location"))
+				return
+			}
+			require.Equal(t, http.StatusFound, w.Code)
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, test.errCode, location.Query().Get("error"))
+		})
+	}
+}
+
+func TestAuthorizeCSRF(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	client, _ := createTestOAuthClient(t, server, []string{domain.ScopeOpenID}, testRedirectURI)
+	params := url.Values{
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {responseTypeCode},
+		"scope":                 {domain.ScopeOpenID},
+		"state":                 {"xyz"},
+		"code_challenge":        {codeChallenge("verifier")},
+		"code_challenge_method": {codeChallengeMethodS256},
+	}
+	csrf, csrfToken := loginForm(t, server, params)
+	otherCSRF, _ := loginForm(t, server, params)
+
+	otherState := url.Values{}
+	for key, values := range params {
+		otherState[key] = values
+	}
+	otherState.Set("state", "attacker")
+
+	tests := map[string]struct {
+		form    url.Values
+		cookies []*http.Cookie
+	}{
+		// A post from another site carries no csrf cookie
+		"MissingCookie": {form: signInForm(params, user, "secret", csrfToken)},
+		"MissingToken":  {form: signInForm(params, user, "secret", ""), cookies: []*http.Cookie{csrf}},
+		// The token of one browser doesn't work with the cookie of another
+		"OtherBrowser": {form: signInForm(params, user, "secret", csrfToken), cookies: []*http.Cookie{otherCSRF}},
+		// The token is bound to the authorize request it was rendered for
+		"OtherRequest": {form: signInForm(otherState, user, "secret", csrfToken), cookies: []*http.Cookie{csrf}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := authorize(server, http.MethodPost, test.form, test.cookies...)
+			require.Equal(t, http.StatusForbidden, w.Code)
+			require.Empty(t, w.Header().Get("Location"))
+			for _, cookie := range w.Result().Cookies() {
+				require.NotEqual(t, ssoSessionCookie, cookie.Name)
+			}
+		})
+	}
+
+	w := authorize(server, http.MethodPost, signInForm(params, user, "secret", csrfToken), csrf)
+	require.Equal(t, http.StatusFound, w.Code)
+}
+
+func TestAuthorizeSSOSession(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	client, _ := createTestOAuthClient(t, server, []string{domain.ScopeOpenID}, testRedirectURI)
+	params := url.Values{
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {responseTypeCode},
+		"scope":                 {domain.ScopeOpenID},
+		"code_challenge":        {codeChallenge("verifier")},
+		"code_challenge_method": {codeChallengeMethodS256},
+	}
+	csrf, csrfToken := loginForm(t, server, params)
+	w := authorize(server, http.MethodPost, signInForm(params, user, "secret", csrfToken), csrf)
+	require.Equal(t, http.StatusFound, w.Code)
+	var sso *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == ssoSessionCookie {
+			sso = cookie
+		}
+	}
+	require.NotNil(t, sso)
+
+	// The cookie skips the sign in form
+	w = authorize(server, http.MethodGet, params, sso)
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.NotEmpty(t, location.Query().Get("code"))
+
+	// but it is no access token
+	_, err = server.tokenMaker.VerifyToken(sso.Value)
+	require.Error(t, err)
+	ctx, _ := rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+sso.Value)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+
+	// and it can't be changed to sign in as someone else
+	sessionID, _, _ := strings.Cut(sso.Value, "~")
+	other := createTestUser(t, server, domain.AdminRole, "secret")
+	otherLogin := loginTestUser(t, server, other, "secret")
+	forged := *sso
+	forged.Value = strings.Replace(sso.Value, sessionID, otherLogin.GetSessionId(), 1)
+	w = authorize(server, http.MethodGet, params, &forged)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Location"))
+
+	// The sign in is in the login history with the session of the cookie
+	events, err := server.UserRepo.ListLoginEventsByUserID(testContext(), user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, domain.LoginMethodPassword, events[0].Method)
+	require.True(t, events[0].Success)
+	require.Equal(t, sessionID, events[0].SessionID)
+
+	// Revoking the session signs the browser out
+	require.NoError(t, server.UserRepo.RevokeSession(testContext(), sessionID))
+	w = authorize(server, http.MethodGet, params, sso)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Location"))
+}
+
+func TestAuthorizeFailedSignIn(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	client, _ := createTestOAuthClient(t, server, []string{domain.ScopeOpenID}, testRedirectURI)
+	params := url.Values{
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {responseTypeCode},
+		"scope":                 {domain.ScopeOpenID},
+		"code_challenge":        {codeChallenge("verifier")},
+		"code_challenge_method": {codeChallengeMethodS256},
+	}
+	csrf, csrfToken := loginForm(t, server, params)
+	w := authorize(server, http.MethodPost, signInForm(params, user, "wrong-password", csrfToken), csrf)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	events, err := server.UserRepo.ListLoginEventsByUserID(testContext(), user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, domain.LoginMethodPassword, events[0].Method)
+	require.False(t, events[0].Success)
+	require.Empty(t, events[0].SessionID)
+}
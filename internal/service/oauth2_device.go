@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	deviceCodeBytes  = 32
+	userCodeLength   = 8
+	slowDownInterval = 5 * time.Second // RFC 8628 section 3.5
+)
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// OAuth2DeviceAuthorizationHandler serves the device authorization endpoint of
+// RFC 8628. A device that can't host a redirect URI gets a device code to poll
+// the token endpoint with, and a user code the user approves through the
+// VerifyDeviceCode RPC from a device they are signed in on.
+func (s *UserServiceServer) OAuth2DeviceAuthorizationHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logger.WithLogger(r.Context(), log)
+
+		tracer := otel.Tracer("http-server")
+		ctx, span := tracer.Start(ctx, "OAuth2/DeviceAuthorization")
+		defer span.End()
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeOAuth2Error(w, http.StatusMethodNotAllowed, oauth2InvalidRequest, "the device authorization endpoint only accepts POST")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "malformed request body")
+			return
+		}
+
+		client, ok := s.authenticateOAuthClient(ctx, w, r)
+		if !ok {
+			return
+		}
+		span.SetAttributes(attribute.String("oauth_client.client_id", client.ClientID))
+
+		scopes := strings.Fields(r.PostForm.Get("scope"))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !client.AllowsScopes(scopes) {
+			log.Warnf(ctx, "OAuth client %s requested scopes it is not allowed: %v", client.ClientID, scopes)
+			writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, "requested scope is not allowed for this client")
+			return
+		}
+
+		deviceCode, err := utils.RandomSecret(deviceCodeBytes)
+		if err != nil {
+			span.RecordError(err)
+			writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to issue device code")
+			return
+		}
+		userCode, err := randomUserCode()
+		if err != nil {
+			span.RecordError(err)
+			writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to issue device code")
+			return
+		}
+
+		interval := int(s.Config.DevicePollInterval / time.Second)
+		authorization, err := s.UserRepo.CreateDeviceAuthorization(ctx, repository.CreateDeviceAuthorizationParams{
+			DeviceCodeHash: utils.HashSecret(deviceCode),
+			UserCode:       userCode,
+			ClientID:       client.ClientID,
+			Scopes:         scopes,
+			Interval:       interval,
+			ExpiresAt:      time.Now().Add(s.Config.DeviceCodeDuration),
+		})
+		if err != nil {
+			log.Errorf(ctx, "Failed to store device authorization: %v", err)
+			span.RecordError(err)
+			writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to issue device code")
+			return
+		}
+
+		log.Infof(ctx, "Device authorization started: ClientID=%s, Scopes=%v", client.ClientID, scopes)
+
+		formatted := domain.FormatUserCode(authorization.UserCode)
+		writeOAuth2JSON(w, http.StatusOK, deviceAuthorizationResponse{
+			DeviceCode:              deviceCode,
+			UserCode:                formatted,
+			VerificationURI:         s.Config.DeviceVerificationURI,
+			VerificationURIComplete: verificationURIComplete(s.Config.DeviceVerificationURI, formatted),
+			ExpiresIn:               int64(s.Config.DeviceCodeDuration.Seconds()),
+			Interval:                int64(interval),
+		})
+	})
+}
+
+// deviceCodeGrant answers a poll of a device, see RFC 8628 section 3.4. Until
+// the user acts on the user code the device gets authorization_pending, and
+// slow_down with a longer interval when it polls too often.
+func (s *UserServiceServer) deviceCodeGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "OAuth2/DeviceCode")
+	defer span.End()
+
+	client, ok := s.authenticateOAuthClient(ctx, w, r)
+	if !ok {
+		return
+	}
+	span.SetAttributes(attribute.String("oauth_client.client_id", client.ClientID))
+
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "device_code is required")
+		return
+	}
+	deviceCodeHash := utils.HashSecret(deviceCode)
+
+	now := time.Now()
+	authorization, err := s.UserRepo.PollDeviceAuthorization(ctx, deviceCodeHash, now)
+	if err != nil || authorization.ClientID != client.ClientID {
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "device code is invalid")
+		return
+	}
+	span.SetAttributes(attribute.String("device_authorization.status", authorization.Status))
+
+	if now.After(authorization.ExpiresAt) {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2ExpiredToken, "the device code has expired")
+		return
+	}
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < interval {
+		slowerInterval := int((interval + slowDownInterval) / time.Second)
+		if err := s.UserRepo.SlowDownDeviceAuthorization(ctx, authorization.ID, slowerInterval); err != nil {
+			span.RecordError(err)
+		}
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2SlowDown, "polling too frequently")
+		return
+	}
+
+	switch authorization.Status {
+	case domain.DeviceAuthorizationPending:
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2AuthorizationPending, "the user has not approved the device yet")
+		return
+	case domain.DeviceAuthorizationDenied:
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2AccessDenied, "the user denied the device")
+		return
+	case domain.DeviceAuthorizationApproved:
+	default:
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "device code is invalid or already used")
+		return
+	}
+
+	authorization, err = s.UserRepo.ConsumeDeviceAuthorization(ctx, deviceCodeHash)
+	if err != nil || authorization.UserID == nil {
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "device code is invalid or already used")
+		return
+	}
+
+	user, err := s.UserRepo.GetUserByID(ctx, *authorization.UserID)
+	if err != nil {
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "the user of the device code no longer exists")
+		return
+	}
+
+	accessToken, payload, err := s.createSessionToken(ctx, user, token.WithScopes(authorization.Scopes...))
+	if err != nil {
+		log.Errorf(ctx, "Failed to create access token for user: %s, error: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to create access token")
+		return
+	}
+
+	log.Infof(ctx, "Tokens issued for device code: ClientID=%s, UserID=%d", client.ClientID, user.ID)
+
+	writeOAuth2Token(w, accessToken, payload, "")
+}
+
+// randomUserCode draws a user code uniformly from the user code alphabet
+func randomUserCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(domain.UserCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = domain.UserCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+func verificationURIComplete(verificationURI string, userCode string) string {
+	target, err := url.Parse(verificationURI)
+	if err != nil {
+		return verificationURI
+	}
+	query := target.Query()
+	query.Set("user_code", userCode)
+	target.RawQuery = query.Encode()
+	return target.String()
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// startDeviceAuthorization requests a device code for the client
+func startDeviceAuthorization(t *testing.T, server *UserServiceServer, clientID string, clientSecret string) deviceAuthorizationResponse {
+	r := httptest.NewRequest(http.MethodPost, OAuth2DeviceAuthorizationPath, strings.NewReader(url.Values{}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, clientSecret)
+	w := httptest.NewRecorder()
+	server.OAuth2DeviceAuthorizationHandler(logger.NewDevLogger()).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var rsp deviceAuthorizationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	require.NotEmpty(t, rsp.DeviceCode)
+	require.Len(t, domain.NormalizeUserCode(rsp.UserCode), userCodeLength)
+	return rsp
+}
+
+// pollDevice asks the token endpoint for the token of the device code
+func pollDevice(server *UserServiceServer, deviceCode string, clientID string, clientSecret string) *httptest.ResponseRecorder {
+	return postOAuth2Token(server, url.Values{
+		"grant_type":  {grantTypeDeviceCode},
+		"device_code": {deviceCode},
+	}, clientID, clientSecret)
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	server := newTestServer(t)
+	// Devices may poll as often as they like, slow_down is tested on its own
+	server.Config.DevicePollInterval = 0
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	client, secret := createTestOAuthClient(t, server, []string{domain.ScopeUsersRead})
+	otherClient, otherSecret := createTestOAuthClient(t, server, []string{domain.ScopeUsersRead})
+
+	verify := func(t *testing.T, userCode string, approve bool) error {
+		ctx, _ := authContext(t, server, "VerifyDeviceCode", user)
+		_, err := server.VerifyDeviceCode(ctx, &userpb.VerifyDeviceCodeRequest{UserCode: userCode, Approve: approve})
+		return err
+	}
+
+	t.Run("Approved", func(t *testing.T) {
+		device := startDeviceAuthorization(t, server, client.ClientID, secret)
+		requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2AuthorizationPending)
+
+		require.NoError(t, verify(t, device.UserCode, true))
+		// A user code is answered once
+		requireCode(t, verify(t, device.UserCode, false), codes.NotFound)
+
+		rsp := requireOAuth2Token(t, pollDevice(server, device.DeviceCode, client.ClientID, secret))
+		// The token is bound to a session of its own, which the user can revoke
+		payload, err := server.verifyAccessToken(testContext(), rsp.AccessToken)
+		require.NoError(t, err)
+		require.Equal(t, user.Email, payload.Email)
+		require.Equal(t, []string{domain.ScopeUsersRead}, payload.Scopes)
+		require.NotEmpty(t, payload.SessionID)
+
+		// The device code is spent
+		requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2InvalidGrant)
+	})
+	t.Run("Denied", func(t *testing.T) {
+		device := startDeviceAuthorization(t, server, client.ClientID, secret)
+		require.NoError(t, verify(t, device.UserCode, false))
+		requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2AccessDenied)
+	})
+	t.Run("OtherClient", func(t *testing.T) {
+		device := startDeviceAuthorization(t, server, client.ClientID, secret)
+		require.NoError(t, verify(t, device.UserCode, true))
+		requireOAuth2Error(t, pollDevice(server, device.DeviceCode, otherClient.ClientID, otherSecret), http.StatusBadRequest, oauth2InvalidGrant)
+	})
+	t.Run("UnknownCode", func(t *testing.T) {
+		requireOAuth2Error(t, pollDevice(server, "unknown", client.ClientID, secret), http.StatusBadRequest, oauth2InvalidGrant)
+		requireCode(t, verify(t, "BCDF-GHJK", true), codes.NotFound)
+		requireCode(t, verify(t, "BCDF", true), codes.InvalidArgument)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		server.Config.DeviceCodeDuration = -time.Second
+		defer func() { server.Config.DeviceCodeDuration = DefaultConfig().DeviceCodeDuration }()
+
+		device := startDeviceAuthorization(t, server, client.ClientID, secret)
+		requireCode(t, verify(t, device.UserCode, true), codes.NotFound)
+		requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2ExpiredToken)
+	})
+}
+
+func TestDeviceCodeGrantSlowDown(t *testing.T) {
+	server := newTestServer(t)
+	client, secret := createTestOAuthClient(t, server, []string{domain.ScopeUsersRead})
+
+	device := startDeviceAuthorization(t, server, client.ClientID, secret)
+	requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2AuthorizationPending)
+	requireOAuth2Error(t, pollDevice(server, device.DeviceCode, client.ClientID, secret), http.StatusBadRequest, oauth2SlowDown)
+
+	// Every poll that comes too early makes the device wait longer
+	authorization, err := server.UserRepo.PollDeviceAuthorization(testContext(), utils.HashSecret(device.DeviceCode), time.Now())
+	require.NoError(t, err)
+	require.Equal(t, int((server.Config.DevicePollInterval+slowDownInterval)/time.Second), authorization.Interval)
+}
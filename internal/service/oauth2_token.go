@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Error codes of the OAuth2 endpoints, see RFC 6749 sections 4.1.2.1 and 5.2
+// and OpenID Connect Core section 3.1.2.6
+const (
+	oauth2InvalidRequest          = "invalid_request"
+	oauth2InvalidClient           = "invalid_client"
+	oauth2InvalidGrant            = "invalid_grant"
+	oauth2InvalidScope            = "invalid_scope"
+	oauth2UnsupportedGrantType    = "unsupported_grant_type"
+	oauth2UnsupportedResponseType = "unsupported_response_type"
+	oauth2LoginRequired           = "login_required"
+	oauth2ServerError             = "server_error"
+	// Errors of device code polling, see RFC 8628 section 3.5
+	oauth2AuthorizationPending = "authorization_pending"
+	oauth2SlowDown             = "slow_down"
+	oauth2AccessDenied         = "access_denied"
+	oauth2ExpiredToken         = "expired_token"
+)
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+	// IssuedTokenType is only set by the token exchange grant
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+type oauth2ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuth2TokenHandler serves the OAuth2 token endpoint. It supports the client
+// credentials grant for service-to-service calls, the authorization code grant
+// of the OpenID provider, the device code grant for CLIs and token exchange for
+// admin impersonation. Access tokens are
+// minted through the token maker.
+func (s *UserServiceServer) OAuth2TokenHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withHTTPAuditInfo(logger.WithLogger(r.Context(), log), s.Config.Proxies, r)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeOAuth2Error(w, http.StatusMethodNotAllowed, oauth2InvalidRequest, "the token endpoint only accepts POST")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "malformed request body")
+			return
+		}
+
+		grantType := r.PostForm.Get("grant_type")
+		switch grantType {
+		case grantTypeClientCredentials:
+			s.clientCredentialsGrant(ctx, w, r)
+		case grantTypeAuthorizationCode:
+			s.authorizationCodeGrant(ctx, w, r)
+		case grantTypeDeviceCode:
+			s.deviceCodeGrant(ctx, w, r)
+		case grantTypeTokenExchange:
+			s.tokenExchangeGrant(ctx, w, r)
+		case "":
+			writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "missing grant_type")
+		default:
+			writeOAuth2Error(w, http.StatusBadRequest, oauth2UnsupportedGrantType, "unsupported grant type: "+grantType)
+		}
+	})
+}
+
+func (s *UserServiceServer) clientCredentialsGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "OAuth2/ClientCredentials")
+	defer span.End()
+
+	client, ok := s.authenticateOAuthClient(ctx, w, r)
+	if !ok {
+		return
+	}
+	span.SetAttributes(attribute.String("oauth_client.client_id", client.ClientID))
+
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		log.Warnf(ctx, "OAuth client %s requested scopes it is not allowed: %v", client.ClientID, scopes)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, "requested scope is not allowed for this client")
+		return
+	}
+
+	accessToken, payload, err := s.tokenMaker.CreateToken(
+		"",
+		domain.ServiceRole,
+		s.Config.ClientTokenDuration,
+		token.WithSubject(client.ClientID),
+		token.WithScopes(scopes...),
+	)
+	if err != nil {
+		log.Errorf(ctx, "Failed to create access token for oauth client %s: %v", client.ClientID, err)
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to create access token")
+		return
+	}
+
+	log.Infof(ctx, "Access token issued to oauth client: ClientID=%s, Scopes=%v", client.ClientID, scopes)
+
+	writeOAuth2Token(w, accessToken, payload, "")
+}
+
+func (s *UserServiceServer) authorizationCodeGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "OAuth2/AuthorizationCode")
+	defer span.End()
+
+	client, ok := s.authenticateOAuthClient(ctx, w, r)
+	if !ok {
+		return
+	}
+	span.SetAttributes(attribute.String("oauth_client.client_id", client.ClientID))
+
+	code := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "code and code_verifier are required")
+		return
+	}
+
+	authCode, err := s.UserRepo.ConsumeAuthorizationCode(ctx, utils.HashSecret(code))
+	if err != nil {
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "authorization code is invalid or already used")
+		return
+	}
+	if authCode.ClientID != client.ClientID ||
+		authCode.RedirectURI != r.PostForm.Get("redirect_uri") ||
+		time.Now().After(authCode.ExpiresAt) ||
+		!verifyCodeChallenge(verifier, authCode.CodeChallenge) {
+		log.Warnf(ctx, "Rejected authorization code of client %s", client.ClientID)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "authorization code is invalid or already used")
+		return
+	}
+
+	user, err := s.UserRepo.GetUserByID(ctx, authCode.UserID)
+	if err != nil {
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "the user of the authorization code no longer exists")
+		return
+	}
+
+	accessToken, payload, err := s.createSessionToken(ctx, user,
+		token.WithScopes(authCode.Scopes...),
+		token.WithAuthTime(authCode.AuthTime),
+	)
+	if err != nil {
+		log.Errorf(ctx, "Failed to create access token for user: %s, error: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to create access token")
+		return
+	}
+
+	var idToken string
+	if domain.ContainsScope(authCode.Scopes, domain.ScopeOpenID) {
+		idToken, err = s.idTokenSigner.Sign(s.idTokenClaims(user, client.ClientID, authCode, payload))
+		if err != nil {
+			log.Errorf(ctx, "Failed to sign id token for user: %s, error: %v", utils.MaskEmail(user.Email), err)
+			span.RecordError(err)
+			writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to create id token")
+			return
+		}
+	}
+
+	log.Infof(ctx, "Tokens issued for authorization code: ClientID=%s, UserID=%d", client.ClientID, user.ID)
+
+	writeOAuth2Token(w, accessToken, payload, idToken)
+}
+
+// authenticateOAuthClient reads client credentials from HTTP basic auth or from
+// the request body and writes an invalid_client error when they do not match.
+func (s *UserServiceServer) authenticateOAuthClient(ctx context.Context, w http.ResponseWriter, r *http.Request) (*domain.OAuthClient, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="sternx"`)
+		writeOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, "missing client credentials")
+		return nil, false
+	}
+
+	client, err := s.UserRepo.GetOAuthClientByClientID(ctx, clientID)
+	if err != nil || !utils.CheckSecret(clientSecret, client.HashedSecret) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="sternx"`)
+		writeOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+func writeOAuth2Token(w http.ResponseWriter, accessToken string, payload *token.Payload, idToken string) {
+	writeOAuth2JSON(w, http.StatusOK, oauth2TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(payload.ExpiredAt.Sub(payload.IssuedAt).Seconds()),
+		Scope:       strings.Join(payload.Scopes, " "),
+		IDToken:     idToken,
+	})
+}
+
+func writeOAuth2Error(w http.ResponseWriter, code int, errCode string, description string) {
+	writeOAuth2JSON(w, code, oauth2ErrorResponse{Error: errCode, ErrorDescription: description})
+}
+
+func writeOAuth2JSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, code, body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tokenTypeAccessToken is the only token type accepted and issued by token exchange
+const tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// tokenExchangeGrant lets an admin trade their own access token for a short
+// lived token of another user, see RFC 8693. The user to act as is named by
+// the requested_subject parameter and the issued token carries the admin in
+// its act claim, so every call made with it can be traced back to them.
+func (s *UserServiceServer) tokenExchangeGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "OAuth2/TokenExchange")
+	defer span.End()
+
+	subjectToken := r.PostForm.Get("subject_token")
+	requestedSubject := r.PostForm.Get("requested_subject")
+	if subjectToken == "" || requestedSubject == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "subject_token and requested_subject are required")
+		return
+	}
+	if r.PostForm.Get("subject_token_type") != tokenTypeAccessToken {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "subject_token_type must be "+tokenTypeAccessToken)
+		return
+	}
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != tokenTypeAccessToken {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, "only access tokens can be requested")
+		return
+	}
+
+	admin, err := s.verifyAccessToken(ctx, subjectToken)
+	if err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "subject_token is invalid or expired")
+		return
+	}
+	if admin.Role != domain.AdminRole || admin.IsScoped() || admin.IsImpersonated() {
+		log.Warnf(ctx, "Rejected token exchange of %s: Role=%s", utils.MaskEmail(admin.Email), admin.Role)
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "subject_token is not allowed to impersonate users")
+		return
+	}
+	// The role in the token is from when it was issued, the admin may have
+	// been demoted or deactivated since
+	adminUser, err := s.UserRepo.GetUserByEmail(ctx, admin.Email)
+	if err != nil || adminUser.Role != domain.AdminRole || !adminUser.Active {
+		log.Warnf(ctx, "Rejected token exchange of %s: the admin no longer exists, is deactivated or was demoted", utils.MaskEmail(admin.Email))
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "subject_token is not allowed to impersonate users")
+		return
+	}
+	span.SetAttributes(attribute.String("token.actor.subject", admin.Subject))
+
+	user, err := s.UserRepo.GetUserByEmail(ctx, requestedSubject)
+	if err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "requested_subject does not exist")
+		return
+	}
+	if user.Role == domain.AdminRole || !user.Active {
+		log.Warnf(ctx, "Rejected impersonation of %s by %s", utils.MaskEmail(user.Email), utils.MaskEmail(admin.Email))
+		writeOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, "requested_subject can't be impersonated")
+		return
+	}
+
+	// The impersonated token never outlives the token of the admin
+	duration := s.Config.ImpersonationDuration
+	if remaining := time.Until(admin.ExpiredAt); remaining < duration {
+		duration = remaining
+	}
+
+	accessToken, payload, err := s.tokenMaker.CreateToken(
+		user.Email,
+		user.Role,
+		duration,
+		token.WithAuthTime(admin.AuthTime),
+		// Signing out or revoking the session of the admin ends the
+		// impersonation too
+		token.WithSessionID(admin.SessionID),
+		token.WithActor(token.Actor{
+			Subject: admin.Subject,
+			Email:   admin.Email,
+			Role:    admin.Role,
+		}),
+	)
+	if err != nil {
+		log.Errorf(ctx, "Failed to create impersonation token for user: %s, error: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		writeOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, "failed to create access token")
+		return
+	}
+
+	log.Infof(ctx, "Impersonation token issued: UserID=%d, Email=%s, Actor=%s, ExpiresAt=%s",
+		user.ID, utils.MaskEmail(user.Email), utils.MaskEmail(admin.Email), payload.ExpiredAt.Format(time.RFC3339))
+
+	writeOAuth2JSON(w, http.StatusOK, oauth2TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(payload.ExpiredAt.Sub(payload.IssuedAt).Seconds()),
+		IssuedTokenType: tokenTypeAccessToken,
+	})
+}
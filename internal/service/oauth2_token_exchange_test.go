@@ -0,0 +1,121 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExchangeGrant(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	otherAdmin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	inactive := createTestUser(t, server, domain.StandardRole, "secret")
+	inactiveAdmin := createTestUser(t, server, domain.AdminRole, "secret")
+	demotedAdmin := createTestUser(t, server, domain.AdminRole, "secret")
+	deletedAdmin := createTestUser(t, server, domain.AdminRole, "secret")
+	active, standardRole := false, domain.StandardRole
+	_, err := server.UserRepo.UpdateUser(testContext(), inactive.ID, repository.UpdateUserParams{Active: &active})
+	require.NoError(t, err)
+	_, err = server.UserRepo.UpdateUser(testContext(), inactiveAdmin.ID, repository.UpdateUserParams{Active: &active})
+	require.NoError(t, err)
+	_, err = server.UserRepo.UpdateUser(testContext(), demotedAdmin.ID, repository.UpdateUserParams{Role: &standardRole})
+	require.NoError(t, err)
+
+	// createToken issues a token for the session of user, with the role the
+	// user had when it was issued
+	createToken := func(user *domain.User, role string, duration time.Duration, opts ...token.PayloadOption) string {
+		user = &domain.User{ID: user.ID, Email: user.Email, Role: role}
+		return sessionToken(t, server, user, duration, opts...)
+	}
+	adminToken := createToken(admin, admin.Role, time.Minute, token.WithAuthTime(time.Now()))
+	deletedAdminToken := createToken(deletedAdmin, domain.AdminRole, time.Minute)
+	require.NoError(t, server.UserRepo.DeleteUserByEmail(testContext(), deletedAdmin.Email, 0))
+	sessionless, _, err := server.tokenMaker.CreateToken(admin.Email, admin.Role, time.Minute)
+	require.NoError(t, err)
+	revokedToken := createToken(admin, admin.Role, time.Minute)
+	revokedPayload, err := server.tokenMaker.VerifyToken(revokedToken)
+	require.NoError(t, err)
+	require.NoError(t, server.UserRepo.RevokeSession(testContext(), revokedPayload.SessionID))
+	exchange := func(subjectToken string, requestedSubject string) url.Values {
+		return url.Values{
+			"grant_type":         {grantTypeTokenExchange},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {tokenTypeAccessToken},
+			"requested_subject":  {requestedSubject},
+		}
+	}
+
+	tests := map[string]struct {
+		form    url.Values
+		errCode string
+	}{
+		"NonAdminSubjectToken": {form: exchange(createToken(user, user.Role, time.Minute), inactive.Email), errCode: oauth2InvalidGrant},
+		"ScopedSubjectToken":   {form: exchange(createToken(admin, admin.Role, time.Minute, token.WithScopes(domain.ScopeUsersWrite)), user.Email), errCode: oauth2InvalidGrant},
+		// An impersonation token can't be exchanged again to hop to another user
+		"ImpersonatedSubjectToken": {form: exchange(createToken(user, admin.Role, time.Minute, token.WithActor(token.Actor{Email: admin.Email, Role: admin.Role})), user.Email), errCode: oauth2InvalidGrant},
+		// The subject token is checked against the admin as they are now
+		"DeactivatedAdmin": {form: exchange(createToken(inactiveAdmin, domain.AdminRole, time.Minute), user.Email), errCode: oauth2InvalidGrant},
+		"DemotedAdmin":     {form: exchange(createToken(demotedAdmin, domain.AdminRole, time.Minute), user.Email), errCode: oauth2InvalidGrant},
+		"DeletedAdmin":     {form: exchange(deletedAdminToken, user.Email), errCode: oauth2InvalidGrant},
+		// The subject token is authenticated like a bearer token
+		"SessionlessSubjectToken":  {form: exchange(sessionless, user.Email), errCode: oauth2InvalidGrant},
+		"RevokedSubjectToken":      {form: exchange(revokedToken, user.Email), errCode: oauth2InvalidGrant},
+		"ExpiredSubjectToken":      {form: exchange(createToken(admin, admin.Role, -time.Minute), user.Email), errCode: oauth2InvalidGrant},
+		"InvalidSubjectToken":      {form: exchange("not-a-token", user.Email), errCode: oauth2InvalidGrant},
+		"AdminRequestedSubject":    {form: exchange(adminToken, otherAdmin.Email), errCode: oauth2InvalidGrant},
+		"InactiveRequestedSubject": {form: exchange(adminToken, inactive.Email), errCode: oauth2InvalidGrant},
+		"UnknownRequestedSubject":  {form: exchange(adminToken, "nobody@example.com"), errCode: oauth2InvalidGrant},
+		"MissingRequestedSubject":  {form: exchange(adminToken, ""), errCode: oauth2InvalidRequest},
+		"WrongSubjectTokenType": {
+			form: url.Values{
+				"grant_type":         {grantTypeTokenExchange},
+				"subject_token":      {adminToken},
+				"subject_token_type": {"urn:ietf:params:oauth:token-type:id_token"},
+				"requested_subject":  {user.Email},
+			},
+			errCode: oauth2InvalidRequest,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			requireOAuth2Error(t, postOAuth2Token(server, test.form, "", ""), http.StatusBadRequest, test.errCode)
+		})
+	}
+
+	// The issued token is the user's, acted on by the admin, and never
+	// outlives the token it was exchanged for
+	rsp := requireOAuth2Token(t, postOAuth2Token(server, exchange(adminToken, user.Email), "", ""))
+	require.Equal(t, tokenTypeAccessToken, rsp.IssuedTokenType)
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, user.Email, payload.Email)
+	require.Equal(t, user.Role, payload.Role)
+	require.True(t, payload.IsImpersonated())
+	require.Equal(t, admin.Email, payload.Actor.Email)
+	require.LessOrEqual(t, rsp.ExpiresIn, int64(time.Minute.Seconds()))
+	adminPayload, err := server.tokenMaker.VerifyToken(adminToken)
+	require.NoError(t, err)
+	require.Equal(t, adminPayload.SessionID, payload.SessionID)
+
+	// The admin acts as the user, but can't do what only the user may
+	ctx, _ := rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+rsp.AccessToken)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.NoError(t, err)
+	ctx, _ = rpcContext("CreateAPIKey", authorizationHeader, authorizationBearer+" "+rsp.AccessToken)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+
+	// Signing the admin out ends the impersonation
+	require.NoError(t, server.UserRepo.RevokeSession(testContext(), adminPayload.SessionID))
+	ctx, _ = rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+rsp.AccessToken)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestOAuthClient registers a client and returns it with its secret
+func createTestOAuthClient(t *testing.T, server *UserServiceServer, scopes []string, redirectURIs ...string) (*domain.OAuthClient, string) {
+	secret := utils.RandomString(32)
+	client, err := server.UserRepo.CreateOAuthClient(testContext(), repository.CreateOAuthClientParams{
+		ClientID:     oauthClientIDTag + utils.RandomString(12),
+		Name:         "test client",
+		HashedSecret: utils.HashSecret(secret),
+		Scopes:       scopes,
+		RedirectURIs: redirectURIs,
+	})
+	require.NoError(t, err)
+	return client, secret
+}
+
+// postOAuth2Token sends form to the token endpoint, authenticated as the
+// client if clientID is set
+func postOAuth2Token(server *UserServiceServer, form url.Values, clientID string, clientSecret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, OAuth2TokenPath, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		r.SetBasicAuth(clientID, clientSecret)
+	}
+	w := httptest.NewRecorder()
+	server.OAuth2TokenHandler(logger.NewDevLogger()).ServeHTTP(w, r)
+	return w
+}
+
+// requireOAuth2Error checks that w is an OAuth2 error response
+func requireOAuth2Error(t *testing.T, w *httptest.ResponseRecorder, code int, errCode string) {
+	t.Helper()
+	require.Equal(t, code, w.Code, w.Body.String())
+	var rsp oauth2ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	require.Equal(t, errCode, rsp.Error)
+}
+
+// requireOAuth2Token checks that w is a token response and returns it
+func requireOAuth2Token(t *testing.T, w *httptest.ResponseRecorder) oauth2TokenResponse {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rsp oauth2TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	require.NotEmpty(t, rsp.AccessToken)
+	return rsp
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	server := newTestServer(t)
+	client, secret := createTestOAuthClient(t, server, []string{domain.ScopeUsersRead})
+	grant := url.Values{"grant_type": {grantTypeClientCredentials}}
+
+	tests := map[string]struct {
+		form         url.Values
+		clientID     string
+		clientSecret string
+		code         int
+		errCode      string
+	}{
+		"WrongSecret":       {form: grant, clientID: client.ClientID, clientSecret: "wrong", code: http.StatusUnauthorized, errCode: oauth2InvalidClient},
+		"UnknownClient":     {form: grant, clientID: "unknown", clientSecret: secret, code: http.StatusUnauthorized, errCode: oauth2InvalidClient},
+		"MissingClient":     {form: grant, code: http.StatusUnauthorized, errCode: oauth2InvalidClient},
+		"ScopeNotAllowed":   {form: url.Values{"grant_type": {grantTypeClientCredentials}, "scope": {domain.ScopeUsersWrite}}, clientID: client.ClientID, clientSecret: secret, code: http.StatusBadRequest, errCode: oauth2InvalidScope},
+		"MissingGrantType":  {form: url.Values{}, clientID: client.ClientID, clientSecret: secret, code: http.StatusBadRequest, errCode: oauth2InvalidRequest},
+		"UnknownGrantType":  {form: url.Values{"grant_type": {"password"}}, clientID: client.ClientID, clientSecret: secret, code: http.StatusBadRequest, errCode: oauth2UnsupportedGrantType},
+		"SecretInFormField": {form: url.Values{"grant_type": {grantTypeClientCredentials}, "client_id": {client.ClientID}, "client_secret": {"wrong"}}, code: http.StatusUnauthorized, errCode: oauth2InvalidClient},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := postOAuth2Token(server, test.form, test.clientID, test.clientSecret)
+			requireOAuth2Error(t, w, test.code, test.errCode)
+		})
+	}
+
+	// The token is for the client itself, restricted to its scopes
+	rsp := requireOAuth2Token(t, postOAuth2Token(server, grant, client.ClientID, secret))
+	require.Equal(t, domain.ScopeUsersRead, rsp.Scope)
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, client.ClientID, payload.Subject)
+	require.Equal(t, domain.ServiceRole, payload.Role)
+
+	ctx, _ := rpcContext("UpdateUser", authorizationHeader, authorizationBearer+" "+rsp.AccessToken)
+	_, err = server.authorizeUser(ctx, []string{domain.ServiceRole})
+	require.Error(t, err)
+	ctx, _ = rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+rsp.AccessToken)
+	_, err = server.authorizeUser(ctx, []string{domain.ServiceRole})
+	require.NoError(t, err)
+
+	// Only POST is accepted
+	r := httptest.NewRequest(http.MethodGet, OAuth2TokenPath, nil)
+	w := httptest.NewRecorder()
+	server.OAuth2TokenHandler(logger.NewDevLogger()).ServeHTTP(w, r)
+	requireOAuth2Error(t, w, http.StatusMethodNotAllowed, oauth2InvalidRequest)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"go.opentelemetry.io/otel"
+)
+
+// Paths of the OpenID provider endpoints on the HTTP gateway
+const (
+	OIDCDiscoveryPath   = "/.well-known/openid-configuration"
+	OAuth2AuthorizePath = "/oauth2/authorize"
+	OAuth2TokenPath     = "/oauth2/token"
+	OAuth2UserInfoPath  = "/oauth2/userinfo"
+	OAuth2JWKSPath      = "/oauth2/jwks"
+	// OAuth2DeviceAuthorizationPath is the device authorization endpoint of RFC 8628
+	OAuth2DeviceAuthorizationPath = "/oauth2/device_authorization"
+	oidcSubjectTypePublic         = "public"
+)
+
+type oidcDiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type oidcUserInfo struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// OIDCDiscoveryHandler serves the OpenID provider metadata
+func (s *UserServiceServer) OIDCDiscoveryHandler() http.Handler {
+	issuer := s.Config.Issuer
+	document := oidcDiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + OAuth2AuthorizePath,
+		TokenEndpoint:                     issuer + OAuth2TokenPath,
+		UserInfoEndpoint:                  issuer + OAuth2UserInfoPath,
+		JWKSURI:                           issuer + OAuth2JWKSPath,
+		DeviceAuthorizationEndpoint:       issuer + OAuth2DeviceAuthorizationPath,
+		ScopesSupported:                   []string{domain.ScopeOpenID, domain.ScopeEmail, domain.ScopeProfile},
+		ResponseTypesSupported:            []string{responseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeClientCredentials, grantTypeDeviceCode, grantTypeTokenExchange},
+		SubjectTypesSupported:             []string{oidcSubjectTypePublic},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "name"},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, document)
+	})
+}
+
+// OAuth2JWKSHandler serves the public keys used to verify ID tokens
+func (s *UserServiceServer) OAuth2JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.idTokenSigner.JWKS())
+	})
+}
+
+// OAuth2UserInfoHandler returns the claims about the user an access token was
+// issued to. Tokens from the authorization code flow need the openid scope.
+func (s *UserServiceServer) OAuth2UserInfoHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logger.WithLogger(r.Context(), log)
+
+		tracer := otel.Tracer("http-server")
+		ctx, span := tracer.Start(ctx, "OAuth2/UserInfo")
+		defer span.End()
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fields := strings.Fields(r.Header.Get("Authorization"))
+		if len(fields) != 2 || strings.ToLower(fields[0]) != authorizationBearer {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sternx"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidRequest, "missing bearer token")
+			return
+		}
+
+		payload, err := s.tokenMaker.VerifyToken(fields[1])
+		if err != nil || (payload.IsScoped() && !payload.HasScope(domain.ScopeOpenID)) || payload.Email == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sternx", error="invalid_token"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, "invalid_token", "the access token is invalid")
+			return
+		}
+
+		user, err := s.UserRepo.GetUserByEmail(ctx, payload.Email)
+		if err != nil {
+			span.RecordError(err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sternx", error="invalid_token"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, "invalid_token", "the user of the access token no longer exists")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, userInfoClaims(user, payload))
+	})
+}
+
+// idTokenClaims builds the ID token for an access token issued through the
+// authorization code flow. Claims beyond sub depend on the granted scopes.
+func (s *UserServiceServer) idTokenClaims(user *domain.User, clientID string, authCode *domain.AuthorizationCode, payload *token.Payload) token.IDTokenClaims {
+	info := userInfoClaims(user, payload)
+	return token.IDTokenClaims{
+		Issuer:    s.Config.Issuer,
+		Subject:   info.Subject,
+		Audience:  clientID,
+		ExpiresAt: payload.ExpiredAt.Unix(),
+		IssuedAt:  payload.IssuedAt.Unix(),
+		AuthTime:  authCode.AuthTime.Unix(),
+		Nonce:     authCode.Nonce,
+		Email:     info.Email,
+		Name:      info.Name,
+	}
+}
+
+func userInfoClaims(user *domain.User, payload *token.Payload) oidcUserInfo {
+	info := oidcUserInfo{Subject: fmt.Sprint(user.ID)}
+	if !payload.IsScoped() || payload.HasScope(domain.ScopeEmail) {
+		info.Email = user.Email
+	}
+	if !payload.IsScoped() || payload.HasScope(domain.ScopeProfile) {
+		info.Name = user.Name
+	}
+	return info
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	apiKeyPrefixTag   = "sx_"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+)
+
+func (s *UserServiceServer) CreateAPIKey(ctx context.Context, req *userpb.CreateAPIKeyRequest) (*userpb.CreateAPIKeyResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/CreateAPIKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "CreateAPIKey"),
+		attribute.String("api_key.name", req.GetName()),
+		attribute.StringSlice("api_key.scopes", req.GetScopes()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for CreateAPIKey request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateCreateAPIKeyRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for CreateAPIKey request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	owner, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find api key owner: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	prefix, err := utils.RandomSecret(apiKeyPrefixBytes)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to generate api key: %s", err)
+	}
+	prefix = apiKeyPrefixTag + prefix
+
+	secret, err := utils.RandomSecret(apiKeySecretBytes)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to generate api key: %s", err)
+	}
+
+	expiresAt := time.Now().Add(s.Config.APIKeyDuration)
+	if req.GetExpiresAt() != nil {
+		expiresAt = req.GetExpiresAt().AsTime()
+	}
+
+	apiKey, err := s.UserRepo.CreateAPIKey(ctx, repository.CreateAPIKeyParams{
+		UserID:       owner.ID,
+		Name:         req.GetName(),
+		Prefix:       prefix,
+		HashedSecret: utils.HashSecret(secret),
+		Scopes:       req.GetScopes(),
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		log.Errorf(ctx, "Failed to create api key: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to create api key")
+	}
+
+	log.Infof(ctx, "API key created successfully: ID=%d, Prefix=%s, Owner=%s", apiKey.ID, apiKey.Prefix, utils.MaskEmail(owner.Email))
+
+	return &userpb.CreateAPIKeyResponse{
+		ApiKey: ConvertToAPIKey(*apiKey),
+		Key:    fmt.Sprintf("%s.%s", prefix, secret),
+	}, nil
+}
+
+func (s *UserServiceServer) ListAPIKeys(ctx context.Context, req *userpb.ListAPIKeysRequest) (*userpb.ListAPIKeysResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListAPIKeys")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListAPIKeys"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ListAPIKeys request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	owner, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find api key owner: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	apiKeys, err := s.UserRepo.ListAPIKeysByUserID(ctx, owner.ID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list api keys: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list api keys")
+	}
+
+	rsp := &userpb.ListAPIKeysResponse{}
+	for _, apiKey := range apiKeys {
+		rsp.ApiKeys = append(rsp.ApiKeys, ConvertToAPIKey(apiKey))
+	}
+	return rsp, nil
+}
+
+func (s *UserServiceServer) RevokeAPIKey(ctx context.Context, req *userpb.RevokeAPIKeyRequest) (*userpb.RevokeAPIKeyResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RevokeAPIKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "RevokeAPIKey"),
+		attribute.String("api_key.id", req.GetApiKeyId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for RevokeAPIKey request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateRevokeAPIKeyRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RevokeAPIKey request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	keyID, _ := strconv.Atoi(req.GetApiKeyId()) // It's checked in validation before
+
+	owner, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find api key owner: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	err = s.UserRepo.RevokeAPIKey(ctx, owner.ID, keyID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to revoke api key %d: %v", keyID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to revoke api key")
+	}
+
+	log.Infof(ctx, "API key revoked successfully: ID=%d, Owner=%s", keyID, utils.MaskEmail(owner.Email))
+
+	return &userpb.RevokeAPIKeyResponse{Success: true}, nil
+}
+
+func ConvertToAPIKey(apiKey domain.APIKey) *userpb.APIKey {
+	pb := &userpb.APIKey{
+		ApiKeyId:  fmt.Sprint(apiKey.ID),
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		ExpiresAt: timestamppb.New(apiKey.ExpiresAt),
+		CreatedAt: timestamppb.New(apiKey.CreatedAt),
+	}
+	if apiKey.LastUsedAt != nil {
+		pb.LastUsedAt = timestamppb.New(*apiKey.LastUsedAt)
+	}
+	if apiKey.RevokedAt != nil {
+		pb.RevokedAt = timestamppb.New(*apiKey.RevokedAt)
+	}
+	return pb
+}
+
+func validateCreateAPIKeyRequest(req *userpb.CreateAPIKeyRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateString(req.GetName(), 3, 100); err != nil {
+		violations = append(violations, fieldViolation("name", err))
+	}
+
+	if err := domain.ValidateScopes(req.GetScopes()); err != nil {
+		violations = append(violations, fieldViolation("scopes", err))
+	}
+
+	if req.GetExpiresAt() != nil && !req.GetExpiresAt().AsTime().After(time.Now()) {
+		violations = append(violations, fieldViolation("expires_at", fmt.Errorf("must be in the future")))
+	}
+	return violations
+}
+
+func validateRevokeAPIKeyRequest(req *userpb.RevokeAPIKeyRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateIdString(req.GetApiKeyId()); err != nil {
+		violations = append(violations, fieldViolation("api_key_id", err))
+	}
+	return violations
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAPIKeys(t *testing.T) {
+	server := newTestServer(t)
+	owner := createTestUser(t, server, domain.StandardRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+
+	ctx, _ := authContext(t, server, "CreateAPIKey", owner)
+	created, err := server.CreateAPIKey(ctx, &userpb.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{domain.ScopeUsersRead}})
+	require.NoError(t, err)
+	require.Contains(t, created.GetKey(), created.GetApiKey().GetPrefix()+".")
+
+	// The key authenticates its owner, within its scopes
+	ctx, _ = rpcContext("GetUser", apiKeyHeader, created.GetKey())
+	payload, err := server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.NoError(t, err)
+	require.Equal(t, owner.Email, payload.Email)
+	ctx, _ = rpcContext("UpdateUser", apiKeyHeader, created.GetKey())
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+
+	for name, key := range map[string]string{
+		"WrongSecret":   created.GetApiKey().GetPrefix() + ".wrong",
+		"UnknownPrefix": "sx_unknown.secret",
+		"NoSeparator":   created.GetApiKey().GetPrefix(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, _ := rpcContext("GetUser", apiKeyHeader, key)
+			_, err := server.authorizeUser(ctx, []string{domain.StandardRole})
+			require.Error(t, err)
+		})
+	}
+
+	// Keys can only be revoked by their owner, and once
+	ctx, _ = authContext(t, server, "RevokeAPIKey", other)
+	_, err = server.RevokeAPIKey(ctx, &userpb.RevokeAPIKeyRequest{ApiKeyId: created.GetApiKey().GetApiKeyId()})
+	requireCode(t, err, codes.NotFound)
+
+	ctx, _ = authContext(t, server, "RevokeAPIKey", owner)
+	_, err = server.RevokeAPIKey(ctx, &userpb.RevokeAPIKeyRequest{ApiKeyId: created.GetApiKey().GetApiKeyId()})
+	require.NoError(t, err)
+	_, err = server.RevokeAPIKey(ctx, &userpb.RevokeAPIKeyRequest{ApiKeyId: created.GetApiKey().GetApiKeyId()})
+	requireCode(t, err, codes.NotFound)
+
+	ctx, _ = rpcContext("GetUser", apiKeyHeader, created.GetKey())
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+}
+
+// failingAPIKeyRepository fails to revoke API keys the way a broken database
+// connection would
+type failingAPIKeyRepository struct {
+	repository.IRepository
+}
+
+func (r failingAPIKeyRepository) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	return errors.New("connection reset by peer")
+}
+
+func TestRevokeAPIKeyRepositoryFailure(t *testing.T) {
+	server := newTestServer(t)
+	owner := createTestUser(t, server, domain.StandardRole, "secret")
+	server.UserRepo = failingAPIKeyRepository{IRepository: server.UserRepo}
+
+	ctx, _ := authContext(t, server, "RevokeAPIKey", owner)
+	_, err := server.RevokeAPIKey(ctx, &userpb.RevokeAPIKeyRequest{ApiKeyId: "1"})
+	requireCode(t, err, codes.Internal)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultAuditEventsLimit = 50
+	maxAuditEventsLimit     = 500
+)
+
+// ListAuditEvents pages through the audit log, oldest first
+func (s *UserServiceServer) ListAuditEvents(ctx context.Context, req *userpb.ListAuditEventsRequest) (*userpb.ListAuditEventsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListAuditEvents")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListAuditEvents"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ListAuditEvents request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateListAuditEventsRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ListAuditEvents request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	// Both IDs are checked in validation before
+	params := repository.ListAuditEventsParams{Actor: req.GetActor(), Target: req.GetTarget(), Limit: int(req.GetLimit())}
+	if req.GetUserId() != "" {
+		userID, _ := strconv.Atoi(req.GetUserId())
+		params.UserID = &userID
+	}
+	if req.GetAfterId() != "" {
+		params.AfterID, _ = strconv.Atoi(req.GetAfterId())
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultAuditEventsLimit
+	}
+
+	events, err := s.UserRepo.ListAuditEvents(ctx, params)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list audit events: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list audit events")
+	}
+
+	rsp := &userpb.ListAuditEventsResponse{}
+	for _, event := range events {
+		rsp.AuditEvents = append(rsp.AuditEvents, ConvertToAuditEvent(event))
+	}
+	if len(events) == params.Limit {
+		rsp.NextAfterId = fmt.Sprint(events[len(events)-1].ID)
+	}
+	return rsp, nil
+}
+
+func ConvertToAuditEvent(event domain.AuditEvent) *userpb.AuditEvent {
+	pb := &userpb.AuditEvent{
+		AuditEventId: fmt.Sprint(event.ID),
+		Actor:        event.Actor,
+		Action:       event.Action,
+		Target:       event.Target,
+		Diff:         string(event.Diff),
+		RequestId:    event.RequestID,
+		ClientIp:     event.ClientIP,
+		CreatedAt:    timestamppb.New(event.CreatedAt),
+		PrevHash:     event.PrevHash,
+		Hash:         event.Hash,
+	}
+	if event.UserID != nil {
+		pb.UserId = fmt.Sprint(*event.UserID)
+	}
+	return pb
+}
+
+func validateListAuditEventsRequest(req *userpb.ListAuditEventsRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetUserId() != "" {
+		if err := domain.ValidateUserIdString(req.GetUserId()); err != nil {
+			violations = append(violations, fieldViolation("user_id", err))
+		}
+	}
+	if req.GetAfterId() != "" {
+		if id, err := strconv.Atoi(req.GetAfterId()); err != nil || id < 0 {
+			violations = append(violations, fieldViolation("after_id", fmt.Errorf("must be a non-negative integer")))
+		}
+	}
+	if req.GetLimit() < 0 || req.GetLimit() > maxAuditEventsLimit {
+		violations = append(violations, fieldViolation("limit", fmt.Errorf("must be between 0 and %d", maxAuditEventsLimit)))
+	}
+	return violations
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestListAuditEvents(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	// The interceptor attaches the audit info of each call
+	ctx, _ := authContext(t, server, "CreateAPIKey", user)
+	ctx = withAuditInfo(withIncomingMetadata(ctx, requestIDHeader, "req-1"), server.Config.Proxies)
+	created, err := server.CreateAPIKey(ctx, &userpb.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{domain.ScopeUsersRead}})
+	require.NoError(t, err)
+	keyTarget := "api_key:" + created.GetApiKey().GetApiKeyId()
+
+	list := func(req *userpb.ListAuditEventsRequest) []*userpb.AuditEvent {
+		ctx, _ := authContext(t, server, "ListAuditEvents", admin)
+		rsp, err := server.ListAuditEvents(ctx, req)
+		require.NoError(t, err)
+		return rsp.GetAuditEvents()
+	}
+
+	events := list(&userpb.ListAuditEventsRequest{Target: keyTarget})
+	require.Len(t, events, 1)
+	require.Equal(t, domain.AuditActionAPIKeyCreate, events[0].GetAction())
+	require.Equal(t, user.Email, events[0].GetActor())
+	require.Equal(t, strconv.Itoa(user.ID), events[0].GetUserId())
+	require.Equal(t, "req-1", events[0].GetRequestId())
+	require.Contains(t, events[0].GetDiff(), `"hashed_secret":{"before":null,"after":"`+audit.Redacted+`"}`)
+
+	t.Run("Filters", func(t *testing.T) {
+		tests := map[string]struct {
+			req     *userpb.ListAuditEventsRequest
+			targets []string
+		}{
+			"Actor": {
+				req:     &userpb.ListAuditEventsRequest{Actor: user.Email},
+				targets: []string{keyTarget},
+			},
+			"User": {
+				req:     &userpb.ListAuditEventsRequest{UserId: strconv.Itoa(user.ID)},
+				targets: []string{fmt.Sprintf("user:%d", user.ID), keyTarget},
+			},
+			"Target": {
+				req:     &userpb.ListAuditEventsRequest{Target: fmt.Sprintf("user:%d", admin.ID)},
+				targets: []string{fmt.Sprintf("user:%d", admin.ID)},
+			},
+			"NoMatch": {
+				req: &userpb.ListAuditEventsRequest{Actor: "nobody@example.com"},
+			},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				var targets []string
+				for _, event := range list(test.req) {
+					targets = append(targets, event.GetTarget())
+				}
+				require.Equal(t, test.targets, targets)
+			})
+		}
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		all := list(&userpb.ListAuditEventsRequest{})
+		require.Len(t, all, 3)
+
+		ctx, _ := authContext(t, server, "ListAuditEvents", admin)
+		rsp, err := server.ListAuditEvents(ctx, &userpb.ListAuditEventsRequest{Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, rsp.GetAuditEvents(), 2)
+		require.Equal(t, all[1].GetAuditEventId(), rsp.GetNextAfterId())
+
+		rsp, err = server.ListAuditEvents(ctx, &userpb.ListAuditEventsRequest{Limit: 2, AfterId: rsp.GetNextAfterId()})
+		require.NoError(t, err)
+		require.Len(t, rsp.GetAuditEvents(), 1)
+		require.Equal(t, all[2].GetAuditEventId(), rsp.GetAuditEvents()[0].GetAuditEventId())
+		require.Empty(t, rsp.GetNextAfterId())
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		tests := map[string]struct {
+			caller *domain.User
+			req    *userpb.ListAuditEventsRequest
+			code   codes.Code
+		}{
+			// Only admins read the audit log
+			"StandardUser":   {caller: user, req: &userpb.ListAuditEventsRequest{UserId: strconv.Itoa(user.ID)}, code: codes.Unauthenticated},
+			"InvalidUserID":  {caller: admin, req: &userpb.ListAuditEventsRequest{UserId: "me"}, code: codes.InvalidArgument},
+			"InvalidAfterID": {caller: admin, req: &userpb.ListAuditEventsRequest{AfterId: "-1"}, code: codes.InvalidArgument},
+			"LimitTooHigh":   {caller: admin, req: &userpb.ListAuditEventsRequest{Limit: maxAuditEventsLimit + 1}, code: codes.InvalidArgument},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				ctx, _ := authContext(t, server, "ListAuditEvents", test.caller)
+				_, err := server.ListAuditEvents(ctx, test.req)
+				requireCode(t, err, test.code)
+			})
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChangePassword replaces the password of a user and signs them in with the
+// new one. The current password authenticates the request, which lets users
+// whose password expired, and who therefore can't get a token, change it.
+func (server *UserServiceServer) ChangePassword(ctx context.Context, req *userpb.ChangePasswordRequest) (*userpb.LoginUserResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ChangePassword")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "ChangePassword"),
+		attribute.String("user.email", req.GetEmail()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	violations := validateChangePasswordRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ChangePassword request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := server.checkCredentials(ctx, req.GetEmail(), req.GetCurrentPassword())
+	if err != nil {
+		span.RecordError(err)
+		server.recordLogin(ctx, domain.LoginMethodPassword, req.GetEmail(), nil, "", err)
+		return nil, err
+	}
+
+	for _, err := range server.Config.PasswordPolicy.Check(req.GetNewPassword(), user.Name, user.Email) {
+		violations = append(violations, fieldViolation("new_password", err))
+	}
+	if violations != nil {
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	reused, err := server.passwordReused(ctx, user, req.GetNewPassword())
+	if err != nil {
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to check password history")
+	}
+	if reused {
+		violations = append(violations, fieldViolation("new_password", server.errPasswordReused()))
+		return nil, invalidArgumentError(violations)
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(req.GetNewPassword())
+	if err != nil {
+		log.Errorf(ctx, "Failed to hash password of user %s: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to hash password: %s", err)
+	}
+	user, err = server.UserRepo.UpdateUser(ctx, user.ID, repository.UpdateUserParams{HashedPassword: &hashedPassword})
+	if err != nil {
+		log.Errorf(ctx, "Failed to change password of user %s: %v", utils.MaskEmail(req.GetEmail()), err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to change password")
+	}
+	server.recordPasswordHistory(ctx, user.ID, hashedPassword)
+
+	rsp, err := server.createLoginResponse(ctx, user)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	server.recordLogin(ctx, domain.LoginMethodPassword, user.Email, user, rsp.GetSessionId(), nil)
+	log.Infof(ctx, "Password changed: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	return rsp, nil
+}
+
+// passwordExpired reports whether a user has to change their password before
+// they can sign in with it again.
+func (server *UserServiceServer) passwordExpired(user *domain.User) bool {
+	maxAge := server.Config.PasswordMaxAge
+	return maxAge > 0 && time.Since(user.PasswordChangedAt) > maxAge
+}
+
+// passwordReused reports whether password is the current password of a user
+// or one of the previous ones kept in the password history.
+func (server *UserServiceServer) passwordReused(ctx context.Context, user *domain.User, password string) (bool, error) {
+	if server.Config.PasswordHistorySize < 0 {
+		return false, nil
+	}
+
+	hashes, err := server.UserRepo.ListPasswordHistory(ctx, user.ID, server.Config.PasswordHistorySize)
+	if err != nil {
+		return false, err
+	}
+	// Passwords set before the history was kept are only in the users table
+	hashes = append(hashes, user.HashedPassword)
+
+	for _, hash := range hashes {
+		// Hashes that can't be verified anymore, e.g. made with a retired
+		// pepper, don't count as a match
+		if _, err := server.passwordHasher.Verify(password, hash); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPasswordHistory remembers a newly set password hash. Failing to do so
+// doesn't fail the change, it only weakens the reuse check.
+func (server *UserServiceServer) recordPasswordHistory(ctx context.Context, userID int, hashedPassword string) {
+	if server.Config.PasswordHistorySize < 0 {
+		return
+	}
+
+	if err := server.UserRepo.AddPasswordHistory(ctx, userID, hashedPassword, server.Config.PasswordHistorySize); err != nil {
+		logger.FromContext(ctx).Warnf(ctx, "Failed to record password history of user %d: %v", userID, err)
+	}
+}
+
+func (server *UserServiceServer) errPasswordReused() error {
+	return fmt.Errorf("must not be one of your last %d passwords", server.Config.PasswordHistorySize)
+}
+
+func validateChangePasswordRequest(req *userpb.ChangePasswordRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateEmail(req.GetEmail()); err != nil {
+		violations = append(violations, fieldViolation("email", err))
+	}
+
+	if err := domain.ValidatePassword(req.GetCurrentPassword()); err != nil {
+		violations = append(violations, fieldViolation("current_password", err))
+	}
+
+	return violations
+}
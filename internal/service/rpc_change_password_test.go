@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func changePassword(server *UserServiceServer, email string, currentPassword string, newPassword string) (*userpb.LoginUserResponse, error) {
+	ctx, _ := rpcContext("ChangePassword")
+	return server.ChangePassword(ctx, &userpb.ChangePasswordRequest{
+		Email:           email,
+		CurrentPassword: currentPassword,
+		NewPassword:     newPassword,
+	})
+}
+
+func TestChangePasswordHistory(t *testing.T) {
+	server := newTestServer(t)
+	server.Config.PasswordHistorySize = 2
+
+	// newUser returns a user who went through the passwords first, second
+	// and third, in that order
+	newUser := func(t *testing.T) *domain.User {
+		user := createTestUser(t, server, domain.StandardRole, "first-password")
+		server.recordPasswordHistory(testContext(), user.ID, user.HashedPassword)
+		_, err := changePassword(server, user.Email, "first-password", "second-password")
+		require.NoError(t, err)
+		_, err = changePassword(server, user.Email, "second-password", "third-password")
+		require.NoError(t, err)
+		return user
+	}
+
+	tests := map[string]struct {
+		currentPassword string
+		newPassword     string
+		code            codes.Code
+	}{
+		"CurrentPassword":  {currentPassword: "third-password", newPassword: "third-password", code: codes.InvalidArgument},
+		"PreviousPassword": {currentPassword: "third-password", newPassword: "second-password", code: codes.InvalidArgument},
+		// Passwords older than the history may be used again
+		"ForgottenPassword":    {currentPassword: "third-password", newPassword: "first-password", code: codes.OK},
+		"NewPassword":          {currentPassword: "third-password", newPassword: "fourth-password", code: codes.OK},
+		"TooShort":             {currentPassword: "third-password", newPassword: "short", code: codes.InvalidArgument},
+		"WrongCurrentPassword": {currentPassword: "second-password", newPassword: "fourth-password", code: codes.NotFound},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			user := newUser(t)
+			rsp, err := changePassword(server, user.Email, test.currentPassword, test.newPassword)
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+				loginTestUser(t, server, user, "third-password")
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, rsp.GetAccessToken())
+			loginTestUser(t, server, user, test.newPassword)
+		})
+	}
+
+	// A negative history size turns the check off
+	server.Config.PasswordHistorySize = -1
+	user := newUser(t)
+	_, err := changePassword(server, user.Email, "third-password", "second-password")
+	require.NoError(t, err)
+}
+
+func TestPasswordMaxAge(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "first-password")
+	server.Config.PasswordMaxAge = time.Nanosecond
+
+	// An expired password signs nobody in, it can only be changed
+	ctx, _ := rpcContext("LoginUser")
+	rsp, err := server.LoginUser(ctx, &userpb.LoginUserRequest{Email: user.Email, Password: "first-password"})
+	require.NoError(t, err)
+	require.True(t, rsp.GetMustChangePassword())
+	require.Empty(t, rsp.GetAccessToken())
+	require.Empty(t, rsp.GetSessionId())
+
+	_, err = changePassword(server, user.Email, "first-password", "first-password")
+	requireCode(t, err, codes.InvalidArgument)
+	rsp, err = changePassword(server, user.Email, "first-password", "second-password")
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.GetAccessToken())
+
+	server.Config.PasswordMaxAge = time.Hour
+	rsp = loginTestUser(t, server, user, "second-password")
+	require.False(t, rsp.GetMustChangePassword())
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/fibonachyy/sternx/internal/logger"
 	"github.com/fibonachyy/sternx/internal/metrics"
 	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/password"
 	"github.com/fibonachyy/sternx/pkg/utils"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -34,14 +35,14 @@ func (s *UserServiceServer) CreateUser(ctx context.Context, req *userpb.CreateUs
 	)
 	ctx = trace.ContextWithSpan(ctx, span)
 
-	violations := validateCreateUserRequest(req)
+	violations := validateCreateUserRequest(req, s.Config.PasswordPolicy)
 	if violations != nil {
 		log.Error(ctx, "Validation failed for CreateUser request", "violations", violations)
 		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
 		return nil, invalidArgumentError(violations)
 	}
 
-	hashedPassword, err := utils.HashPassword(req.GetPassword())
+	hashedPassword, err := s.passwordHasher.Hash(req.GetPassword())
 	if err != nil {
 		log.Errorf(ctx, "Failed to hash password for user creation: %v", err)
 		span.RecordError(err)
@@ -59,8 +60,9 @@ func (s *UserServiceServer) CreateUser(ctx context.Context, req *userpb.CreateUs
 	if err != nil {
 		log.Errorf(ctx, "Failed to create user: %v", err)
 		span.RecordError(err)
-		return nil, status.Errorf(codes.Internal, "failed to create user: %v", err)
+		return nil, repositoryError(err, "failed to create user")
 	}
+	s.recordPasswordHistory(ctx, user.ID, hashedPassword)
 
 	createUserCounter, _ := meter.Int64Counter("createUser")
 	createUserCounter.Add(ctx, 1)
@@ -92,14 +94,14 @@ func (s *UserServiceServer) CreateAdmin(ctx context.Context, req *userpb.CreateU
 		return nil, unauthenticatedError(err)
 	}
 
-	violations := validateCreateUserRequest(req)
+	violations := validateCreateUserRequest(req, s.Config.PasswordPolicy)
 	if violations != nil {
 		log.Error(ctx, "Validation failed for CreateAdmin request", "violations", violations)
 		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
 		return nil, invalidArgumentError(violations)
 	}
 
-	hashedPassword, err := utils.HashPassword(req.GetPassword())
+	hashedPassword, err := s.passwordHasher.Hash(req.GetPassword())
 	if err != nil {
 		log.Errorf(ctx, "Failed to hash password for admin user creation: %v", err)
 		return nil, status.Errorf(codes.Internal, "failed to hash password: %s", err)
@@ -116,8 +118,9 @@ func (s *UserServiceServer) CreateAdmin(ctx context.Context, req *userpb.CreateU
 	if err != nil {
 		log.Errorf(ctx, "Failed to create admin user: %v", err)
 		span.RecordError(err)
-		return nil, status.Errorf(codes.Internal, "failed to create admin user: %v", err)
+		return nil, repositoryError(err, "failed to create admin user")
 	}
+	s.recordPasswordHistory(ctx, user.ID, hashedPassword)
 	// Increment the createUser counter
 	createUserCounter, _ := meter.Int64Counter("createUser")
 	createUserCounter.Add(ctx, 1)
@@ -127,7 +130,7 @@ func (s *UserServiceServer) CreateAdmin(ctx context.Context, req *userpb.CreateU
 }
 
 func ConvertToUserResponse(user domain.User) *userpb.UserResponse {
-	return &userpb.UserResponse{
+	rsp := &userpb.UserResponse{
 		User: &userpb.User{
 			UserId:            fmt.Sprint(user.ID),
 			Name:              user.Name,
@@ -135,11 +138,16 @@ func ConvertToUserResponse(user domain.User) *userpb.UserResponse {
 			Role:              domain.StringToRole(user.Role),
 			PasswordChangedAt: timestamppb.New(user.PasswordChangedAt),
 			CreatedAt:         timestamppb.New(user.CreatedAt),
+			Etag:              userETag(user),
 		},
 	}
+	if user.DeletedAt != nil {
+		rsp.User.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	return rsp
 }
 
-func validateCreateUserRequest(req *userpb.CreateUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+func validateCreateUserRequest(req *userpb.CreateUserRequest, policy password.Policy) (violations []*errdetails.BadRequest_FieldViolation) {
 	if err := domain.ValidateName(req.GetName()); err != nil {
 		violations = append(violations, fieldViolation("name", err))
 	}
@@ -148,7 +156,7 @@ func validateCreateUserRequest(req *userpb.CreateUserRequest) (violations []*err
 		violations = append(violations, fieldViolation("email", err))
 	}
 
-	if err := domain.ValidatePassword(req.GetPassword()); err != nil {
+	for _, err := range policy.Check(req.GetPassword(), req.GetName(), req.GetEmail()) {
 		violations = append(violations, fieldViolation("password", err))
 	}
 
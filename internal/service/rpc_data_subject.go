@@ -0,0 +1,403 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultErasureRequestsLimit = 50
+	maxErasureRequestsLimit     = 500
+
+	// exportChunkSize is about how many bytes ExportMyData sends per message
+	exportChunkSize = 32 << 10
+)
+
+// ExportMyData streams everything stored about the caller as one JSON
+// document. Secrets, like password and API key hashes, are left out.
+func (s *UserServiceServer) ExportMyData(req *userpb.ExportMyDataRequest, stream userpb.UserService_ExportMyDataServer) error {
+	ctx := stream.Context()
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ExportMyData")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ExportMyData"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ExportMyData request: %v", err)
+		span.RecordError(err)
+		return unauthenticatedError(err)
+	}
+
+	user, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user: %s, error: %v", utils.MaskEmail(authPayload.Email), err)
+		span.RecordError(err)
+		return repositoryError(err, "failed to find user")
+	}
+
+	if err := s.exportUserData(ctx, user, &exportStream{stream: stream}); err != nil {
+		log.Errorf(ctx, "Failed to export data of user %d: %v", user.ID, err)
+		span.RecordError(err)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return repositoryError(err, "failed to export data")
+	}
+
+	log.Infof(ctx, "User data exported: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+	return nil
+}
+
+// exportUserData writes the export document of user to out, one section at a time
+func (s *UserServiceServer) exportUserData(ctx context.Context, user *domain.User, out *exportStream) error {
+	out.raw(`{"exported_at":`)
+	if err := out.value(time.Now()); err != nil {
+		return err
+	}
+	out.raw(`,"user":`)
+	if err := out.value(exportedUserOf(*user)); err != nil {
+		return err
+	}
+
+	identities, err := s.UserRepo.ListUserIdentitiesByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := exportList(out, "identities", identities); err != nil {
+		return err
+	}
+
+	apiKeys, err := s.UserRepo.ListAPIKeysByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	exportedKeys := make([]exportedAPIKey, 0, len(apiKeys))
+	for _, key := range apiKeys {
+		exportedKeys = append(exportedKeys, exportedAPIKeyOf(key))
+	}
+	if err := exportList(out, "api_keys", exportedKeys); err != nil {
+		return err
+	}
+
+	sessions, err := s.UserRepo.ListSessionHistoryByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := exportList(out, "sessions", sessions); err != nil {
+		return err
+	}
+
+	loginEvents, err := s.UserRepo.ListLoginEventsByUserID(ctx, user.ID, -1)
+	if err != nil {
+		return err
+	}
+	if err := exportList(out, "login_events", loginEvents); err != nil {
+		return err
+	}
+
+	var auditEvents []domain.AuditEvent
+	params := repository.ListAuditEventsParams{UserID: &user.ID, Limit: maxAuditEventsLimit}
+	for {
+		page, err := s.UserRepo.ListAuditEvents(ctx, params)
+		if err != nil {
+			return err
+		}
+		auditEvents = append(auditEvents, page...)
+		if len(page) < params.Limit {
+			break
+		}
+		params.AfterID = page[len(page)-1].ID
+	}
+	if err := exportList(out, "audit_events", auditEvents); err != nil {
+		return err
+	}
+
+	out.raw("}")
+	return out.flush()
+}
+
+// RequestErasure anonymizes the personal data of a user in place, keeping the
+// user row and the records referencing it. Users can erase themselves and
+// admins anyone. The erasure is recorded as a request that is completed in
+// the same transaction; a request that failed stays pending and is reused by
+// the next attempt.
+func (s *UserServiceServer) RequestErasure(ctx context.Context, req *userpb.RequestErasureRequest) (*userpb.ErasureRequest, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RequestErasure")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "RequestErasure"),
+		attribute.String("user.id", req.GetUserId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for RequestErasure request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateRequestErasureRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RequestErasure request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	applicant, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user: %s, error: %v", utils.MaskEmail(authPayload.Email), err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	userID := applicant.ID
+	if req.GetUserId() != "" {
+		userID, _ = strconv.Atoi(req.GetUserId()) // It's checked in validation before
+	}
+	if userID != applicant.ID && authPayload.Role != domain.AdminRole {
+		log.Errorf(ctx, "Permission denied for erasing user with ID: %d", userID)
+		return nil, status.Errorf(codes.PermissionDenied, "cannot erase other user")
+	}
+
+	request, err := s.UserRepo.CreateErasureRequest(ctx, userID, applicant.ID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to create erasure request of user %d: %v", userID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to create erasure request")
+	}
+	span.SetAttributes(attribute.Int("erasure_request.id", request.ID))
+
+	request, err = s.UserRepo.EraseUser(ctx, request.ID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to erase user %d: %v", userID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to erase user")
+	}
+
+	log.Infof(ctx, "User erased: ID=%d, ErasureRequest=%d, RequestedBy=%d", userID, request.ID, applicant.ID)
+
+	return ConvertToErasureRequest(*request), nil
+}
+
+func (s *UserServiceServer) GetErasureRequest(ctx context.Context, req *userpb.GetErasureRequestRequest) (*userpb.ErasureRequest, error) {
+	log := logger.FromContext(ctx)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for GetErasureRequest request: %v", err)
+		return nil, unauthenticatedError(err)
+	}
+
+	if err := domain.ValidateIdString(req.GetErasureRequestId()); err != nil {
+		violations := []*errdetails.BadRequest_FieldViolation{fieldViolation("erasure_request_id", err)}
+		log.Error(ctx, "Validation failed for GetErasureRequest request", "violations", violations)
+		return nil, invalidArgumentError(violations)
+	}
+	id, _ := strconv.Atoi(req.GetErasureRequestId())
+
+	request, err := s.UserRepo.GetErasureRequest(ctx, id)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find erasure request %d: %v", id, err)
+		return nil, repositoryError(err, "failed to find erasure request")
+	}
+	return ConvertToErasureRequest(*request), nil
+}
+
+func (s *UserServiceServer) ListErasureRequests(ctx context.Context, req *userpb.ListErasureRequestsRequest) (*userpb.ListErasureRequestsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ListErasureRequests request: %v", err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateListErasureRequestsRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ListErasureRequests request", "violations", violations)
+		return nil, invalidArgumentError(violations)
+	}
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultErasureRequestsLimit
+	}
+	params := repository.ListErasureRequestsParams{Status: req.GetStatus(), Offset: int(req.GetOffset()), Limit: limit}
+	requests, total, err := s.UserRepo.ListErasureRequests(ctx, params)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list erasure requests: %v", err)
+		return nil, repositoryError(err, "failed to list erasure requests")
+	}
+
+	rsp := &userpb.ListErasureRequestsResponse{Total: int32(total)}
+	for _, request := range requests {
+		rsp.ErasureRequests = append(rsp.ErasureRequests, ConvertToErasureRequest(request))
+	}
+	return rsp, nil
+}
+
+func ConvertToErasureRequest(request domain.ErasureRequest) *userpb.ErasureRequest {
+	pb := &userpb.ErasureRequest{
+		ErasureRequestId: fmt.Sprint(request.ID),
+		UserId:           fmt.Sprint(request.UserID),
+		RequestedBy:      fmt.Sprint(request.RequestedBy),
+		Status:           request.Status,
+		CreatedAt:        timestamppb.New(request.CreatedAt),
+	}
+	if request.CompletedAt != nil {
+		pb.CompletedAt = timestamppb.New(*request.CompletedAt)
+	}
+	return pb
+}
+
+func validateRequestErasureRequest(req *userpb.RequestErasureRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetUserId() != "" {
+		if err := domain.ValidateUserIdString(req.GetUserId()); err != nil {
+			violations = append(violations, fieldViolation("user_id", err))
+		}
+	}
+	return violations
+}
+
+func validateListErasureRequestsRequest(req *userpb.ListErasureRequestsRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	switch req.GetStatus() {
+	case "", domain.ErasureStatusPending, domain.ErasureStatusCompleted:
+	default:
+		violations = append(violations, fieldViolation("status", fmt.Errorf("must be %s or %s", domain.ErasureStatusPending, domain.ErasureStatusCompleted)))
+	}
+	if req.GetLimit() < 0 || req.GetLimit() > maxErasureRequestsLimit {
+		violations = append(violations, fieldViolation("limit", fmt.Errorf("must be between 0 and %d", maxErasureRequestsLimit)))
+	}
+	if req.GetOffset() < 0 {
+		violations = append(violations, fieldViolation("offset", fmt.Errorf("must not be negative")))
+	}
+	return violations
+}
+
+// exportStream writes a JSON document to an ExportMyData stream. Chunks only
+// end between JSON values, since the gateway separates them with a newline.
+type exportStream struct {
+	stream userpb.UserService_ExportMyDataServer
+	buf    bytes.Buffer
+}
+
+func (e *exportStream) raw(s string) {
+	e.buf.WriteString(s)
+}
+
+// value writes v as JSON, sending the buffered document once it's big enough
+func (e *exportStream) value(v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	e.buf.Write(encoded)
+	if e.buf.Len() >= exportChunkSize {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportStream) flush() error {
+	if e.buf.Len() == 0 {
+		return nil
+	}
+	err := e.stream.Send(&httpbody.HttpBody{ContentType: "application/json", Data: bytes.Clone(e.buf.Bytes())})
+	e.buf.Reset()
+	return err
+}
+
+// exportList writes rows as the array field name of the export document
+func exportList[T any](out *exportStream, name string, rows []T) error {
+	out.raw(`,"` + name + `":[`)
+	for i, row := range rows {
+		if i > 0 {
+			out.raw(",")
+		}
+		if err := out.value(row); err != nil {
+			return err
+		}
+	}
+	out.raw("]")
+	return nil
+}
+
+// exportedUser is a domain.User without its password hash
+type exportedUser struct {
+	ID                int        `json:"id"`
+	Name              string     `json:"name"`
+	Email             string     `json:"email"`
+	Role              string     `json:"role"`
+	ExternalID        string     `json:"external_id"`
+	Active            bool       `json:"active"`
+	PasswordChangedAt time.Time  `json:"password_changed_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+}
+
+func exportedUserOf(user domain.User) exportedUser {
+	return exportedUser{
+		ID:                user.ID,
+		Name:              user.Name,
+		Email:             user.Email,
+		Role:              user.Role,
+		ExternalID:        user.ExternalID,
+		Active:            user.Active,
+		PasswordChangedAt: user.PasswordChangedAt,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+		DeletedAt:         user.DeletedAt,
+	}
+}
+
+// exportedAPIKey is a domain.APIKey without its secret hash
+type exportedAPIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func exportedAPIKeyOf(key domain.APIKey) exportedAPIKey {
+	return exportedAPIKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/audit"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/internal/webhook"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// testExportStream collects what ExportMyData sends
+type testExportStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	chunks []*httpbody.HttpBody
+}
+
+func (s *testExportStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testExportStream) Send(chunk *httpbody.HttpBody) error {
+	s.chunks = append(s.chunks, chunk)
+	return nil
+}
+
+// exportTestUser exports the data of user and returns the joined document
+func exportTestUser(t *testing.T, server *UserServiceServer, user *domain.User) []byte {
+	ctx, _ := authContext(t, server, "ExportMyData", user)
+	stream := &testExportStream{ctx: ctx}
+	require.NoError(t, server.ExportMyData(&userpb.ExportMyDataRequest{}, stream))
+
+	var document bytes.Buffer
+	for _, chunk := range stream.chunks {
+		require.Equal(t, "application/json", chunk.GetContentType())
+		document.Write(chunk.GetData())
+	}
+	return document.Bytes()
+}
+
+func TestExportMyData(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+
+	login := loginTestUser(t, server, user, "secret")
+	ctx, _ := rpcContext("LoginUser")
+	_, err := server.LoginUser(ctx, &userpb.LoginUserRequest{Email: user.Email, Password: "wrong-password"})
+	requireCode(t, err, codes.NotFound)
+	otherLogin := loginTestUser(t, server, other, "secret")
+
+	document := exportTestUser(t, server, user)
+	var export struct {
+		User        exportedUser          `json:"user"`
+		Sessions    []domain.Session      `json:"sessions"`
+		LoginEvents []domain.LoginEvent   `json:"login_events"`
+		APIKeys     []exportedAPIKey      `json:"api_keys"`
+		Identities  []domain.UserIdentity `json:"identities"`
+		AuditEvents []domain.AuditEvent   `json:"audit_events"`
+	}
+	require.NoError(t, json.Unmarshal(document, &export), string(document))
+
+	require.Equal(t, user.ID, export.User.ID)
+	require.Equal(t, user.Email, export.User.Email)
+	require.Equal(t, user.Name, export.User.Name)
+	require.NotContains(t, string(document), user.HashedPassword)
+
+	// The session of the login and the one the export was called with
+	sessionIDs := make([]string, 0, len(export.Sessions))
+	for _, session := range export.Sessions {
+		require.Equal(t, user.ID, session.UserID)
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+	require.Len(t, sessionIDs, 2)
+	require.Contains(t, sessionIDs, login.GetSessionId())
+	require.NotContains(t, sessionIDs, otherLogin.GetSessionId())
+
+	var succeeded, failed int
+	for _, event := range export.LoginEvents {
+		require.Equal(t, user.Email, event.Email)
+		if event.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	require.Equal(t, 1, succeeded)
+	require.Equal(t, 1, failed)
+
+	actions := make([]string, 0, len(export.AuditEvents))
+	for _, event := range export.AuditEvents {
+		require.NotNil(t, event.UserID)
+		require.Equal(t, user.ID, *event.UserID)
+		actions = append(actions, event.Action)
+	}
+	require.Equal(t, []string{domain.AuditActionUserCreate}, actions)
+
+	require.NotContains(t, string(document), other.Email)
+	require.NotContains(t, string(document), other.Name)
+}
+
+func TestExportMyDataStaleLogin(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	accessToken := sessionToken(t, server, user, time.Minute, token.WithAuthTime(time.Now().Add(-time.Hour)))
+	ctx, _ := rpcContext("ExportMyData", authorizationHeader, authorizationBearer+" "+accessToken)
+	stream := &testExportStream{ctx: ctx}
+	requireCode(t, server.ExportMyData(&userpb.ExportMyDataRequest{}, stream), codes.Unauthenticated)
+	require.Empty(t, stream.chunks)
+}
+
+func TestRequestErasure(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+
+	tests := map[string]struct {
+		caller func(user *domain.User) *domain.User
+		userID func(user *domain.User) string
+		code   codes.Code
+	}{
+		"Self": {
+			caller: func(user *domain.User) *domain.User { return user },
+			userID: func(user *domain.User) string { return "" },
+			code:   codes.OK,
+		},
+		"ByAdmin": {
+			caller: func(user *domain.User) *domain.User { return admin },
+			userID: func(user *domain.User) string { return strconv.Itoa(user.ID) },
+			code:   codes.OK,
+		},
+		"OtherUser": {
+			caller: func(user *domain.User) *domain.User { return other },
+			userID: func(user *domain.User) string { return strconv.Itoa(user.ID) },
+			code:   codes.PermissionDenied,
+		},
+		"UnknownUser": {
+			caller: func(user *domain.User) *domain.User { return admin },
+			userID: func(user *domain.User) string { return "999999" },
+			code:   codes.NotFound,
+		},
+		"InvalidUserID": {
+			caller: func(user *domain.User) *domain.User { return admin },
+			userID: func(user *domain.User) string { return "me" },
+			code:   codes.InvalidArgument,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			user := createTestUser(t, server, domain.StandardRole, "secret")
+			login := loginTestUser(t, server, user, "secret")
+
+			ctx, _ := authContext(t, server, "RequestErasure", test.caller(user))
+			rsp, err := server.RequestErasure(ctx, &userpb.RequestErasureRequest{UserId: test.userID(user)})
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+				unchanged, err := server.UserRepo.GetUserByID(testContext(), user.ID)
+				require.NoError(t, err)
+				require.Equal(t, user.Email, unchanged.Email)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, strconv.Itoa(user.ID), rsp.GetUserId())
+			require.Equal(t, strconv.Itoa(test.caller(user).ID), rsp.GetRequestedBy())
+			require.Equal(t, domain.ErasureStatusCompleted, rsp.GetStatus())
+			require.NotNil(t, rsp.GetCompletedAt())
+
+			erased, err := server.UserRepo.GetUserByID(testContext(), user.ID)
+			require.NoError(t, err)
+			require.Equal(t, domain.ErasedUserName, erased.Name)
+			require.Equal(t, domain.ErasedUserEmail(user.ID), erased.Email)
+			require.False(t, erased.Active)
+
+			// Sessions of erased users are revoked
+			ctx, _ = rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+login.GetAccessToken())
+			_, err = server.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestErasureRequestStatus(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	// A request left pending by a failed erasure is completed by the next one
+	pending, err := server.UserRepo.CreateErasureRequest(testContext(), user.ID, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.ErasureStatusPending, pending.Status)
+
+	ctx, _ := authContext(t, server, "GetErasureRequest", admin)
+	rsp, err := server.GetErasureRequest(ctx, &userpb.GetErasureRequestRequest{ErasureRequestId: strconv.Itoa(pending.ID)})
+	require.NoError(t, err)
+	require.Equal(t, domain.ErasureStatusPending, rsp.GetStatus())
+	require.Nil(t, rsp.GetCompletedAt())
+
+	listStatus := func(status string) []string {
+		ctx, _ := authContext(t, server, "ListErasureRequests", admin)
+		rsp, err := server.ListErasureRequests(ctx, &userpb.ListErasureRequestsRequest{Status: status})
+		require.NoError(t, err)
+		ids := make([]string, 0, len(rsp.GetErasureRequests()))
+		for _, request := range rsp.GetErasureRequests() {
+			ids = append(ids, request.GetErasureRequestId())
+		}
+		return ids
+	}
+	require.Equal(t, []string{strconv.Itoa(pending.ID)}, listStatus(domain.ErasureStatusPending))
+	require.Empty(t, listStatus(domain.ErasureStatusCompleted))
+
+	ctx, _ = authContext(t, server, "RequestErasure", admin)
+	completed, err := server.RequestErasure(ctx, &userpb.RequestErasureRequest{UserId: strconv.Itoa(user.ID)})
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(pending.ID), completed.GetErasureRequestId())
+	require.Equal(t, domain.ErasureStatusCompleted, completed.GetStatus())
+
+	ctx, _ = authContext(t, server, "GetErasureRequest", admin)
+	rsp, err = server.GetErasureRequest(ctx, &userpb.GetErasureRequestRequest{ErasureRequestId: strconv.Itoa(pending.ID)})
+	require.NoError(t, err)
+	require.Equal(t, domain.ErasureStatusCompleted, rsp.GetStatus())
+	require.NotNil(t, rsp.GetCompletedAt())
+	require.Empty(t, listStatus(domain.ErasureStatusPending))
+	require.Equal(t, []string{strconv.Itoa(pending.ID)}, listStatus(domain.ErasureStatusCompleted))
+
+	// Only admins look up erasure requests
+	ctx, _ = authContext(t, server, "ListErasureRequests", admin)
+	_, err = server.ListErasureRequests(ctx, &userpb.ListErasureRequestsRequest{Status: "done"})
+	requireCode(t, err, codes.InvalidArgument)
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+	ctx, _ = authContext(t, server, "GetErasureRequest", other)
+	_, err = server.GetErasureRequest(ctx, &userpb.GetErasureRequestRequest{ErasureRequestId: strconv.Itoa(pending.ID)})
+	requireCode(t, err, codes.Unauthenticated)
+	ctx, _ = authContext(t, server, "GetErasureRequest", admin)
+	_, err = server.GetErasureRequest(ctx, &userpb.GetErasureRequestRequest{ErasureRequestId: "999999"})
+	requireCode(t, err, codes.NotFound)
+}
+
+func TestErasureScrubsPersonalData(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	loginTestUser(t, server, user, "secret")
+
+	// auditContext is authContext with the audit info the interceptor adds
+	auditContext := func(method string, caller *domain.User) context.Context {
+		ctx, _ := authContext(t, server, method, caller)
+		return withAuditInfo(ctx, server.Config.Proxies)
+	}
+
+	// The user leaves traces as actor and as target of changes
+	_, err := server.CreateAPIKey(auditContext("CreateAPIKey", user), &userpb.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{domain.ScopeUsersRead}})
+	require.NoError(t, err)
+	name := "renamed " + user.Name
+	_, err = server.UserRepo.UpdateUser(auditContext("UpdateUser", admin), user.ID, repository.UpdateUserParams{Name: &name})
+	require.NoError(t, err)
+
+	// and the events about it were sent to webhooks already
+	subscription, err := server.UserRepo.CreateWebhookSubscription(testContext(), repository.CreateWebhookSubscriptionParams{
+		URL:        "https://example.com/hook",
+		EventTypes: []string{domain.UserEventCreated, domain.UserEventUpdated},
+		Secret:     "secret",
+	})
+	require.NoError(t, err)
+	published, err := server.UserRepo.ListPendingUserEvents(testContext(), 1000)
+	require.NoError(t, err)
+	publisher := webhook.NewPublisher(server.UserRepo)
+	for _, event := range published {
+		require.NoError(t, publisher.Publish(testContext(), event))
+	}
+
+	_, err = server.RequestErasure(auditContext("RequestErasure", user), &userpb.RequestErasureRequest{})
+	require.NoError(t, err)
+
+	personal := []string{user.Email, user.Name}
+	ctx, _ := authContext(t, server, "ListAuditEvents", admin)
+	rsp, err := server.ListAuditEvents(ctx, &userpb.ListAuditEventsRequest{Limit: maxAuditEventsLimit})
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.GetAuditEvents())
+	for _, event := range rsp.GetAuditEvents() {
+		for _, value := range personal {
+			require.NotContains(t, event.GetActor(), value)
+			require.NotContains(t, event.GetDiff(), value)
+		}
+	}
+
+	// nor do the events other services receive
+	userEvents, err := server.UserRepo.ListPendingUserEvents(testContext(), 1000)
+	require.NoError(t, err)
+	require.NotEmpty(t, userEvents)
+	for _, event := range userEvents {
+		for _, value := range personal {
+			require.NotContains(t, event.User.Name, value)
+			require.NotContains(t, event.User.Email, value)
+		}
+	}
+
+	deliveries, err := server.UserRepo.ListWebhookDeliveries(testContext(), repository.ListWebhookDeliveriesParams{SubscriptionID: subscription.ID, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, deliveries, len(published))
+	for _, delivery := range deliveries {
+		for _, value := range personal {
+			require.NotContains(t, string(delivery.Payload), value)
+		}
+	}
+
+	// and the log still verifies
+	events, err := server.UserRepo.ListAuditEvents(testContext(), repository.ListAuditEventsParams{Limit: maxAuditEventsLimit})
+	require.NoError(t, err)
+	var verifier audit.Verifier
+	for _, event := range events {
+		require.NoError(t, verifier.Verify(event))
+	}
+}
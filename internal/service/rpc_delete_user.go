@@ -40,7 +40,8 @@ func (s *UserServiceServer) DeleteUser(ctx context.Context, req *userpb.DeleteUs
 		attribute.String("Applicant.role", authPayload.Role),
 	)
 
-	violations := validateDeleteUserRequest(req)
+	etag := requestETag(ctx, req.GetEtag())
+	violations := validateDeleteUserRequest(req, etag)
 	if violations != nil {
 		log.Error(ctx, "Validation failed for DeleteUser request", "violations", violations)
 		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
@@ -53,25 +54,32 @@ func (s *UserServiceServer) DeleteUser(ctx context.Context, req *userpb.DeleteUs
 		return nil, status.Errorf(codes.PermissionDenied, "cannot delete other user")
 	}
 
-	err = s.UserRepo.DeleteUserByEmail(ctx, authPayload.Email)
+	// The user named in the request is deleted, which is the caller unless
+	// they're an admin
+	version, _ := parseETag(etag) // It's checked in validation before
+	err = s.UserRepo.DeleteUserByEmail(ctx, req.GetEmail(), version)
 	if err != nil {
-		log.Errorf(ctx, "Failed to delete user with email %s: %v", authPayload.Email, err)
+		log.Errorf(ctx, "Failed to delete user with email %s: %v", req.GetEmail(), err)
 		span.RecordError(err)
-		return nil, status.Errorf(codes.Internal, "failed to delete user: %v", err)
+		return nil, repositoryError(err, "failed to delete user")
 	}
 
 	// Log user deletion without sensitive details
-	log.Infof(ctx, "User deleted successfully: Email=%s", utils.MaskEmail(authPayload.Email))
+	log.Infof(ctx, "User deleted successfully: Email=%s", utils.MaskEmail(req.GetEmail()))
 
 	return &userpb.UpdateUserResponse{
 		Success: true,
 	}, nil
 }
-func validateDeleteUserRequest(req *userpb.DeleteUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+func validateDeleteUserRequest(req *userpb.DeleteUserRequest, etag string) (violations []*errdetails.BadRequest_FieldViolation) {
 
 	if err := domain.ValidateEmail(req.GetEmail()); err != nil {
 		violations = append(violations, fieldViolation("email", err))
 	}
 
+	if _, err := parseETag(etag); err != nil {
+		violations = append(violations, fieldViolation("etag", err))
+	}
+
 	return violations
 }
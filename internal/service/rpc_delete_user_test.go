@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestDeleteUserPermissions(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := map[string]struct {
+		caller string
+		// target is "self", a role, or "unknown" for a user that doesn't exist
+		target string
+		// etag is "current", "stale" or sent as is
+		etag string
+		code codes.Code
+	}{
+		"StandardDeletingSelf":  {caller: domain.StandardRole, target: "self", code: codes.OK},
+		"StandardDeletingOther": {caller: domain.StandardRole, target: domain.StandardRole, code: codes.PermissionDenied},
+		"StandardDeletingAdmin": {caller: domain.StandardRole, target: domain.AdminRole, code: codes.PermissionDenied},
+		"AdminDeletingSelf":     {caller: domain.AdminRole, target: "self", code: codes.OK},
+		"AdminDeletingOther":    {caller: domain.AdminRole, target: domain.StandardRole, code: codes.OK},
+		"AdminDeletingAdmin":    {caller: domain.AdminRole, target: domain.AdminRole, code: codes.OK},
+		"AdminWithETag":         {caller: domain.AdminRole, target: domain.StandardRole, etag: "current", code: codes.OK},
+		// A stale etag leaves the user alone
+		"AdminWithStaleETag":   {caller: domain.AdminRole, target: domain.StandardRole, etag: "stale", code: codes.Aborted},
+		"AdminDeletingUnknown": {caller: domain.AdminRole, target: "unknown", code: codes.NotFound},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			caller := createTestUser(t, server, test.caller, "secret")
+			target := caller
+			switch test.target {
+			case "self":
+			case "unknown":
+				target = &domain.User{Email: "unknown@example.com"}
+			default:
+				target = createTestUser(t, server, test.target, "secret")
+			}
+			etag := test.etag
+			switch etag {
+			case "current":
+				etag = strconv.Quote(userETag(*target))
+			case "stale":
+				etag = strconv.Quote(strconv.Itoa(target.Version + 1))
+			}
+
+			ctx, _ := authContext(t, server, "DeleteUser", caller)
+			_, err := server.DeleteUser(ctx, &userpb.DeleteUserRequest{Email: target.Email, Etag: etag})
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+			} else {
+				require.NoError(t, err)
+			}
+
+			// Only the named user is deleted, never the caller in its place
+			_, err = server.UserRepo.GetUserByEmail(testContext(), target.Email)
+			if test.code == codes.OK || test.target == "unknown" {
+				require.ErrorIs(t, err, domain.ErrNotFound)
+			} else {
+				require.NoError(t, err)
+			}
+			if test.target != "self" {
+				_, err = server.UserRepo.GetUserByEmail(testContext(), caller.Email)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const (
+	defaultDeletedUsersLimit = 50
+	maxDeletedUsersLimit     = 500
+)
+
+// RestoreUser undoes the deletion of a user that wasn't purged yet. Sessions
+// revoked by the deletion stay revoked.
+func (s *UserServiceServer) RestoreUser(ctx context.Context, req *userpb.RestoreUserRequest) (*userpb.UserResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RestoreUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "RestoreUser"),
+		attribute.String("user.id", req.GetUserId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for RestoreUser request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateRestoreUserRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RestoreUser request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	id, _ := strconv.Atoi(req.GetUserId()) // It's checked in validation before
+
+	user, err := s.UserRepo.RestoreUser(ctx, id)
+	if err != nil {
+		log.Errorf(ctx, "Failed to restore user with ID %d: %v", id, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to restore user")
+	}
+
+	log.Infof(ctx, "User restored successfully: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	return ConvertToUserResponse(*user), nil
+}
+
+// ListDeletedUsers lists the deleted users that can still be restored
+func (s *UserServiceServer) ListDeletedUsers(ctx context.Context, req *userpb.ListDeletedUsersRequest) (*userpb.ListDeletedUsersResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListDeletedUsers")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListDeletedUsers"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ListDeletedUsers request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateListDeletedUsersRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ListDeletedUsers request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultDeletedUsersLimit
+	}
+	users, total, err := s.UserRepo.ListDeletedUsers(ctx, repository.ListUsersParams{Offset: int(req.GetOffset()), Limit: limit})
+	if err != nil {
+		log.Errorf(ctx, "Failed to list deleted users: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list deleted users")
+	}
+
+	rsp := &userpb.ListDeletedUsersResponse{Total: int32(total)}
+	for _, user := range users {
+		rsp.Users = append(rsp.Users, ConvertToUserResponse(user).GetUser())
+	}
+	return rsp, nil
+}
+
+// PurgeDeletedUsers hard deletes the users deleted more than
+// Config.DeletedUserRetention ago every Config.UserPurgeInterval, until ctx
+// is done. Their emails can be registered again afterwards.
+func (s *UserServiceServer) PurgeDeletedUsers(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(s.Config.UserPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.UserRepo.PurgeDeletedUsers(ctx, time.Now().Add(-s.Config.DeletedUserRetention))
+		if err != nil && ctx.Err() == nil {
+			log.Errorf(ctx, "Failed to purge deleted users: %v", err)
+		} else if purged > 0 {
+			log.Infof(ctx, "Purged %d deleted users", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func validateRestoreUserRequest(req *userpb.RestoreUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateUserIdString(req.GetUserId()); err != nil {
+		violations = append(violations, fieldViolation("user_id", err))
+	}
+	return violations
+}
+
+func validateListDeletedUsersRequest(req *userpb.ListDeletedUsersRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetLimit() < 0 || req.GetLimit() > maxDeletedUsersLimit {
+		violations = append(violations, fieldViolation("limit", fmt.Errorf("must be between 0 and %d", maxDeletedUsersLimit)))
+	}
+	if req.GetOffset() < 0 {
+		violations = append(violations, fieldViolation("offset", fmt.Errorf("must not be negative")))
+	}
+	return violations
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// deleteTestUser deletes user the way they would delete their own account
+func deleteTestUser(t *testing.T, server *UserServiceServer, user *domain.User) {
+	ctx, _ := authContext(t, server, "DeleteUser", user)
+	_, err := server.DeleteUser(ctx, &userpb.DeleteUserRequest{Email: user.Email})
+	require.NoError(t, err)
+}
+
+func TestRestoreUser(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+
+	tests := map[string]struct {
+		caller *domain.User
+		userID func(user *domain.User) string
+		code   codes.Code
+	}{
+		"ByAdmin": {caller: admin, code: codes.OK},
+		// Only admins restore users
+		"ByStandardUser": {caller: other, code: codes.Unauthenticated},
+		"UnknownUser": {
+			caller: admin,
+			userID: func(user *domain.User) string { return "999999" },
+			code:   codes.NotFound,
+		},
+		"InvalidUserID": {
+			caller: admin,
+			userID: func(user *domain.User) string { return "me" },
+			code:   codes.InvalidArgument,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			user := createTestUser(t, server, domain.StandardRole, "secret")
+			deleteTestUser(t, server, user)
+			userID := strconv.Itoa(user.ID)
+			if test.userID != nil {
+				userID = test.userID(user)
+			}
+
+			ctx, _ := authContext(t, server, "RestoreUser", test.caller)
+			rsp, err := server.RestoreUser(ctx, &userpb.RestoreUserRequest{UserId: userID})
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+				_, err = server.UserRepo.GetUserByID(testContext(), user.ID)
+				require.ErrorIs(t, err, domain.ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, user.Email, rsp.GetUser().GetEmail())
+			require.Nil(t, rsp.GetUser().GetDeletedAt())
+
+			// A restored user signs in with their old password
+			loginTestUser(t, server, user, "secret")
+		})
+	}
+}
+
+func TestTokensOfChangedUsers(t *testing.T) {
+	server := newTestServer(t)
+	active, standardRole := false, domain.StandardRole
+
+	// Tokens are checked against the user as they are now, not as they were
+	// when the token was issued
+	tests := map[string]struct {
+		role   string
+		change func(t *testing.T, user *domain.User)
+	}{
+		"Deleted": {
+			role:   domain.StandardRole,
+			change: func(t *testing.T, user *domain.User) { deleteTestUser(t, server, user) },
+		},
+		"Deactivated": {
+			role: domain.StandardRole,
+			change: func(t *testing.T, user *domain.User) {
+				_, err := server.UserRepo.UpdateUser(testContext(), user.ID, repository.UpdateUserParams{Active: &active})
+				require.NoError(t, err)
+			},
+		},
+		"Demoted": {
+			role: domain.AdminRole,
+			change: func(t *testing.T, user *domain.User) {
+				_, err := server.UserRepo.UpdateUser(testContext(), user.ID, repository.UpdateUserParams{Role: &standardRole})
+				require.NoError(t, err)
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			user := createTestUser(t, server, test.role, "secret")
+			login := loginTestUser(t, server, user, "secret")
+			ctx, _ := rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+login.GetAccessToken())
+			_, err := server.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+			require.NoError(t, err)
+
+			test.change(t, user)
+			_, err = server.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestListDeletedUsers(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	deleted := createTestUser(t, server, domain.StandardRole, "secret")
+	deleteTestUser(t, server, deleted)
+
+	ctx, _ := authContext(t, server, "ListDeletedUsers", admin)
+	rsp, err := server.ListDeletedUsers(ctx, &userpb.ListDeletedUsersRequest{})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, rsp.GetTotal())
+	require.Len(t, rsp.GetUsers(), 1)
+	require.Equal(t, deleted.Email, rsp.GetUsers()[0].GetEmail())
+	require.NotNil(t, rsp.GetUsers()[0].GetDeletedAt())
+
+	ctx, _ = authContext(t, server, "ListDeletedUsers", user)
+	_, err = server.ListDeletedUsers(ctx, &userpb.ListDeletedUsersRequest{})
+	requireCode(t, err, codes.Unauthenticated)
+
+	ctx, _ = authContext(t, server, "ListDeletedUsers", admin)
+	_, err = server.ListDeletedUsers(ctx, &userpb.ListDeletedUsersRequest{Limit: maxDeletedUsersLimit + 1})
+	requireCode(t, err, codes.InvalidArgument)
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	deleteTestUser(t, server, user)
+
+	register := func() error {
+		_, err := server.CreateUser(testContext(), &userpb.CreateUserRequest{
+			Name:     "returning",
+			Email:    user.Email,
+			Password: "correct-horse-battery",
+			Role:     userpb.Role_STANDARD,
+		})
+		return err
+	}
+
+	// The email stays taken while the user can still be restored
+	requireCode(t, register(), codes.AlreadyExists)
+
+	// A cancelled context purges once and returns
+	ctx, cancel := context.WithCancel(testContext())
+	cancel()
+	server.PurgeDeletedUsers(ctx)
+	_, total, err := server.UserRepo.ListDeletedUsers(testContext(), repository.ListUsersParams{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	requireCode(t, register(), codes.AlreadyExists)
+
+	server.Config.DeletedUserRetention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	server.PurgeDeletedUsers(ctx)
+	_, total, err = server.UserRepo.ListDeletedUsers(testContext(), repository.ListUsersParams{Limit: 10})
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	// Once purged, the email can be registered again
+	require.NoError(t, register())
+}
@@ -9,14 +9,12 @@ import (
 	"github.com/fibonachyy/sternx/internal/logger"
 	"github.com/fibonachyy/sternx/pkg/utils"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 func (s *UserServiceServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.UserResponse, error) {
 	log := logger.FromContext(ctx)
 
-	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.ServiceRole})
 	if err != nil {
 		log.Errorf(ctx, "Authorization failed for GetUser request: %v", err)
 		return nil, unauthenticatedError(err)
@@ -35,9 +33,11 @@ func (s *UserServiceServer) GetUser(ctx context.Context, req *userpb.GetUserRequ
 	userData, err := s.UserRepo.GetUserByID(ctx, id)
 	if err != nil {
 		log.Errorf(ctx, "Failed to find user by ID: %d, error: %v", id, err)
-		return nil, status.Errorf(codes.Internal, "failed to find user")
+		return nil, repositoryError(err, "failed to find user")
 	}
 
+	setUserETagHeader(ctx, *userData)
+
 	log.Infof(ctx, "User retrieved successfully: ID=%d, Email=%s, Role=%s", userData.ID, utils.MaskEmail(userData.Email), userData.Role)
 
 	return ConvertToUserResponse(*userData), nil
@@ -2,12 +2,17 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	userpb "github.com/fibonachyy/sternx/internal/api"
 	"github.com/fibonachyy/sternx/internal/domain"
 	"github.com/fibonachyy/sternx/internal/logger"
 	"github.com/fibonachyy/sternx/internal/metrics"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/token"
 	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -40,44 +45,136 @@ func (server *UserServiceServer) LoginUser(ctx context.Context, req *userpb.Logi
 		return nil, invalidArgumentError(violations)
 	}
 
-	user, err := server.UserRepo.GetUserByEmail(ctx, req.GetEmail())
+	user, err := server.checkCredentials(ctx, req.GetEmail(), req.GetPassword())
 	if err != nil {
-		log.Errorf(ctx, "Failed to find user by email: %s, error: %v", utils.MaskEmail(req.GetEmail()), err)
 		span.RecordError(err)
-		return nil, status.Errorf(codes.Internal, "failed to find user")
+		server.recordLogin(ctx, domain.LoginMethodPassword, req.GetEmail(), nil, "", err)
+		return nil, err
 	}
 	span.SetAttributes(
 		attribute.String("user.role", user.Role),
 	)
 
-	err = utils.CheckPassword(req.Password, user.HashedPassword)
+	if server.passwordExpired(user) {
+		log.Warnf(ctx, "Login attempt with expired password of user: %s", utils.MaskEmail(user.Email))
+		server.recordLogin(ctx, domain.LoginMethodPassword, user.Email, user, "", status.Errorf(codes.FailedPrecondition, "password expired"))
+		return &userpb.LoginUserResponse{
+			User:               ConvertToUserResponse(*user).User,
+			MustChangePassword: true,
+		}, nil
+	}
+
+	rsp, err := server.createLoginResponse(ctx, user)
 	if err != nil {
-		log.Errorf(ctx, "Incorrect password for user: %s", utils.MaskEmail(user.Email))
 		span.RecordError(err)
-		return nil, status.Errorf(codes.NotFound, "incorrect password")
+		return nil, err
 	}
+	server.recordLogin(ctx, domain.LoginMethodPassword, user.Email, user, rsp.GetSessionId(), nil)
 
-	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
-		user.Email,
-		user.Role,
-		server.Config.JWTDuration,
-	)
+	loginCounter, _ := meter.Int64Counter("login")
+	loginCounter.Add(ctx, 1)
+	log.Infof(ctx, "User login successful: ID=%d, Email=%s, Role=%s", user.ID, utils.MaskEmail(user.Email), user.Role)
+
+	return rsp, nil
+}
+
+// createLoginResponse starts a session for a signed in user and issues an
+// access token bound to it. Every login flow returns the same response as LoginUser.
+func (server *UserServiceServer) createLoginResponse(ctx context.Context, user *domain.User) (*userpb.LoginUserResponse, error) {
+	log := logger.FromContext(ctx)
+
+	accessToken, accessPayload, err := server.createSessionToken(ctx, user, token.WithAuthTime(time.Now()))
 	if err != nil {
 		log.Errorf(ctx, "Failed to create access token for user: %s, error: %v", utils.MaskEmail(user.Email), err)
-		span.RecordError(err)
 		return nil, status.Errorf(codes.Internal, "failed to create access token")
 	}
 
-	rsp := &userpb.LoginUserResponse{
+	return &userpb.LoginUserResponse{
 		User:                 ConvertToUserResponse(*user).User,
 		AccessToken:          accessToken,
 		AccessTokenExpiresAt: timestamppb.New(accessPayload.ExpiredAt),
+		SessionId:            accessPayload.SessionID,
+	}, nil
+}
+
+// createSessionToken starts a session for user and issues an access token
+// bound to it. Every token issued to a user carries a session, so revoking
+// the session revokes the token.
+func (server *UserServiceServer) createSessionToken(ctx context.Context, user *domain.User, opts ...token.PayloadOption) (string, *token.Payload, error) {
+	sessionID := uuid.NewString()
+	accessToken, payload, err := server.tokenMaker.CreateToken(
+		user.Email,
+		user.Role,
+		server.Config.JWTDuration,
+		append(opts, token.WithSessionID(sessionID))...,
+	)
+	if err != nil {
+		return "", nil, err
 	}
-	loginCounter, _ := meter.Int64Counter("login")
-	loginCounter.Add(ctx, 1)
-	log.Infof(ctx, "User login successful: ID=%d, Email=%s, Role=%s", user.ID, utils.MaskEmail(user.Email), user.Role)
+	if err := server.startSession(ctx, user, sessionID, payload.ExpiredAt); err != nil {
+		return "", nil, err
+	}
+	return accessToken, payload, nil
+}
 
-	return rsp, nil
+// startSession records a session of user on the device the request comes from
+func (server *UserServiceServer) startSession(ctx context.Context, user *domain.User, sessionID string, expiresAt time.Time) error {
+	client := clientInfoFromContext(ctx)
+	_, err := server.UserRepo.CreateSession(ctx, repository.CreateSessionParams{
+		ID:        sessionID,
+		UserID:    user.ID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// checkCredentials verifies an email and password pair. It is shared by
+// LoginUser and every other flow that signs a user in with a password.
+func (server *UserServiceServer) checkCredentials(ctx context.Context, email string, password string) (*domain.User, error) {
+	log := logger.FromContext(ctx)
+
+	user, err := server.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user by email: %s, error: %v", utils.MaskEmail(email), err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	needsRehash, err := server.passwordHasher.Verify(password, user.HashedPassword)
+	if err != nil {
+		log.Errorf(ctx, "Incorrect password for user: %s", utils.MaskEmail(user.Email))
+		return nil, status.Errorf(codes.NotFound, "incorrect password")
+	}
+	if !user.Active {
+		log.Errorf(ctx, "Login attempt of deactivated user: %s", utils.MaskEmail(user.Email))
+		return nil, status.Errorf(codes.PermissionDenied, "user is deactivated")
+	}
+	if needsRehash {
+		server.rehashPassword(ctx, user, password)
+	}
+	return user, nil
+}
+
+// rehashPassword upgrades a hash made by an outdated scheme or cost, now that
+// the password is known. Failing to do so doesn't fail the login.
+func (server *UserServiceServer) rehashPassword(ctx context.Context, user *domain.User, password string) {
+	log := logger.FromContext(ctx)
+
+	hashedPassword, err := server.passwordHasher.Hash(password)
+	if err != nil {
+		log.Warnf(ctx, "Failed to rehash password of user %s: %v", utils.MaskEmail(user.Email), err)
+		return
+	}
+	if err := server.UserRepo.RehashPassword(ctx, user.ID, user.HashedPassword, hashedPassword); err != nil {
+		log.Warnf(ctx, "Failed to store rehashed password of user %s: %v", utils.MaskEmail(user.Email), err)
+		return
+	}
+	user.HashedPassword = hashedPassword
+	log.Infof(ctx, "Password hash upgraded for user: ID=%d", user.ID)
 }
 
 func validateLoginUserRequest(req *userpb.LoginUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/notification"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// magicLinkMaxRequests links can be requested for an email per magicLinkRequestWindow
+	magicLinkMaxRequests   = 3
+	magicLinkRequestWindow = 15 * time.Minute
+	// magicLinkMaxAttempts failed redemptions for an email burn its pending links
+	magicLinkMaxAttempts = 5
+)
+
+// RequestMagicLink sends a single-use login link to the email of a user. It
+// answers the same way for unknown emails and for requests over the rate
+// limit, so it can't be used to discover accounts or to flood an inbox.
+func (server *UserServiceServer) RequestMagicLink(ctx context.Context, req *userpb.RequestMagicLinkRequest) (*userpb.RequestMagicLinkResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RequestMagicLink")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "RequestMagicLink"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	violations := validateRequestMagicLinkRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RequestMagicLink request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	rsp := &userpb.RequestMagicLinkResponse{}
+
+	user, err := server.UserRepo.GetUserByEmail(ctx, req.GetEmail())
+	if err != nil || !user.Active {
+		log.Warnf(ctx, "Magic link requested for unknown or deactivated user: %s", utils.MaskEmail(req.GetEmail()))
+		return rsp, nil
+	}
+
+	count, err := server.UserRepo.CountMagicLinksSince(ctx, user.Email, time.Now().Add(-magicLinkRequestWindow))
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to create magic link")
+	}
+	if count >= magicLinkMaxRequests {
+		log.Warnf(ctx, "Magic link rate limit reached for user: %s", utils.MaskEmail(user.Email))
+		return rsp, nil
+	}
+
+	secret, err := utils.RandomSecret(32)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to create magic link")
+	}
+	link, err := server.UserRepo.CreateMagicLink(ctx, repository.CreateMagicLinkParams{
+		TokenHash: utils.HashSecret(secret),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(server.Config.MagicLinkDuration),
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to create magic link")
+	}
+
+	err = server.Config.NotificationSender.Send(ctx, notification.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Use this link to log in. It works once and expires at %s.\n\n%s\n",
+			link.ExpiresAt.UTC().Format(time.RFC1123), magicLinkURL(server.Config.MagicLinkURL, secret, user.Email)),
+	})
+	if err != nil {
+		log.Errorf(ctx, "Failed to send magic link to user: %s, error: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to send magic link")
+	}
+
+	log.Infof(ctx, "Magic link sent: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	return rsp, nil
+}
+
+// RedeemMagicLink signs a user in with the token of a login link. The token is
+// only accepted together with the email it was sent to, and every failed
+// attempt counts against the pending links of that email.
+func (server *UserServiceServer) RedeemMagicLink(ctx context.Context, req *userpb.RedeemMagicLinkRequest) (*userpb.LoginUserResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RedeemMagicLink")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "RedeemMagicLink"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	violations := validateRedeemMagicLinkRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RedeemMagicLink request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	link, err := server.UserRepo.ConsumeMagicLink(ctx, utils.HashSecret(req.GetToken()), req.GetEmail(), magicLinkMaxAttempts)
+	if err != nil {
+		span.RecordError(err)
+		if err := server.UserRepo.RecordMagicLinkFailure(ctx, req.GetEmail()); err != nil {
+			log.Warnf(ctx, "Failed to record magic link failure for user: %s", utils.MaskEmail(req.GetEmail()))
+		}
+		err = status.Errorf(codes.Unauthenticated, "magic link is invalid or expired")
+		server.recordLogin(ctx, domain.LoginMethodMagicLink, req.GetEmail(), nil, "", err)
+		return nil, err
+	}
+
+	user, err := server.UserRepo.GetUserByID(ctx, link.UserID)
+	if err != nil || !strings.EqualFold(user.Email, link.Email) {
+		return nil, status.Errorf(codes.Unauthenticated, "magic link is invalid or expired")
+	}
+	if !user.Active {
+		log.Errorf(ctx, "Magic link login attempt of deactivated user: %s", utils.MaskEmail(user.Email))
+		err = status.Errorf(codes.PermissionDenied, "user is deactivated")
+		server.recordLogin(ctx, domain.LoginMethodMagicLink, user.Email, user, "", err)
+		return nil, err
+	}
+
+	rsp, err := server.createLoginResponse(ctx, user)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	server.recordLogin(ctx, domain.LoginMethodMagicLink, user.Email, user, rsp.GetSessionId(), nil)
+	log.Infof(ctx, "Magic link login successful: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	return rsp, nil
+}
+
+func magicLinkURL(base string, secret string, email string) string {
+	target, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := target.Query()
+	query.Set("token", secret)
+	query.Set("email", email)
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+func validateRequestMagicLinkRequest(req *userpb.RequestMagicLinkRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateEmail(req.GetEmail()); err != nil {
+		violations = append(violations, fieldViolation("email", err))
+	}
+
+	return violations
+}
+
+func validateRedeemMagicLinkRequest(req *userpb.RedeemMagicLinkRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateEmail(req.GetEmail()); err != nil {
+		violations = append(violations, fieldViolation("email", err))
+	}
+	if req.GetToken() == "" {
+		violations = append(violations, fieldViolation("token", fmt.Errorf("must not be empty")))
+	}
+
+	return violations
+}
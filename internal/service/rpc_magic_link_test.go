@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/notification"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// recordingSender keeps the notifications it is asked to send
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []notification.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg notification.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// sent returns the number of notifications sent so far
+func (s *recordingSender) sent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// magicLinkToken requests a login link for user and returns its token
+func magicLinkToken(t *testing.T, server *UserServiceServer, sender *recordingSender, user *domain.User) string {
+	sent := sender.sent()
+	ctx, _ := rpcContext("RequestMagicLink")
+	_, err := server.RequestMagicLink(ctx, &userpb.RequestMagicLinkRequest{Email: user.Email})
+	require.NoError(t, err)
+	require.Equal(t, sent+1, sender.sent())
+
+	msg := sender.messages[sent]
+	require.Equal(t, user.Email, msg.To)
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	require.NoError(t, err)
+	require.Equal(t, user.Email, link.Query().Get("email"))
+	require.NotEmpty(t, link.Query().Get("token"))
+	return link.Query().Get("token")
+}
+
+func redeemMagicLink(server *UserServiceServer, token string, email string) (*userpb.LoginUserResponse, error) {
+	ctx, _ := rpcContext("RedeemMagicLink")
+	return server.RedeemMagicLink(ctx, &userpb.RedeemMagicLinkRequest{Token: token, Email: email})
+}
+
+func TestRedeemMagicLink(t *testing.T) {
+	server := newTestServer(t)
+	sender := &recordingSender{}
+	server.Config.NotificationSender = sender
+
+	tests := map[string]struct {
+		// redeem redeems the link sent to user and reports the error
+		redeem func(t *testing.T, user *domain.User, other *domain.User, token string) error
+		code   codes.Code
+	}{
+		"Valid": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				rsp, err := redeemMagicLink(server, token, user.Email)
+				if err == nil {
+					require.Equal(t, user.Email, rsp.GetUser().GetEmail())
+					require.NotEmpty(t, rsp.GetAccessToken())
+				}
+				return err
+			},
+			code: codes.OK,
+		},
+		// A leaked token is of no use without the email it was sent to
+		"OtherEmail": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				return ignoreResponse(redeemMagicLink(server, token, other.Email))
+			},
+			code: codes.Unauthenticated,
+		},
+		"Reused": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				require.NoError(t, ignoreResponse(redeemMagicLink(server, token, user.Email)))
+				return ignoreResponse(redeemMagicLink(server, token, user.Email))
+			},
+			code: codes.Unauthenticated,
+		},
+		"WrongToken": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				return ignoreResponse(redeemMagicLink(server, token+"x", user.Email))
+			},
+			code: codes.Unauthenticated,
+		},
+		// Guessing burns the pending links of the email
+		"TooManyAttempts": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				for i := 0; i < magicLinkMaxAttempts; i++ {
+					requireCode(t, ignoreResponse(redeemMagicLink(server, "guess", user.Email)), codes.Unauthenticated)
+				}
+				return ignoreResponse(redeemMagicLink(server, token, user.Email))
+			},
+			code: codes.Unauthenticated,
+		},
+		"MissingToken": {
+			redeem: func(t *testing.T, user *domain.User, other *domain.User, token string) error {
+				return ignoreResponse(redeemMagicLink(server, "", user.Email))
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			user := createTestUser(t, server, domain.StandardRole, "secret")
+			other := createTestUser(t, server, domain.StandardRole, "secret")
+			token := magicLinkToken(t, server, sender, user)
+
+			err := test.redeem(t, user, other, token)
+			if test.code == codes.OK {
+				require.NoError(t, err)
+				return
+			}
+			requireCode(t, err, test.code)
+		})
+	}
+
+	t.Run("Expired", func(t *testing.T) {
+		server.Config.MagicLinkDuration = -time.Second
+		defer func() { server.Config.MagicLinkDuration = DefaultConfig().MagicLinkDuration }()
+
+		user := createTestUser(t, server, domain.StandardRole, "secret")
+		token := magicLinkToken(t, server, sender, user)
+		requireCode(t, ignoreResponse(redeemMagicLink(server, token, user.Email)), codes.Unauthenticated)
+	})
+}
+
+func TestRequestMagicLink(t *testing.T) {
+	server := newTestServer(t)
+	sender := &recordingSender{}
+	server.Config.NotificationSender = sender
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	// Unknown emails get the same answer, but no email
+	ctx, _ := rpcContext("RequestMagicLink")
+	_, err := server.RequestMagicLink(ctx, &userpb.RequestMagicLinkRequest{Email: "nobody@example.com"})
+	require.NoError(t, err)
+	require.Zero(t, sender.sent())
+
+	for i := 0; i < magicLinkMaxRequests; i++ {
+		magicLinkToken(t, server, sender, user)
+	}
+	_, err = server.RequestMagicLink(ctx, &userpb.RequestMagicLinkRequest{Email: user.Email})
+	require.NoError(t, err)
+	require.Equal(t, magicLinkMaxRequests, sender.sent())
+}
+
+// ignoreResponse drops the response of an RPC to keep its error
+func ignoreResponse(_ *userpb.LoginUserResponse, err error) error {
+	return err
+}
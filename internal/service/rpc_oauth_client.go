@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	oauthClientIDTag       = "sxc_"
+	oauthClientIDBytes     = 12
+	oauthClientSecretBytes = 32
+)
+
+func (s *UserServiceServer) CreateOAuthClient(ctx context.Context, req *userpb.CreateOAuthClientRequest) (*userpb.CreateOAuthClientResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/CreateOAuthClient")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "CreateOAuthClient"),
+		attribute.String("oauth_client.name", req.GetName()),
+		attribute.StringSlice("oauth_client.scopes", req.GetScopes()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for CreateOAuthClient request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateCreateOAuthClientRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for CreateOAuthClient request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	clientID, err := utils.RandomSecret(oauthClientIDBytes)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to generate client id: %s", err)
+	}
+	clientID = oauthClientIDTag + clientID
+
+	secret, err := utils.RandomSecret(oauthClientSecretBytes)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Errorf(codes.Internal, "failed to generate client secret: %s", err)
+	}
+
+	client, err := s.UserRepo.CreateOAuthClient(ctx, repository.CreateOAuthClientParams{
+		ClientID:     clientID,
+		Name:         req.GetName(),
+		HashedSecret: utils.HashSecret(secret),
+		Scopes:       req.GetScopes(),
+		RedirectURIs: req.GetRedirectUris(),
+	})
+	if err != nil {
+		log.Errorf(ctx, "Failed to create oauth client: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to create oauth client")
+	}
+
+	log.Infof(ctx, "OAuth client registered successfully: ClientID=%s, Name=%s", client.ClientID, client.Name)
+
+	return &userpb.CreateOAuthClientResponse{
+		Client:       ConvertToOAuthClient(*client),
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *UserServiceServer) ListOAuthClients(ctx context.Context, req *userpb.ListOAuthClientsRequest) (*userpb.ListOAuthClientsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListOAuthClients")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListOAuthClients"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ListOAuthClients request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	clients, err := s.UserRepo.ListOAuthClients(ctx)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list oauth clients: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list oauth clients")
+	}
+
+	rsp := &userpb.ListOAuthClientsResponse{}
+	for _, client := range clients {
+		rsp.Clients = append(rsp.Clients, ConvertToOAuthClient(client))
+	}
+	return rsp, nil
+}
+
+func (s *UserServiceServer) DeleteOAuthClient(ctx context.Context, req *userpb.DeleteOAuthClientRequest) (*userpb.DeleteOAuthClientResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/DeleteOAuthClient")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "DeleteOAuthClient"),
+		attribute.String("oauth_client.client_id", req.GetClientId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for DeleteOAuthClient request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	err = s.UserRepo.DeleteOAuthClient(ctx, req.GetClientId())
+	if err != nil {
+		log.Errorf(ctx, "Failed to delete oauth client %s: %v", req.GetClientId(), err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to delete oauth client")
+	}
+
+	log.Infof(ctx, "OAuth client deleted successfully: ClientID=%s", req.GetClientId())
+
+	return &userpb.DeleteOAuthClientResponse{Success: true}, nil
+}
+
+func ConvertToOAuthClient(client domain.OAuthClient) *userpb.OAuthClient {
+	return &userpb.OAuthClient{
+		ClientId:     client.ClientID,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		CreatedAt:    timestamppb.New(client.CreatedAt),
+		RedirectUris: client.RedirectURIs,
+	}
+}
+
+func validateCreateOAuthClientRequest(req *userpb.CreateOAuthClientRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateString(req.GetName(), 3, 100); err != nil {
+		violations = append(violations, fieldViolation("name", err))
+	}
+
+	if err := domain.ValidateScopes(req.GetScopes()); err != nil {
+		violations = append(violations, fieldViolation("scopes", err))
+	}
+
+	for _, redirectURI := range req.GetRedirectUris() {
+		if err := domain.ValidateRedirectURI(redirectURI); err != nil {
+			violations = append(violations, fieldViolation("redirect_uris", err))
+		}
+	}
+
+	if domain.ContainsScope(req.GetScopes(), domain.ScopeOpenID) && len(req.GetRedirectUris()) == 0 {
+		violations = append(violations, fieldViolation("redirect_uris", fmt.Errorf("at least one redirect uri is required for openid clients")))
+	}
+	return violations
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// Reauthenticate checks the password of the signed in user again and issues a
+// token with a fresh auth_time, for the RPCs listed in methodMaxAuthAge.
+// Impersonated tokens can't call it, since an admin must not learn or need the
+// password of the user they act as.
+func (server *UserServiceServer) Reauthenticate(ctx context.Context, req *userpb.ReauthenticateRequest) (*userpb.LoginUserResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/Reauthenticate")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "Reauthenticate"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := server.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for Reauthenticate request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+	span.SetAttributes(attribute.String("user.email", authPayload.Email))
+
+	violations := validateReauthenticateRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for Reauthenticate request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := server.checkCredentials(ctx, authPayload.Email, req.GetPassword())
+	if err != nil {
+		span.RecordError(err)
+		server.recordLogin(ctx, domain.LoginMethodReauthenticate, authPayload.Email, nil, "", err)
+		return nil, err
+	}
+
+	rsp, err := server.createLoginResponse(ctx, user)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	server.recordLogin(ctx, domain.LoginMethodReauthenticate, user.Email, user, rsp.GetSessionId(), nil)
+
+	// The new session replaces the one the request was made with
+	if authPayload.SessionID != "" {
+		if err := server.UserRepo.RevokeSession(ctx, authPayload.SessionID); err != nil {
+			log.Warnf(ctx, "Failed to revoke replaced session of user %s: %v", utils.MaskEmail(user.Email), err)
+		}
+	}
+	log.Infof(ctx, "User reauthenticated: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	return rsp, nil
+}
+
+func validateReauthenticateRequest(req *userpb.ReauthenticateRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidatePassword(req.GetPassword()); err != nil {
+		violations = append(violations, fieldViolation("password", err))
+	}
+
+	return violations
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaxAuthAge(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	tests := map[string]struct {
+		method   string
+		authTime time.Time
+		stale    bool
+	}{
+		"RecentLogin":      {method: "CreateAPIKey", authTime: time.Now()},
+		"StaleLogin":       {method: "CreateAPIKey", authTime: time.Now().Add(-time.Hour), stale: true},
+		"JustTooOld":       {method: "CreateAdmin", authTime: time.Now().Add(-6 * time.Minute), stale: true},
+		"MissingAuthTime":  {method: "CreateAPIKey", stale: true},
+		"NoMaxAge":         {method: "GetUser", authTime: time.Now().Add(-time.Hour)},
+		"NoMaxAgeNoLogin":  {method: "GetUser"},
+		"LongerMaxAge":     {method: "CreateAPIKey", authTime: time.Now().Add(-10 * time.Minute)},
+		"ShorterMaxAgeOld": {method: "DeleteUser", authTime: time.Now().Add(-10 * time.Minute), stale: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []token.PayloadOption
+			if !test.authTime.IsZero() {
+				opts = append(opts, token.WithAuthTime(test.authTime))
+			}
+			accessToken := sessionToken(t, server, user, time.Hour, opts...)
+
+			ctx, _ := rpcContext(test.method, authorizationHeader, authorizationBearer+" "+accessToken)
+			_, err := server.authorizeUser(ctx, []string{domain.StandardRole})
+			if !test.stale {
+				require.NoError(t, err)
+				return
+			}
+			err = unauthenticatedError(err)
+			requireCode(t, err, codes.Unauthenticated)
+			requireReason(t, err, ReauthenticationRequiredReason)
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	ctx, _ := rpcContext("LoginUser")
+	login, err := server.LoginUser(ctx, &userpb.LoginUserRequest{Email: user.Email, Password: "secret"})
+	require.NoError(t, err)
+	require.NotEmpty(t, login.GetSessionId())
+	impersonated := sessionToken(t, server, user, time.Minute,
+		token.WithAuthTime(time.Now()),
+		token.WithActor(token.Actor{Email: admin.Email, Role: admin.Role}),
+	)
+
+	tests := map[string]struct {
+		accessToken string
+		password    string
+		code        codes.Code
+	}{
+		"WrongPassword": {accessToken: login.GetAccessToken(), password: "wrong-password", code: codes.NotFound},
+		"ShortPassword": {accessToken: login.GetAccessToken(), password: "short", code: codes.InvalidArgument},
+		"NoToken":       {password: "secret", code: codes.Unauthenticated},
+		// The admin doesn't know the password of the user they act as
+		"Impersonated": {accessToken: impersonated, password: "secret", code: codes.PermissionDenied},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var kv []string
+			if test.accessToken != "" {
+				kv = []string{authorizationHeader, authorizationBearer + " " + test.accessToken}
+			}
+			ctx, _ := rpcContext("Reauthenticate", kv...)
+			_, err := server.Reauthenticate(ctx, &userpb.ReauthenticateRequest{Password: test.password})
+			requireCode(t, err, test.code)
+		})
+	}
+
+	stale := sessionToken(t, server, user, time.Minute, token.WithAuthTime(time.Now().Add(-time.Hour)))
+	ctx, _ = rpcContext("CreateAPIKey", authorizationHeader, authorizationBearer+" "+stale)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+
+	ctx, _ = rpcContext("Reauthenticate", authorizationHeader, authorizationBearer+" "+stale)
+	rsp, err := server.Reauthenticate(ctx, &userpb.ReauthenticateRequest{Password: "secret"})
+	require.NoError(t, err)
+	require.NotEqual(t, login.GetSessionId(), rsp.GetSessionId())
+
+	// The new token is fresh, the one it replaces is revoked with its session
+	ctx, _ = rpcContext("CreateAPIKey", authorizationHeader, authorizationBearer+" "+rsp.GetAccessToken())
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.NoError(t, err)
+	ctx, _ = rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+stale)
+	_, err = server.authorizeUser(ctx, []string{domain.StandardRole})
+	require.Error(t, err)
+}
+
+// requireReason checks that err carries an ErrorInfo with reason
+func requireReason(t *testing.T, err error, reason string) {
+	t.Helper()
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			require.Equal(t, reason, info.GetReason())
+			return
+		}
+	}
+	require.Fail(t, "error has no ErrorInfo", "%v", err)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultLoginEventsLimit = 50
+	maxLoginEventsLimit     = 500
+)
+
+func (s *UserServiceServer) ListSessions(ctx context.Context, req *userpb.ListSessionsRequest) (*userpb.ListSessionsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListSessions")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListSessions"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ListSessions request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	user, err := s.historyOwner(ctx, authPayload, req.GetEmail())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	sessions, err := s.UserRepo.ListSessionsByUserID(ctx, user.ID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list sessions: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list sessions")
+	}
+
+	rsp := &userpb.ListSessionsResponse{}
+	for _, session := range sessions {
+		pb := ConvertToSession(session)
+		pb.Current = session.ID == authPayload.SessionID
+		rsp.Sessions = append(rsp.Sessions, pb)
+	}
+	return rsp, nil
+}
+
+// RevokeSession signs a device out. Users can revoke their own sessions and
+// admins the sessions of anyone.
+func (s *UserServiceServer) RevokeSession(ctx context.Context, req *userpb.RevokeSessionRequest) (*userpb.RevokeSessionResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/RevokeSession")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "RevokeSession"),
+		attribute.String("session.id", req.GetSessionId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for RevokeSession request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateRevokeSessionRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for RevokeSession request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	caller, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	session, err := s.UserRepo.GetSession(ctx, req.GetSessionId())
+	if err != nil {
+		log.Errorf(ctx, "Failed to find session: %v", err)
+		return nil, repositoryError(err, "failed to find session")
+	}
+	// Sessions of other users look missing rather than forbidden
+	if session.UserID != caller.ID && authPayload.Role != domain.AdminRole {
+		return nil, status.Errorf(codes.NotFound, "session not found")
+	}
+
+	if err := s.UserRepo.RevokeSession(ctx, session.ID); err != nil {
+		log.Errorf(ctx, "Failed to revoke session %s: %v", session.ID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to revoke session")
+	}
+
+	log.Infof(ctx, "Session revoked successfully: ID=%s, UserID=%d, By=%s", session.ID, session.UserID, utils.MaskEmail(caller.Email))
+
+	return &userpb.RevokeSessionResponse{Success: true}, nil
+}
+
+func (s *UserServiceServer) ListLoginEvents(ctx context.Context, req *userpb.ListLoginEventsRequest) (*userpb.ListLoginEventsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListLoginEvents")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListLoginEvents"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ListLoginEvents request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateListLoginEventsRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ListLoginEvents request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := s.historyOwner(ctx, authPayload, req.GetEmail())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultLoginEventsLimit
+	}
+	events, err := s.UserRepo.ListLoginEventsByUserID(ctx, user.ID, limit)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list login events: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list login events")
+	}
+
+	rsp := &userpb.ListLoginEventsResponse{}
+	for _, event := range events {
+		rsp.LoginEvents = append(rsp.LoginEvents, ConvertToLoginEvent(event))
+	}
+	return rsp, nil
+}
+
+// historyOwner returns the user whose sessions or login history are requested.
+// It defaults to the caller, and only admins may look at other users.
+func (s *UserServiceServer) historyOwner(ctx context.Context, authPayload *token.Payload, email string) (*domain.User, error) {
+	log := logger.FromContext(ctx)
+
+	if email == "" {
+		email = authPayload.Email
+	}
+	if email != authPayload.Email && authPayload.Role != domain.AdminRole {
+		log.Warn(ctx, "Permission denied: cannot list other user's sessions")
+		return nil, status.Errorf(codes.PermissionDenied, "cannot list other user's sessions")
+	}
+
+	user, err := s.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user: %s, error: %v", utils.MaskEmail(email), err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+	return user, nil
+}
+
+func ConvertToSession(session domain.Session) *userpb.Session {
+	return &userpb.Session{
+		SessionId: session.ID,
+		IpAddress: session.IPAddress,
+		UserAgent: session.UserAgent,
+		CreatedAt: timestamppb.New(session.CreatedAt),
+		ExpiresAt: timestamppb.New(session.ExpiresAt),
+	}
+}
+
+func ConvertToLoginEvent(event domain.LoginEvent) *userpb.LoginEvent {
+	return &userpb.LoginEvent{
+		LoginEventId:  fmt.Sprint(event.ID),
+		Email:         event.Email,
+		Method:        event.Method,
+		Success:       event.Success,
+		FailureReason: event.FailureReason,
+		IpAddress:     event.IPAddress,
+		UserAgent:     event.UserAgent,
+		SessionId:     event.SessionID,
+		CreatedAt:     timestamppb.New(event.CreatedAt),
+	}
+}
+
+func validateRevokeSessionRequest(req *userpb.RevokeSessionRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if _, err := uuid.Parse(req.GetSessionId()); err != nil {
+		violations = append(violations, fieldViolation("session_id", fmt.Errorf("must be a valid session id")))
+	}
+	return violations
+}
+
+func validateListLoginEventsRequest(req *userpb.ListLoginEventsRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetEmail() != "" {
+		if err := domain.ValidateEmail(req.GetEmail()); err != nil {
+			violations = append(violations, fieldViolation("email", err))
+		}
+	}
+	if req.GetLimit() < 0 || req.GetLimit() > maxLoginEventsLimit {
+		violations = append(violations, fieldViolation("limit", fmt.Errorf("must be between 0 and %d", maxLoginEventsLimit)))
+	}
+	return violations
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// loginTestUser signs user in with password and returns the new session
+func loginTestUser(t *testing.T, server *UserServiceServer, user *domain.User, password string) *userpb.LoginUserResponse {
+	ctx, _ := rpcContext("LoginUser")
+	rsp, err := server.LoginUser(ctx, &userpb.LoginUserRequest{Email: user.Email, Password: password})
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.GetSessionId())
+	return rsp
+}
+
+func TestRevokeSession(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+	adminLogin := loginTestUser(t, server, admin, "secret")
+	otherLogin := loginTestUser(t, server, other, "secret")
+
+	tests := map[string]struct {
+		caller    *userpb.LoginUserResponse
+		sessionID func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string
+		code      codes.Code
+	}{
+		"OwnOtherSession": {
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string {
+				return phone.GetSessionId()
+			},
+			code: codes.OK,
+		},
+		// Signing out of the current session is allowed too
+		"OwnCurrentSession": {
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string {
+				return laptop.GetSessionId()
+			},
+			code: codes.OK,
+		},
+		"ByAdmin": {
+			caller: adminLogin,
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string {
+				return phone.GetSessionId()
+			},
+			code: codes.OK,
+		},
+		// Sessions of other users look missing rather than forbidden
+		"ByOtherUser": {
+			caller: otherLogin,
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string {
+				return phone.GetSessionId()
+			},
+			code: codes.NotFound,
+		},
+		"UnknownSession": {
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string {
+				return uuid.NewString()
+			},
+			code: codes.NotFound,
+		},
+		"InvalidSessionID": {
+			sessionID: func(laptop *userpb.LoginUserResponse, phone *userpb.LoginUserResponse) string { return "1" },
+			code:      codes.InvalidArgument,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			laptop := loginTestUser(t, server, user, "secret")
+			phone := loginTestUser(t, server, user, "secret")
+			caller := test.caller
+			if caller == nil {
+				caller = laptop
+			}
+			sessionID := test.sessionID(laptop, phone)
+
+			ctx, _ := rpcContext("RevokeSession", authorizationHeader, authorizationBearer+" "+caller.GetAccessToken())
+			_, err := server.RevokeSession(ctx, &userpb.RevokeSessionRequest{SessionId: sessionID})
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+				return
+			}
+			require.NoError(t, err)
+
+			// The token of the revoked session stops working at once, the
+			// other session of the user is untouched
+			for _, login := range []*userpb.LoginUserResponse{laptop, phone} {
+				ctx, _ := rpcContext("GetUser", authorizationHeader, authorizationBearer+" "+login.GetAccessToken())
+				_, err := server.authorizeUser(ctx, []string{domain.StandardRole})
+				if login.GetSessionId() == sessionID {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+				}
+			}
+		})
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	other := createTestUser(t, server, domain.StandardRole, "secret")
+	laptop := loginTestUser(t, server, user, "secret")
+	phone := loginTestUser(t, server, user, "secret")
+
+	ctx, _ := rpcContext("ListSessions", authorizationHeader, authorizationBearer+" "+laptop.GetAccessToken())
+	rsp, err := server.ListSessions(ctx, &userpb.ListSessionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, rsp.GetSessions(), 2)
+	for _, session := range rsp.GetSessions() {
+		require.Contains(t, []string{laptop.GetSessionId(), phone.GetSessionId()}, session.GetSessionId())
+		require.Equal(t, session.GetSessionId() == laptop.GetSessionId(), session.GetCurrent())
+	}
+
+	// Only admins see the sessions of other users
+	_, err = server.ListSessions(ctx, &userpb.ListSessionsRequest{Email: other.Email})
+	requireCode(t, err, codes.PermissionDenied)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 
 	userpb "github.com/fibonachyy/sternx/internal/api"
 	"github.com/fibonachyy/sternx/internal/domain"
@@ -39,25 +40,38 @@ func (s *UserServiceServer) UpdateUser(ctx context.Context, req *userpb.UpdateUs
 		attribute.String("Applicant.role", authPayload.Role),
 	)
 
-	violations := validateUpdateUserRequest(req)
+	etag := requestETag(ctx, req.GetEtag())
+	violations := validateUpdateUserRequest(req, etag)
 	if violations != nil {
 		log.Errorf(ctx, "Validation failed for UpdateUser request: %v", violations)
 		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
 		return nil, invalidArgumentError(violations)
 	}
 
-	if authPayload.Email != req.GetEmail() || authPayload.Role == domain.AdminRole {
-		log.Warn(ctx, "Permission denied: cannot update other user's info")
-		err = status.Errorf(codes.PermissionDenied, "cannot update other user's info")
-		span.RecordError(err)
-		return nil, err
+	// A user with another etag was changed since the caller read it, and
+	// updating it would overwrite that change
+	version, _ := parseETag(etag) // It's checked in validation before
+	if authPayload.Email != req.GetEmail() {
+		if authPayload.Role != domain.AdminRole {
+			log.Warn(ctx, "Permission denied: cannot update other user's info")
+			err = status.Errorf(codes.PermissionDenied, "cannot update other user's info")
+			span.RecordError(err)
+			return nil, err
+		}
+		// Other admins may be editing the same user
+		if version == 0 {
+			violations = append(violations, fieldViolation("etag", fmt.Errorf("etag is required to update another user")))
+			log.Errorf(ctx, "Validation failed for UpdateUser request: %v", violations)
+			span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+			return nil, invalidArgumentError(violations)
+		}
 	}
 
-	updatedUser, err := s.UserRepo.PartialUpdateUserByEmail(ctx, req.GetEmail(), domain.User{Name: req.GetName()})
+	updatedUser, err := s.UserRepo.PartialUpdateUserByEmail(ctx, req.GetEmail(), domain.User{Name: req.GetName(), Version: version})
 	if err != nil {
 		log.Errorf(ctx, "Failed to update user info: %v", err)
 		span.RecordError(err)
-		return nil, status.Errorf(codes.Internal, "failed to update user info")
+		return nil, repositoryError(err, "failed to update user info")
 	}
 	span.SetAttributes(
 		attribute.String("user.prevName", req.GetName()),
@@ -65,13 +79,14 @@ func (s *UserServiceServer) UpdateUser(ctx context.Context, req *userpb.UpdateUs
 	)
 
 	res := ConvertToUserResponse(*updatedUser)
+	setUserETagHeader(ctx, *updatedUser)
 
 	log.Infof(ctx, "User info updated successfully: ID=%d, Email=%s, Role=%s", updatedUser.ID, utils.MaskEmail(updatedUser.Email), updatedUser.Role)
 
 	return res, nil
 }
 
-func validateUpdateUserRequest(req *userpb.UpdateUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+func validateUpdateUserRequest(req *userpb.UpdateUserRequest, etag string) (violations []*errdetails.BadRequest_FieldViolation) {
 	if err := domain.ValidateName(req.GetName()); err != nil {
 		violations = append(violations, fieldViolation("name", err))
 	}
@@ -80,5 +95,9 @@ func validateUpdateUserRequest(req *userpb.UpdateUserRequest) (violations []*err
 		violations = append(violations, fieldViolation("email", err))
 	}
 
+	if _, err := parseETag(etag); err != nil {
+		violations = append(violations, fieldViolation("etag", err))
+	}
+
 	return violations
 }
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestUpdateUserETag(t *testing.T) {
+	server := newTestServer(t)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	etag := strconv.Quote(userETag(*user))
+
+	update := func(name string, etag string) (*userpb.UserResponse, *testTransportStream, error) {
+		ctx, stream := authContext(t, server, "UpdateUser", user)
+		rsp, err := server.UpdateUser(ctx, &userpb.UpdateUserRequest{Email: &user.Email, Name: &name, Etag: etag})
+		return rsp, stream, err
+	}
+
+	// Two clients read the user, the second update is based on a stale etag
+	rsp, stream, err := update("First", etag)
+	require.NoError(t, err)
+	require.Equal(t, "First", rsp.GetUser().GetName())
+	require.NotEqual(t, strconv.Quote(rsp.GetUser().GetEtag()), etag)
+	require.Equal(t, []string{strconv.Quote(rsp.GetUser().GetEtag())}, stream.header.Get(etagHeader))
+
+	_, _, err = update("Second", etag)
+	requireCode(t, err, codes.Aborted)
+
+	// The gateway answers with 412 Precondition Failed
+	w := httptest.NewRecorder()
+	GatewayErrorHandler(testContext(), nil, &runtime.JSONPb{}, w, httptest.NewRequest(http.MethodPut, "/v1/users", nil), err)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	require.Contains(t, w.Body.String(), EtagMismatchReason)
+
+	// The If-Match header works like the etag of the request
+	ctx, _ := authContext(t, server, "UpdateUser", user)
+	ctx = withIncomingMetadata(ctx, ifMatchHeader, etag)
+	second := "Second"
+	_, err = server.UpdateUser(ctx, &userpb.UpdateUserRequest{Email: &user.Email, Name: &second})
+	requireCode(t, err, codes.Aborted)
+
+	stored, err := server.UserRepo.GetUserByEmail(testContext(), user.Email)
+	require.NoError(t, err)
+	require.Equal(t, "First", stored.Name)
+
+	// Only strong etags of a version are accepted, and without one or with
+	// "*" the update is unconditional
+	for _, invalid := range []string{"W/" + etag, `"latest"`, `"0"`} {
+		_, _, err = update("Second", invalid)
+		requireCode(t, err, codes.InvalidArgument)
+	}
+	for _, unconditional := range []string{"", "*"} {
+		_, _, err = update("Second", unconditional)
+		require.NoError(t, err)
+	}
+}
+
+func TestUpdateUserPermissions(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := map[string]struct {
+		caller string
+		// target is "self", a role, or "unknown" for a user that doesn't exist
+		target string
+		// etag is "current", "stale" or sent as is
+		etag string
+		code codes.Code
+	}{
+		"StandardUpdatingSelf":         {caller: domain.StandardRole, target: "self", code: codes.OK},
+		"StandardUpdatingSelfWithETag": {caller: domain.StandardRole, target: "self", etag: "current", code: codes.OK},
+		"StandardUpdatingOther":        {caller: domain.StandardRole, target: domain.StandardRole, etag: "current", code: codes.PermissionDenied},
+		"StandardUpdatingAdmin":        {caller: domain.StandardRole, target: domain.AdminRole, etag: "current", code: codes.PermissionDenied},
+		"AdminUpdatingSelf":            {caller: domain.AdminRole, target: "self", code: codes.OK},
+		"AdminUpdatingOther":           {caller: domain.AdminRole, target: domain.StandardRole, etag: "current", code: codes.OK},
+		"AdminUpdatingAdmin":           {caller: domain.AdminRole, target: domain.AdminRole, etag: "current", code: codes.OK},
+		// Other admins may be editing the same user, so admins must say
+		// which version they are changing
+		"AdminWithoutETag":     {caller: domain.AdminRole, target: domain.StandardRole, code: codes.InvalidArgument},
+		"AdminWithAnyETag":     {caller: domain.AdminRole, target: domain.StandardRole, etag: "*", code: codes.InvalidArgument},
+		"AdminWithStaleETag":   {caller: domain.AdminRole, target: domain.StandardRole, etag: "stale", code: codes.Aborted},
+		"AdminUpdatingUnknown": {caller: domain.AdminRole, target: "unknown", etag: `"1"`, code: codes.NotFound},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			caller := createTestUser(t, server, test.caller, "secret")
+			target := caller
+			switch test.target {
+			case "self":
+			case "unknown":
+				target = &domain.User{Email: "unknown@example.com", Version: 1}
+			default:
+				target = createTestUser(t, server, test.target, "secret")
+			}
+			etag := test.etag
+			switch etag {
+			case "current":
+				etag = strconv.Quote(userETag(*target))
+			case "stale":
+				etag = strconv.Quote(strconv.Itoa(target.Version + 1))
+			}
+
+			ctx, _ := authContext(t, server, "UpdateUser", caller)
+			name := "Renamed"
+			rsp, err := server.UpdateUser(ctx, &userpb.UpdateUserRequest{Email: &target.Email, Name: &name, Etag: etag})
+			if test.code != codes.OK {
+				requireCode(t, err, test.code)
+				if test.target != "unknown" {
+					// The target is left as it was
+					stored, err := server.UserRepo.GetUserByEmail(testContext(), target.Email)
+					require.NoError(t, err)
+					require.Equal(t, target.Name, stored.Name)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, target.Email, rsp.GetUser().GetEmail())
+			require.Equal(t, "Renamed", rsp.GetUser().GetName())
+		})
+	}
+}
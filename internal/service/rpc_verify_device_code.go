@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// VerifyDeviceCode lets a signed in user approve or deny the user code shown
+// by a device. Scoped credentials can't call it, so an API key can never sign
+// a device in with more access than the key itself has.
+func (s *UserServiceServer) VerifyDeviceCode(ctx context.Context, req *userpb.VerifyDeviceCodeRequest) (*userpb.VerifyDeviceCodeResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/VerifyDeviceCode")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "VerifyDeviceCode"),
+		attribute.Bool("device_authorization.approve", req.GetApprove()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole, domain.StandardRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for VerifyDeviceCode request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateVerifyDeviceCodeRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for VerifyDeviceCode request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := s.UserRepo.GetUserByEmail(ctx, authPayload.Email)
+	if err != nil {
+		log.Errorf(ctx, "Failed to find user: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to find user")
+	}
+
+	result := domain.DeviceAuthorizationDenied
+	if req.GetApprove() {
+		result = domain.DeviceAuthorizationApproved
+	}
+
+	authorization, err := s.UserRepo.CompleteDeviceAuthorization(ctx, domain.NormalizeUserCode(req.GetUserCode()), user.ID, result)
+	if err != nil {
+		log.Warnf(ctx, "Failed to verify device code for user %s: %v", utils.MaskEmail(user.Email), err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "user code is invalid or expired")
+	}
+
+	rsp := &userpb.VerifyDeviceCodeResponse{
+		ClientId: authorization.ClientID,
+		Scopes:   authorization.Scopes,
+		Approved: req.GetApprove(),
+	}
+	if client, err := s.UserRepo.GetOAuthClientByClientID(ctx, authorization.ClientID); err == nil {
+		rsp.ClientName = client.Name
+	}
+
+	log.Infof(ctx, "Device code verified: ClientID=%s, UserID=%d, Approved=%t", authorization.ClientID, user.ID, req.GetApprove())
+
+	return rsp, nil
+}
+
+func validateVerifyDeviceCodeRequest(req *userpb.VerifyDeviceCodeRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if len(domain.NormalizeUserCode(req.GetUserCode())) != userCodeLength {
+		violations = append(violations, fieldViolation("user_code", fmt.Errorf("must be %d letters, e.g. BCDF-GHJK", userCodeLength)))
+	}
+	return violations
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchUsersBatchSize is how many events WatchUsers reads from the outbox at once
+const watchUsersBatchSize = 100
+
+// WatchUsers streams the changes of users as they are written to the outbox.
+// The outbox is shared by all replicas, so every stream sees every change,
+// whichever replica made it.
+func (s *UserServiceServer) WatchUsers(req *userpb.WatchUsersRequest, stream userpb.UserService_WatchUsersServer) error {
+	ctx := stream.Context()
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/WatchUsers")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "WatchUsers"),
+		attribute.String("watch.resume_token", req.GetResumeToken()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	authPayload, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for WatchUsers request: %v", err)
+		span.RecordError(err)
+		return unauthenticatedError(err)
+	}
+
+	violations := validateWatchUsersRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for WatchUsers request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return invalidArgumentError(violations)
+	}
+	filter := newUserEventFilter(req)
+
+	cursor, err := s.watchCursor(ctx, req.GetResumeToken())
+	if err != nil {
+		log.Errorf(ctx, "Failed to start watching users: %v", err)
+		span.RecordError(err)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return repositoryError(err, "failed to watch users")
+	}
+
+	// The stream ends with the token it was opened with, clients reconnect
+	// with a new one and the resume token of the last event they got
+	expiry := time.NewTimer(time.Until(authPayload.ExpiredAt))
+	defer expiry.Stop()
+	ticker := time.NewTicker(s.Config.WatchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		events, err := s.UserRepo.ListUserEvents(ctx, cursor, watchUsersBatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			log.Errorf(ctx, "Failed to list user events: %v", err)
+			span.RecordError(err)
+			return repositoryError(err, "failed to watch users")
+		}
+		for _, event := range events {
+			cursor = event.ID
+			if !filter.matches(event) {
+				continue
+			}
+			if err := stream.Send(ConvertToUserChangeEvent(event)); err != nil {
+				return err
+			}
+		}
+		if len(events) == watchUsersBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-expiry.C:
+			return status.Error(codes.Unauthenticated, "access token expired, watch again with a new one")
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchCursor returns the ID of the event a stream starts after: the event
+// of the resume token, or the newest event when there is none
+func (s *UserServiceServer) watchCursor(ctx context.Context, resumeToken string) (int, error) {
+	if resumeToken == "" {
+		return s.UserRepo.LastUserEventID(ctx)
+	}
+
+	// The token is checked in validation before
+	eventID, _ := strconv.Atoi(resumeToken)
+	events, err := s.UserRepo.ListUserEvents(ctx, eventID-1, 1)
+	if err != nil {
+		return 0, err
+	}
+	// Events are deleted a while after they were published, and the changes
+	// after a deleted one can't all be sent anymore
+	if len(events) == 0 || events[0].ID != eventID {
+		return 0, status.Error(codes.OutOfRange, "resume token expired, watch again without it")
+	}
+	return eventID, nil
+}
+
+// userEventFilter decides which events a WatchUsers stream gets
+type userEventFilter struct {
+	roles   map[string]bool
+	userIDs map[int]bool
+}
+
+// newUserEventFilter builds the filter of a validated request
+func newUserEventFilter(req *userpb.WatchUsersRequest) userEventFilter {
+	var filter userEventFilter
+	if len(req.GetRoles()) > 0 {
+		filter.roles = make(map[string]bool)
+		for _, role := range req.GetRoles() {
+			filter.roles[roleToString(role)] = true
+		}
+	}
+	if len(req.GetUserIds()) > 0 {
+		filter.userIDs = make(map[int]bool)
+		for _, userID := range req.GetUserIds() {
+			id, _ := strconv.Atoi(userID)
+			filter.userIDs[id] = true
+		}
+	}
+	return filter
+}
+
+// matches reports whether the user of event passes the filter. Roles are
+// compared with the role after the change.
+func (f userEventFilter) matches(event domain.UserEvent) bool {
+	if f.roles != nil && !f.roles[event.User.Role] {
+		return false
+	}
+	if f.userIDs != nil && !f.userIDs[event.UserID] {
+		return false
+	}
+	return true
+}
+
+func roleToString(role userpb.Role) string {
+	if role == userpb.Role_ADMIN {
+		return domain.AdminRole
+	}
+	return domain.StandardRole
+}
+
+func ConvertToUserChangeEvent(event domain.UserEvent) *userpb.UserChangeEvent {
+	user := &userpb.User{
+		UserId:    fmt.Sprint(event.User.ID),
+		Name:      event.User.Name,
+		Email:     event.User.Email,
+		Role:      domain.StringToRole(event.User.Role),
+		CreatedAt: timestamppb.New(event.User.CreatedAt),
+		Etag:      strconv.Itoa(event.User.Version),
+	}
+	if event.User.DeletedAt != nil {
+		user.DeletedAt = timestamppb.New(*event.User.DeletedAt)
+	}
+	return &userpb.UserChangeEvent{
+		ResumeToken: fmt.Sprint(event.ID),
+		Type:        event.Type,
+		User:        user,
+		OccurredAt:  timestamppb.New(event.OccurredAt),
+		RequestId:   event.RequestID,
+	}
+}
+
+func validateWatchUsersRequest(req *userpb.WatchUsersRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetResumeToken() != "" {
+		if err := domain.ValidateIdString(req.GetResumeToken()); err != nil {
+			violations = append(violations, fieldViolation("resume_token", fmt.Errorf("invalid resume token")))
+		}
+	}
+	for _, role := range req.GetRoles() {
+		if role != userpb.Role_ADMIN && role != userpb.Role_STANDARD {
+			violations = append(violations, fieldViolation("roles", fmt.Errorf("invalid role")))
+		}
+	}
+	for _, userID := range req.GetUserIds() {
+		if err := domain.ValidateUserIdString(userID); err != nil {
+			violations = append(violations, fieldViolation("user_ids", err))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// testWatchStream collects what WatchUsers sends, and ends the stream once it
+// got want events
+type testWatchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	want   int
+	onSend func(event *userpb.UserChangeEvent)
+	events []*userpb.UserChangeEvent
+}
+
+func (s *testWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testWatchStream) Send(event *userpb.UserChangeEvent) error {
+	s.events = append(s.events, event)
+	if s.onSend != nil {
+		s.onSend(event)
+	}
+	if len(s.events) >= s.want {
+		s.cancel()
+	}
+	return nil
+}
+
+func TestWatchUsers(t *testing.T) {
+	server := newTestServer(t)
+	server.Config.WatchPollInterval = 10 * time.Millisecond
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+
+	// watch streams the changes for req until it got want events
+	watch := func(t *testing.T, caller *domain.User, req *userpb.WatchUsersRequest, want int, onSend func(event *userpb.UserChangeEvent)) ([]*userpb.UserChangeEvent, error) {
+		ctx, _ := authContext(t, server, "WatchUsers", caller)
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		stream := &testWatchStream{ctx: ctx, cancel: cancel, want: want, onSend: onSend}
+		err := server.WatchUsers(req, stream)
+		return stream.events, err
+	}
+	// changes returns the type and user ID of events
+	changes := func(events []*userpb.UserChangeEvent) []string {
+		var changes []string
+		for _, event := range events {
+			changes = append(changes, event.GetType()+" "+event.GetUser().GetUserId())
+		}
+		return changes
+	}
+
+	start, err := server.UserRepo.LastUserEventID(testContext())
+	require.NoError(t, err)
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	name := "renamed"
+	_, err = server.UserRepo.UpdateUser(testContext(), admin.ID, repository.UpdateUserParams{Name: &name})
+	require.NoError(t, err)
+	require.NoError(t, server.UserRepo.DeleteUserByEmail(testContext(), user.Email, 0))
+	userID, adminID := strconv.Itoa(user.ID), strconv.Itoa(admin.ID)
+
+	t.Run("Resume", func(t *testing.T) {
+		events, err := watch(t, admin, &userpb.WatchUsersRequest{ResumeToken: strconv.Itoa(start)}, 3, nil)
+		requireCode(t, err, codes.Canceled)
+		require.Equal(t, []string{
+			domain.UserEventCreated + " " + userID,
+			domain.UserEventUpdated + " " + adminID,
+			domain.UserEventDeleted + " " + userID,
+		}, changes(events))
+		require.Equal(t, "renamed", events[1].GetUser().GetName())
+		require.NotNil(t, events[2].GetUser().GetDeletedAt())
+
+		// Resuming after an event skips it and the ones before
+		events, err = watch(t, admin, &userpb.WatchUsersRequest{ResumeToken: events[0].GetResumeToken()}, 2, nil)
+		requireCode(t, err, codes.Canceled)
+		require.Equal(t, []string{domain.UserEventUpdated + " " + adminID, domain.UserEventDeleted + " " + userID}, changes(events))
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		tests := map[string]struct {
+			req     *userpb.WatchUsersRequest
+			changes []string
+		}{
+			"Admins": {
+				req:     &userpb.WatchUsersRequest{Roles: []userpb.Role{userpb.Role_ADMIN}},
+				changes: []string{domain.UserEventUpdated + " " + adminID},
+			},
+			"StandardUsers": {
+				req:     &userpb.WatchUsersRequest{Roles: []userpb.Role{userpb.Role_STANDARD}},
+				changes: []string{domain.UserEventCreated + " " + userID, domain.UserEventDeleted + " " + userID},
+			},
+			"UserIDs": {
+				req:     &userpb.WatchUsersRequest{UserIds: []string{adminID}},
+				changes: []string{domain.UserEventUpdated + " " + adminID},
+			},
+			"RolesAndUserIDs": {
+				req:     &userpb.WatchUsersRequest{Roles: []userpb.Role{userpb.Role_STANDARD}, UserIds: []string{userID, adminID}},
+				changes: []string{domain.UserEventCreated + " " + userID, domain.UserEventDeleted + " " + userID},
+			},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				test.req.ResumeToken = strconv.Itoa(start)
+				events, err := watch(t, admin, test.req, len(test.changes), nil)
+				requireCode(t, err, codes.Canceled)
+				require.Equal(t, test.changes, changes(events))
+			})
+		}
+	})
+
+	t.Run("Live", func(t *testing.T) {
+		// Changes made while the stream is open reach it on the next poll
+		var created *domain.User
+		events, err := watch(t, admin, &userpb.WatchUsersRequest{ResumeToken: strconv.Itoa(start)}, 4, func(event *userpb.UserChangeEvent) {
+			if created == nil {
+				created = createTestUser(t, server, domain.StandardRole, "secret")
+			}
+		})
+		requireCode(t, err, codes.Canceled)
+		require.Len(t, events, 4)
+		require.Equal(t, domain.UserEventCreated+" "+strconv.Itoa(created.ID), changes(events)[3])
+	})
+
+	t.Run("ExpiredResumeToken", func(t *testing.T) {
+		// Published events are deleted after a while, and so is the event
+		// of the token
+		ctx := testContext()
+		pending, err := server.UserRepo.ListPendingUserEvents(ctx, 1000)
+		require.NoError(t, err)
+		publishedAt := time.Now().Add(-time.Hour)
+		for _, event := range pending {
+			if event.ID <= start {
+				require.NoError(t, server.UserRepo.MarkUserEventPublished(ctx, event.ID, publishedAt))
+			}
+		}
+		_, err = server.UserRepo.DeletePublishedUserEvents(ctx, time.Now())
+		require.NoError(t, err)
+
+		_, err = watch(t, admin, &userpb.WatchUsersRequest{ResumeToken: strconv.Itoa(start)}, 1, nil)
+		requireCode(t, err, codes.OutOfRange)
+		// as is a token of no event
+		_, err = watch(t, admin, &userpb.WatchUsersRequest{ResumeToken: strconv.Itoa(start + 1000)}, 1, nil)
+		requireCode(t, err, codes.OutOfRange)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		standard := createTestUser(t, server, domain.StandardRole, "secret")
+		tests := map[string]struct {
+			caller *domain.User
+			req    *userpb.WatchUsersRequest
+			code   codes.Code
+		}{
+			// Only admins watch users
+			"StandardUser":       {caller: standard, req: &userpb.WatchUsersRequest{}, code: codes.Unauthenticated},
+			"InvalidResumeToken": {caller: admin, req: &userpb.WatchUsersRequest{ResumeToken: "latest"}, code: codes.InvalidArgument},
+			"InvalidRole":        {caller: admin, req: &userpb.WatchUsersRequest{Roles: []userpb.Role{userpb.Role(42)}}, code: codes.InvalidArgument},
+			"InvalidUserID":      {caller: admin, req: &userpb.WatchUsersRequest{UserIds: []string{"me"}}, code: codes.InvalidArgument},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := watch(t, test.caller, test.req, 1, nil)
+				requireCode(t, err, test.code)
+			})
+		}
+	})
+}
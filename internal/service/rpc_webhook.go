@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	webhookSecretTag   = "whsec_"
+	webhookSecretBytes = 32
+
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 500
+)
+
+func (s *UserServiceServer) CreateWebhookSubscription(ctx context.Context, req *userpb.CreateWebhookSubscriptionRequest) (*userpb.CreateWebhookSubscriptionResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/CreateWebhookSubscription")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "CreateWebhookSubscription"),
+		attribute.String("webhook_subscription.url", req.GetUrl()),
+		attribute.StringSlice("webhook_subscription.event_types", req.GetEventTypes()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for CreateWebhookSubscription request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateCreateWebhookSubscriptionRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for CreateWebhookSubscription request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	// Unlike other secrets this one is stored as is, since deliveries are
+	// signed with it
+	secret := req.GetSecret()
+	if secret == "" {
+		secret, err = utils.RandomSecret(webhookSecretBytes)
+		if err != nil {
+			span.RecordError(err)
+			return nil, status.Errorf(codes.Internal, "failed to generate webhook secret: %s", err)
+		}
+		secret = webhookSecretTag + secret
+	}
+
+	subscription, err := s.UserRepo.CreateWebhookSubscription(ctx, repository.CreateWebhookSubscriptionParams{
+		URL:        req.GetUrl(),
+		EventTypes: req.GetEventTypes(),
+		Secret:     secret,
+	})
+	if err != nil {
+		log.Errorf(ctx, "Failed to create webhook subscription: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to create webhook subscription")
+	}
+
+	log.Infof(ctx, "Webhook subscription created successfully: ID=%d, URL=%s", subscription.ID, subscription.URL)
+
+	return &userpb.CreateWebhookSubscriptionResponse{
+		WebhookSubscription: ConvertToWebhookSubscription(*subscription),
+		Secret:              secret,
+	}, nil
+}
+
+func (s *UserServiceServer) ListWebhookSubscriptions(ctx context.Context, req *userpb.ListWebhookSubscriptionsRequest) (*userpb.ListWebhookSubscriptionsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListWebhookSubscriptions")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListWebhookSubscriptions"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for ListWebhookSubscriptions request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	subscriptions, err := s.UserRepo.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list webhook subscriptions: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list webhook subscriptions")
+	}
+
+	rsp := &userpb.ListWebhookSubscriptionsResponse{}
+	for _, subscription := range subscriptions {
+		rsp.WebhookSubscriptions = append(rsp.WebhookSubscriptions, ConvertToWebhookSubscription(subscription))
+	}
+	return rsp, nil
+}
+
+func (s *UserServiceServer) DeleteWebhookSubscription(ctx context.Context, req *userpb.DeleteWebhookSubscriptionRequest) (*userpb.DeleteWebhookSubscriptionResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/DeleteWebhookSubscription")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "DeleteWebhookSubscription"),
+		attribute.String("webhook_subscription.id", req.GetWebhookSubscriptionId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	_, err := s.authorizeUser(ctx, []string{domain.AdminRole})
+	if err != nil {
+		log.Errorf(ctx, "Authorization failed for DeleteWebhookSubscription request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	if err := domain.ValidateIdString(req.GetWebhookSubscriptionId()); err != nil {
+		violations := []*errdetails.BadRequest_FieldViolation{fieldViolation("webhook_subscription_id", err)}
+		log.Error(ctx, "Validation failed for DeleteWebhookSubscription request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+	subscriptionID, _ := strconv.Atoi(req.GetWebhookSubscriptionId())
+
+	// The deliveries of the subscription are deleted with it
+	err = s.UserRepo.DeleteWebhookSubscription(ctx, subscriptionID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to delete webhook subscription %d: %v", subscriptionID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to delete webhook subscription")
+	}
+
+	log.Infof(ctx, "Webhook subscription deleted successfully: ID=%d", subscriptionID)
+
+	return &userpb.DeleteWebhookSubscriptionResponse{Success: true}, nil
+}
+
+// ListWebhookDeliveries pages through the webhook deliveries, oldest first
+func (s *UserServiceServer) ListWebhookDeliveries(ctx context.Context, req *userpb.ListWebhookDeliveriesRequest) (*userpb.ListWebhookDeliveriesResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListWebhookDeliveries")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("service.method.name", "ListWebhookDeliveries"))
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ListWebhookDeliveries request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	violations := validateListWebhookDeliveriesRequest(req)
+	if violations != nil {
+		log.Error(ctx, "Validation failed for ListWebhookDeliveries request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+
+	// Both IDs are checked in validation before
+	params := repository.ListWebhookDeliveriesParams{Status: req.GetStatus(), Limit: int(req.GetLimit())}
+	if req.GetWebhookSubscriptionId() != "" {
+		params.SubscriptionID, _ = strconv.Atoi(req.GetWebhookSubscriptionId())
+	}
+	if req.GetAfterId() != "" {
+		params.AfterID, _ = strconv.Atoi(req.GetAfterId())
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultWebhookDeliveriesLimit
+	}
+
+	deliveries, err := s.UserRepo.ListWebhookDeliveries(ctx, params)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list webhook deliveries: %v", err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list webhook deliveries")
+	}
+
+	rsp := &userpb.ListWebhookDeliveriesResponse{}
+	for _, delivery := range deliveries {
+		rsp.WebhookDeliveries = append(rsp.WebhookDeliveries, ConvertToWebhookDelivery(delivery))
+	}
+	if len(deliveries) == params.Limit {
+		rsp.NextAfterId = fmt.Sprint(deliveries[len(deliveries)-1].ID)
+	}
+	return rsp, nil
+}
+
+func (s *UserServiceServer) ListWebhookDeliveryAttempts(ctx context.Context, req *userpb.ListWebhookDeliveryAttemptsRequest) (*userpb.ListWebhookDeliveryAttemptsResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ListWebhookDeliveryAttempts")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "ListWebhookDeliveryAttempts"),
+		attribute.String("webhook_delivery.id", req.GetWebhookDeliveryId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ListWebhookDeliveryAttempts request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	if err := domain.ValidateIdString(req.GetWebhookDeliveryId()); err != nil {
+		violations := []*errdetails.BadRequest_FieldViolation{fieldViolation("webhook_delivery_id", err)}
+		log.Error(ctx, "Validation failed for ListWebhookDeliveryAttempts request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+	deliveryID, _ := strconv.Atoi(req.GetWebhookDeliveryId())
+
+	attempts, err := s.UserRepo.ListWebhookDeliveryAttempts(ctx, deliveryID)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list attempts of webhook delivery %d: %v", deliveryID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to list webhook delivery attempts")
+	}
+
+	rsp := &userpb.ListWebhookDeliveryAttemptsResponse{}
+	for _, attempt := range attempts {
+		rsp.Attempts = append(rsp.Attempts, ConvertToWebhookDeliveryAttempt(attempt))
+	}
+	return rsp, nil
+}
+
+// ReplayWebhookDelivery sends a delivery again, whatever its status, with a
+// new set of attempts
+func (s *UserServiceServer) ReplayWebhookDelivery(ctx context.Context, req *userpb.ReplayWebhookDeliveryRequest) (*userpb.ReplayWebhookDeliveryResponse, error) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("grpc-server")
+	ctx, span := tracer.Start(ctx, "UserService/ReplayWebhookDelivery")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("service.method.name", "ReplayWebhookDelivery"),
+		attribute.String("webhook_delivery.id", req.GetWebhookDeliveryId()),
+	)
+	ctx = trace.ContextWithSpan(ctx, span)
+
+	if _, err := s.authorizeUser(ctx, []string{domain.AdminRole}); err != nil {
+		log.Errorf(ctx, "Authorization failed for ReplayWebhookDelivery request: %v", err)
+		span.RecordError(err)
+		return nil, unauthenticatedError(err)
+	}
+
+	if err := domain.ValidateIdString(req.GetWebhookDeliveryId()); err != nil {
+		violations := []*errdetails.BadRequest_FieldViolation{fieldViolation("webhook_delivery_id", err)}
+		log.Error(ctx, "Validation failed for ReplayWebhookDelivery request", "violations", violations)
+		span.SetAttributes(domain.ConvertFieldViolationsToAttributes(violations)...)
+		return nil, invalidArgumentError(violations)
+	}
+	deliveryID, _ := strconv.Atoi(req.GetWebhookDeliveryId())
+
+	delivery, err := s.UserRepo.ReplayWebhookDelivery(ctx, deliveryID, time.Now())
+	if err != nil {
+		log.Errorf(ctx, "Failed to replay webhook delivery %d: %v", deliveryID, err)
+		span.RecordError(err)
+		return nil, repositoryError(err, "failed to replay webhook delivery")
+	}
+
+	log.Infof(ctx, "Webhook delivery replayed successfully: ID=%d", deliveryID)
+
+	return &userpb.ReplayWebhookDeliveryResponse{WebhookDelivery: ConvertToWebhookDelivery(*delivery)}, nil
+}
+
+// ConvertToWebhookSubscription leaves out the secret, it is only returned
+// when the subscription is created
+func ConvertToWebhookSubscription(subscription domain.WebhookSubscription) *userpb.WebhookSubscription {
+	return &userpb.WebhookSubscription{
+		WebhookSubscriptionId: fmt.Sprint(subscription.ID),
+		Url:                   subscription.URL,
+		EventTypes:            subscription.EventTypes,
+		CreatedAt:             timestamppb.New(subscription.CreatedAt),
+	}
+}
+
+func ConvertToWebhookDelivery(delivery domain.WebhookDelivery) *userpb.WebhookDelivery {
+	return &userpb.WebhookDelivery{
+		WebhookDeliveryId:     fmt.Sprint(delivery.ID),
+		WebhookSubscriptionId: fmt.Sprint(delivery.SubscriptionID),
+		EventId:               fmt.Sprint(delivery.EventID),
+		EventType:             delivery.EventType,
+		Payload:               string(delivery.Payload),
+		Status:                delivery.Status,
+		Attempts:              int32(delivery.Attempts),
+		NextAttemptAt:         timestamppb.New(delivery.NextAttemptAt),
+		LastError:             delivery.LastError,
+		CreatedAt:             timestamppb.New(delivery.CreatedAt),
+		UpdatedAt:             timestamppb.New(delivery.UpdatedAt),
+	}
+}
+
+func ConvertToWebhookDeliveryAttempt(attempt domain.WebhookDeliveryAttempt) *userpb.WebhookDeliveryAttempt {
+	return &userpb.WebhookDeliveryAttempt{
+		WebhookDeliveryAttemptId: fmt.Sprint(attempt.ID),
+		StatusCode:               int32(attempt.StatusCode),
+		Error:                    attempt.Error,
+		DurationMs:               attempt.Duration.Milliseconds(),
+		AttemptedAt:              timestamppb.New(attempt.AttemptedAt),
+	}
+}
+
+func validateCreateWebhookSubscriptionRequest(req *userpb.CreateWebhookSubscriptionRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := domain.ValidateWebhookURL(req.GetUrl()); err != nil {
+		violations = append(violations, fieldViolation("url", err))
+	}
+
+	if err := domain.ValidateUserEventTypes(req.GetEventTypes()); err != nil {
+		violations = append(violations, fieldViolation("event_types", err))
+	}
+
+	if req.GetSecret() != "" {
+		if err := domain.ValidateString(req.GetSecret(), 16, 200); err != nil {
+			violations = append(violations, fieldViolation("secret", err))
+		}
+	}
+	return violations
+}
+
+func validateListWebhookDeliveriesRequest(req *userpb.ListWebhookDeliveriesRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetWebhookSubscriptionId() != "" {
+		if err := domain.ValidateIdString(req.GetWebhookSubscriptionId()); err != nil {
+			violations = append(violations, fieldViolation("webhook_subscription_id", err))
+		}
+	}
+	switch req.GetStatus() {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryDead:
+	default:
+		violations = append(violations, fieldViolation("status", fmt.Errorf("must be one of %s, %s or %s", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryDead)))
+	}
+	if req.GetAfterId() != "" {
+		if id, err := strconv.Atoi(req.GetAfterId()); err != nil || id < 0 {
+			violations = append(violations, fieldViolation("after_id", fmt.Errorf("must be a non-negative integer")))
+		}
+	}
+	if req.GetLimit() < 0 || req.GetLimit() > maxWebhookDeliveriesLimit {
+		violations = append(violations, fieldViolation("limit", fmt.Errorf("must be between 0 and %d", maxWebhookDeliveriesLimit)))
+	}
+	return violations
+}
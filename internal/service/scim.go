@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/scim"
+	"google.golang.org/grpc/metadata"
+)
+
+// SCIMPathPrefix is where the SCIM 2.0 provisioning API is mounted on the HTTP gateway
+const SCIMPathPrefix = "/scim/v2/"
+
+const (
+	scimDefaultCount  = 100
+	scimMaxCount      = 1000
+	scimMaxBodyBytes  = 1 << 20
+	scimUsersPath     = "Users"
+	scimGroupsPath    = "Groups"
+	scimProviderPath  = "ServiceProviderConfig"
+	scimResourceUser  = "User"
+	scimResourceGroup = "Group"
+)
+
+type scimAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type scimSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type scimFilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type scimBulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type scimServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 scimSupported              `json:"patch"`
+	Bulk                  scimBulkSupported          `json:"bulk"`
+	Filter                scimFilterSupported        `json:"filter"`
+	ChangePassword        scimSupported              `json:"changePassword"`
+	Sort                  scimSupported              `json:"sort"`
+	ETag                  scimSupported              `json:"etag"`
+	AuthenticationSchemes []scimAuthenticationScheme `json:"authenticationSchemes"`
+}
+
+// SCIMHandler serves the SCIM 2.0 Users and Groups endpoints that HR systems
+// and identity providers push users through. Users map onto the user
+// repository, and the groups are the fixed user roles: adding a user to the
+// admin group makes them an admin. Callers authenticate with a bearer token or
+// API key of an admin, or a credential with the scim scope.
+func (s *UserServiceServer) SCIMHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withHTTPAuditInfo(logger.WithLogger(r.Context(), log), s.Config.Proxies, r)
+
+		if err := s.authorizeSCIM(ctx, r); err != nil {
+			log.Warnf(ctx, "SCIM request rejected: %v", err)
+			if err.StatusCode() == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="sternx"`)
+			}
+			writeSCIMError(w, err)
+			return
+		}
+
+		resource, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, SCIMPathPrefix), "/")
+		if strings.Contains(id, "/") {
+			writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "unknown endpoint"))
+			return
+		}
+
+		switch {
+		case resource == scimUsersPath && id == "":
+			s.scimUsers(ctx, w, r)
+		case resource == scimUsersPath:
+			s.scimUser(ctx, w, r, id)
+		case resource == scimGroupsPath && id == "":
+			s.scimGroups(ctx, w, r)
+		case resource == scimGroupsPath:
+			s.scimGroup(ctx, w, r, id)
+		case resource == scimProviderPath && id == "":
+			s.scimServiceProviderConfig(w, r)
+		default:
+			writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "unknown endpoint"))
+		}
+	})
+}
+
+// authorizeSCIM accepts the same credentials as the gRPC API. Only admins and
+// OAuth2 clients may provision users, and scoped credentials need the scim scope.
+func (s *UserServiceServer) authorizeSCIM(ctx context.Context, r *http.Request) *scim.Error {
+	md := metadata.MD{}
+	if value := r.Header.Get("Authorization"); value != "" {
+		md.Set(authorizationHeader, value)
+	}
+	if value := r.Header.Get("X-Api-Key"); value != "" {
+		md.Set(apiKeyHeader, value)
+	}
+
+	payload, err := s.authenticate(ctx, md)
+	if err != nil {
+		return scim.NewError(http.StatusUnauthorized, "", err.Error())
+	}
+	if !hasPermission(payload.Role, []string{domain.AdminRole, domain.ServiceRole}) {
+		return scim.NewError(http.StatusForbidden, "", "permission denied")
+	}
+	if payload.IsImpersonated() {
+		return scim.NewError(http.StatusForbidden, "", errImpersonationForbidden.Error())
+	}
+	if payload.IsScoped() && !payload.HasScope(domain.ScopeSCIM) {
+		return scim.NewError(http.StatusForbidden, "", "credential is missing the scim scope")
+	}
+	setAuditActor(ctx, payload)
+	return nil
+}
+
+func (s *UserServiceServer) scimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeSCIMMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimServiceProviderConfig{
+		Schemas:        []string{scim.SchemaServiceProviderConfig},
+		Patch:          scimSupported{Supported: true},
+		Filter:         scimFilterSupported{Supported: true, MaxResults: scimMaxCount},
+		ChangePassword: scimSupported{Supported: true},
+		ETag:           scimSupported{Supported: true},
+		AuthenticationSchemes: []scimAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "OAuth Bearer Token",
+			Description: "An access token of an admin or of an OAuth2 client with the scim scope",
+			Primary:     true,
+		}},
+	})
+}
+
+func (s *UserServiceServer) scimLocation(resource string, id string) string {
+	return s.Config.Issuer + SCIMPathPrefix + resource + "/" + id
+}
+
+// scimPage reads the 1-based startIndex and the count of a list request
+func scimPage(r *http.Request) (startIndex int, count int, err *scim.Error) {
+	startIndex, count = 1, scimDefaultCount
+	query := r.URL.Query()
+	if value := query.Get("startIndex"); value != "" {
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, 0, scim.Errorf(scim.ErrInvalidValue, "startIndex must be a number")
+		}
+		if n > 1 {
+			startIndex = n
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, 0, scim.Errorf(scim.ErrInvalidValue, "count must be a number")
+		}
+		count = n
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count, nil
+}
+
+// checkIfMatch enforces the If-Match precondition of a write against the
+// current version of the resource.
+func checkIfMatch(r *http.Request, etag string) *scim.Error {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagListContains(header, etag) {
+		return nil
+	}
+	return errSCIMModified()
+}
+
+// errSCIMModified is the error of a write to a resource that changed since
+// the client read it
+func errSCIMModified() *scim.Error {
+	return scim.NewError(http.StatusPreconditionFailed, "", "the resource was modified, fetch it again")
+}
+
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListContains(header, etag) {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func etagListContains(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSCIMBody(r *http.Request, v interface{}) *scim.Error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, scimMaxBodyBytes))
+	if err := decoder.Decode(v); err != nil {
+		return scim.Errorf(scim.ErrInvalidSyntax, "malformed request body: %v", err)
+	}
+	return nil
+}
+
+func writeSCIMResource(w http.ResponseWriter, code int, etag string, location string, resource interface{}) {
+	w.Header().Set("ETag", etag)
+	if code == http.StatusCreated {
+		w.Header().Set("Location", location)
+	}
+	writeSCIM(w, code, resource)
+}
+
+func writeSCIMMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeSCIMError(w, scim.NewError(http.StatusMethodNotAllowed, "", "method not allowed"))
+}
+
+func writeSCIMError(w http.ResponseWriter, err *scim.Error) {
+	writeSCIM(w, err.StatusCode(), err)
+}
+
+func writeSCIM(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", scim.MediaType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/internal/scim"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// scimGroupRoles are the SCIM groups, each one is a user role. Every user is
+// in exactly one of them.
+var scimGroupRoles = []string{domain.AdminRole, domain.StandardRole}
+
+func (s *UserServiceServer) scimGroups(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	if r.Method == http.MethodPost {
+		writeSCIMError(w, scim.NewError(http.StatusNotImplemented, "", "groups are fixed and map to user roles"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeSCIMMethodNotAllowed(w, "GET")
+		return
+	}
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "SCIM/ListGroups")
+	defer span.End()
+
+	startIndex, count, scimErr := scimPage(r)
+	if scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	var filter *scim.Filter
+	if value := r.URL.Query().Get("filter"); value != "" {
+		span.SetAttributes(attribute.String("scim.filter", value))
+		var err error
+		filter, err = scim.Parse(value)
+		if err != nil {
+			writeSCIMError(w, asSCIMError(err, scim.ErrInvalidFilter))
+			return
+		}
+	}
+
+	var matches []interface{}
+	for _, role := range scimGroupRoles {
+		group, _, err := s.loadSCIMGroup(ctx, role)
+		if err != nil {
+			log.Errorf(ctx, "Failed to load SCIM group %s: %v", role, err)
+			span.RecordError(err)
+			writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to list groups"))
+			return
+		}
+		if filter == nil || filter.Match(scimGroupValues(group)) {
+			matches = append(matches, excludeSCIMMembers(r, group))
+		}
+	}
+
+	total := len(matches)
+	if startIndex > total {
+		matches = nil
+	} else {
+		matches = matches[startIndex-1:]
+	}
+	if len(matches) > count {
+		matches = matches[:count]
+	}
+	writeSCIM(w, http.StatusOK, scim.NewListResponse(matches, total, startIndex))
+}
+
+func (s *UserServiceServer) scimGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "SCIM/Group")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("scim.group.id", id),
+		attribute.String("http.method", r.Method),
+	)
+
+	if !containsString(scimGroupRoles, id) {
+		writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "group not found"))
+		return
+	}
+	group, etag, err := s.loadSCIMGroup(ctx, id)
+	if err != nil {
+		log.Errorf(ctx, "Failed to load SCIM group %s: %v", id, err)
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to load group"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !notModified(w, r, etag) {
+			writeSCIMResource(w, http.StatusOK, etag, "", excludeSCIMMembers(r, group))
+		}
+		return
+	case http.MethodDelete:
+		writeSCIMError(w, scim.NewError(http.StatusNotImplemented, "", "groups are fixed and map to user roles"))
+		return
+	case http.MethodPut, http.MethodPatch:
+	default:
+		writeSCIMMethodNotAllowed(w, "GET, PUT, PATCH")
+		return
+	}
+	if scimErr := checkIfMatch(r, etag); scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	members := make(map[string]bool, len(group.Members))
+	for _, member := range group.Members {
+		members[member.Value] = true
+	}
+	var scimErr *scim.Error
+	if r.Method == http.MethodPut {
+		scimErr = replaceSCIMGroup(r, group, members)
+	} else {
+		scimErr = patchSCIMGroup(r, group, members)
+	}
+	if scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	if scimErr := s.saveSCIMGroupMembers(ctx, group, members); scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	group, etag, err = s.loadSCIMGroup(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to load group"))
+		return
+	}
+	writeSCIMResource(w, http.StatusOK, etag, "", excludeSCIMMembers(r, group))
+}
+
+// loadSCIMGroup renders the group of a role with all users of the role as
+// members, and returns it with its entity tag.
+func (s *UserServiceServer) loadSCIMGroup(ctx context.Context, role string) (scim.Group, string, error) {
+	group := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          role,
+		DisplayName: role,
+		Meta: &scim.Meta{
+			ResourceType: scimResourceGroup,
+			Location:     s.scimLocation(scimGroupsPath, role),
+		},
+	}
+
+	filter := &repository.UserFilter{Op: repository.FilterEqual, Field: repository.UserFieldRole, Value: role}
+	for offset := 0; ; offset += scimMaxCount {
+		users, total, err := s.UserRepo.ListUsers(ctx, repository.ListUsersParams{Filter: filter, Offset: offset, Limit: scimMaxCount})
+		if err != nil {
+			return scim.Group{}, "", err
+		}
+		for _, user := range users {
+			group.Members = append(group.Members, scim.MultiValued{
+				Value:   strconv.Itoa(user.ID),
+				Display: user.Name,
+				Ref:     s.scimLocation(scimUsersPath, strconv.Itoa(user.ID)),
+			})
+			if group.Meta.Created.IsZero() || user.CreatedAt.Before(group.Meta.Created) {
+				group.Meta.Created = user.CreatedAt
+			}
+			if user.UpdatedAt.After(group.Meta.LastModified) {
+				group.Meta.LastModified = user.UpdatedAt
+			}
+		}
+		if offset+scimMaxCount >= total {
+			break
+		}
+	}
+
+	etag, err := scim.ETag(group)
+	if err != nil {
+		return scim.Group{}, "", err
+	}
+	group.Meta.Version = etag
+	return group, etag, nil
+}
+
+func replaceSCIMGroup(r *http.Request, group scim.Group, members map[string]bool) *scim.Error {
+	var body scim.Group
+	if scimErr := decodeSCIMBody(r, &body); scimErr != nil {
+		return scimErr
+	}
+	if body.DisplayName != "" && body.DisplayName != group.DisplayName {
+		return scim.Errorf(scim.ErrMutability, "displayName of a group can't be changed")
+	}
+	for id := range members {
+		delete(members, id)
+	}
+	for _, member := range body.Members {
+		members[member.Value] = true
+	}
+	return nil
+}
+
+func patchSCIMGroup(r *http.Request, group scim.Group, members map[string]bool) *scim.Error {
+	var body scim.PatchRequest
+	if scimErr := decodeSCIMBody(r, &body); scimErr != nil {
+		return scimErr
+	}
+	if !containsString(body.Schemas, scim.SchemaPatchOp) {
+		return scim.Errorf(scim.ErrInvalidSyntax, "the request must use the %s schema", scim.SchemaPatchOp)
+	}
+
+	for _, operation := range body.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != scimOpAdd && op != scimOpReplace && op != scimOpRemove {
+			return scim.Errorf(scim.ErrInvalidSyntax, "unsupported patch operation %q", operation.Op)
+		}
+
+		path := scim.Path{Attribute: "members"}
+		value := operation.Value
+		if operation.Path != "" {
+			parsed, err := scim.ParsePath(operation.Path)
+			if err != nil {
+				return asSCIMError(err, scim.ErrInvalidPath)
+			}
+			path = parsed
+		} else {
+			// Without a path the value holds the attributes to change
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return scim.Errorf(scim.ErrInvalidValue, "the value of a patch operation without path must be an object")
+			}
+			for attribute, attributeValue := range attributes {
+				if !strings.EqualFold(attribute, "members") {
+					return scim.Errorf(scim.ErrMutability, "only the members of a group can be changed")
+				}
+				value = attributeValue
+			}
+		}
+		if path.Attribute != "members" || (path.SubAttribute != "" && path.SubAttribute != "value") {
+			return scim.Errorf(scim.ErrMutability, "only the members of a group can be changed")
+		}
+
+		var values []scim.MultiValued
+		if len(value) > 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, &values); err != nil {
+				return scim.Errorf(scim.ErrInvalidValue, "members must be a list")
+			}
+		}
+
+		switch op {
+		case scimOpAdd:
+			for _, member := range values {
+				members[member.Value] = true
+			}
+		case scimOpReplace:
+			for id := range members {
+				delete(members, id)
+			}
+			for _, member := range values {
+				members[member.Value] = true
+			}
+		case scimOpRemove:
+			for _, member := range group.Members {
+				if path.ValueFilter != nil && !path.ValueFilter.Match(scimMemberValues(member)) {
+					continue
+				}
+				if len(values) > 0 && !containsSCIMValue(values, member.Value) {
+					continue
+				}
+				delete(members, member.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// saveSCIMGroupMembers moves users into and out of the role of a group. Users
+// removed from the admin group become standard users, and since every user
+// needs a role nobody can be removed from the standard group directly.
+func (s *UserServiceServer) saveSCIMGroupMembers(ctx context.Context, group scim.Group, members map[string]bool) *scim.Error {
+	log := logger.FromContext(ctx)
+
+	current := make(map[string]bool, len(group.Members))
+	for _, member := range group.Members {
+		current[member.Value] = true
+	}
+
+	var removed []string
+	for id := range current {
+		if !members[id] {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) > 0 && group.ID == domain.StandardRole {
+		return scim.Errorf(scim.ErrMutability, "users can't leave the %s group, add them to another group instead", domain.StandardRole)
+	}
+
+	changes := make(map[int]string)
+	for id := range members {
+		if current[id] {
+			continue
+		}
+		userID, err := strconv.Atoi(id)
+		if err != nil {
+			return scim.Errorf(scim.ErrInvalidValue, "unknown member %q", id)
+		}
+		if _, err := s.UserRepo.GetUserByID(ctx, userID); err != nil {
+			return scim.Errorf(scim.ErrInvalidValue, "unknown member %q", id)
+		}
+		changes[userID] = group.ID
+	}
+	for _, id := range removed {
+		userID, _ := strconv.Atoi(id) // Members come from the repository
+		changes[userID] = domain.StandardRole
+	}
+
+	for userID, role := range changes {
+		role := role
+		if _, err := s.UserRepo.UpdateUser(ctx, userID, repository.UpdateUserParams{Role: &role}); err != nil {
+			log.Errorf(ctx, "Failed to change role of user %d over SCIM: %v", userID, err)
+			return scim.NewError(http.StatusInternalServerError, "", "failed to update group members")
+		}
+		log.Infof(ctx, "User role changed over SCIM: ID=%d, Role=%s", userID, role)
+	}
+	return nil
+}
+
+// excludeSCIMMembers drops the members of a group when the client asked for
+// it with excludedAttributes=members, as large groups are expensive to send.
+func excludeSCIMMembers(r *http.Request, group scim.Group) scim.Group {
+	for _, attribute := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(scim.NormalizePath(strings.TrimSpace(attribute)), "members") {
+			group.Members = nil
+		}
+	}
+	return group
+}
+
+func scimGroupValues(group scim.Group) func(path string) []interface{} {
+	return func(path string) []interface{} {
+		switch path {
+		case "id", "displayname":
+			return []interface{}{group.ID}
+		case "members", "members.value":
+			values := make([]interface{}, 0, len(group.Members))
+			for _, member := range group.Members {
+				values = append(values, member.Value)
+			}
+			return values
+		case "members.display":
+			values := make([]interface{}, 0, len(group.Members))
+			for _, member := range group.Members {
+				values = append(values, member.Display)
+			}
+			return values
+		}
+		return nil
+	}
+}
+
+func scimMemberValues(member scim.MultiValued) func(path string) []interface{} {
+	return func(path string) []interface{} {
+		switch path {
+		case "value":
+			return []interface{}{member.Value}
+		case "display":
+			return []interface{}{member.Display}
+		}
+		return nil
+	}
+}
+
+func containsSCIMValue(values []scim.MultiValued, value string) bool {
+	for _, v := range values {
+		if v.Value == value {
+			return true
+		}
+	}
+	return false
+}
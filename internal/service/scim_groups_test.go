@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/scim"
+	"github.com/stretchr/testify/require"
+)
+
+// scimRequest sends a SCIM request as user, with the extra headers given as
+// name, value pairs
+func scimRequest(t *testing.T, server *UserServiceServer, user *domain.User, method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	accessToken := sessionToken(t, server, user, time.Minute)
+
+	r := httptest.NewRequest(method, SCIMPathPrefix+path, strings.NewReader(body))
+	r.Header.Set("Content-Type", scim.MediaType)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	server.SCIMHandler(logger.NewDevLogger()).ServeHTTP(w, r)
+	return w
+}
+
+// requireSCIMGroup checks that w holds a group and returns it
+func requireSCIMGroup(t *testing.T, w *httptest.ResponseRecorder) scim.Group {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var group scim.Group
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &group))
+	require.Equal(t, w.Header().Get("ETag"), group.Meta.Version)
+	return group
+}
+
+func scimMemberIDs(group scim.Group) []string {
+	ids := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		ids = append(ids, member.Value)
+	}
+	return ids
+}
+
+func patchMembers(op string, path string, ids ...string) string {
+	members := make([]scim.MultiValued, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, scim.MultiValued{Value: id})
+	}
+	value, _ := json.Marshal(members)
+	operation := map[string]interface{}{"op": op, "value": json.RawMessage(value)}
+	if path != "" {
+		operation["path"] = path
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"schemas":    []string{scim.SchemaPatchOp},
+		"Operations": []interface{}{operation},
+	})
+	return string(body)
+}
+
+func TestSCIMGroups(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+	adminID, userID := strconv.Itoa(admin.ID), strconv.Itoa(user.ID)
+
+	// Groups are the fixed roles, they can't be created or deleted
+	w := scimRequest(t, server, admin, http.MethodPost, "Groups", `{"schemas":["`+scim.SchemaGroup+`"],"displayName":"auditors"}`)
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+	w = scimRequest(t, server, admin, http.MethodDelete, "Groups/"+domain.AdminRole, "")
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+	w = scimRequest(t, server, admin, http.MethodGet, "Groups/auditors", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// Only admins manage groups
+	w = scimRequest(t, server, user, http.MethodGet, "Groups/"+domain.AdminRole, "")
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	group := requireSCIMGroup(t, scimRequest(t, server, admin, http.MethodGet, "Groups/"+domain.AdminRole, ""))
+	require.Equal(t, []string{adminID}, scimMemberIDs(group))
+	etag := group.Meta.Version
+
+	t.Run("NotModified", func(t *testing.T) {
+		w := scimRequest(t, server, admin, http.MethodGet, "Groups/"+domain.AdminRole, "", "If-None-Match", etag)
+		require.Equal(t, http.StatusNotModified, w.Code)
+		require.Equal(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("AddMember", func(t *testing.T) {
+		w := scimRequest(t, server, admin, http.MethodPatch, "Groups/"+domain.AdminRole, patchMembers("add", "members", userID), "If-Match", etag)
+		group := requireSCIMGroup(t, w)
+		require.ElementsMatch(t, []string{adminID, userID}, scimMemberIDs(group))
+		require.NotEqual(t, etag, group.Meta.Version)
+
+		promoted, err := server.UserRepo.GetUserByID(testContext(), user.ID)
+		require.NoError(t, err)
+		require.Equal(t, domain.AdminRole, promoted.Role)
+
+		// The old etag no longer matches the group
+		w = scimRequest(t, server, admin, http.MethodPatch, "Groups/"+domain.AdminRole, patchMembers("remove", "members", userID), "If-Match", etag)
+		require.Equal(t, http.StatusPreconditionFailed, w.Code)
+		etag = group.Meta.Version
+	})
+
+	t.Run("RemoveMember", func(t *testing.T) {
+		w := scimRequest(t, server, admin, http.MethodPatch, "Groups/"+domain.AdminRole, patchMembers("remove", `members[value eq "`+userID+`"]`), "If-Match", etag)
+		group := requireSCIMGroup(t, w)
+		require.Equal(t, []string{adminID}, scimMemberIDs(group))
+
+		// Users removed from the admin group become standard users
+		demoted, err := server.UserRepo.GetUserByID(testContext(), user.ID)
+		require.NoError(t, err)
+		require.Equal(t, domain.StandardRole, demoted.Role)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		tests := map[string]struct {
+			group string
+			body  string
+		}{
+			"UnknownMember":   {group: domain.AdminRole, body: patchMembers("add", "members", "999999")},
+			"LeaveStandard":   {group: domain.StandardRole, body: patchMembers("remove", "members", userID)},
+			"RenameGroup":     {group: domain.AdminRole, body: `{"schemas":["` + scim.SchemaPatchOp + `"],"Operations":[{"op":"replace","path":"displayName","value":"owners"}]}`},
+			"MissingSchema":   {group: domain.AdminRole, body: `{"Operations":[{"op":"add","path":"members","value":[]}]}`},
+			"UnknownOperator": {group: domain.AdminRole, body: patchMembers("move", "members", userID)},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				w := scimRequest(t, server, admin, http.MethodPatch, "Groups/"+test.group, test.body)
+				require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			})
+		}
+
+		unchanged, err := server.UserRepo.GetUserByID(testContext(), user.ID)
+		require.NoError(t, err)
+		require.Equal(t, domain.StandardRole, unchanged.Role)
+	})
+}
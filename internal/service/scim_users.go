@@ -0,0 +1,693 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/internal/scim"
+	"github.com/fibonachyy/sternx/pkg/password"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	scimOpAdd     = "add"
+	scimOpReplace = "replace"
+	scimOpRemove  = "remove"
+)
+
+// scimUserFields maps lowercase SCIM attribute paths of users to the user
+// fields they are stored in. userName and emails are the same field since a
+// user has a single email address.
+var scimUserFields = map[string]repository.UserField{
+	"id":                repository.UserFieldID,
+	"username":          repository.UserFieldEmail,
+	"emails":            repository.UserFieldEmail,
+	"emails.value":      repository.UserFieldEmail,
+	"displayname":       repository.UserFieldName,
+	"name.formatted":    repository.UserFieldName,
+	"externalid":        repository.UserFieldExternalID,
+	"active":            repository.UserFieldActive,
+	"meta.created":      repository.UserFieldCreatedAt,
+	"meta.lastmodified": repository.UserFieldUpdatedAt,
+	"groups":            repository.UserFieldRole,
+	"groups.value":      repository.UserFieldRole,
+	"groups.display":    repository.UserFieldRole,
+}
+
+// scimUserChange holds the writable attributes of a user while a PUT or
+// PATCH request is applied to them.
+type scimUserChange struct {
+	name       string
+	email      string
+	externalID string
+	active     bool
+	password   *string
+}
+
+func newSCIMUserChange(user *domain.User) *scimUserChange {
+	return &scimUserChange{
+		name:       user.Name,
+		email:      user.Email,
+		externalID: user.ExternalID,
+		active:     user.Active,
+	}
+}
+
+func (s *UserServiceServer) scimUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.scimListUsers(ctx, w, r)
+	case http.MethodPost:
+		s.scimCreateUser(ctx, w, r)
+	default:
+		writeSCIMMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+func (s *UserServiceServer) scimUser(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "SCIM/User")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("scim.user.id", id),
+		attribute.String("http.method", r.Method),
+	)
+
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "user not found"))
+		return
+	}
+	user, err := s.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "user not found"))
+		return
+	}
+	resource, etag := s.toSCIMUser(user)
+
+	if r.Method == http.MethodGet {
+		if !notModified(w, r, etag) {
+			writeSCIMResource(w, http.StatusOK, etag, "", resource)
+		}
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		writeSCIMMethodNotAllowed(w, "GET, PUT, PATCH, DELETE")
+		return
+	}
+	if scimErr := checkIfMatch(r, etag); scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		// The version keeps a change made since the If-Match check from being
+		// overwritten
+		err := s.UserRepo.DeleteUserByEmail(ctx, user.Email, user.Version)
+		if errors.Is(err, domain.ErrVersionMismatch) {
+			writeSCIMError(w, errSCIMModified())
+			return
+		}
+		if err != nil {
+			log.Errorf(ctx, "Failed to delete user over SCIM: %v", err)
+			span.RecordError(err)
+			writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to delete user"))
+			return
+		}
+		log.Infof(ctx, "User deleted over SCIM: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	change := newSCIMUserChange(user)
+	var scimErr *scim.Error
+	if r.Method == http.MethodPut {
+		scimErr = replaceSCIMUser(r, change)
+	} else {
+		scimErr = patchSCIMUser(r, change)
+	}
+	if scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	updated, scimErr := s.saveSCIMUserChange(ctx, user, change)
+	if scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+	resource, etag = s.toSCIMUser(updated)
+
+	log.Infof(ctx, "User updated over SCIM: ID=%d, Email=%s", updated.ID, utils.MaskEmail(updated.Email))
+
+	writeSCIMResource(w, http.StatusOK, etag, "", resource)
+}
+
+func (s *UserServiceServer) scimListUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "SCIM/ListUsers")
+	defer span.End()
+
+	startIndex, count, scimErr := scimPage(r)
+	if scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	params := repository.ListUsersParams{Offset: startIndex - 1, Limit: count}
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		span.SetAttributes(attribute.String("scim.filter", filter))
+		parsed, err := scim.Parse(filter)
+		if err != nil {
+			writeSCIMError(w, asSCIMError(err, scim.ErrInvalidFilter))
+			return
+		}
+		params.Filter, scimErr = scimUserFilter(parsed)
+		if scimErr != nil {
+			writeSCIMError(w, scimErr)
+			return
+		}
+	}
+
+	users, total, err := s.UserRepo.ListUsers(ctx, params)
+	if err != nil {
+		log.Errorf(ctx, "Failed to list users over SCIM: %v", err)
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to list users"))
+		return
+	}
+
+	resources := make([]interface{}, 0, len(users))
+	for i := range users {
+		resource, _ := s.toSCIMUser(&users[i])
+		resources = append(resources, resource)
+	}
+	writeSCIM(w, http.StatusOK, scim.NewListResponse(resources, total, startIndex))
+}
+
+func (s *UserServiceServer) scimCreateUser(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(ctx)
+
+	tracer := otel.Tracer("http-server")
+	ctx, span := tracer.Start(ctx, "SCIM/CreateUser")
+	defer span.End()
+
+	var body scim.User
+	if scimErr := decodeSCIMBody(r, &body); scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+
+	change := &scimUserChange{
+		name:       scimUserName(body),
+		email:      scimUserEmail(body),
+		externalID: body.ExternalID,
+		active:     body.Active == nil || *body.Active,
+	}
+	if body.Password != "" {
+		change.password = &body.Password
+	}
+	if change.name == "" {
+		change.name, _, _ = strings.Cut(change.email, "@")
+	}
+	if scimErr := validateSCIMUserChange(change, s.Config.PasswordPolicy); scimErr != nil {
+		writeSCIMError(w, scimErr)
+		return
+	}
+	if _, err := s.UserRepo.GetUserByEmail(ctx, change.email); err == nil {
+		writeSCIMError(w, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "a user with this userName already exists"))
+		return
+	}
+
+	password := change.password
+	if password == nil {
+		// Users provisioned without a password sign in through a federated
+		// identity provider until they get one
+		random, err := utils.RandomSecret(32)
+		if err != nil {
+			span.RecordError(err)
+			writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to create user"))
+			return
+		}
+		password = &random
+	}
+	hashedPassword, err := s.passwordHasher.Hash(*password)
+	if err != nil {
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to create user"))
+		return
+	}
+
+	user, err := s.UserRepo.CreateUser(ctx, repository.CreateUserParams{
+		Name:           change.name,
+		Email:          change.email,
+		Role:           domain.StandardRole,
+		HashedPassword: hashedPassword,
+		ExternalID:     change.externalID,
+	})
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		// Another request created the user since the check above
+		writeSCIMError(w, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "a user with this userName already exists"))
+		return
+	}
+	if err != nil {
+		log.Errorf(ctx, "Failed to create user over SCIM: %v", err)
+		span.RecordError(err)
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to create user"))
+		return
+	}
+	if change.password != nil {
+		s.recordPasswordHistory(ctx, user.ID, hashedPassword)
+	}
+	if !change.active {
+		inactive := false
+		user, err = s.UserRepo.UpdateUser(ctx, user.ID, repository.UpdateUserParams{Active: &inactive})
+		if err != nil {
+			log.Errorf(ctx, "Failed to deactivate user created over SCIM: %v", err)
+			span.RecordError(err)
+			writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "failed to create user"))
+			return
+		}
+	}
+
+	resource, etag := s.toSCIMUser(user)
+
+	log.Infof(ctx, "User created over SCIM: ID=%d, Email=%s", user.ID, utils.MaskEmail(user.Email))
+
+	writeSCIMResource(w, http.StatusCreated, etag, resource.Meta.Location, resource)
+}
+
+// replaceSCIMUser applies a PUT body. Attributes missing from the body are
+// cleared, except active and password which keep their current value.
+func replaceSCIMUser(r *http.Request, change *scimUserChange) *scim.Error {
+	var body scim.User
+	if scimErr := decodeSCIMBody(r, &body); scimErr != nil {
+		return scimErr
+	}
+	change.name = scimUserName(body)
+	change.email = scimUserEmail(body)
+	change.externalID = body.ExternalID
+	if body.Active != nil {
+		change.active = *body.Active
+	}
+	if body.Password != "" {
+		change.password = &body.Password
+	}
+	return nil
+}
+
+func patchSCIMUser(r *http.Request, change *scimUserChange) *scim.Error {
+	var body scim.PatchRequest
+	if scimErr := decodeSCIMBody(r, &body); scimErr != nil {
+		return scimErr
+	}
+	if !containsString(body.Schemas, scim.SchemaPatchOp) {
+		return scim.Errorf(scim.ErrInvalidSyntax, "the request must use the %s schema", scim.SchemaPatchOp)
+	}
+	for _, operation := range body.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != scimOpAdd && op != scimOpReplace && op != scimOpRemove {
+			return scim.Errorf(scim.ErrInvalidSyntax, "unsupported patch operation %q", operation.Op)
+		}
+
+		if operation.Path != "" {
+			if scimErr := patchSCIMUserAttribute(change, op, operation.Path, operation.Value); scimErr != nil {
+				return scimErr
+			}
+			continue
+		}
+
+		// Without a path the value holds the attributes to change
+		if op == scimOpRemove {
+			return scim.Errorf(scim.ErrNoTarget, "remove operations need a path")
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return scim.Errorf(scim.ErrInvalidValue, "the value of a patch operation without path must be an object")
+		}
+		for path, value := range attributes {
+			if scimErr := patchSCIMUserAttribute(change, op, path, value); scimErr != nil {
+				return scimErr
+			}
+		}
+	}
+	return nil
+}
+
+func patchSCIMUserAttribute(change *scimUserChange, op string, rawPath string, value json.RawMessage) *scim.Error {
+	path, err := scim.ParsePath(rawPath)
+	if err != nil {
+		return asSCIMError(err, scim.ErrInvalidPath)
+	}
+	if strings.HasPrefix(strings.ToLower(path.Attribute), "urn:") {
+		return nil // Attributes of schema extensions are not stored
+	}
+
+	if op == scimOpRemove {
+		switch path.Attribute {
+		case "externalid":
+			change.externalID = ""
+			return nil
+		case "username", "displayname", "name", "emails", "active", "password":
+			return scim.Errorf(scim.ErrMutability, "%s can't be removed", rawPath)
+		}
+		return unknownSCIMUserAttribute(rawPath, path)
+	}
+
+	switch path.Attribute {
+	case "username":
+		return decodeSCIMString(value, &change.email)
+	case "displayname":
+		return decodeSCIMString(value, &change.name)
+	case "externalid":
+		return decodeSCIMString(value, &change.externalID)
+	case "password":
+		var password string
+		if scimErr := decodeSCIMString(value, &password); scimErr != nil {
+			return scimErr
+		}
+		change.password = &password
+		return nil
+	case "active":
+		return decodeSCIMBool(value, &change.active)
+	case "name":
+		return patchSCIMUserName(change, path.SubAttribute, value)
+	case "emails":
+		if path.SubAttribute == "value" {
+			return decodeSCIMString(value, &change.email)
+		}
+		if path.SubAttribute == "" && path.ValueFilter == nil {
+			var emails []scim.MultiValued
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return scim.Errorf(scim.ErrInvalidValue, "emails must be a list")
+			}
+			if email := scimUserEmail(scim.User{Emails: emails}); email != "" {
+				change.email = email
+			}
+			return nil
+		}
+	case "id", "meta", "schemas", "groups":
+		return scim.Errorf(scim.ErrMutability, "%s is read-only", rawPath)
+	}
+	return unknownSCIMUserAttribute(rawPath, path)
+}
+
+// patchSCIMUserName updates the single name of a user from the name attribute
+// or one of its parts. Users have no separate given and family name, so a
+// part replaces the first or the remaining words of the name.
+func patchSCIMUserName(change *scimUserChange, subAttribute string, value json.RawMessage) *scim.Error {
+	givenName, familyName, _ := strings.Cut(change.name, " ")
+	switch subAttribute {
+	case "":
+		var name scim.Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return scim.Errorf(scim.ErrInvalidValue, "name must be an object")
+		}
+		if formatted := scimUserName(scim.User{Name: &name}); formatted != "" {
+			change.name = formatted
+		}
+		return nil
+	case "formatted":
+		return decodeSCIMString(value, &change.name)
+	case "givenname":
+		if scimErr := decodeSCIMString(value, &givenName); scimErr != nil {
+			return scimErr
+		}
+	case "familyname":
+		if scimErr := decodeSCIMString(value, &familyName); scimErr != nil {
+			return scimErr
+		}
+	default:
+		return scim.Errorf(scim.ErrInvalidPath, "unknown attribute name.%s", subAttribute)
+	}
+	change.name = strings.TrimSpace(givenName + " " + familyName)
+	return nil
+}
+
+// saveSCIMUserChange validates a change and stores the attributes that differ
+// from the user.
+func (s *UserServiceServer) saveSCIMUserChange(ctx context.Context, user *domain.User, change *scimUserChange) (*domain.User, *scim.Error) {
+	log := logger.FromContext(ctx)
+
+	if scimErr := validateSCIMUserChange(change, s.Config.PasswordPolicy); scimErr != nil {
+		return nil, scimErr
+	}
+
+	// The version keeps a change made since the user was loaded, and checked
+	// against If-Match, from being overwritten
+	params := repository.UpdateUserParams{ExpectedVersion: user.Version}
+	changed := false
+	if change.name != user.Name {
+		params.Name, changed = &change.name, true
+	}
+	if !strings.EqualFold(change.email, user.Email) {
+		if _, err := s.UserRepo.GetUserByEmail(ctx, change.email); err == nil {
+			return nil, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "a user with this userName already exists")
+		}
+		params.Email, changed = &change.email, true
+	}
+	if change.externalID != user.ExternalID {
+		params.ExternalID, changed = &change.externalID, true
+	}
+	if change.active != user.Active {
+		params.Active, changed = &change.active, true
+	}
+	if change.password != nil {
+		reused, err := s.passwordReused(ctx, user, *change.password)
+		if err != nil {
+			log.Errorf(ctx, "Failed to check password history of user %d: %v", user.ID, err)
+			return nil, scim.NewError(http.StatusInternalServerError, "", "failed to update user")
+		}
+		if reused {
+			return nil, scim.Errorf(scim.ErrInvalidValue, "password %s", s.errPasswordReused())
+		}
+		hashedPassword, err := s.passwordHasher.Hash(*change.password)
+		if err != nil {
+			log.Errorf(ctx, "Failed to hash password of user %d: %v", user.ID, err)
+			return nil, scim.NewError(http.StatusInternalServerError, "", "failed to update user")
+		}
+		params.HashedPassword, changed = &hashedPassword, true
+	}
+	if !changed {
+		return user, nil
+	}
+
+	updated, err := s.UserRepo.UpdateUser(ctx, user.ID, params)
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		return nil, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "a user with this userName already exists")
+	}
+	if errors.Is(err, domain.ErrVersionMismatch) {
+		return nil, errSCIMModified()
+	}
+	if err != nil {
+		log.Errorf(ctx, "Failed to update user %d over SCIM: %v", user.ID, err)
+		return nil, scim.NewError(http.StatusInternalServerError, "", "failed to update user")
+	}
+	if params.HashedPassword != nil {
+		s.recordPasswordHistory(ctx, user.ID, *params.HashedPassword)
+	}
+	return updated, nil
+}
+
+func validateSCIMUserChange(change *scimUserChange, policy password.Policy) *scim.Error {
+	if err := domain.ValidateEmail(change.email); err != nil {
+		return scim.Errorf(scim.ErrInvalidValue, "userName %s", err)
+	}
+	if err := domain.ValidateName(change.name); err != nil {
+		return scim.Errorf(scim.ErrInvalidValue, "displayName %s", err)
+	}
+	if err := domain.ValidateString(change.externalID, 0, 255); err != nil {
+		return scim.Errorf(scim.ErrInvalidValue, "externalId %s", err)
+	}
+	if change.password != nil {
+		if violations := policy.Check(*change.password, change.name, change.email); len(violations) > 0 {
+			descriptions := make([]string, len(violations))
+			for i, violation := range violations {
+				descriptions[i] = violation.Error()
+			}
+			return scim.Errorf(scim.ErrInvalidValue, "password %s", strings.Join(descriptions, "; "))
+		}
+	}
+	return nil
+}
+
+// toSCIMUser renders a user and returns it with its entity tag, the etag the
+// gRPC API and gateway return for the user too
+func (s *UserServiceServer) toSCIMUser(user *domain.User) (scim.User, string) {
+	active := user.Active
+	resource := scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          strconv.Itoa(user.ID),
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		Name:        &scim.Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scim.MultiValued{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups: []scim.MultiValued{{
+			Value:   user.Role,
+			Display: user.Role,
+			Ref:     s.scimLocation(scimGroupsPath, user.Role),
+		}},
+		Meta: &scim.Meta{
+			ResourceType: scimResourceUser,
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     s.scimLocation(scimUsersPath, strconv.Itoa(user.ID)),
+		},
+	}
+	etag := strconv.Quote(userETag(*user))
+	resource.Meta.Version = etag
+	return resource, etag
+}
+
+// scimUserFilter translates a SCIM filter on users to a repository filter
+func scimUserFilter(f *scim.Filter) (*repository.UserFilter, *scim.Error) {
+	switch f.Op {
+	case scim.OpAnd, scim.OpOr, scim.OpNot:
+		filter := &repository.UserFilter{Op: f.Op}
+		for _, operand := range f.Operands {
+			translated, scimErr := scimUserFilter(operand)
+			if scimErr != nil {
+				return nil, scimErr
+			}
+			filter.Operands = append(filter.Operands, *translated)
+		}
+		return filter, nil
+	}
+
+	field, ok := scimUserFields[strings.ToLower(f.Path)]
+	if !ok {
+		return nil, scim.Errorf(scim.ErrInvalidFilter, "filtering on %s is not supported", f.Path)
+	}
+	filter := &repository.UserFilter{Op: f.Op, Field: field}
+	if f.Op == scim.OpPresent {
+		return filter, nil
+	}
+
+	switch field {
+	case repository.UserFieldID:
+		value, _ := f.Value.(string)
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "id must be compared with a user id")
+		}
+		filter.Value = id
+	case repository.UserFieldActive:
+		value, ok := f.Value.(bool)
+		if !ok {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "active must be compared with a boolean")
+		}
+		filter.Value = value
+	case repository.UserFieldCreatedAt, repository.UserFieldUpdatedAt:
+		value, _ := f.Value.(string)
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "%s must be compared with a date time", f.Path)
+		}
+		filter.Value = t
+	default:
+		value, ok := f.Value.(string)
+		if !ok {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "%s must be compared with a string", f.Path)
+		}
+		filter.Value = value
+	}
+
+	switch f.Op {
+	case scim.OpContains, scim.OpStartsWith, scim.OpEndsWith:
+		if _, isString := filter.Value.(string); !isString {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "operator %s is only supported for strings", f.Op)
+		}
+	case scim.OpGreater, scim.OpGreaterOrEqual, scim.OpLess, scim.OpLessOrEqual:
+		if _, isBool := filter.Value.(bool); isBool {
+			return nil, scim.Errorf(scim.ErrInvalidFilter, "operator %s is not supported for booleans", f.Op)
+		}
+	}
+	return filter, nil
+}
+
+// scimUserName picks the name of a user from displayName or the name parts
+func scimUserName(user scim.User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	if user.Name == nil {
+		return ""
+	}
+	if user.Name.Formatted != "" {
+		return user.Name.Formatted
+	}
+	return strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName)
+}
+
+// scimUserEmail picks the email of a user from userName or the primary email
+func scimUserEmail(user scim.User) string {
+	if user.UserName != "" {
+		return user.UserName
+	}
+	for _, email := range user.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(user.Emails) > 0 {
+		return user.Emails[0].Value
+	}
+	return ""
+}
+
+func unknownSCIMUserAttribute(rawPath string, path scim.Path) *scim.Error {
+	if path.ValueFilter != nil {
+		return scim.Errorf(scim.ErrNoTarget, "no value matches %s", rawPath)
+	}
+	return scim.Errorf(scim.ErrInvalidPath, "unknown attribute %s", rawPath)
+}
+
+func decodeSCIMString(value json.RawMessage, target *string) *scim.Error {
+	if err := json.Unmarshal(value, target); err != nil {
+		return scim.Errorf(scim.ErrInvalidValue, "expected a string value")
+	}
+	return nil
+}
+
+// decodeSCIMBool accepts JSON booleans and, since some identity providers
+// send them that way, the strings "true" and "false".
+func decodeSCIMBool(value json.RawMessage, target *bool) *scim.Error {
+	if err := json.Unmarshal(value, target); err == nil {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(text)); err == nil {
+			*target = parsed
+			return nil
+		}
+	}
+	return scim.Errorf(scim.ErrInvalidValue, "expected a boolean value")
+}
+
+// asSCIMError keeps SCIM errors and turns other errors into bad requests of
+// the detail error type.
+func asSCIMError(err error, scimType string) *scim.Error {
+	if scimErr, ok := err.(*scim.Error); ok {
+		return scimErr
+	}
+	return scim.Errorf(scimType, "%v", err)
+}
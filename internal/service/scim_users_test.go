@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/internal/scim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCIMUserETag(t *testing.T) {
+	server := newTestServer(t)
+	admin := createTestUser(t, server, domain.AdminRole, "secret")
+	user := createTestUser(t, server, domain.StandardRole, "secret")
+
+	do := func(method string, ifMatch string, body string) *httptest.ResponseRecorder {
+		var headers []string
+		if ifMatch != "" {
+			headers = append(headers, "If-Match", ifMatch)
+		}
+		return scimRequest(t, server, admin, method, "Users/"+strconv.Itoa(user.ID), body, headers...)
+	}
+
+	// The SCIM version is the etag of the gRPC API
+	w := do(http.MethodGet, "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := strconv.Quote(userETag(*user))
+	require.Equal(t, etag, w.Header().Get("ETag"))
+	var resource scim.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resource))
+	require.Equal(t, etag, resource.Meta.Version)
+
+	// Any write moves it on
+	name := "Renamed"
+	changed, err := server.UserRepo.UpdateUser(testContext(), user.ID, repository.UpdateUserParams{Name: &name})
+	require.NoError(t, err)
+	patch := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","path":"displayName","value":"Other"}]}`
+	require.Equal(t, http.StatusPreconditionFailed, do(http.MethodPatch, etag, patch).Code)
+	require.Equal(t, http.StatusPreconditionFailed, do(http.MethodDelete, etag, "").Code)
+
+	// A change between the If-Match check and the write isn't overwritten
+	change := newSCIMUserChange(user)
+	change.name = "Other"
+	_, scimErr := server.saveSCIMUserChange(testContext(), user, change)
+	require.NotNil(t, scimErr)
+	require.Equal(t, http.StatusPreconditionFailed, scimErr.StatusCode())
+
+	w = do(http.MethodPatch, strconv.Quote(userETag(*changed)), patch)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, strconv.Quote(strconv.Itoa(changed.Version+1)), w.Header().Get("ETag"))
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, w.Header().Get("ETag"), "").Code)
+}
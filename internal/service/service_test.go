@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/metrics"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/fibonachyy/sternx/pkg/token"
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testTokenSymmetricKey = "12345678901234567890123456789012"
+
+// newTestServer returns a server backed by an in-memory repository
+func newTestServer(t *testing.T) *UserServiceServer {
+	config := DefaultConfig()
+	config.TokenSymmetricKey = testTokenSymmetricKey
+	server, err := NewUserServiceServer(repository.NewMemory(), config)
+	require.NoError(t, err)
+	return server
+}
+
+func testContext() context.Context {
+	ctx := logger.WithLogger(context.Background(), logger.NewDevLogger())
+	return metrics.WithMeter(ctx, noop.NewMeterProvider().Meter("test"))
+}
+
+// testTransportStream stands in for the transport of an RPC, so handlers see
+// the method they serve and can set response headers
+type testTransportStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *testTransportStream) Method() string {
+	return s.method
+}
+
+func (s *testTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *testTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *testTransportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+// rpcContext returns the context of a call of the RPC method with the given
+// metadata, e.g. "authorization", "bearer <token>"
+func rpcContext(method string, kv ...string) (context.Context, *testTransportStream) {
+	stream := &testTransportStream{method: "/userpb.UserService/" + method}
+	ctx := grpc.NewContextWithServerTransportStream(testContext(), stream)
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(kv...)), stream
+}
+
+// authContext is rpcContext for a caller logged in as user just now
+func authContext(t *testing.T, server *UserServiceServer, method string, user *domain.User) (context.Context, *testTransportStream) {
+	accessToken := sessionToken(t, server, user, time.Minute, token.WithAuthTime(time.Now()))
+	return rpcContext(method, authorizationHeader, authorizationBearer+" "+accessToken)
+}
+
+// sessionToken starts a session for user and returns an access token bound
+// to it, valid for duration
+func sessionToken(t *testing.T, server *UserServiceServer, user *domain.User, duration time.Duration, opts ...token.PayloadOption) string {
+	sessionID := uuid.NewString()
+	require.NoError(t, server.startSession(testContext(), user, sessionID, time.Now().Add(duration)))
+	accessToken, _, err := server.tokenMaker.CreateToken(user.Email, user.Role, duration, append(opts, token.WithSessionID(sessionID))...)
+	require.NoError(t, err)
+	return accessToken
+}
+
+// withIncomingMetadata adds kv to the metadata of the call of ctx
+func withIncomingMetadata(ctx context.Context, kv ...string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return metadata.NewIncomingContext(ctx, metadata.Join(md, metadata.Pairs(kv...)))
+}
+
+// createTestUser adds a user with the given role and password
+func createTestUser(t *testing.T, server *UserServiceServer, role string, password string) *domain.User {
+	hashedPassword, err := server.passwordHasher.Hash(password)
+	require.NoError(t, err)
+	user, err := server.UserRepo.CreateUser(testContext(), repository.CreateUserParams{
+		Name:           utils.RandomString(8),
+		Email:          utils.RandomString(12) + "@example.com",
+		Role:           role,
+		HashedPassword: hashedPassword,
+	})
+	require.NoError(t, err)
+	return user
+}
+
+// requireCode checks that err is a status with code
+func requireCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, code, status.Code(err), "%v", err)
+}
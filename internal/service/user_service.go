@@ -1,11 +1,17 @@
 package service
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/fibonachyy/sternx/pkg/password"
 	"github.com/fibonachyy/sternx/pkg/token"
 
 	userpb "github.com/fibonachyy/sternx/internal/api"
+	"github.com/fibonachyy/sternx/internal/federation"
+	"github.com/fibonachyy/sternx/internal/notification"
 	"github.com/fibonachyy/sternx/internal/repository"
 )
 
@@ -13,8 +19,15 @@ type UserServiceServer struct {
 	userpb.UnimplementedUserServiceServer
 	UserRepo repository.IRepository
 
-	Config     Config
-	tokenMaker token.Maker
+	Config         Config
+	tokenMaker     token.Maker
+	idTokenSigner  *token.IDTokenSigner
+	passwordHasher password.Hasher
+
+	federationProviders map[string]*federation.Provider
+	federationStateKey  []byte
+	authorizeCSRFKey    []byte
+	ssoCookieKey        []byte
 }
 
 func NewUserServiceServer(repo repository.IRepository, config Config) (*UserServiceServer, error) {
@@ -27,12 +40,92 @@ func NewUserServiceServer(repo repository.IRepository, config Config) (*UserServ
 		return nil, fmt.Errorf("failed to create token maker: %w", err)
 	}
 
+	defaultConfig := DefaultConfig()
+	if config.Proxies == nil {
+		config.Proxies, err = NewProxies(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if config.JWTDuration == 0 {
-		defaultConfig := DefaultConfig()
 		config.JWTDuration = defaultConfig.JWTDuration
 	}
+	if config.APIKeyDuration == 0 {
+		config.APIKeyDuration = defaultConfig.APIKeyDuration
+	}
+	if config.ClientTokenDuration == 0 {
+		config.ClientTokenDuration = defaultConfig.ClientTokenDuration
+	}
+	if config.Issuer == "" {
+		config.Issuer = defaultConfig.Issuer
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if config.AuthCodeDuration == 0 {
+		config.AuthCodeDuration = defaultConfig.AuthCodeDuration
+	}
+	if config.DeviceCodeDuration == 0 {
+		config.DeviceCodeDuration = defaultConfig.DeviceCodeDuration
+	}
+	if config.DevicePollInterval < time.Second {
+		config.DevicePollInterval = defaultConfig.DevicePollInterval
+	}
+	if config.ImpersonationDuration == 0 {
+		config.ImpersonationDuration = defaultConfig.ImpersonationDuration
+	}
+	if config.MagicLinkDuration == 0 {
+		config.MagicLinkDuration = defaultConfig.MagicLinkDuration
+	}
+	if config.MagicLinkURL == "" {
+		config.MagicLinkURL = config.Issuer + "/magic-link"
+	}
+	if config.PasswordPolicy.MinLength == 0 && config.PasswordPolicy.MaxLength == 0 {
+		breached := config.PasswordPolicy.Breached
+		config.PasswordPolicy = password.DefaultPolicy()
+		config.PasswordPolicy.Breached = breached
+	}
+	if config.PasswordHistorySize == 0 {
+		config.PasswordHistorySize = defaultConfig.PasswordHistorySize
+	}
+	if config.DeletedUserRetention == 0 {
+		config.DeletedUserRetention = defaultConfig.DeletedUserRetention
+	}
+	if config.UserPurgeInterval == 0 {
+		config.UserPurgeInterval = defaultConfig.UserPurgeInterval
+	}
+	if config.WatchPollInterval == 0 {
+		config.WatchPollInterval = defaultConfig.WatchPollInterval
+	}
+	if config.NotificationSender == nil {
+		config.NotificationSender = notification.LogSender{}
+	}
+	if config.DeviceVerificationURI == "" {
+		config.DeviceVerificationURI = config.Issuer + "/device"
+	}
+
+	idTokenSigner, err := token.NewIDTokenSigner(config.IDTokenSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create id token signer: %w", err)
+	}
+
+	federationProviders := make(map[string]*federation.Provider, len(config.FederationProviders))
+	for _, providerConfig := range config.FederationProviders {
+		federationProviders[providerConfig.Name] = federation.NewProvider(providerConfig, nil)
+	}
+	federationStateKey := sha256.Sum256([]byte("federation-state:" + config.TokenSymmetricKey))
+	authorizeCSRFKey := sha256.Sum256([]byte("authorize-csrf:" + config.TokenSymmetricKey))
+	ssoCookieKey := sha256.Sum256([]byte("sso-cookie:" + config.TokenSymmetricKey))
 
-	return &UserServiceServer{UserRepo: repo, tokenMaker: tokenMaker, Config: config}, nil
+	return &UserServiceServer{
+		UserRepo:            repo,
+		tokenMaker:          tokenMaker,
+		idTokenSigner:       idTokenSigner,
+		passwordHasher:      password.NewDefaultHasher(config.PasswordHashing),
+		federationProviders: federationProviders,
+		federationStateKey:  federationStateKey[:],
+		authorizeCSRFKey:    authorizeCSRFKey[:],
+		ssoCookieKey:        ssoCookieKey[:],
+		Config:              config,
+	}, nil
 }
 
 func createTokenMaker(symmetricKey string) (token.Maker, error) {
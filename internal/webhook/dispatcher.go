@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+)
+
+// maxResponseBytes is how much of a response the dispatcher reads before it
+// closes the connection
+const maxResponseBytes = 64 << 10
+
+type Config struct {
+	// Interval is how long the dispatcher waits before it looks for due
+	// deliveries again
+	Interval time.Duration
+	// BatchSize is how many deliveries the dispatcher sends at once
+	BatchSize int
+	// Timeout bounds each request
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is sent before it is dead
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt. It doubles
+	// with each further attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultConfig returns the default configuration. Its attempts span over a
+// day.
+func DefaultConfig() Config {
+	return Config{
+		Interval:       time.Second,
+		BatchSize:      20,
+		Timeout:        10 * time.Second,
+		MaxAttempts:    15,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     6 * time.Hour,
+	}
+}
+
+// Dispatcher sends the queued webhook deliveries. Replicas can each run one,
+// since deliveries are claimed before they're sent.
+type Dispatcher struct {
+	repo   repository.IWebhookRepository
+	client *http.Client
+	config Config
+}
+
+func NewDispatcher(repo repository.IWebhookRepository, config Config) *Dispatcher {
+	return &Dispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// A redirect counts as a failure, receivers have to update
+			// their subscription instead
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		config: config,
+	}
+}
+
+// Run sends the due deliveries every Interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf(ctx, "Failed to dispatch webhook deliveries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue sends the deliveries that are due, in batches, until none is
+// left, and returns how many it attempted
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		// Claims outlast the requests of a batch, which run in parallel
+		deliveries, err := d.repo.ClaimWebhookDeliveries(ctx, time.Now(), 2*d.config.Timeout, d.config.BatchSize)
+		if err != nil {
+			return attempted, err
+		}
+
+		subscriptions := make(map[int]*domain.WebhookSubscription)
+		for _, delivery := range deliveries {
+			if _, ok := subscriptions[delivery.SubscriptionID]; ok {
+				continue
+			}
+			subscription, err := d.repo.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+				return attempted, err
+			}
+			// Deleted subscriptions are nil, their deliveries are gone too
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(deliveries))
+		for i, delivery := range deliveries {
+			subscription := subscriptions[delivery.SubscriptionID]
+			if subscription == nil {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, subscription domain.WebhookSubscription, delivery domain.WebhookDelivery) {
+				defer wg.Done()
+				errs[i] = d.attempt(ctx, subscription, delivery)
+			}(i, *subscription, delivery)
+			attempted++
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return attempted, err
+		}
+
+		if len(deliveries) < d.config.BatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt sends a delivery and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, subscription domain.WebhookSubscription, delivery domain.WebhookDelivery) error {
+	log := logger.FromContext(ctx)
+
+	attemptedAt := time.Now()
+	statusCode, err := d.send(ctx, subscription, delivery, attemptedAt)
+	params := repository.RecordWebhookAttemptParams{
+		DeliveryID:    delivery.ID,
+		StatusCode:    statusCode,
+		Duration:      time.Since(attemptedAt),
+		AttemptedAt:   attemptedAt,
+		Status:        domain.WebhookDeliverySucceeded,
+		NextAttemptAt: attemptedAt,
+	}
+	if err != nil {
+		params.Error = err.Error()
+		attempts := delivery.Attempts + 1
+		if attempts >= d.config.MaxAttempts {
+			params.Status = domain.WebhookDeliveryDead
+			log.Warnf(ctx, "Webhook delivery %d to subscription %d is dead after %d attempts: %v", delivery.ID, subscription.ID, attempts, err)
+		} else {
+			params.Status = domain.WebhookDeliveryPending
+			params.NextAttemptAt = attemptedAt.Add(d.backoff(attempts))
+		}
+	}
+	return d.repo.RecordWebhookAttempt(ctx, params)
+}
+
+// send POSTs a delivery to the URL of its subscription and returns the
+// status of the response. Statuses other than 2xx are errors.
+func (d *Dispatcher) send(ctx context.Context, subscription domain.WebhookSubscription, delivery domain.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sternx-webhooks")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, now, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(rsp.Body, maxResponseBytes))
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return rsp.StatusCode, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
+
+// backoff is the wait after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.InitialBackoff
+	for i := 1; i < attempts && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+	return wait
+}
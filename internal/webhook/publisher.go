@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/repository"
+)
+
+// Publisher queues each user event for the webhook subscriptions of its
+// type. It is the events.Publisher the relay hands events to; the Dispatcher
+// sends what it queued.
+type Publisher struct {
+	repo repository.IWebhookRepository
+}
+
+func NewPublisher(repo repository.IWebhookRepository) *Publisher {
+	return &Publisher{repo: repo}
+}
+
+func (p *Publisher) Publish(ctx context.Context, event domain.UserEvent) error {
+	subscriptions, err := p.repo.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	// The relay publishes the event again when one of these fails, and the
+	// deliveries queued already aren't queued twice
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(event.Type) {
+			continue
+		}
+		err := p.repo.CreateWebhookDelivery(ctx, repository.CreateWebhookDeliveryParams{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			UserID:         event.UserID,
+			EventType:      event.Type,
+			Payload:        payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package webhook sends user events to the URLs subscribed to them as signed
+// HTTP callbacks.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of webhook requests
+const (
+	// SignatureHeader holds the Sign signature of the body
+	SignatureHeader = "X-Sternx-Signature"
+	// TimestampHeader holds the time the request was sent, in Unix seconds
+	TimestampHeader = "X-Sternx-Timestamp"
+	EventHeader     = "X-Sternx-Event"
+	DeliveryHeader  = "X-Sternx-Delivery"
+)
+
+// signaturePrefix names the scheme of the signature, to allow changing it
+// later without breaking receivers
+const signaturePrefix = "v1="
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp is too old")
+)
+
+// Sign returns the signature of a payload sent at timestamp: the hex encoded
+// HMAC-SHA256 of "{unix timestamp}.{payload}" with secret. Signing the
+// timestamp keeps a captured request from being replayed later.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a webhook request with the header and body
+// it came with, for receivers. Requests sent more than tolerance before now
+// are rejected.
+func Verify(secret string, header http.Header, payload []byte, now time.Time, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	timestamp := time.Unix(seconds, 0)
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(timestamp); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
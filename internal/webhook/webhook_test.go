@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fibonachyy/sternx/internal/domain"
+	"github.com/fibonachyy/sternx/internal/events"
+	"github.com/fibonachyy/sternx/internal/logger"
+	"github.com/fibonachyy/sternx/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "whsec_test"
+
+func testContext() context.Context {
+	return logger.WithLogger(context.Background(), logger.NewDevLogger())
+}
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.Timeout = time.Second
+	config.MaxAttempts = 3
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 2 * time.Millisecond
+	return config
+}
+
+// receiver is a webhook endpoint that verifies the requests it gets and
+// answers with status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	events   []domain.UserEvent
+	requests int
+	errs     []error
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	body, err := io.ReadAll(req.Body)
+	if err == nil {
+		err = Verify(testSecret, req.Header, body, time.Now(), time.Minute)
+	}
+	if err != nil {
+		r.errs = append(r.errs, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event domain.UserEvent
+	if err := json.Unmarshal(body, &event); err != nil || req.Header.Get(EventHeader) != event.Type {
+		r.errs = append(r.errs, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.status != http.StatusOK {
+		w.WriteHeader(r.status)
+		return
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func setup(t *testing.T, eventTypes ...string) (repository.IRepository, *events.Relay, *receiver, *domain.WebhookSubscription) {
+	repo := repository.NewMemory()
+	rcv := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+
+	subscription, err := repo.CreateWebhookSubscription(context.Background(), repository.CreateWebhookSubscriptionParams{
+		URL:        server.URL,
+		EventTypes: eventTypes,
+		Secret:     testSecret,
+	})
+	require.NoError(t, err)
+	relay := events.NewRelay(repo, NewPublisher(repo), events.DefaultRelayConfig())
+	return repo, relay, rcv, subscription
+}
+
+func createUser(t *testing.T, repo repository.IRepository, email string) *domain.User {
+	user, err := repo.CreateUser(context.Background(), repository.CreateUserParams{
+		Name:           "Test",
+		Email:          email,
+		Role:           domain.StandardRole,
+		HashedPassword: "hash",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{"id":1}`)
+	header := http.Header{}
+	header.Set(TimestampHeader, "1700000000")
+	header.Set(SignatureHeader, Sign(testSecret, time.Unix(1700000000, 0), payload))
+
+	require.NoError(t, Verify(testSecret, header, payload, time.Unix(1700000010, 0), time.Minute))
+	require.ErrorIs(t, Verify(testSecret, header, payload, now, time.Minute), ErrStaleTimestamp)
+	require.ErrorIs(t, Verify("other", header, payload, time.Unix(1700000010, 0), time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(testSecret, header, []byte(`{"id":2}`), time.Unix(1700000010, 0), time.Minute), ErrInvalidSignature)
+
+	// The timestamp is signed too
+	header.Set(TimestampHeader, "1700000001")
+	require.ErrorIs(t, Verify(testSecret, header, payload, time.Unix(1700000010, 0), time.Minute), ErrInvalidSignature)
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := testContext()
+	repo, relay, rcv, subscription := setup(t, domain.UserEventCreated, domain.UserEventDeleted)
+	dispatcher := NewDispatcher(repo, testConfig())
+
+	user := createUser(t, repo, "a@example.com")
+	name := "Renamed"
+	_, err := repo.UpdateUser(ctx, user.ID, repository.UpdateUserParams{Name: &name})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUserByEmail(ctx, user.Email, 0))
+	_, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+
+	// Only the subscribed types are queued
+	attempted, err := dispatcher.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, attempted)
+	require.Empty(t, rcv.errs)
+	require.Len(t, rcv.events, 2)
+	types := map[string]bool{}
+	for _, event := range rcv.events {
+		require.Equal(t, user.ID, event.UserID)
+		types[event.Type] = true
+	}
+	require.Equal(t, map[string]bool{domain.UserEventCreated: true, domain.UserEventDeleted: true}, types)
+
+	deliveries, err := repo.ListWebhookDeliveries(ctx, repository.ListWebhookDeliveriesParams{SubscriptionID: subscription.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		require.Equal(t, domain.WebhookDeliverySucceeded, delivery.Status)
+		require.Equal(t, 1, delivery.Attempts)
+		attempts, err := repo.ListWebhookDeliveryAttempts(ctx, delivery.ID)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+		require.Equal(t, http.StatusOK, attempts[0].StatusCode)
+		require.Empty(t, attempts[0].Error)
+	}
+
+	// Succeeded deliveries aren't sent again
+	attempted, err = dispatcher.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Zero(t, attempted)
+}
+
+func TestDispatchRetriesAndReplay(t *testing.T) {
+	ctx := testContext()
+	repo, relay, rcv, subscription := setup(t, domain.UserEventCreated)
+	config := testConfig()
+	dispatcher := NewDispatcher(repo, config)
+
+	rcv.setStatus(http.StatusInternalServerError)
+	createUser(t, repo, "a@example.com")
+	_, err := relay.PublishPending(ctx)
+	require.NoError(t, err)
+
+	// Failed deliveries wait for their backoff, then are retried until they
+	// are dead
+	for i := 1; i <= config.MaxAttempts; i++ {
+		attempted, err := dispatcher.DispatchDue(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, attempted)
+		attempted, err = dispatcher.DispatchDue(ctx)
+		require.NoError(t, err)
+		require.Zero(t, attempted)
+		time.Sleep(10 * time.Millisecond)
+	}
+	attempted, err := dispatcher.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Zero(t, attempted)
+
+	deliveries, err := repo.ListWebhookDeliveries(ctx, repository.ListWebhookDeliveriesParams{Status: domain.WebhookDeliveryDead, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	require.Equal(t, subscription.ID, delivery.SubscriptionID)
+	require.Equal(t, config.MaxAttempts, delivery.Attempts)
+	require.Contains(t, delivery.LastError, "500")
+
+	attempts, err := repo.ListWebhookDeliveryAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, config.MaxAttempts)
+	for _, attempt := range attempts {
+		require.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+	}
+
+	// A replayed delivery is sent again with a fresh set of attempts
+	rcv.setStatus(http.StatusOK)
+	replayed, err := repo.ReplayWebhookDelivery(ctx, delivery.ID, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, domain.WebhookDeliveryPending, replayed.Status)
+	attempted, err = dispatcher.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, attempted)
+	require.Len(t, rcv.events, 1)
+	require.Empty(t, rcv.errs)
+
+	attempts, err = repo.ListWebhookDeliveryAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, config.MaxAttempts+1)
+	require.Equal(t, http.StatusOK, attempts[config.MaxAttempts].StatusCode)
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, Config{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		40: 10 * time.Second,
+	} {
+		require.Equal(t, want, dispatcher.backoff(attempts), "attempts %d", attempts)
+	}
+}
@@ -0,0 +1,211 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Config tunes the argon2id scheme
+type Config struct {
+	// Memory is the memory cost in KiB
+	Memory uint32
+	// Iterations is the number of passes over the memory
+	Iterations uint32
+	// Parallelism is the number of lanes, and threads used per hash
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+	// Pepper is a server-side secret mixed into every password before hashing.
+	// Unlike the salt it is not stored with the hash, so a leaked database
+	// alone is not enough to crack passwords.
+	Pepper string
+	// PepperID names the pepper in the hashes made with it, so a new pepper
+	// can be rolled out while hashes of the old one still verify
+	PepperID string
+	// OldPeppers are previous peppers by their ID. Hashes made with them verify
+	// and are flagged for rehash.
+	OldPeppers map[string]string
+}
+
+// DefaultConfig follows the OWASP recommendation for argon2id
+func DefaultConfig() Config {
+	return Config{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Argon2id is the argon2id scheme. Hashes are encoded in the PHC string format,
+// $argon2id$v=19$m=19456,t=2,p=1[,k=<pepper id>]$<salt>$<key>.
+type Argon2id struct {
+	config Config
+}
+
+// NewArgon2id returns the argon2id scheme. Zero parameters fall back to DefaultConfig.
+func NewArgon2id(config Config) *Argon2id {
+	defaults := DefaultConfig()
+	if config.Memory == 0 {
+		config.Memory = defaults.Memory
+	}
+	if config.Iterations == 0 {
+		config.Iterations = defaults.Iterations
+	}
+	if config.Parallelism == 0 {
+		config.Parallelism = defaults.Parallelism
+	}
+	if config.SaltLength == 0 {
+		config.SaltLength = defaults.SaltLength
+	}
+	if config.KeyLength == 0 {
+		config.KeyLength = defaults.KeyLength
+	}
+	if config.Pepper != "" && config.PepperID == "" {
+		config.PepperID = "1"
+	}
+	return &Argon2id{config: config}
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	pepperID    string
+	salt        []byte
+	key         []byte
+}
+
+func (a *Argon2id) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.config.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey(peppered(password, a.config.Pepper), salt, a.config.Iterations, a.config.Memory, a.config.Parallelism, a.config.KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", a.config.Memory, a.config.Iterations, a.config.Parallelism)
+	if a.config.Pepper != "" {
+		params += ",k=" + a.config.PepperID
+	}
+	return fmt.Sprintf("%sv=%d$%s$%s$%s", argon2idPrefix, argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Verify(password string, hash string) (bool, error) {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	pepper := ""
+	switch decoded.pepperID {
+	case "":
+	case a.config.PepperID:
+		pepper = a.config.Pepper
+	default:
+		old, ok := a.config.OldPeppers[decoded.pepperID]
+		if !ok {
+			return false, fmt.Errorf("unknown pepper %q", decoded.pepperID)
+		}
+		pepper = old
+	}
+
+	key := argon2.IDKey(peppered(password, pepper), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism, uint32(len(decoded.key)))
+	if subtle.ConstantTimeCompare(key, decoded.key) != 1 {
+		return false, ErrMismatchedPassword
+	}
+
+	needsRehash := decoded.memory != a.config.Memory ||
+		decoded.iterations != a.config.Iterations ||
+		decoded.parallelism != a.config.Parallelism ||
+		uint32(len(decoded.salt)) != a.config.SaltLength ||
+		uint32(len(decoded.key)) != a.config.KeyLength ||
+		decoded.pepperID != a.currentPepperID()
+	return needsRehash, nil
+}
+
+func (a *Argon2id) currentPepperID() string {
+	if a.config.Pepper == "" {
+		return ""
+	}
+	return a.config.PepperID
+}
+
+func decodeArgon2id(hash string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", params, salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	decoded := &argon2idHash{}
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "m", "t", "p":
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid argon2id parameter %q", param)
+			}
+			switch name {
+			case "m":
+				decoded.memory = uint32(n)
+			case "t":
+				decoded.iterations = uint32(n)
+			case "p":
+				if n > 255 {
+					return nil, fmt.Errorf("invalid argon2id parameter %q", param)
+				}
+				decoded.parallelism = uint8(n)
+			}
+		case "k":
+			decoded.pepperID = value
+		default:
+			return nil, fmt.Errorf("unknown argon2id parameter %q", param)
+		}
+	}
+	if decoded.memory == 0 || decoded.iterations == 0 || decoded.parallelism == 0 {
+		return nil, fmt.Errorf("missing argon2id parameters")
+	}
+
+	var err error
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(decoded.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id key")
+	}
+	return decoded, nil
+}
+
+// peppered mixes the pepper into the password with HMAC-SHA256, which also
+// keeps long passwords from being truncated by the hash input
+func peppered(password string, pepper string) []byte {
+	if pepper == "" {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,51 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt is the legacy scheme every password was hashed with before argon2id
+type Bcrypt struct {
+	// Cost defaults to bcrypt.DefaultCost
+	Cost int
+}
+
+func (b Bcrypt) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	cost := b.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(password string, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrMismatchedPassword
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, err
+	}
+	wantCost := b.Cost
+	if wantCost == 0 {
+		wantCost = bcrypt.DefaultCost
+	}
+	return cost != wantCost, nil
+}
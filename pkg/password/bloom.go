@@ -0,0 +1,131 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// BloomFilter is a compact set of breached passwords. It can report false
+// positives at the rate it was sized for, but never false negatives.
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+}
+
+// NewBloomFilter sizes a filter for n entries at the given false positive rate
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	size := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Max(1, math.Round(float64(size)/float64(n)*math.Ln2)))
+	return &BloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// Add inserts the SHA-1 digest of a password
+func (f *BloomFilter) Add(digest [sha1.Size]byte) {
+	h1, h2 := splitDigest(digest)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// AddPassword inserts a password
+func (f *BloomFilter) AddPassword(password string) {
+	f.Add(sha1.Sum([]byte(password)))
+}
+
+// ContainsPassword reports whether the password is probably in the filter
+func (f *BloomFilter) ContainsPassword(password string) bool {
+	h1, h2 := splitDigest(sha1.Sum([]byte(password)))
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDigest derives the two hashes of double hashing from a digest, which
+// is already uniformly distributed
+func splitDigest(digest [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1
+}
+
+// LoadBreachedList reads a breached password list with one entry per line
+// into a bloom filter. An entry is either a plain text password or, as in the
+// Have I Been Pwned downloads, an uppercase SHA-1 hex digest optionally
+// followed by ":<count>".
+func LoadBreachedList(path string, falsePositiveRate float64) (*BloomFilter, error) {
+	lines, err := countLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	filter := NewBloomFilter(lines, falsePositiveRate)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if digest, ok := parseSHA1Entry(line); ok {
+			filter.Add(digest)
+			continue
+		}
+		filter.AddPassword(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return filter, nil
+}
+
+func parseSHA1Entry(line string) ([sha1.Size]byte, bool) {
+	var digest [sha1.Size]byte
+	hexDigest, _, _ := strings.Cut(line, ":")
+	if len(hexDigest) != 2*sha1.Size || strings.ToUpper(hexDigest) != hexDigest {
+		return digest, false
+	}
+	if _, err := hex.Decode(digest[:], []byte(hexDigest)); err != nil {
+		return digest, false
+	}
+	return digest, true
+}
+
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,219 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonWords are frequent password words, most common first. A word's rank
+// stands in for how early an attacker's dictionary tries it.
+var commonWords = []string{
+	"password", "qwerty", "dragon", "letmein", "monkey", "football", "iloveyou", "admin",
+	"welcome", "login", "master", "sunshine", "princess", "shadow", "superman", "baseball",
+	"trustno", "hello", "freedom", "whatever", "starwars", "secret", "summer", "winter",
+	"spring", "autumn", "love", "money", "computer", "internet", "michael", "jennifer",
+	"jordan", "hunter", "ranger", "buster", "soccer", "hockey", "batman", "thomas",
+	"charlie", "andrew", "matrix", "pepper", "cheese", "cookie", "chocolate", "flower",
+	"orange", "banana", "apple", "tiger", "lion", "bear", "eagle", "killer",
+	"pass", "test", "user", "guest", "root", "changeme", "default", "access",
+	"family", "friend", "house", "world", "dream", "happy", "lucky", "magic",
+	"angel", "devil", "heaven", "life", "baby", "sweet", "honey", "star",
+	"moon", "blue", "green", "black", "white", "purple", "silver", "golden",
+	"diamond", "forever", "always", "never", "secure", "private", "company", "office",
+	"london", "paris", "berlin", "monday", "friday", "january", "december", "sternx",
+}
+
+var commonWordRanks = func() map[string]int {
+	ranks := make(map[string]int, len(commonWords))
+	for i, word := range commonWords {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+// keyboardRows are walked by keyboard patterns such as "qwerty" and "asdf"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't',
+}
+
+const (
+	minPatternLength = 3
+	minWordLength    = 4
+)
+
+// EstimateEntropy returns a zxcvbn-style estimate of the bits of guessing
+// entropy of a password. It splits the password into the cheapest sequence of
+// patterns an attacker would try: common words, with capitals and leet
+// substitutions, repeated characters, alphabetic or numeric sequences,
+// keyboard walks and years, and charges brute force for everything else.
+func EstimateEntropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+	bruteForceBits := math.Log2(float64(cardinality(runes)))
+
+	lower := []rune(strings.ToLower(password))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+	unleet := make([]rune, len(lower))
+	for i, r := range lower {
+		if plain, ok := leetSubstitutions[r]; ok {
+			unleet[i] = plain
+		} else {
+			unleet[i] = r
+		}
+	}
+
+	// bits[i] is the cheapest estimate for the first i runes
+	bits := make([]float64, len(runes)+1)
+	for i := range bits {
+		bits[i] = math.Inf(1)
+	}
+	bits[0] = 0
+	relax := func(end int, cost float64) {
+		if cost < bits[end] {
+			bits[end] = cost
+		}
+	}
+
+	for i := range runes {
+		relax(i+1, bits[i]+bruteForceBits)
+
+		for end := i + minWordLength; end <= len(runes); end++ {
+			rank, ok := commonWordRanks[string(unleet[i:end])]
+			if !ok {
+				continue
+			}
+			cost := math.Log2(float64(rank + 1))
+			if string(lower[i:end]) != string(unleet[i:end]) {
+				cost++ // leet substitutions
+			}
+			if string(runes[i:end]) != string(lower[i:end]) {
+				cost++ // capitals
+			}
+			relax(end, bits[i]+cost)
+		}
+
+		if n := repeatLength(lower, i); n >= minPatternLength {
+			relax(i+n, bits[i]+bruteForceBits+math.Log2(float64(n)))
+		}
+		if n := sequenceLength(lower, i); n >= minPatternLength {
+			relax(i+n, bits[i]+math.Log2(26)+math.Log2(float64(n))+1)
+		}
+		if n := keyboardWalkLength(lower, i); n >= minPatternLength {
+			relax(i+n, bits[i]+math.Log2(float64(len(strings.Join(keyboardRows, ""))))+math.Log2(float64(n))+1)
+		}
+		if isYear(runes, i) {
+			relax(i+4, bits[i]+math.Log2(130))
+		}
+	}
+	return bits[len(runes)]
+}
+
+// cardinality is the size of the character space a brute force attack on the
+// password has to cover
+func cardinality(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
+
+func repeatLength(runes []rune, start int) int {
+	n := 1
+	for start+n < len(runes) && runes[start+n] == runes[start] {
+		n++
+	}
+	return n
+}
+
+// sequenceLength measures runs like "abcd", "4321" or "aceg" with a constant step of at most 2
+func sequenceLength(runes []rune, start int) int {
+	if start+1 >= len(runes) {
+		return 1
+	}
+	step := runes[start+1] - runes[start]
+	if step == 0 || step > 2 || step < -2 {
+		return 1
+	}
+	n := 2
+	for start+n < len(runes) && runes[start+n]-runes[start+n-1] == step {
+		n++
+	}
+	return n
+}
+
+func keyboardWalkLength(runes []rune, start int) int {
+	best := 1
+	for _, row := range keyboardRows {
+		for _, walk := range []string{row, reverse(row)} {
+			idx := strings.IndexRune(walk, runes[start])
+			if idx < 0 {
+				continue
+			}
+			n := 1
+			for start+n < len(runes) && idx+n < len(walk) && rune(walk[idx+n]) == runes[start+n] {
+				n++
+			}
+			if n > best {
+				best = n
+			}
+		}
+	}
+	return best
+}
+
+func isYear(runes []rune, start int) bool {
+	if start+4 > len(runes) {
+		return false
+	}
+	year := 0
+	for _, r := range runes[start : start+4] {
+		if r < '0' || r > '9' {
+			return false
+		}
+		year = year*10 + int(r-'0')
+	}
+	return year >= 1900 && year < 2030
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
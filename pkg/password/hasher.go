@@ -0,0 +1,66 @@
+// Package password hashes user passwords into self describing strings, so
+// the algorithm and its cost can change without invalidating stored hashes,
+// and checks new passwords against a configurable policy.
+package password
+
+import (
+	"errors"
+)
+
+// ErrMismatchedPassword is returned by Verify when the password doesn't match the hash
+var ErrMismatchedPassword = errors.New("password does not match")
+
+// ErrUnknownHash is returned by Verify for hashes no configured scheme produced
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher hashes and verifies passwords
+type Hasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify checks the password against an encoded hash. needsRehash reports
+	// that the hash was made by an outdated scheme or with outdated parameters
+	// and should be replaced by a fresh Hash of the password.
+	Verify(password string, hash string) (needsRehash bool, err error)
+}
+
+// Scheme is a single hashing algorithm
+type Scheme interface {
+	Hasher
+	// Identifies reports whether the encoded hash was produced by this scheme
+	Identifies(hash string) bool
+}
+
+type versionedHasher struct {
+	current Scheme
+	legacy  []Scheme
+}
+
+// NewHasher returns a hasher that hashes new passwords with the current scheme
+// and still verifies hashes of the legacy schemes, flagging them for rehash.
+func NewHasher(current Scheme, legacy ...Scheme) Hasher {
+	return &versionedHasher{current: current, legacy: legacy}
+}
+
+// NewDefaultHasher hashes with argon2id and verifies legacy bcrypt hashes
+func NewDefaultHasher(config Config) Hasher {
+	return NewHasher(NewArgon2id(config), Bcrypt{})
+}
+
+func (h *versionedHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *versionedHasher) Verify(password string, hash string) (bool, error) {
+	if h.current.Identifies(hash) {
+		return h.current.Verify(password, hash)
+	}
+	for _, scheme := range h.legacy {
+		if scheme.Identifies(hash) {
+			if _, err := scheme.Verify(password, hash); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, ErrUnknownHash
+}
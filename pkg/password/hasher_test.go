@@ -0,0 +1,150 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fibonachyy/sternx/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig keeps the tests fast, the benchmarks cover realistic costs
+func testConfig() Config {
+	return Config{Memory: 64, Iterations: 1, Parallelism: 1}
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := NewHasher(NewArgon2id(testConfig()))
+	password := utils.RandomString(12)
+
+	hash1, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash1, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	needsRehash, err := hasher.Verify(password, hash1)
+	require.NoError(t, err)
+	require.False(t, needsRehash)
+
+	_, err = hasher.Verify(utils.RandomString(12), hash1)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	hash2, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.NotEqual(t, hash1, hash2)
+}
+
+func TestArgon2idRehashOnParameterChange(t *testing.T) {
+	password := utils.RandomString(12)
+	hash, err := NewArgon2id(testConfig()).Hash(password)
+	require.NoError(t, err)
+
+	stronger := testConfig()
+	stronger.Iterations = 2
+	needsRehash, err := NewHasher(NewArgon2id(stronger)).Verify(password, hash)
+	require.NoError(t, err)
+	require.True(t, needsRehash)
+}
+
+func TestArgon2idPepper(t *testing.T) {
+	password := utils.RandomString(12)
+
+	config := testConfig()
+	config.Pepper = "pepper-1"
+	config.PepperID = "1"
+	hash, err := NewArgon2id(config).Hash(password)
+	require.NoError(t, err)
+	require.Contains(t, hash, ",k=1$")
+
+	needsRehash, err := NewArgon2id(config).Verify(password, hash)
+	require.NoError(t, err)
+	require.False(t, needsRehash)
+
+	wrongPepper := config
+	wrongPepper.Pepper = "pepper-other"
+	_, err = NewArgon2id(wrongPepper).Verify(password, hash)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	rotated := config
+	rotated.Pepper = "pepper-2"
+	rotated.PepperID = "2"
+	_, err = NewArgon2id(rotated).Verify(password, hash)
+	require.Error(t, err)
+
+	rotated.OldPeppers = map[string]string{"1": "pepper-1"}
+	needsRehash, err = NewArgon2id(rotated).Verify(password, hash)
+	require.NoError(t, err)
+	require.True(t, needsRehash)
+
+	// Hashes from before the pepper was introduced still verify
+	unpeppered, err := NewArgon2id(testConfig()).Hash(password)
+	require.NoError(t, err)
+	needsRehash, err = NewArgon2id(config).Verify(password, unpeppered)
+	require.NoError(t, err)
+	require.True(t, needsRehash)
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	password := utils.RandomString(12)
+	legacy, err := utils.HashPassword(password)
+	require.NoError(t, err)
+
+	hasher := NewHasher(NewArgon2id(testConfig()), Bcrypt{})
+
+	needsRehash, err := hasher.Verify(password, legacy)
+	require.NoError(t, err)
+	require.True(t, needsRehash)
+
+	_, err = hasher.Verify(utils.RandomString(12), legacy)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	_, err = NewHasher(NewArgon2id(testConfig())).Verify(password, legacy)
+	require.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestDecodeArgon2idRejectsMalformedHashes(t *testing.T) {
+	hasher := NewArgon2id(testConfig())
+	for _, hash := range []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1,x=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+	} {
+		_, err := hasher.Verify("password", hash)
+		require.Error(t, err, hash)
+	}
+}
+
+func BenchmarkArgon2id(b *testing.B) {
+	for _, config := range []Config{
+		DefaultConfig(),
+		{Memory: 46 * 1024, Iterations: 1, Parallelism: 1},
+		{Memory: 64 * 1024, Iterations: 1, Parallelism: 4},
+		{Memory: 64 * 1024, Iterations: 3, Parallelism: 4},
+	} {
+		hasher := NewArgon2id(config)
+		name := fmt.Sprintf("m=%d,t=%d,p=%d", config.Memory, config.Iterations, config.Parallelism)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := hasher.Hash("correct horse battery staple"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBcrypt(b *testing.B) {
+	for _, cost := range []int{10, 12} {
+		hasher := Bcrypt{Cost: cost}
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := hasher.Hash("correct horse battery staple"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
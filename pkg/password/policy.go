@@ -0,0 +1,109 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minPersonalInfoLength is the shortest name part or email local part the
+// policy looks for in passwords, shorter ones would ban too much
+const minPersonalInfoLength = 3
+
+// Policy decides which passwords users may choose. It applies when a password
+// is set, not when one is checked at login.
+type Policy struct {
+	MinLength        int
+	MaxLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// MinEntropyBits is the minimum of EstimateEntropy, zero disables the check
+	MinEntropyBits float64
+	// ForbidPersonalInfo rejects passwords containing the name or email of the user
+	ForbidPersonalInfo bool
+	// Breached rejects passwords of known data breaches when set
+	Breached *BloomFilter
+}
+
+// DefaultPolicy only bounds the length, as passwords always were
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength: 6,
+		MaxLength: 100,
+	}
+}
+
+// Check returns every rule of the policy the password breaks, one error per
+// rule. name and email belong to the user the password is for.
+func (p Policy) Check(password string, name string, email string) []error {
+	var violations []error
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Errorf("must contain at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Errorf("must contain at most %d characters", p.MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, fmt.Errorf("must contain a lowercase letter"))
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, fmt.Errorf("must contain an uppercase letter"))
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, fmt.Errorf("must contain a digit"))
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, fmt.Errorf("must contain a symbol"))
+	}
+
+	if p.ForbidPersonalInfo && containsPersonalInfo(password, name, email) {
+		violations = append(violations, fmt.Errorf("must not contain your name or email"))
+	}
+	if p.MinEntropyBits > 0 && EstimateEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, fmt.Errorf("is too easy to guess, avoid common words, sequences and keyboard patterns"))
+	}
+	if p.Breached != nil && p.Breached.ContainsPassword(password) {
+		violations = append(violations, fmt.Errorf("appeared in a data breach, choose another one"))
+	}
+	return violations
+}
+
+func containsPersonalInfo(password string, name string, email string) bool {
+	password = strings.ToLower(password)
+
+	var parts []string
+	parts = append(parts, strings.Fields(strings.ToLower(name))...)
+	if email != "" {
+		local, _, _ := strings.Cut(strings.ToLower(email), "@")
+		parts = append(parts, strings.ToLower(email), local)
+		parts = append(parts, strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
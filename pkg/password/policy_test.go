@@ -0,0 +1,99 @@
+package password
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{
+		MinLength:          10,
+		MaxLength:          64,
+		RequireLowercase:   true,
+		RequireUppercase:   true,
+		RequireDigit:       true,
+		RequireSymbol:      true,
+		MinEntropyBits:     40,
+		ForbidPersonalInfo: true,
+	}
+
+	require.Empty(t, policy.Check("x7#Kq9!vLm-Tz", "Jane Doe", "jane.doe@example.com"))
+
+	violations := policy.Check("abc", "Jane Doe", "jane.doe@example.com")
+	require.Len(t, violations, 5)
+	require.EqualError(t, violations[0], "must contain at least 10 characters")
+
+	violations = policy.Check("Doe#2024!secure", "Jane Doe", "jane.doe@example.com")
+	require.Len(t, violations, 1)
+	require.EqualError(t, violations[0], "must not contain your name or email")
+
+	violations = policy.Check("P@ssw0rd1234", "Jane Doe", "jane.doe@example.com")
+	require.Len(t, violations, 1)
+	require.Contains(t, violations[0].Error(), "too easy to guess")
+
+	violations = policy.Check(strings.Repeat("aA1!", 20), "", "")
+	require.EqualError(t, violations[0], "must contain at most 64 characters")
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	require.Empty(t, DefaultPolicy().Check("secret", "Jane Doe", "jane@example.com"))
+	require.Len(t, DefaultPolicy().Check("short", "", ""), 1)
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	for _, weak := range []string{"password", "P@ssw0rd", "qwerty123", "aaaaaaaaaa", "abcdef123", "summer2023"} {
+		require.Less(t, EstimateEntropy(weak), 20.0, weak)
+	}
+	for _, strong := range []string{"Tr0ub4dor&3", "x7#Kq9!vLm", "correct horse battery staple"} {
+		require.Greater(t, EstimateEntropy(strong), 50.0, strong)
+	}
+	require.Zero(t, EstimateEntropy(""))
+}
+
+func TestBreachedList(t *testing.T) {
+	digest := sha1.Sum([]byte("hunter2"))
+	list := strings.Join([]string{
+		"123456",
+		"letmein",
+		fmt.Sprintf("%X:4242", digest),
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+
+	filter, err := LoadBreachedList(path, 0.001)
+	require.NoError(t, err)
+	require.True(t, filter.ContainsPassword("123456"))
+	require.True(t, filter.ContainsPassword("letmein"))
+	require.True(t, filter.ContainsPassword("hunter2"))
+	require.False(t, filter.ContainsPassword("x7#Kq9!vLm-Tz"))
+
+	policy := DefaultPolicy()
+	policy.Breached = filter
+	violations := policy.Check("letmein", "", "")
+	require.Len(t, violations, 1)
+	require.EqualError(t, violations[0], "appeared in a data breach, choose another one")
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	filter := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.AddPassword(fmt.Sprintf("breached-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		require.True(t, filter.ContainsPassword(fmt.Sprintf("breached-%d", i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.ContainsPassword(fmt.Sprintf("fresh-%d", i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 200)
+}
@@ -0,0 +1,117 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const idTokenKeySize = 2048
+
+// IDTokenClaims are the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Valid checks if the ID token has expired
+func (claims IDTokenClaims) Valid() error {
+	if time.Now().Unix() > claims.ExpiresAt {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// JSONWebKey is the public part of a signing key, see RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// JSONWebKeySet is served on the jwks_uri of the OpenID provider
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// IDTokenSigner signs OpenID Connect ID tokens with an RSA key (RS256).
+// ID tokens are verified by relying parties, so unlike access tokens they
+// cannot use the symmetric key of the Maker.
+type IDTokenSigner struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewIDTokenSigner loads a PEM encoded RSA private key from keyPath. When
+// keyPath is empty an ephemeral key is generated, which is only suitable for
+// development since tokens signed by it do not survive a restart.
+func NewIDTokenSigner(keyPath string) (*IDTokenSigner, error) {
+	var key *rsa.PrivateKey
+	if keyPath == "" {
+		generated, err := rsa.GenerateKey(rand.Reader, idTokenKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate id token signing key: %w", err)
+		}
+		key = generated
+	} else {
+		pemBytes, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read id token signing key: %w", err)
+		}
+		key, err = jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse id token signing key: %w", err)
+		}
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode id token public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+
+	return &IDTokenSigner{
+		key:   key,
+		keyID: base64.RawURLEncoding.EncodeToString(sum[:8]),
+	}, nil
+}
+
+// Sign returns the signed compact serialization of the ID token
+func (signer *IDTokenSigner) Sign(claims IDTokenClaims) (string, error) {
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = signer.keyID
+	return idToken.SignedString(signer.key)
+}
+
+// JWKS returns the key set relying parties use to verify ID tokens
+func (signer *IDTokenSigner) JWKS() JSONWebKeySet {
+	publicKey := signer.key.PublicKey
+	return JSONWebKeySet{
+		Keys: []JSONWebKey{{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodRS256.Alg(),
+			KeyID:     signer.keyID,
+			Modulus:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	}
+}
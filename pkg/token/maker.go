@@ -7,7 +7,7 @@ import (
 // Maker is an interface for managing tokens
 type Maker interface {
 	// CreateToken creates a new token for a specific email and duration
-	CreateToken(email string, role string, duration time.Duration) (string, *Payload, error)
+	CreateToken(email string, role string, duration time.Duration, opts ...PayloadOption) (string, *Payload, error)
 
 	// VerifyToken checks if the token is valid or not
 	VerifyToken(token string) (*Payload, error)
@@ -29,8 +29,8 @@ func NewPasetoMaker(symmetricKey string) (Maker, error) {
 }
 
 // CreateToken creates a new token for a specific email and duration
-func (maker *PasetoMaker) CreateToken(email string, role string, duration time.Duration) (string, *Payload, error) {
-	payload, err := NewPayload(email, role, duration)
+func (maker *PasetoMaker) CreateToken(email string, role string, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(email, role, duration, opts...)
 	if err != nil {
 		return "", payload, err
 	}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,14 +17,71 @@ var (
 // Payload contains the payload data of the token
 type Payload struct {
 	ID        uuid.UUID `json:"id"`
+	Subject   string    `json:"sub"`
 	Email     string    `json:"email"`
 	Role      string    `json:"role"`
+	Scopes    []string  `json:"scopes,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
+	// AuthTime is when the user last proved their credentials. It is zero for
+	// tokens that were not issued right after a credential check, like those of
+	// API keys and OAuth2 clients.
+	AuthTime time.Time `json:"auth_time"`
+	// SessionID is set on tokens of interactive logins. Revoking the session
+	// invalidates the token before it expires.
+	SessionID string `json:"sid,omitempty"`
+	// Actor is set on tokens issued through token exchange and identifies who
+	// acts as the subject, see RFC 8693 section 4.1
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor is the party that acts on behalf of the subject of a token
+type Actor struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+}
+
+// PayloadOption customizes a payload created by NewPayload
+type PayloadOption func(*Payload)
+
+// WithSubject sets the subject of the token. It defaults to the email of the user.
+func WithSubject(subject string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Subject = subject
+	}
+}
+
+// WithScopes restricts the token to the given scopes
+func WithScopes(scopes ...string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Scopes = scopes
+	}
+}
+
+// WithAuthTime records when the user last proved their credentials
+func WithAuthTime(authTime time.Time) PayloadOption {
+	return func(payload *Payload) {
+		payload.AuthTime = authTime
+	}
+}
+
+// WithSessionID binds the token to a login session
+func WithSessionID(sessionID string) PayloadOption {
+	return func(payload *Payload) {
+		payload.SessionID = sessionID
+	}
+}
+
+// WithActor marks the token as issued to the actor on behalf of the subject
+func WithActor(actor Actor) PayloadOption {
+	return func(payload *Payload) {
+		payload.Actor = &actor
+	}
 }
 
 // NewPayload creates a new token payload with a specific email and duration
-func NewPayload(email string, role string, duration time.Duration) (*Payload, error) {
+func NewPayload(email string, role string, duration time.Duration, opts ...PayloadOption) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -31,11 +89,15 @@ func NewPayload(email string, role string, duration time.Duration) (*Payload, er
 
 	payload := &Payload{
 		ID:        tokenID,
+		Subject:   email,
 		Email:     email,
 		Role:      role,
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(duration),
 	}
+	for _, opt := range opts {
+		opt(payload)
+	}
 	return payload, nil
 }
 
@@ -46,3 +108,32 @@ func (payload *Payload) Valid() error {
 	}
 	return nil
 }
+
+// IsScoped reports whether the token is restricted to a set of scopes.
+// Tokens issued by LoginUser carry no scopes and are not restricted.
+func (payload *Payload) IsScoped() bool {
+	return len(payload.Scopes) > 0
+}
+
+// IsImpersonated reports whether someone else acts as the subject of the token
+func (payload *Payload) IsImpersonated() bool {
+	return payload.Actor != nil
+}
+
+// AuthAge returns how long ago the user last proved their credentials
+func (payload *Payload) AuthAge() time.Duration {
+	if payload.AuthTime.IsZero() {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Since(payload.AuthTime)
+}
+
+// HasScope checks if the token grants the given scope
+func (payload *Payload) HasScope(scope string) bool {
+	for _, s := range payload.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,8 @@ import (
 )
 
 // HashPassword returns the bcrypt hash of the password
+//
+// Deprecated: new hashes are made by password.Hasher, which still verifies bcrypt hashes.
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -16,6 +18,8 @@ func HashPassword(password string) (string, error) {
 }
 
 // CheckPassword checks if the provided password is correct or not
+//
+// Deprecated: use password.Hasher, which also verifies argon2id hashes.
 func CheckPassword(password string, hashedPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// RandomSecret returns a URL-safe string built from n bytes of crypto/rand output
+func RandomSecret(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashSecret returns the hex encoded SHA-256 digest of a high-entropy secret.
+// It must not be used for user chosen passwords, see HashPassword for those.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSecret compares a secret with its hash in constant time
+func CheckSecret(secret string, hashedSecret string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hashedSecret)) == 1
+}